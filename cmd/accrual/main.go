@@ -0,0 +1,11 @@
+package main
+
+import (
+	"github.com/ry461ch/loyalty_system/internal/accrual/app"
+	"github.com/ry461ch/loyalty_system/internal/accrual/config"
+)
+
+func main() {
+	server := accrualserver.NewServer(accrualconfig.New())
+	server.Run()
+}
@@ -1,11 +1,22 @@
 package main
 
 import (
+	"log"
+
 	"github.com/ry461ch/loyalty_system/internal/app"
 	"github.com/ry461ch/loyalty_system/internal/config"
 )
 
 func main() {
-	server := server.NewServer(config.New())
+	cfg := config.New()
+	if len(cfg.Args) > 0 && cfg.Args[0] == "migrate" {
+		err := server.Migrate(cfg, cfg.Args[1:])
+		if err != nil {
+			log.Fatalf("Migrate: %s", err)
+		}
+		return
+	}
+
+	server := server.NewServer(cfg)
 	server.Run()
 }
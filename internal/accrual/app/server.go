@@ -0,0 +1,95 @@
+package accrualserver
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"sync"
+
+	"github.com/ry461ch/loyalty_system/internal/accrual/config"
+	"github.com/ry461ch/loyalty_system/internal/accrual/crontasks/calculator"
+	"github.com/ry461ch/loyalty_system/internal/accrual/handlers/goods"
+	"github.com/ry461ch/loyalty_system/internal/accrual/handlers/orders"
+	"github.com/ry461ch/loyalty_system/internal/accrual/router"
+	"github.com/ry461ch/loyalty_system/internal/accrual/services/accrual"
+	"github.com/ry461ch/loyalty_system/internal/accrual/storage/memory/orders"
+	"github.com/ry461ch/loyalty_system/internal/accrual/storage/memory/rewards"
+	"github.com/ry461ch/loyalty_system/pkg/logging"
+	"github.com/ry461ch/loyalty_system/pkg/middlewares/throttle"
+)
+
+type Server struct {
+	cfg               *accrualconfig.Config
+	accrualCalculator *accrualcalculator.AccrualCalculator
+	server            *http.Server
+}
+
+func NewServer(cfg *accrualconfig.Config) *Server {
+	logging.Initialize(cfg.LogLevel)
+
+	accrualService := accrualservice.NewAccrualService(
+		rewardmemstorage.NewRewardMemStorage(),
+		accrualordermemstorage.NewOrderMemStorage(),
+	)
+	router := accrualrouter.NewRouter(
+		goodshandlers.NewGoodsHandlers(accrualService),
+		accrualorderhandlers.NewOrderHandlers(accrualService),
+		throttle.New(cfg.RateLimit),
+	)
+	accrualCalculator := accrualcalculator.NewAccrualCalculator(accrualService, cfg)
+
+	server := &http.Server{Addr: cfg.Addr.Host + ":" + strconv.FormatInt(cfg.Addr.Port, 10), Handler: router}
+
+	return &Server{
+		cfg:               cfg,
+		accrualCalculator: accrualCalculator,
+		server:            server,
+	}
+}
+
+func (s *Server) Run() {
+	var wg sync.WaitGroup
+	wg.Add(3)
+
+	// run server
+	go func() {
+		logging.Logger.Info("Accrual: server is running: ", s.cfg.Addr.String())
+		err := s.server.ListenAndServe()
+		if err != nil {
+			logging.Logger.Errorf("Accrual: something went wrong while serving: %v", err)
+		}
+		logging.Logger.Infof("Accrual: server stopped")
+		wg.Done()
+	}()
+
+	// run crontasks
+	calculatorCtx, calculatorCtxCancel := context.WithCancel(context.Background())
+	go func() {
+		logging.Logger.Infof("Accrual: calculator started")
+		err := s.accrualCalculator.Run(calculatorCtx)
+		if err != nil {
+			logging.Logger.Errorf("Accrual: something went wrong while running calculator: %v", err)
+		}
+		logging.Logger.Infof("Accrual: calculator stopped")
+		wg.Done()
+	}()
+
+	// wait for interrupting signal
+	go func() {
+		stop := make(chan os.Signal, 1)
+		signal.Notify(stop, os.Interrupt)
+		<-stop
+		logging.Logger.Infof("Accrual: got interrupt signal")
+		err := s.server.Shutdown(context.Background())
+		if err != nil {
+			logging.Logger.Errorf("Accrual: something went wrong while shutting down server: %v", err)
+		}
+		calculatorCtxCancel()
+		wg.Done()
+	}()
+
+	wg.Wait()
+	logging.Logger.Infof("Accrual: done")
+}
@@ -0,0 +1,46 @@
+package accrualconfig
+
+import (
+	"flag"
+	"log"
+	"time"
+
+	"github.com/caarlos0/env/v11"
+
+	"github.com/ry461ch/loyalty_system/internal/models/netaddr"
+)
+
+type Config struct {
+	Addr                  netaddr.NetAddress `env:"RUN_ADDRESS"`
+	LogLevel              string             `env:"LOG_LEVEL"`
+	RateLimit             int                `env:"RATE_LIMIT"`
+	CalculatorPeriod      time.Duration      `env:"CALCULATOR_PERIOD"`
+	CalculatorOrdersLimit int                `env:"CALCULATOR_ORDERS_LIMIT"`
+}
+
+func New() *Config {
+	addr := netaddr.NetAddress{Host: "localhost", Port: 8081}
+	cfg := &Config{
+		LogLevel: "INFO",
+		Addr:     addr,
+	}
+	parseArgs(cfg)
+	parseEnv(cfg)
+	return cfg
+}
+
+func parseArgs(cfg *Config) {
+	flag.Var(&cfg.Addr, "a", "Net address host:port")
+	flag.StringVar(&cfg.LogLevel, "log-level", "INFO", "Log level")
+	flag.IntVar(&cfg.RateLimit, "rate-limit", 0, "max num of order requests per minute, 0 means unlimited")
+	flag.DurationVar(&cfg.CalculatorPeriod, "calculator-period", time.Second, "period of running accrual calculator")
+	flag.IntVar(&cfg.CalculatorOrdersLimit, "calculator-orders-limit", 100, "num of orders in one iteration of accrual calculator")
+	flag.Parse()
+}
+
+func parseEnv(cfg *Config) {
+	err := env.Parse(cfg)
+	if err != nil {
+		log.Fatalf("Can't parse env variables: %s", err)
+	}
+}
@@ -0,0 +1,63 @@
+package accrualcalculator
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/ry461ch/loyalty_system/internal/accrual/config"
+	"github.com/ry461ch/loyalty_system/pkg/logging"
+)
+
+type AccrualCalculator struct {
+	accrualService  AccrualService
+	ordersLimit     int
+	iterationPeriod time.Duration
+}
+
+func NewAccrualCalculator(accrualService AccrualService, cfg *accrualconfig.Config) *AccrualCalculator {
+	return &AccrualCalculator{
+		accrualService:  accrualService,
+		ordersLimit:     cfg.CalculatorOrdersLimit,
+		iterationPeriod: cfg.CalculatorPeriod,
+	}
+}
+
+func (ac *AccrualCalculator) runIteration(ctx context.Context) {
+	for {
+		registeredOrders, err := ac.accrualService.PopRegisteredOrders(ctx, ac.ordersLimit)
+		if err != nil {
+			logging.Logger.Errorf("Accrual Calculator: exceptions occured while getting registered orders: %v", err)
+			return
+		}
+
+		failed := false
+		for _, registeredOrder := range registeredOrders {
+			err = ac.accrualService.CalculateOrder(ctx, &registeredOrder)
+			if err != nil {
+				logging.Logger.Warnf("Accrual Calculator: exceptions occured for orderID: %s: %v", registeredOrder.ID, err)
+				failed = true
+			}
+		}
+
+		// failed orders are requeued, retry them on the next tick instead of popping them again right away
+		if failed || len(registeredOrders) < ac.ordersLimit {
+			return
+		}
+	}
+}
+
+func (ac *AccrualCalculator) Run(ctx context.Context) error {
+	logging.Logger.Infof("Accrual Calculator: started")
+	ticker := time.NewTicker(ac.iterationPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return errors.New("accrual calculator: graceful shutdown")
+		case <-ticker.C:
+			ac.runIteration(ctx)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package accrualcalculator
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ry461ch/loyalty_system/internal/accrual/config"
+	"github.com/ry461ch/loyalty_system/internal/accrual/models/order"
+	"github.com/ry461ch/loyalty_system/internal/accrual/models/reward"
+	"github.com/ry461ch/loyalty_system/internal/accrual/services/accrual"
+	"github.com/ry461ch/loyalty_system/internal/accrual/storage/memory/orders"
+	"github.com/ry461ch/loyalty_system/internal/accrual/storage/memory/rewards"
+	"github.com/ry461ch/loyalty_system/pkg/logging"
+)
+
+func TestCalculator(t *testing.T) {
+	logging.Initialize("INFO")
+	accrualService := accrualservice.NewAccrualService(rewardmemstorage.NewRewardMemStorage(), accrualordermemstorage.NewOrderMemStorage())
+	accrualService.RegisterReward(context.TODO(), &reward.Reward{Match: "Bork", Reward: 10, RewardType: reward.PERCENT})
+
+	expectedStatuses := map[string]accrualorder.Status{
+		"1115": accrualorder.PROCESSED,
+		"1321": accrualorder.PROCESSED,
+		"1214": accrualorder.PROCESSED,
+		"1322": accrualorder.INVALID,
+	}
+	for orderID := range expectedStatuses {
+		accrualService.RegisterOrder(context.TODO(), &accrualorder.InputOrder{
+			ID:    orderID,
+			Goods: []accrualorder.Good{{Description: "Чайник Bork", Price: 7000}},
+		})
+	}
+
+	cfg := accrualconfig.Config{CalculatorOrdersLimit: 2}
+	calculator := NewAccrualCalculator(accrualService, &cfg)
+	calculator.runIteration(context.TODO())
+
+	for orderID, expectedStatus := range expectedStatuses {
+		calculatedOrder, _ := accrualService.GetOrder(context.TODO(), orderID)
+		assert.Equal(t, expectedStatus, calculatedOrder.Status, "statuses not equal")
+	}
+}
@@ -0,0 +1,12 @@
+package accrualcalculator
+
+import (
+	"context"
+
+	"github.com/ry461ch/loyalty_system/internal/accrual/models/order"
+)
+
+type AccrualService interface {
+	PopRegisteredOrders(ctx context.Context, limit int) ([]accrualorder.Order, error)
+	CalculateOrder(ctx context.Context, inputOrder *accrualorder.Order) error
+}
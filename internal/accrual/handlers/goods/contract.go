@@ -0,0 +1,11 @@
+package goodshandlers
+
+import (
+	"context"
+
+	"github.com/ry461ch/loyalty_system/internal/accrual/models/reward"
+)
+
+type AccrualService interface {
+	RegisterReward(ctx context.Context, inputReward *reward.Reward) error
+}
@@ -0,0 +1,51 @@
+package goodshandlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/ry461ch/loyalty_system/internal/accrual/models/exceptions"
+	"github.com/ry461ch/loyalty_system/internal/accrual/models/reward"
+	"github.com/ry461ch/loyalty_system/pkg/logging"
+)
+
+type GoodsHandlers struct {
+	accrualService AccrualService
+}
+
+func NewGoodsHandlers(accrualService AccrualService) *GoodsHandlers {
+	return &GoodsHandlers{
+		accrualService: accrualService,
+	}
+}
+
+func (gh *GoodsHandlers) PostReward(res http.ResponseWriter, req *http.Request) {
+	reqBody, err := io.ReadAll(req.Body)
+	if err != nil {
+		res.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	var inputReward reward.Reward
+	err = json.Unmarshal(reqBody, &inputReward)
+	if err != nil {
+		res.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	err = gh.accrualService.RegisterReward(req.Context(), &inputReward)
+	if err == nil {
+		res.WriteHeader(http.StatusOK)
+		return
+	}
+
+	switch {
+	case errors.Is(err, exceptions.ErrRewardConflict):
+		res.WriteHeader(http.StatusConflict)
+	default:
+		logging.Logger.Errorf("New reward: internal error: %v", err)
+		res.WriteHeader(http.StatusInternalServerError)
+	}
+}
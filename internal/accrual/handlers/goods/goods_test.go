@@ -0,0 +1,69 @@
+package goodshandlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-resty/resty/v2"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ry461ch/loyalty_system/internal/accrual/services/accrual"
+	"github.com/ry461ch/loyalty_system/internal/accrual/storage/memory/orders"
+	"github.com/ry461ch/loyalty_system/internal/accrual/storage/memory/rewards"
+	"github.com/ry461ch/loyalty_system/pkg/logging"
+)
+
+func mockRouter(goodsHandlers *GoodsHandlers) chi.Router {
+	router := chi.NewRouter()
+	router.Post("/api/goods", goodsHandlers.PostReward)
+	return router
+}
+
+func TestPostReward(t *testing.T) {
+	logging.Initialize("INFO")
+	accrualService := accrualservice.NewAccrualService(rewardmemstorage.NewRewardMemStorage(), accrualordermemstorage.NewOrderMemStorage())
+	handlers := NewGoodsHandlers(accrualService)
+	router := mockRouter(handlers)
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+	client := resty.New()
+
+	testCases := []struct {
+		testName     string
+		requestBody  string
+		expectedCode int
+	}{
+		{
+			testName:     "successfully registered",
+			requestBody:  `{"match": "Bork", "reward": 10, "reward_type": "%"}`,
+			expectedCode: http.StatusOK,
+		},
+		{
+			testName:     "match already registered",
+			requestBody:  `{"match": "Bork", "reward": 15, "reward_type": "pt"}`,
+			expectedCode: http.StatusConflict,
+		},
+		{
+			testName:     "bad reward type",
+			requestBody:  `{"match": "Tefal", "reward": 15, "reward_type": "rub"}`,
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			testName:     "bad request",
+			requestBody:  `{}`,
+			expectedCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			resp, _ := client.R().
+				SetHeader("Content-Type", "application/json").
+				SetBody(tc.requestBody).
+				Execute(http.MethodPost, srv.URL+"/api/goods")
+			assert.Equal(t, tc.expectedCode, resp.StatusCode(), "Код ответа не совпадает с ожидаемым")
+		})
+	}
+}
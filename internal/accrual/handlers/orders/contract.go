@@ -0,0 +1,12 @@
+package accrualorderhandlers
+
+import (
+	"context"
+
+	"github.com/ry461ch/loyalty_system/internal/accrual/models/order"
+)
+
+type AccrualService interface {
+	RegisterOrder(ctx context.Context, inputOrder *accrualorder.InputOrder) error
+	GetOrder(ctx context.Context, orderID string) (*accrualorder.Order, error)
+}
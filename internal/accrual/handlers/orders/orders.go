@@ -0,0 +1,79 @@
+package accrualorderhandlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/ry461ch/loyalty_system/internal/accrual/models/exceptions"
+	"github.com/ry461ch/loyalty_system/internal/accrual/models/order"
+	"github.com/ry461ch/loyalty_system/pkg/logging"
+)
+
+type OrderHandlers struct {
+	accrualService AccrualService
+}
+
+func NewOrderHandlers(accrualService AccrualService) *OrderHandlers {
+	return &OrderHandlers{
+		accrualService: accrualService,
+	}
+}
+
+func (oh *OrderHandlers) PostOrder(res http.ResponseWriter, req *http.Request) {
+	reqBody, err := io.ReadAll(req.Body)
+	if err != nil {
+		res.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	var inputOrder accrualorder.InputOrder
+	err = json.Unmarshal(reqBody, &inputOrder)
+	if err != nil {
+		res.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	err = oh.accrualService.RegisterOrder(req.Context(), &inputOrder)
+	if err == nil {
+		res.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	switch {
+	case errors.Is(err, exceptions.ErrOrderConflict):
+		res.WriteHeader(http.StatusConflict)
+	default:
+		logging.Logger.Errorf("Register order: internal error: %v", err)
+		res.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+func (oh *OrderHandlers) GetOrder(res http.ResponseWriter, req *http.Request) {
+	orderID := chi.URLParam(req, "number")
+
+	orderInDB, err := oh.accrualService.GetOrder(req.Context(), orderID)
+	if err != nil {
+		if errors.Is(err, exceptions.ErrOrderNotFound) {
+			res.WriteHeader(http.StatusNoContent)
+			return
+		}
+		logging.Logger.Errorf("Get order: internal error: %v", err)
+		res.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	resp, err := json.Marshal(orderInDB)
+	if err != nil {
+		logging.Logger.Errorf("Get order: internal error: %v", err)
+		res.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(http.StatusOK)
+	res.Write(resp)
+}
@@ -0,0 +1,132 @@
+package accrualorderhandlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-resty/resty/v2"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ry461ch/loyalty_system/internal/accrual/models/order"
+	"github.com/ry461ch/loyalty_system/internal/accrual/models/reward"
+	"github.com/ry461ch/loyalty_system/internal/accrual/services/accrual"
+	"github.com/ry461ch/loyalty_system/internal/accrual/storage/memory/orders"
+	"github.com/ry461ch/loyalty_system/internal/accrual/storage/memory/rewards"
+	"github.com/ry461ch/loyalty_system/pkg/logging"
+)
+
+func mockRouter(orderHandlers *OrderHandlers) chi.Router {
+	router := chi.NewRouter()
+	router.Post("/api/orders", orderHandlers.PostOrder)
+	router.Get("/api/orders/{number}", orderHandlers.GetOrder)
+	return router
+}
+
+func TestPostOrder(t *testing.T) {
+	logging.Initialize("INFO")
+	accrualService := accrualservice.NewAccrualService(rewardmemstorage.NewRewardMemStorage(), accrualordermemstorage.NewOrderMemStorage())
+	accrualService.RegisterOrder(context.TODO(), &accrualorder.InputOrder{
+		ID:    "1115",
+		Goods: []accrualorder.Good{{Description: "Чайник Bork", Price: 7000}},
+	})
+	handlers := NewOrderHandlers(accrualService)
+	router := mockRouter(handlers)
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+	client := resty.New()
+
+	testCases := []struct {
+		testName     string
+		requestBody  string
+		expectedCode int
+	}{
+		{
+			testName:     "successfully registered",
+			requestBody:  `{"order": "1321", "goods": [{"description": "Чайник Bork", "price": 7000}]}`,
+			expectedCode: http.StatusAccepted,
+		},
+		{
+			testName:     "order already registered",
+			requestBody:  `{"order": "1115", "goods": [{"description": "Чайник Bork", "price": 7000}]}`,
+			expectedCode: http.StatusConflict,
+		},
+		{
+			testName:     "order without goods",
+			requestBody:  `{"order": "1214", "goods": []}`,
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			testName:     "order number is not a number",
+			requestBody:  `{"order": "12a4", "goods": [{"description": "Чайник Bork", "price": 7000}]}`,
+			expectedCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			resp, _ := client.R().
+				SetHeader("Content-Type", "application/json").
+				SetBody(tc.requestBody).
+				Execute(http.MethodPost, srv.URL+"/api/orders")
+			assert.Equal(t, tc.expectedCode, resp.StatusCode(), "Код ответа не совпадает с ожидаемым")
+		})
+	}
+}
+
+func TestGetOrder(t *testing.T) {
+	logging.Initialize("INFO")
+	accrualService := accrualservice.NewAccrualService(rewardmemstorage.NewRewardMemStorage(), accrualordermemstorage.NewOrderMemStorage())
+	accrualService.RegisterReward(context.TODO(), &reward.Reward{Match: "Bork", Reward: 10, RewardType: reward.PERCENT})
+	for _, orderID := range []string{"1115", "1321"} {
+		accrualService.RegisterOrder(context.TODO(), &accrualorder.InputOrder{
+			ID:    orderID,
+			Goods: []accrualorder.Good{{Description: "Чайник Bork", Price: 7000}},
+		})
+	}
+	registeredOrders, _ := accrualService.PopRegisteredOrders(context.TODO(), 1)
+	accrualService.CalculateOrder(context.TODO(), &registeredOrders[0])
+
+	handlers := NewOrderHandlers(accrualService)
+	router := mockRouter(handlers)
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+	client := resty.New()
+
+	testCases := []struct {
+		testName     string
+		orderID      string
+		expectedCode int
+		expectedBody string
+	}{
+		{
+			testName:     "processed order",
+			orderID:      "1115",
+			expectedCode: http.StatusOK,
+			expectedBody: `{"order": "1115", "status": "PROCESSED", "accrual": 700}`,
+		},
+		{
+			testName:     "registered order",
+			orderID:      "1321",
+			expectedCode: http.StatusOK,
+			expectedBody: `{"order": "1321", "status": "REGISTERED"}`,
+		},
+		{
+			testName:     "unknown order",
+			orderID:      "1214",
+			expectedCode: http.StatusNoContent,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			resp, _ := client.R().Execute(http.MethodGet, srv.URL+"/api/orders/"+tc.orderID)
+			assert.Equal(t, tc.expectedCode, resp.StatusCode(), "Код ответа не совпадает с ожидаемым")
+			if tc.expectedBody != "" {
+				assert.JSONEq(t, tc.expectedBody, string(resp.Body()), "bodies not equal")
+			}
+		})
+	}
+}
@@ -0,0 +1,11 @@
+package exceptions
+
+import "errors"
+
+var (
+	ErrRewardBadFormat = errors.New("bad reward format")
+	ErrRewardConflict  = errors.New("reward with same match already exists")
+	ErrOrderBadFormat  = errors.New("bad order format")
+	ErrOrderConflict   = errors.New("order already registered")
+	ErrOrderNotFound   = errors.New("order not found")
+)
@@ -0,0 +1,78 @@
+package accrualorder
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/ry461ch/loyalty_system/internal/accrual/models/exceptions"
+)
+
+type Status int32
+
+const (
+	REGISTERED Status = iota
+	PROCESSING
+	INVALID
+	PROCESSED
+)
+
+func (s Status) MarshalJSON() ([]byte, error) {
+	switch s {
+	case REGISTERED:
+		return []byte("\"REGISTERED\""), nil
+	case PROCESSING:
+		return []byte("\"PROCESSING\""), nil
+	case INVALID:
+		return []byte("\"INVALID\""), nil
+	case PROCESSED:
+		return []byte("\"PROCESSED\""), nil
+	default:
+		return nil, exceptions.ErrOrderBadFormat
+	}
+}
+
+type Good struct {
+	Description string  `json:"description"`
+	Price       float64 `json:"price"`
+}
+
+type Order struct {
+	ID      string   `json:"order"`
+	Status  Status   `json:"status"`
+	Accrual *float64 `json:"accrual,omitempty"`
+	Goods   []Good   `json:"-"`
+}
+
+type InputOrder struct {
+	ID    string `json:"order"`
+	Goods []Good `json:"goods"`
+}
+
+func (o *InputOrder) UnmarshalJSON(data []byte) error {
+	type InputOrderAlias InputOrder
+
+	aliasValue := &struct {
+		*InputOrderAlias
+	}{
+		InputOrderAlias: (*InputOrderAlias)(o),
+	}
+
+	if err := json.Unmarshal(data, aliasValue); err != nil {
+		return err
+	}
+
+	isNotDigit := func(r rune) bool { return r < '0' || r > '9' }
+	if aliasValue.ID == "" || strings.IndexFunc(aliasValue.ID, isNotDigit) != -1 {
+		return exceptions.ErrOrderBadFormat
+	}
+	if len(aliasValue.Goods) == 0 {
+		return exceptions.ErrOrderBadFormat
+	}
+	for _, good := range aliasValue.Goods {
+		if good.Description == "" || good.Price < 0 {
+			return exceptions.ErrOrderBadFormat
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,86 @@
+package reward
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"strings"
+
+	"github.com/ry461ch/loyalty_system/internal/accrual/models/exceptions"
+)
+
+type Type int32
+
+const (
+	POINTS Type = iota
+	PERCENT
+)
+
+func (t Type) MarshalJSON() ([]byte, error) {
+	switch t {
+	case POINTS:
+		return []byte("\"pt\""), nil
+	case PERCENT:
+		return []byte("\"%\""), nil
+	default:
+		return nil, exceptions.ErrRewardBadFormat
+	}
+}
+
+func (t *Type) UnmarshalJSON(data []byte) error {
+	switch {
+	case bytes.Equal(data, []byte("\"pt\"")):
+		*t = POINTS
+	case bytes.Equal(data, []byte("\"%\"")):
+		*t = PERCENT
+	default:
+		return exceptions.ErrRewardBadFormat
+	}
+	return nil
+}
+
+type Reward struct {
+	Match      string  `json:"match"`
+	Reward     float64 `json:"reward"`
+	RewardType Type    `json:"reward_type"`
+}
+
+func (r *Reward) UnmarshalJSON(data []byte) error {
+	type RewardAlias Reward
+
+	aliasValue := &struct {
+		*RewardAlias
+	}{
+		RewardAlias: (*RewardAlias)(r),
+	}
+
+	if err := json.Unmarshal(data, aliasValue); err != nil {
+		return err
+	}
+
+	if aliasValue.Match == "" || aliasValue.Reward <= 0 {
+		return exceptions.ErrRewardBadFormat
+	}
+	if aliasValue.RewardType == PERCENT && aliasValue.Reward > 100 {
+		return exceptions.ErrRewardBadFormat
+	}
+
+	return nil
+}
+
+// Matches reports whether the good description contains the reward match key.
+func (r *Reward) Matches(description string) bool {
+	return strings.Contains(strings.ToLower(description), strings.ToLower(r.Match))
+}
+
+// Calculate returns the accrual for a good with the given price rounded to hundredths.
+func (r *Reward) Calculate(price float64) float64 {
+	var accrual float64
+	switch r.RewardType {
+	case POINTS:
+		accrual = r.Reward
+	case PERCENT:
+		accrual = price * r.Reward / 100
+	}
+	return math.Round(accrual*100) / 100
+}
@@ -0,0 +1,97 @@
+package reward
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnmarshal(t *testing.T) {
+	testCases := []struct {
+		testName       string
+		inputReward    string
+		expectedReward *Reward
+	}{
+		{
+			testName:       "points reward",
+			inputReward:    `{"match": "Bork", "reward": 10, "reward_type": "pt"}`,
+			expectedReward: &Reward{Match: "Bork", Reward: 10, RewardType: POINTS},
+		},
+		{
+			testName:       "percent reward",
+			inputReward:    `{"match": "Bork", "reward": 7.5, "reward_type": "%"}`,
+			expectedReward: &Reward{Match: "Bork", Reward: 7.5, RewardType: PERCENT},
+		},
+		{
+			testName:       "too big percent",
+			inputReward:    `{"match": "Bork", "reward": 101, "reward_type": "%"}`,
+			expectedReward: nil,
+		},
+		{
+			testName:       "unknown reward type",
+			inputReward:    `{"match": "Bork", "reward": 10, "reward_type": "rub"}`,
+			expectedReward: nil,
+		},
+		{
+			testName:       "empty match",
+			inputReward:    `{"reward": 10, "reward_type": "pt"}`,
+			expectedReward: nil,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			var reward Reward
+			err := json.Unmarshal([]byte(tc.inputReward), &reward)
+			if tc.expectedReward == nil {
+				assert.Error(t, err, "invalid reward was successfully parsed")
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, *tc.expectedReward, reward, "rewards not equal")
+		})
+	}
+}
+
+func TestCalculate(t *testing.T) {
+	testCases := []struct {
+		testName        string
+		reward          Reward
+		price           float64
+		expectedAccrual float64
+	}{
+		{
+			testName:        "points",
+			reward:          Reward{Match: "Bork", Reward: 15, RewardType: POINTS},
+			price:           5000,
+			expectedAccrual: 15,
+		},
+		{
+			testName:        "percent",
+			reward:          Reward{Match: "Bork", Reward: 10, RewardType: PERCENT},
+			price:           5000,
+			expectedAccrual: 500,
+		},
+		{
+			testName:        "percent rounding",
+			reward:          Reward{Match: "Bork", Reward: 3, RewardType: PERCENT},
+			price:           33.33,
+			expectedAccrual: 1,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			assert.Equal(t, tc.expectedAccrual, tc.reward.Calculate(tc.price), "accruals not equal")
+		})
+	}
+}
+
+func TestMatches(t *testing.T) {
+	bork := Reward{Match: "Bork", Reward: 10, RewardType: POINTS}
+
+	assert.True(t, bork.Matches("Чайник Bork"), "same case description doesn't match")
+	assert.True(t, bork.Matches("чайник BORK"), "upper case description doesn't match")
+	assert.False(t, bork.Matches("Чайник Tefal"), "another description matches")
+}
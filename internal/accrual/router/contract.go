@@ -0,0 +1,12 @@
+package accrualrouter
+
+import "net/http"
+
+type GoodsHandlers interface {
+	PostReward(res http.ResponseWriter, req *http.Request)
+}
+
+type OrderHandlers interface {
+	PostOrder(res http.ResponseWriter, req *http.Request)
+	GetOrder(res http.ResponseWriter, req *http.Request)
+}
@@ -0,0 +1,39 @@
+package accrualrouter
+
+import (
+	"github.com/go-chi/chi/v5"
+
+	"github.com/ry461ch/loyalty_system/pkg/logging/middleware"
+	"github.com/ry461ch/loyalty_system/pkg/middlewares/contenttypes"
+	"github.com/ry461ch/loyalty_system/pkg/middlewares/throttle"
+)
+
+func NewRouter(
+	goodsHandlers GoodsHandlers,
+	orderHandlers OrderHandlers,
+	ordersThrottle *throttle.Throttle,
+) chi.Router {
+	r := chi.NewRouter()
+
+	r.Use(requestlogger.WithLogging)
+
+	r.Route("/api", func(r chi.Router) {
+		r.Route("/goods", func(r chi.Router) {
+			r.Use(contenttypes.ValidateJSONContentType)
+			r.Post("/", goodsHandlers.PostReward)
+		})
+		r.Route("/orders", func(r chi.Router) {
+			r.Group(func(r chi.Router) {
+				r.Use(contenttypes.ValidateJSONContentType)
+				r.Post("/", orderHandlers.PostOrder)
+			})
+
+			r.Group(func(r chi.Router) {
+				r.Use(ordersThrottle.Handle)
+				r.Get("/{number:[0-9]+}", orderHandlers.GetOrder)
+			})
+		})
+	})
+
+	return r
+}
@@ -0,0 +1,88 @@
+package accrualservice
+
+import (
+	"context"
+	"errors"
+	"math"
+
+	"github.com/ry461ch/loyalty_system/internal/accrual/models/order"
+	"github.com/ry461ch/loyalty_system/internal/accrual/models/reward"
+	"github.com/ry461ch/loyalty_system/internal/helpers/order"
+)
+
+type AccrualService struct {
+	rewardStorage RewardStorage
+	orderStorage  OrderStorage
+}
+
+func NewAccrualService(rewardStorage RewardStorage, orderStorage OrderStorage) *AccrualService {
+	return &AccrualService{
+		rewardStorage: rewardStorage,
+		orderStorage:  orderStorage,
+	}
+}
+
+func (as *AccrualService) RegisterReward(ctx context.Context, inputReward *reward.Reward) error {
+	return as.rewardStorage.InsertReward(ctx, inputReward)
+}
+
+func (as *AccrualService) RegisterOrder(ctx context.Context, inputOrder *accrualorder.InputOrder) error {
+	newOrder := accrualorder.Order{
+		ID:     inputOrder.ID,
+		Status: accrualorder.REGISTERED,
+		Goods:  inputOrder.Goods,
+	}
+	return as.orderStorage.InsertOrder(ctx, &newOrder)
+}
+
+func (as *AccrualService) GetOrder(ctx context.Context, orderID string) (*accrualorder.Order, error) {
+	return as.orderStorage.GetOrder(ctx, orderID)
+}
+
+func (as *AccrualService) PopRegisteredOrders(ctx context.Context, limit int) ([]accrualorder.Order, error) {
+	return as.orderStorage.PopRegisteredOrders(ctx, limit)
+}
+
+// CalculateOrder sums rewards of the first matching rule for every good of the order.
+// Orders with number failing the Luhn check are marked INVALID.
+// Order which failed to be calculated is put back to REGISTERED, otherwise it would stay PROCESSING forever.
+func (as *AccrualService) CalculateOrder(ctx context.Context, inputOrder *accrualorder.Order) error {
+	err := as.calculateOrder(ctx, inputOrder)
+	if err != nil {
+		requeueErr := as.orderStorage.RequeueOrder(context.WithoutCancel(ctx), inputOrder.ID)
+		return errors.Join(err, requeueErr)
+	}
+	return nil
+}
+
+func (as *AccrualService) calculateOrder(ctx context.Context, inputOrder *accrualorder.Order) error {
+	calculatedOrder := *inputOrder
+	if !orderhelpers.ValidateOrderID(calculatedOrder.ID) {
+		calculatedOrder.Status = accrualorder.INVALID
+		return as.orderStorage.UpdateOrder(ctx, &calculatedOrder)
+	}
+
+	rewards, err := as.rewardStorage.GetRewards(ctx)
+	if err != nil {
+		return err
+	}
+
+	var accrual float64
+	matched := false
+	for _, good := range calculatedOrder.Goods {
+		for _, goodReward := range rewards {
+			if goodReward.Matches(good.Description) {
+				accrual += goodReward.Calculate(good.Price)
+				matched = true
+				break
+			}
+		}
+	}
+
+	calculatedOrder.Status = accrualorder.PROCESSED
+	if matched {
+		accrual = math.Round(accrual*100) / 100
+		calculatedOrder.Accrual = &accrual
+	}
+	return as.orderStorage.UpdateOrder(ctx, &calculatedOrder)
+}
@@ -0,0 +1,131 @@
+package accrualservice
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ry461ch/loyalty_system/internal/accrual/models/exceptions"
+	"github.com/ry461ch/loyalty_system/internal/accrual/models/order"
+	"github.com/ry461ch/loyalty_system/internal/accrual/models/reward"
+	"github.com/ry461ch/loyalty_system/internal/accrual/storage/memory/orders"
+	"github.com/ry461ch/loyalty_system/internal/accrual/storage/memory/rewards"
+)
+
+func TestRegisterReward(t *testing.T) {
+	service := NewAccrualService(rewardmemstorage.NewRewardMemStorage(), accrualordermemstorage.NewOrderMemStorage())
+	bork := reward.Reward{Match: "Bork", Reward: 10, RewardType: reward.PERCENT}
+
+	err := service.RegisterReward(context.TODO(), &bork)
+	assert.Nil(t, err, "not expected error")
+	err = service.RegisterReward(context.TODO(), &bork)
+	assert.ErrorIs(t, err, exceptions.ErrRewardConflict, "exceptions don't match")
+}
+
+func TestRegisterOrder(t *testing.T) {
+	service := NewAccrualService(rewardmemstorage.NewRewardMemStorage(), accrualordermemstorage.NewOrderMemStorage())
+	inputOrder := accrualorder.InputOrder{
+		ID:    "1115",
+		Goods: []accrualorder.Good{{Description: "Чайник Bork", Price: 7000}},
+	}
+
+	err := service.RegisterOrder(context.TODO(), &inputOrder)
+	assert.Nil(t, err, "not expected error")
+	err = service.RegisterOrder(context.TODO(), &inputOrder)
+	assert.ErrorIs(t, err, exceptions.ErrOrderConflict, "exceptions don't match")
+
+	registeredOrder, _ := service.GetOrder(context.TODO(), inputOrder.ID)
+	assert.Equal(t, accrualorder.REGISTERED, registeredOrder.Status, "statuses not equal")
+	assert.Nil(t, registeredOrder.Accrual, "accrual of registered order")
+}
+
+func TestCalculateOrder(t *testing.T) {
+	rewards := []reward.Reward{
+		{Match: "Bork", Reward: 10, RewardType: reward.PERCENT},
+		{Match: "Чайник", Reward: 100, RewardType: reward.POINTS},
+		{Match: "Tefal", Reward: 50, RewardType: reward.POINTS},
+	}
+
+	testCases := []struct {
+		testName        string
+		inputOrder      accrualorder.InputOrder
+		expectedStatus  accrualorder.Status
+		expectedAccrual *float64
+	}{
+		{
+			testName: "first matching reward for each good",
+			inputOrder: accrualorder.InputOrder{
+				ID: "1115",
+				Goods: []accrualorder.Good{
+					{Description: "Чайник Bork", Price: 7000},
+					{Description: "Сковорода Tefal", Price: 3000},
+				},
+			},
+			expectedStatus:  accrualorder.PROCESSED,
+			expectedAccrual: func() *float64 { accrual := float64(750); return &accrual }(),
+		},
+		{
+			testName: "no matching rewards",
+			inputOrder: accrualorder.InputOrder{
+				ID:    "1321",
+				Goods: []accrualorder.Good{{Description: "Утюг Philips", Price: 5000}},
+			},
+			expectedStatus:  accrualorder.PROCESSED,
+			expectedAccrual: nil,
+		},
+		{
+			testName: "invalid order number",
+			inputOrder: accrualorder.InputOrder{
+				ID:    "1322",
+				Goods: []accrualorder.Good{{Description: "Чайник Bork", Price: 7000}},
+			},
+			expectedStatus:  accrualorder.INVALID,
+			expectedAccrual: nil,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			service := NewAccrualService(rewardmemstorage.NewRewardMemStorage(), accrualordermemstorage.NewOrderMemStorage())
+			for _, goodReward := range rewards {
+				service.RegisterReward(context.TODO(), &goodReward)
+			}
+			service.RegisterOrder(context.TODO(), &tc.inputOrder)
+
+			registeredOrders, _ := service.PopRegisteredOrders(context.TODO(), 1)
+			err := service.CalculateOrder(context.TODO(), &registeredOrders[0])
+			assert.Nil(t, err, "not expected error")
+
+			calculatedOrder, _ := service.GetOrder(context.TODO(), tc.inputOrder.ID)
+			assert.Equal(t, tc.expectedStatus, calculatedOrder.Status, "statuses not equal")
+			assert.Equal(t, tc.expectedAccrual, calculatedOrder.Accrual, "accruals not equal")
+		})
+	}
+}
+
+type brokenRewardStorage struct {
+	RewardStorage
+}
+
+func (*brokenRewardStorage) GetRewards(ctx context.Context) ([]reward.Reward, error) {
+	return nil, errors.New("storage is down")
+}
+
+func TestCalculateOrderFailure(t *testing.T) {
+	service := NewAccrualService(&brokenRewardStorage{}, accrualordermemstorage.NewOrderMemStorage())
+	service.RegisterOrder(context.TODO(), &accrualorder.InputOrder{
+		ID:    "1115",
+		Goods: []accrualorder.Good{{Description: "Чайник Bork", Price: 7000}},
+	})
+
+	registeredOrders, _ := service.PopRegisteredOrders(context.TODO(), 1)
+	err := service.CalculateOrder(context.TODO(), &registeredOrders[0])
+	assert.NotNil(t, err, "expected error")
+
+	failedOrder, _ := service.GetOrder(context.TODO(), "1115")
+	assert.Equal(t, accrualorder.REGISTERED, failedOrder.Status, "failed order wasn't requeued")
+	registeredOrders, _ = service.PopRegisteredOrders(context.TODO(), 1)
+	assert.Equal(t, 1, len(registeredOrders), "failed order can't be popped again")
+}
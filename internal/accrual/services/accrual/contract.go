@@ -0,0 +1,21 @@
+package accrualservice
+
+import (
+	"context"
+
+	"github.com/ry461ch/loyalty_system/internal/accrual/models/order"
+	"github.com/ry461ch/loyalty_system/internal/accrual/models/reward"
+)
+
+type RewardStorage interface {
+	InsertReward(ctx context.Context, inputReward *reward.Reward) error
+	GetRewards(ctx context.Context) ([]reward.Reward, error)
+}
+
+type OrderStorage interface {
+	InsertOrder(ctx context.Context, newOrder *accrualorder.Order) error
+	GetOrder(ctx context.Context, orderID string) (*accrualorder.Order, error)
+	UpdateOrder(ctx context.Context, updatedOrder *accrualorder.Order) error
+	PopRegisteredOrders(ctx context.Context, limit int) ([]accrualorder.Order, error)
+	RequeueOrder(ctx context.Context, orderID string) error
+}
@@ -0,0 +1,94 @@
+package accrualordermemstorage
+
+import (
+	"context"
+	"sync"
+
+	"github.com/ry461ch/loyalty_system/internal/accrual/models/exceptions"
+	"github.com/ry461ch/loyalty_system/internal/accrual/models/order"
+)
+
+type OrderMemStorage struct {
+	mu               sync.RWMutex
+	orders           map[string]accrualorder.Order
+	registeredOrders []string // ids of orders waiting for calculation in order of registration
+}
+
+func NewOrderMemStorage() *OrderMemStorage {
+	return &OrderMemStorage{
+		orders:           map[string]accrualorder.Order{},
+		registeredOrders: []string{},
+	}
+}
+
+func (oms *OrderMemStorage) InsertOrder(ctx context.Context, newOrder *accrualorder.Order) error {
+	oms.mu.Lock()
+	defer oms.mu.Unlock()
+
+	if _, ok := oms.orders[newOrder.ID]; ok {
+		return exceptions.ErrOrderConflict
+	}
+	oms.orders[newOrder.ID] = *newOrder
+	if newOrder.Status == accrualorder.REGISTERED {
+		oms.registeredOrders = append(oms.registeredOrders, newOrder.ID)
+	}
+	return nil
+}
+
+func (oms *OrderMemStorage) GetOrder(ctx context.Context, orderID string) (*accrualorder.Order, error) {
+	oms.mu.RLock()
+	defer oms.mu.RUnlock()
+
+	orderInDB, ok := oms.orders[orderID]
+	if !ok {
+		return nil, exceptions.ErrOrderNotFound
+	}
+	return &orderInDB, nil
+}
+
+func (oms *OrderMemStorage) UpdateOrder(ctx context.Context, updatedOrder *accrualorder.Order) error {
+	oms.mu.Lock()
+	defer oms.mu.Unlock()
+
+	if _, ok := oms.orders[updatedOrder.ID]; !ok {
+		return exceptions.ErrOrderNotFound
+	}
+	oms.orders[updatedOrder.ID] = *updatedOrder
+	return nil
+}
+
+// PopRegisteredOrders moves up to limit oldest REGISTERED orders to PROCESSING and returns them.
+func (oms *OrderMemStorage) PopRegisteredOrders(ctx context.Context, limit int) ([]accrualorder.Order, error) {
+	oms.mu.Lock()
+	defer oms.mu.Unlock()
+
+	num := min(limit, len(oms.registeredOrders))
+	poppedOrders := make([]accrualorder.Order, 0, num)
+	for _, orderID := range oms.registeredOrders[:num] {
+		poppedOrder := oms.orders[orderID]
+		poppedOrder.Status = accrualorder.PROCESSING
+		oms.orders[orderID] = poppedOrder
+		poppedOrders = append(poppedOrders, poppedOrder)
+	}
+	oms.registeredOrders = oms.registeredOrders[num:]
+	return poppedOrders, nil
+}
+
+// RequeueOrder moves popped order back to REGISTERED, so it is calculated again by the next iteration.
+func (oms *OrderMemStorage) RequeueOrder(ctx context.Context, orderID string) error {
+	oms.mu.Lock()
+	defer oms.mu.Unlock()
+
+	orderInDB, ok := oms.orders[orderID]
+	if !ok {
+		return exceptions.ErrOrderNotFound
+	}
+	if orderInDB.Status != accrualorder.PROCESSING {
+		return nil
+	}
+	orderInDB.Status = accrualorder.REGISTERED
+	orderInDB.Accrual = nil
+	oms.orders[orderID] = orderInDB
+	oms.registeredOrders = append(oms.registeredOrders, orderID)
+	return nil
+}
@@ -0,0 +1,127 @@
+package accrualordermemstorage
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ry461ch/loyalty_system/internal/accrual/models/exceptions"
+	"github.com/ry461ch/loyalty_system/internal/accrual/models/order"
+)
+
+func TestInsertOrder(t *testing.T) {
+	existingOrder := accrualorder.Order{
+		ID:     "1115",
+		Status: accrualorder.REGISTERED,
+	}
+
+	testCases := []struct {
+		testName    string
+		newOrder    accrualorder.Order
+		expectedErr error
+	}{
+		{
+			testName:    "new order",
+			newOrder:    accrualorder.Order{ID: "1321", Status: accrualorder.REGISTERED},
+			expectedErr: nil,
+		},
+		{
+			testName:    "existing order",
+			newOrder:    accrualorder.Order{ID: existingOrder.ID, Status: accrualorder.REGISTERED},
+			expectedErr: exceptions.ErrOrderConflict,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			storage := NewOrderMemStorage()
+			storage.InsertOrder(context.TODO(), &existingOrder)
+
+			err := storage.InsertOrder(context.TODO(), &tc.newOrder)
+			assert.ErrorIs(t, err, tc.expectedErr, "errors don't match")
+			if tc.expectedErr == nil {
+				assert.Equal(t, 2, len(storage.registeredOrders), "new order wasn't queued")
+			}
+		})
+	}
+}
+
+func TestGetOrder(t *testing.T) {
+	existingOrder := accrualorder.Order{
+		ID:     "1115",
+		Status: accrualorder.REGISTERED,
+	}
+
+	testCases := []struct {
+		testName      string
+		orderID       string
+		expectedOrder *accrualorder.Order
+	}{
+		{
+			testName:      "existing order",
+			orderID:       existingOrder.ID,
+			expectedOrder: &existingOrder,
+		},
+		{
+			testName:      "new order",
+			orderID:       "1321",
+			expectedOrder: nil,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			storage := NewOrderMemStorage()
+			storage.InsertOrder(context.TODO(), &existingOrder)
+
+			orderInDB, err := storage.GetOrder(context.TODO(), tc.orderID)
+			if tc.expectedOrder != nil {
+				assert.Equal(t, *tc.expectedOrder, *orderInDB, "orders don't match")
+			} else {
+				assert.ErrorIs(t, err, exceptions.ErrOrderNotFound, "order found but shouldn't")
+			}
+		})
+	}
+}
+
+func TestPopRegisteredOrders(t *testing.T) {
+	storage := NewOrderMemStorage()
+	for _, orderID := range []string{"1115", "1321", "1214"} {
+		storage.InsertOrder(context.TODO(), &accrualorder.Order{ID: orderID, Status: accrualorder.REGISTERED})
+	}
+
+	poppedOrders, _ := storage.PopRegisteredOrders(context.TODO(), 2)
+	assert.Equal(t, 2, len(poppedOrders), "num of orders don't match")
+	assert.Equal(t, "1115", poppedOrders[0].ID, "orders popped not in order of registration")
+	assert.Equal(t, "1321", poppedOrders[1].ID, "orders popped not in order of registration")
+
+	orderInDB, _ := storage.GetOrder(context.TODO(), "1115")
+	assert.Equal(t, accrualorder.PROCESSING, orderInDB.Status, "popped order wasn't moved to PROCESSING")
+
+	poppedOrders, _ = storage.PopRegisteredOrders(context.TODO(), 2)
+	assert.Equal(t, 1, len(poppedOrders), "num of orders don't match")
+	assert.Equal(t, "1214", poppedOrders[0].ID, "orders don't match")
+}
+
+func TestRequeueOrder(t *testing.T) {
+	storage := NewOrderMemStorage()
+	for _, orderID := range []string{"1115", "1321"} {
+		storage.InsertOrder(context.TODO(), &accrualorder.Order{ID: orderID, Status: accrualorder.REGISTERED})
+	}
+	storage.PopRegisteredOrders(context.TODO(), 2)
+
+	err := storage.RequeueOrder(context.TODO(), "1115")
+	assert.Nil(t, err, "not expected error")
+	err = storage.RequeueOrder(context.TODO(), "1115")
+	assert.Nil(t, err, "not expected error")
+	err = storage.RequeueOrder(context.TODO(), "1214")
+	assert.ErrorIs(t, err, exceptions.ErrOrderNotFound, "errors don't match")
+
+	orderInDB, _ := storage.GetOrder(context.TODO(), "1115")
+	assert.Equal(t, accrualorder.REGISTERED, orderInDB.Status, "order wasn't moved back to REGISTERED")
+
+	poppedOrders, _ := storage.PopRegisteredOrders(context.TODO(), 2)
+	assert.Equal(t, 1, len(poppedOrders), "order was queued more than once")
+	assert.Equal(t, "1115", poppedOrders[0].ID, "requeued order wasn't popped")
+}
@@ -0,0 +1,43 @@
+package rewardmemstorage
+
+import (
+	"context"
+	"sync"
+
+	"github.com/ry461ch/loyalty_system/internal/accrual/models/exceptions"
+	"github.com/ry461ch/loyalty_system/internal/accrual/models/reward"
+)
+
+type RewardMemStorage struct {
+	mu      sync.RWMutex
+	rewards []reward.Reward // in order of registration
+	matches map[string]bool
+}
+
+func NewRewardMemStorage() *RewardMemStorage {
+	return &RewardMemStorage{
+		rewards: []reward.Reward{},
+		matches: map[string]bool{},
+	}
+}
+
+func (rms *RewardMemStorage) InsertReward(ctx context.Context, inputReward *reward.Reward) error {
+	rms.mu.Lock()
+	defer rms.mu.Unlock()
+
+	if rms.matches[inputReward.Match] {
+		return exceptions.ErrRewardConflict
+	}
+	rms.matches[inputReward.Match] = true
+	rms.rewards = append(rms.rewards, *inputReward)
+	return nil
+}
+
+func (rms *RewardMemStorage) GetRewards(ctx context.Context) ([]reward.Reward, error) {
+	rms.mu.RLock()
+	defer rms.mu.RUnlock()
+
+	rewards := make([]reward.Reward, len(rms.rewards))
+	copy(rewards, rms.rewards)
+	return rewards, nil
+}
@@ -0,0 +1,10 @@
+package server
+
+import (
+	"context"
+)
+
+type Storage interface {
+	Init(ctx context.Context) error
+	Close()
+}
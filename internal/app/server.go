@@ -12,55 +12,121 @@ import (
 
 	"github.com/ry461ch/loyalty_system/internal/components/orders"
 	"github.com/ry461ch/loyalty_system/internal/config"
+	"github.com/ry461ch/loyalty_system/internal/crontasks/loginattempts/pruner"
 	"github.com/ry461ch/loyalty_system/internal/crontasks/orders/enricher"
+	"github.com/ry461ch/loyalty_system/internal/crontasks/points/expirer"
 	"github.com/ry461ch/loyalty_system/internal/handlers"
 	"github.com/ry461ch/loyalty_system/internal/router"
 	"github.com/ry461ch/loyalty_system/internal/services"
+	"github.com/ry461ch/loyalty_system/internal/storage/memory"
 	"github.com/ry461ch/loyalty_system/internal/storage/postgres"
 	"github.com/ry461ch/loyalty_system/pkg/authentication"
+	"github.com/ry461ch/loyalty_system/pkg/encrypt"
 	"github.com/ry461ch/loyalty_system/pkg/logging"
+	"github.com/ry461ch/loyalty_system/pkg/password"
 )
 
 type Server struct {
 	cfg           *config.Config
-	pgStorage     *pgstorage.PGStorage
+	storage       Storage
 	orderEnricher *orderenricher.OrderEnricher
+	pointExpirer  *pointexpirer.PointExpirer
+	loginPruner   *loginattemptpruner.LoginAttemptPruner
 	server        *http.Server
 }
 
 func NewServer(cfg *config.Config) *Server {
 	logging.Initialize(cfg.LogLevel)
 
+	authenticator := newAuthenticator(cfg)
+	passwordHasher := password.NewHasher(password.Params{
+		Memory:      uint32(cfg.PasswordHashMemory),
+		Iterations:  uint32(cfg.PasswordHashIterations),
+		Parallelism: uint8(cfg.PasswordHashParallelism),
+		SaltLength:  password.DefaultParams.SaltLength,
+		KeyLength:   password.DefaultParams.KeyLength,
+	})
+
 	// initialize storage
-	pgStorage := pgstorage.NewPGStorage(cfg.DBDsn, cfg.ConnectionsLimit)
-	authenticator := authentication.NewAuthenticator(cfg.JWTSecretKey, cfg.TokenExp)
-	services := services.NewServices(pgStorage.BalanceStorage, pgStorage.WithdrawalStorage, pgStorage.UserStorage, pgStorage.OrderStorage, authenticator)
-	handlers := handlers.NewHandlers(services.MoneyService, services.OrderService, services.UserService)
-	router := router.NewRouter(handlers.AuthHandlers, handlers.MoneyHandlers, handlers.OrdersHandlers, authenticator)
-	orderComponents := ordercomponents.NewOrderComponents(cfg, services.OrderService)
+	var storage Storage
+	var appServices *services.Services
+	switch cfg.StorageType {
+	case config.MemoryStorage:
+		memStorage := memstorage.NewMemStorage()
+		storage = memStorage
+		appServices = services.NewServices(memStorage.BalanceStorage, memStorage.WithdrawalStorage, memStorage.UserStorage, memStorage.OrderStorage, memStorage.LedgerStorage, memStorage.SessionStorage, memStorage.LoginAttemptStorage, memStorage.ExportStorage, authenticator, passwordHasher, cfg)
+	default:
+		pgStorage := pgstorage.NewPGStorage(cfg.DBDsn, cfg.ConnectionsLimit)
+		storage = pgStorage
+		appServices = services.NewServices(pgStorage.BalanceStorage, pgStorage.WithdrawalStorage, pgStorage.UserStorage, pgStorage.OrderStorage, pgStorage.LedgerStorage, pgStorage.SessionStorage, pgStorage.LoginAttemptStorage, pgStorage.ExportStorage, authenticator, passwordHasher, cfg)
+	}
+
+	orderComponents := ordercomponents.NewOrderComponents(cfg, appServices.OrderService)
+	handlers := handlers.NewHandlers(appServices.MoneyService, appServices.OrderService, appServices.UserService, appServices.SessionService, orderComponents.Sender, authenticator, appServices.ExportService)
+	var accrualEncrypter *encrypt.Encrypter
+	if cfg.AccrualCallbackSecretKey != "" {
+		accrualEncrypter = encrypt.New(cfg.AccrualCallbackSecretKey)
+	}
+	var merchantEncrypter *encrypt.Encrypter
+	if cfg.MerchantSecretKey != "" {
+		merchantEncrypter = encrypt.New(cfg.MerchantSecretKey)
+	}
+	var opsEncrypter *encrypt.Encrypter
+	if cfg.OpsSecretKey != "" {
+		opsEncrypter = encrypt.New(cfg.OpsSecretKey)
+	}
+	router := router.NewRouter(
+		handlers.AuthHandlers,
+		handlers.MoneyHandlers,
+		handlers.OrdersHandlers,
+		handlers.StatusHandlers,
+		handlers.AccrualHandlers,
+		handlers.KeysHandlers,
+		handlers.ExportHandlers,
+		authenticator,
+		appServices.SessionService,
+		accrualEncrypter,
+		merchantEncrypter,
+		opsEncrypter,
+	)
 	orderEnricher := orderenricher.NewOrderEnricher(orderComponents.Getter, orderComponents.Sender, orderComponents.Updater, cfg)
 
 	server := &http.Server{Addr: cfg.Addr.Host + ":" + strconv.FormatInt(cfg.Addr.Port, 10), Handler: router}
 
 	return &Server{
 		cfg:           cfg,
-		pgStorage:     pgStorage,
+		storage:       storage,
 		orderEnricher: orderEnricher,
+		pointExpirer:  pointexpirer.NewPointExpirer(appServices.MoneyService, cfg),
+		loginPruner:   loginattemptpruner.NewLoginAttemptPruner(appServices.LoginGuard, cfg),
 		server:        server,
 	}
 }
 
+// newAuthenticator prefers asymmetric keys, HS256 tokens signed by secret key can't be verified by other services.
+func newAuthenticator(cfg *config.Config) *authentication.Authenticator {
+	if cfg.JWTSigningKeyFile == "" {
+		return authentication.NewAuthenticator(cfg.JWTSecretKey, cfg.TokenExp)
+	}
+
+	keySet, err := authentication.LoadKeySet(cfg.JWTSigningKeyFile, cfg.JWTVerificationKeyFiles)
+	if err != nil {
+		logging.Logger.Fatalf("Server: can't load jwt keys: %v", err)
+	}
+	return authentication.NewKeySetAuthenticator(keySet, cfg.TokenExp)
+}
+
 func (s *Server) Run() {
-	err := s.pgStorage.Init(context.Background())
+	err := s.storage.Init(context.Background())
 	if err != nil {
 		logging.Logger.Errorf("Db wasn't initialized: %s", err.Error())
 		return
 	}
-	defer s.pgStorage.Close()
-	logging.Logger.Infof("Server: intiated db")
+	defer s.storage.Close()
+	logging.Logger.Infof("Server: intiated %s storage", s.cfg.StorageType)
 
 	var wg sync.WaitGroup
-	wg.Add(3)
+	wg.Add(5)
 
 	// run server
 	go func() {
@@ -85,6 +151,28 @@ func (s *Server) Run() {
 		wg.Done()
 	}()
 
+	pointExpirerCtx, pointExpirerCtxCancel := context.WithCancel(context.Background())
+	go func() {
+		logging.Logger.Infof("Server: point expirer started")
+		err = s.pointExpirer.Run(pointExpirerCtx)
+		if err != nil {
+			logging.Logger.Errorf("Server: something went wrong while running point expirer: %v", err)
+		}
+		logging.Logger.Infof("Server: point expirer stopped")
+		wg.Done()
+	}()
+
+	loginPrunerCtx, loginPrunerCtxCancel := context.WithCancel(context.Background())
+	go func() {
+		logging.Logger.Infof("Server: login attempt pruner started")
+		err = s.loginPruner.Run(loginPrunerCtx)
+		if err != nil {
+			logging.Logger.Errorf("Server: something went wrong while running login attempt pruner: %v", err)
+		}
+		logging.Logger.Infof("Server: login attempt pruner stopped")
+		wg.Done()
+	}()
+
 	// wait for interrupting signal
 	go func() {
 		stop := make(chan os.Signal, 1)
@@ -96,6 +184,8 @@ func (s *Server) Run() {
 			logging.Logger.Errorf("Server: something went wrong while shutting down server: %v", err)
 		}
 		orderEnricherCtxCancel()
+		pointExpirerCtxCancel()
+		loginPrunerCtxCancel()
 		wg.Done()
 	}()
 
@@ -4,9 +4,12 @@ import (
 	"context"
 	"time"
 
+	"github.com/ry461ch/loyalty_system/internal/helpers/retry"
 	"github.com/ry461ch/loyalty_system/internal/models/order"
 )
 
 type WaitingOrdersGetterService interface {
-	GetWaitingOrders(ctx context.Context, limit int, createdAt *time.Time) ([]order.Order, error)
+	ClaimWaitingOrders(ctx context.Context, lease order.Lease, backoff retry.Policy, limit int, createdAt *time.Time) ([]order.Order, error)
+	GiveUpWaitingOrders(ctx context.Context, giveUpAfter time.Duration) (int, error)
+	ReleaseOrders(ctx context.Context, lease order.Lease, orderIDs []string) (int, error)
 }
@@ -6,26 +6,40 @@ import (
 	"time"
 
 	"github.com/ry461ch/loyalty_system/internal/config"
+	"github.com/ry461ch/loyalty_system/internal/helpers/retry"
 	"github.com/ry461ch/loyalty_system/internal/models/exceptions"
+	"github.com/ry461ch/loyalty_system/internal/models/order"
 	"github.com/ry461ch/loyalty_system/pkg/logging"
 )
 
 type OrderGetter struct {
 	orderService   WaitingOrdersGetterService
+	lease          order.Lease  // other instances skip orders claimed by this one until lease expires
+	backoff        retry.Policy // delay between checks of the same order
+	giveUpAfter    time.Duration
 	getOrdersLimit int
 	rateLimit      int
 }
 
 func NewOrderGetter(orderService WaitingOrdersGetterService, cfg *config.Config) *OrderGetter {
 	return &OrderGetter{
-		orderService:   orderService,
+		orderService: orderService,
+		lease: order.Lease{
+			Owner: cfg.InstanceID,
+			TTL:   cfg.OrderLeaseTTL,
+		},
+		backoff: retry.Policy{
+			BaseDelay: cfg.OrderRetryBaseDelay,
+			MaxDelay:  cfg.OrderRetryMaxDelay,
+		},
+		giveUpAfter:    cfg.OrderGiveUpAfter,
 		getOrdersLimit: cfg.OrderGetterOrdersLimit,
 		rateLimit:      cfg.OrderGetterRateLimit,
 	}
 }
 
 func (og *OrderGetter) getWaitingOrderIDsIteration(ctx context.Context, orderIDsChannel chan<- string, createdAt *time.Time) (*time.Time, error) {
-	waitingOrders, err := og.orderService.GetWaitingOrders(ctx, og.getOrdersLimit, createdAt)
+	waitingOrders, err := og.orderService.ClaimWaitingOrders(ctx, og.lease, og.backoff, og.getOrdersLimit, createdAt)
 	if createdAt != nil {
 		logging.Logger.Infof("Order Getter: got %d orders with createdAt less than %s", len(waitingOrders), createdAt.String())
 	} else {
@@ -36,9 +50,15 @@ func (og *OrderGetter) getWaitingOrderIDsIteration(ctx context.Context, orderIDs
 		return nil, err
 	}
 
-	for _, waitingOrder := range waitingOrders {
+	for idx, waitingOrder := range waitingOrders {
 		select {
 		case <-ctx.Done():
+			// the rest of the batch is never sent to accrual system
+			notSentIDs := make([]string, 0, len(waitingOrders)-idx)
+			for _, notSentOrder := range waitingOrders[idx:] {
+				notSentIDs = append(notSentIDs, notSentOrder.ID)
+			}
+			og.ReleaseOrders(context.WithoutCancel(ctx), notSentIDs)
 			return nil, exceptions.ErrGracefullyShutDown
 		case orderIDsChannel <- waitingOrder.ID:
 		}
@@ -55,6 +75,15 @@ func (og *OrderGetter) getWaitingOrderIDs(ctx context.Context, orderIDsChannel c
 	logging.Logger.Infof("Order Getter: initiated")
 	var createdAt *time.Time
 
+	if og.giveUpAfter > 0 {
+		givenUp, err := og.orderService.GiveUpWaitingOrders(ctx, og.giveUpAfter)
+		if err != nil {
+			logging.Logger.Errorf("Order Getter: exceptions occured while giving up stale orders: %s", err.Error())
+		} else if givenUp > 0 {
+			logging.Logger.Infof("Order Getter: gave up %d orders waiting longer than %s", givenUp, og.giveUpAfter.String())
+		}
+	}
+
 	for {
 		select {
 		case <-ctx.Done():
@@ -83,6 +112,17 @@ func (og *OrderGetter) getWaitingOrderIDs(ctx context.Context, orderIDsChannel c
 	}
 }
 
+// ReleaseOrders returns orders claimed by this instance but not checked, e.g. skipped by open circuit breaker,
+// without counting the claim as an attempt.
+func (og *OrderGetter) ReleaseOrders(ctx context.Context, orderIDs []string) {
+	released, err := og.orderService.ReleaseOrders(ctx, og.lease, orderIDs)
+	if err != nil {
+		logging.Logger.Errorf("Order Getter: exceptions occured while releasing orders: %s", err.Error())
+		return
+	}
+	logging.Logger.Infof("Order Getter: released %d not checked orders", released)
+}
+
 func (og *OrderGetter) GetWaitingOrderIdsGenerator(ctx context.Context) chan string {
 	orderIDsChannel := make(chan string)
 
@@ -2,16 +2,20 @@ package ordergetter
 
 import (
 	"context"
+	"strconv"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 
+	"github.com/ry461ch/loyalty_system/internal/models/balance"
 	"github.com/ry461ch/loyalty_system/internal/models/order"
 	"github.com/ry461ch/loyalty_system/internal/services/money"
 	"github.com/ry461ch/loyalty_system/internal/services/order"
 	"github.com/ry461ch/loyalty_system/internal/storage/memory/balances"
+	"github.com/ry461ch/loyalty_system/internal/storage/memory/ledger"
 	"github.com/ry461ch/loyalty_system/internal/storage/memory/orders"
 	"github.com/ry461ch/loyalty_system/internal/storage/memory/withdrawals"
 	"github.com/ry461ch/loyalty_system/pkg/logging"
@@ -48,10 +52,11 @@ func TestGetter(t *testing.T) {
 		}
 	}
 
-	moneyService := moneyservice.NewMoneyService(balanceStorage, withdrawalStorage)
+	moneyService := moneyservice.NewMoneyService(balanceStorage, withdrawalStorage, ledgermemstorage.NewLedgerMemStorage(), balance.Expiry{}, balance.Clawback{})
 	orderService := orderservice.NewOrderService(orderStorage, moneyService)
 	getter := OrderGetter{
 		orderService:   orderService,
+		lease:          order.Lease{Owner: "instance", TTL: time.Minute},
 		getOrdersLimit: 2,
 		rateLimit:      1,
 	}
@@ -72,3 +77,50 @@ func TestGetter(t *testing.T) {
 		}
 	}
 }
+
+func TestGettersClaimDisjointOrders(t *testing.T) {
+	logging.Initialize("INFO")
+	const ordersNum = 20
+
+	orderStorage := ordermemstorage.NewOrderMemStorage()
+	for idx := range ordersNum {
+		orderStorage.InsertOrder(context.TODO(), uuid.New(), strconv.Itoa(idx), nil)
+	}
+	moneyService := moneyservice.NewMoneyService(
+		balancememstorage.NewBalanceMemStorage(),
+		withdrawalmemstorage.NewWithdrawalMemStorage(),
+		ledgermemstorage.NewLedgerMemStorage(),
+		balance.Expiry{},
+		balance.Clawback{},
+	)
+	orderService := orderservice.NewOrderService(orderStorage, moneyService)
+
+	instances := []string{"instance-1", "instance-2"}
+	claimedOrders := make([][]string, len(instances))
+	var wg sync.WaitGroup
+	for idx, instanceID := range instances {
+		getter := OrderGetter{
+			orderService:   orderService,
+			lease:          order.Lease{Owner: instanceID, TTL: time.Minute},
+			getOrdersLimit: 3,
+			rateLimit:      100,
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for orderID := range getter.GetWaitingOrderIdsGenerator(context.TODO()) {
+				claimedOrders[idx] = append(claimedOrders[idx], orderID)
+			}
+		}()
+	}
+	wg.Wait()
+
+	allClaimedOrders := map[string]bool{}
+	for _, instanceOrders := range claimedOrders {
+		for _, orderID := range instanceOrders {
+			assert.False(t, allClaimedOrders[orderID], "order %s was claimed twice", orderID)
+			allClaimedOrders[orderID] = true
+		}
+	}
+	assert.Equal(t, ordersNum, len(allClaimedOrders), "not all orders were claimed")
+}
@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"regexp"
 	"strconv"
 	"sync"
 	"time"
@@ -16,82 +17,131 @@ import (
 	"github.com/ry461ch/loyalty_system/internal/models/exceptions"
 	"github.com/ry461ch/loyalty_system/internal/models/netaddr"
 	"github.com/ry461ch/loyalty_system/internal/models/order"
+	"github.com/ry461ch/loyalty_system/pkg/circuitbreaker"
 	"github.com/ry461ch/loyalty_system/pkg/logging"
+	"github.com/ry461ch/loyalty_system/pkg/ratelimit"
 )
 
+// limitBodyRegexp matches the body of 429 response of accrual service.
+var limitBodyRegexp = regexp.MustCompile(`No more than (\d+) requests per minute allowed`)
+
 type OrderSender struct {
 	accrualAddr *netaddr.NetAddress
-	workersNum  int // RateLimit
+	workersNum  int
+	limiter     *ratelimit.Limiter // shared by all workers
+	breaker     *circuitbreaker.Breaker
 	client      *resty.Client
 }
 
 func getClient(timeout time.Duration, retries int) *resty.Client {
+	// only transport errors are retried here, 429 is handled by the limiter for the whole pool
 	return resty.New().
 		SetContentLength(true).
 		SetRetryCount(retries).
-		SetTimeout(timeout).
-		SetRetryAfter(func(client *resty.Client, resp *resty.Response) (time.Duration, error) {
-			// 429
-			if resp.StatusCode() == http.StatusTooManyRequests {
-				retryAfterStr := resp.Header().Get("Retry-After")
-				if retryAfterStr == "" {
-					return 0, fmt.Errorf("no Retry-After header came from accrual service")
-				}
-				retryAfter, err := strconv.Atoi(retryAfterStr)
-				if err != nil {
-					return 0, fmt.Errorf("bad Retry-After header came from accrual service")
-				}
-				return time.Duration(retryAfter) * time.Second, nil
-			}
-
-			// timeout or 5**
-			if resp.IsError() || resp.StatusCode() >= 500 {
-				return 0, nil
-			}
-
-			// 4**
-			return 0, fmt.Errorf("bad Request")
-		})
+		SetTimeout(timeout)
 }
 
 func NewOrderSender(cfg *config.Config) *OrderSender {
 	return &OrderSender{
 		accrualAddr: &cfg.AccuralSystemAddr,
 		workersNum:  cfg.OrderSenderRateLimit,
-		client:      getClient(cfg.OrderSenderAccrualTimeout, cfg.OrderSenderAccrualRetries),
+		limiter:     ratelimit.New(cfg.OrderSenderRPS, 1),
+		breaker: circuitbreaker.New(circuitbreaker.Settings{
+			FailureRatio: cfg.AccrualBreakerFailureRatio,
+			MinRequests:  cfg.AccrualBreakerMinRequests,
+			Interval:     cfg.AccrualBreakerInterval,
+			OpenTimeout:  cfg.AccrualBreakerOpenTimeout,
+			OnStateChange: func(from, to circuitbreaker.State) {
+				logging.Logger.Warnf("Order Sender: accrual circuit breaker changed state from %s to %s", from, to)
+			},
+		}),
+		client: getClient(cfg.OrderSenderAccrualTimeout, cfg.OrderSenderAccrualRetries),
 	}
 }
 
-func (os *OrderSender) getOrderFromAccrual(ctx context.Context, orderID string) (*order.Order, error) {
-	serverURL := "http://" + os.accrualAddr.Host + ":" + strconv.FormatInt(os.accrualAddr.Port, 10)
+// AccrualState returns the state of circuit breaker around accrual service.
+func (os *OrderSender) AccrualState() circuitbreaker.State {
+	return os.breaker.State()
+}
 
-	resp, err := os.client.R().SetContext(ctx).Get(serverURL + "/api/orders/" + orderID)
-	if err != nil {
-		return nil, err
+// throttle pauses all workers for Retry-After and lowers the rate to the one accrual service allows.
+func (os *OrderSender) throttle(resp *resty.Response) {
+	retryAfter, err := strconv.Atoi(resp.Header().Get("Retry-After"))
+	if err != nil || retryAfter <= 0 {
+		logging.Logger.Warnf("Order Sender: no valid Retry-After header came from accrual service, pause for 1 second")
+		retryAfter = 1
 	}
+	os.limiter.Pause(time.Duration(retryAfter) * time.Second)
 
-	if resp.StatusCode() > 400 && resp.StatusCode() < 500 {
-		return nil, fmt.Errorf("bad request, accrual returned %d", resp.StatusCode())
+	matches := limitBodyRegexp.FindSubmatch(resp.Body())
+	if matches == nil {
+		return
 	}
-
-	if resp.StatusCode() > 500 {
-		return nil, fmt.Errorf("accrual server unavailable")
+	requestsPerMinute, err := strconv.Atoi(string(matches[1]))
+	if err != nil || requestsPerMinute <= 0 {
+		return
 	}
-
-	if resp.StatusCode() == http.StatusNoContent {
-		return nil, nil
+	allowedRate := float64(requestsPerMinute) / 60
+	currentRate := os.limiter.Rate()
+	if currentRate <= 0 || allowedRate < currentRate {
+		logging.Logger.Infof("Order Sender: accrual service allows %d requests per minute, rate is lowered", requestsPerMinute)
+		os.limiter.SetRate(allowedRate)
 	}
+}
 
-	var updatedOrder order.Order
-	err = json.Unmarshal(resp.Body(), &updatedOrder)
-	if err != nil {
-		return nil, err
-	}
+func (os *OrderSender) getOrderFromAccrual(ctx context.Context, orderID string) (*order.Order, error) {
+	serverURL := "http://" + os.accrualAddr.Host + ":" + strconv.FormatInt(os.accrualAddr.Port, 10)
 
-	return &updatedOrder, nil
+	for {
+		err := os.limiter.Wait(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		err = os.breaker.Allow()
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := os.client.R().SetContext(ctx).Get(serverURL + "/api/orders/" + orderID)
+		if err != nil {
+			if ctx.Err() == nil {
+				os.breaker.Failure()
+			} else {
+				os.breaker.Cancel()
+			}
+			return nil, err
+		}
+		if resp.StatusCode() >= 500 {
+			os.breaker.Failure()
+			return nil, fmt.Errorf("accrual server unavailable, accrual returned %d", resp.StatusCode())
+		}
+		os.breaker.Success()
+
+		if resp.StatusCode() == http.StatusTooManyRequests {
+			os.throttle(resp)
+			continue
+		}
+
+		if resp.StatusCode() >= 400 {
+			return nil, fmt.Errorf("bad request, accrual returned %d", resp.StatusCode())
+		}
+
+		if resp.StatusCode() == http.StatusNoContent {
+			return nil, nil
+		}
+
+		var updatedOrder order.Order
+		err = json.Unmarshal(resp.Body(), &updatedOrder)
+		if err != nil {
+			return nil, err
+		}
+
+		return &updatedOrder, nil
+	}
 }
 
-func (os *OrderSender) getOrderFromAccrualWorker(ctx context.Context, workerID int, orderIDsChannel <-chan string, updatedOrders chan<- order.Order) error {
+func (os *OrderSender) getOrderFromAccrualWorker(ctx context.Context, workerID int, orderIDsChannel <-chan string, updatedOrders chan<- order.Order, skippedOrderIDs chan<- string) error {
 	for orderID := range orderIDsChannel {
 		select {
 		case <-ctx.Done():
@@ -100,19 +150,21 @@ func (os *OrderSender) getOrderFromAccrualWorker(ctx context.Context, workerID i
 		}
 
 		updatedOrder, err := os.getOrderFromAccrual(ctx, orderID)
-		if err != nil {
+		if errors.Is(err, circuitbreaker.ErrOpen) {
+			// state changes are logged by the breaker itself
+			logging.Logger.Debugf("Order Sender: orderID %s skipped: %v", orderID, err)
+			skippedOrderIDs <- orderID
+		} else if err != nil {
 			logging.Logger.Warnf("Order Sender: exceptions occured for orderID: %s: %v", orderID, err)
 		}
 		if updatedOrder != nil {
 			updatedOrders <- *updatedOrder
 		}
-
-		time.Sleep(time.Second)
 	}
 	return nil
 }
 
-func (os *OrderSender) sendOrders(ctx context.Context, orderIDsChannel <-chan string, updatedOrders chan<- order.Order) {
+func (os *OrderSender) sendOrders(ctx context.Context, orderIDsChannel <-chan string, updatedOrders chan<- order.Order, skippedOrderIDs chan<- string) {
 	logging.Logger.Infof("Order Sender: init with %d workers", os.workersNum)
 	var wg sync.WaitGroup
 	wg.Add(os.workersNum)
@@ -120,7 +172,7 @@ func (os *OrderSender) sendOrders(ctx context.Context, orderIDsChannel <-chan st
 	for w := 0; w < os.workersNum; w++ {
 		workerID := w
 		go func() {
-			err := os.getOrderFromAccrualWorker(ctx, workerID, orderIDsChannel, updatedOrders)
+			err := os.getOrderFromAccrualWorker(ctx, workerID, orderIDsChannel, updatedOrders, skippedOrderIDs)
 			if err != nil {
 				if errors.Is(err, exceptions.ErrGracefullyShutDown) {
 					logging.Logger.Infof("Order Sender:  worker %d gracefully shutdown", workerID)
@@ -140,12 +192,14 @@ func (os *OrderSender) sendOrders(ctx context.Context, orderIDsChannel <-chan st
 	logging.Logger.Info("Order Sender: gracefully shutdown")
 }
 
-func (os *OrderSender) SendOrdersGenerator(ctx context.Context, orderIDsChannel <-chan string) chan order.Order {
+// SendOrdersGenerator polls accrual system for every order, orders not polled because circuit breaker is open
+// are sent to skippedOrderIDs, the channel has to be read until the returned one is closed.
+func (os *OrderSender) SendOrdersGenerator(ctx context.Context, orderIDsChannel <-chan string, skippedOrderIDs chan<- string) chan order.Order {
 	updatedOrders := make(chan order.Order)
 
 	go func() {
 		defer close(updatedOrders)
-		os.sendOrders(ctx, orderIDsChannel, updatedOrders)
+		os.sendOrders(ctx, orderIDsChannel, updatedOrders, skippedOrderIDs)
 	}()
 
 	return updatedOrders
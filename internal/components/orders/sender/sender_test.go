@@ -7,15 +7,20 @@ import (
 	"net/http/httptest"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/stretchr/testify/assert"
 
+	"github.com/ry461ch/loyalty_system/internal/models/money"
 	"github.com/ry461ch/loyalty_system/internal/models/netaddr"
 	"github.com/ry461ch/loyalty_system/internal/models/order"
+	"github.com/ry461ch/loyalty_system/pkg/circuitbreaker"
 	"github.com/ry461ch/loyalty_system/pkg/logging"
+	"github.com/ry461ch/loyalty_system/pkg/ratelimit"
 )
 
 type MockServerStorage struct {
@@ -85,11 +90,13 @@ func TestSender(t *testing.T) {
 	sender := OrderSender{
 		accrualAddr: splitURL(srv.URL),
 		workersNum:  2,
+		limiter:     ratelimit.New(1, 1),
+		breaker:     circuitbreaker.New(circuitbreaker.Settings{FailureRatio: 1, MinRequests: 100}),
 		client:      getClient(time.Millisecond*500, 3),
 	}
 
 	start := time.Now().UTC()
-	updatedOrdersChannel := sender.SendOrdersGenerator(context.TODO(), orderIDsChannel)
+	updatedOrdersChannel := sender.SendOrdersGenerator(context.TODO(), orderIDsChannel, make(chan string, 3))
 
 	updatedOrders := map[string]order.Order{}
 	for updatedOrder := range updatedOrdersChannel {
@@ -98,7 +105,7 @@ func TestSender(t *testing.T) {
 	assert.GreaterOrEqual(t, time.Since(start), time.Second*2, "workers worked less than 2 seconds")
 	assert.Equal(t, 3, serverStorage.timesCalled, "Не прошел запрос на сервер")
 
-	accrual := float64(100)
+	accrual := money.New(100)
 	expectedOrders := []order.Order{
 		{
 			ID:      "1115",
@@ -120,3 +127,142 @@ func TestSender(t *testing.T) {
 		}
 	}
 }
+
+func TestSenderTooManyRequests(t *testing.T) {
+	logging.Initialize("INFO")
+	var mu sync.Mutex
+	var requestTimes []time.Time
+	router := chi.NewRouter()
+	router.Get("/api/orders/{order_id:[0-9]+}", func(res http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		requestTimes = append(requestTimes, time.Now())
+		isFirst := len(requestTimes) == 1
+		mu.Unlock()
+
+		if isFirst {
+			res.Header().Set("Retry-After", "1")
+			res.WriteHeader(http.StatusTooManyRequests)
+			res.Write([]byte("No more than 120 requests per minute allowed"))
+			return
+		}
+		resp, _ := json.Marshal(outputOrder{ID: chi.URLParam(req, "order_id"), Status: "INVALID"})
+		res.Write(resp)
+	})
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+
+	orderIDsChannel := make(chan string, 3)
+	orderIDsChannel <- "1115"
+	orderIDsChannel <- "1313"
+	orderIDsChannel <- "1214"
+	close(orderIDsChannel)
+
+	sender := OrderSender{
+		accrualAddr: splitURL(srv.URL),
+		workersNum:  3,
+		limiter:     ratelimit.New(100, 1),
+		breaker:     circuitbreaker.New(circuitbreaker.Settings{FailureRatio: 1, MinRequests: 100}),
+		client:      getClient(time.Millisecond*500, 3),
+	}
+
+	updatedOrders := map[string]order.Order{}
+	for updatedOrder := range sender.SendOrdersGenerator(context.TODO(), orderIDsChannel, make(chan string, 3)) {
+		updatedOrders[updatedOrder.ID] = updatedOrder
+	}
+
+	assert.Equal(t, 3, len(updatedOrders), "throttled order was lost")
+	assert.Equal(t, float64(2), sender.limiter.Rate(), "rate wasn't lowered")
+	mu.Lock()
+	defer mu.Unlock()
+	for _, requestTime := range requestTimes[1:] {
+		if requestTime.Sub(requestTimes[0]) < time.Millisecond*50 {
+			// requests which were sent before the first response came back
+			continue
+		}
+		assert.GreaterOrEqual(t, requestTime.Sub(requestTimes[0]), time.Millisecond*900, "request was sent during pause")
+	}
+}
+
+func TestSenderCircuitBreaker(t *testing.T) {
+	logging.Initialize("INFO")
+	var timesCalled atomic.Int64
+	router := chi.NewRouter()
+	router.Get("/api/orders/{order_id:[0-9]+}", func(res http.ResponseWriter, req *http.Request) {
+		timesCalled.Add(1)
+		res.WriteHeader(http.StatusServiceUnavailable)
+	})
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+
+	orderIDsChannel := make(chan string, 5)
+	for _, orderID := range []string{"1115", "1313", "1214", "1321", "1123"} {
+		orderIDsChannel <- orderID
+	}
+	close(orderIDsChannel)
+
+	sender := OrderSender{
+		accrualAddr: splitURL(srv.URL),
+		workersNum:  1,
+		limiter:     ratelimit.New(0, 1),
+		breaker: circuitbreaker.New(circuitbreaker.Settings{
+			FailureRatio: 0.5,
+			MinRequests:  2,
+			OpenTimeout:  time.Minute,
+		}),
+		client: getClient(time.Millisecond*500, 0),
+	}
+
+	skippedOrderIDs := make(chan string, 5)
+	updatedOrders := 0
+	for range sender.SendOrdersGenerator(context.TODO(), orderIDsChannel, skippedOrderIDs) {
+		updatedOrders++
+	}
+	close(skippedOrderIDs)
+	skippedOrders := []string{}
+	for orderID := range skippedOrderIDs {
+		skippedOrders = append(skippedOrders, orderID)
+	}
+
+	assert.Equal(t, 0, updatedOrders, "orders were updated by failing accrual")
+	assert.Equal(t, int64(2), timesCalled.Load(), "requests weren't short-circuited")
+	assert.Equal(t, []string{"1214", "1321", "1123"}, skippedOrders, "short-circuited orders weren't reported")
+	assert.Equal(t, circuitbreaker.Open, sender.AccrualState(), "breaker wasn't opened")
+}
+
+func TestSenderCancelledProbe(t *testing.T) {
+	logging.Initialize("INFO")
+	router := chi.NewRouter()
+	router.Get("/api/orders/{order_id:[0-9]+}", func(res http.ResponseWriter, req *http.Request) {
+		select {
+		case <-req.Context().Done():
+		case <-time.After(time.Second):
+		}
+		res.WriteHeader(http.StatusNoContent)
+	})
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+
+	breaker := circuitbreaker.New(circuitbreaker.Settings{
+		FailureRatio: 0.5,
+		MinRequests:  1,
+		OpenTimeout:  time.Millisecond * 10,
+	})
+	breaker.Allow()
+	breaker.Failure()
+	time.Sleep(time.Millisecond * 20)
+
+	sender := OrderSender{
+		accrualAddr: splitURL(srv.URL),
+		workersNum:  1,
+		limiter:     ratelimit.New(0, 1),
+		breaker:     breaker,
+		client:      getClient(time.Second*2, 0),
+	}
+
+	ctx, cancel := context.WithTimeout(context.TODO(), time.Millisecond*50)
+	defer cancel()
+	_, err := sender.getOrderFromAccrual(ctx, "1115")
+	assert.Error(t, err, "cancelled probe succeeded")
+	assert.Equal(t, circuitbreaker.HalfOpen, sender.AccrualState(), "cancelled probe changed state")
+	assert.NoError(t, breaker.Allow(), "breaker got stuck after cancelled probe")
+}
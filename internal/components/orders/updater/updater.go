@@ -41,7 +41,7 @@ func (ou *OrderUpdater) updateOrderWorker(ctx context.Context, workerID int, upd
 		err := ou.orderService.UpdateOrder(ctx, &updatedOrder)
 		if err != nil {
 			logging.Logger.Warnf("Order Updater: exceptions occured for orderID: %s: %s", updatedOrder.ID, err.Error())
-			return nil
+			continue
 		}
 
 		time.Sleep(time.Second)
@@ -9,10 +9,12 @@ import (
 	"github.com/stretchr/testify/assert"
 
 	"github.com/ry461ch/loyalty_system/internal/models/balance"
+	"github.com/ry461ch/loyalty_system/internal/models/money"
 	"github.com/ry461ch/loyalty_system/internal/models/order"
 	"github.com/ry461ch/loyalty_system/internal/services/money"
 	"github.com/ry461ch/loyalty_system/internal/services/order"
 	"github.com/ry461ch/loyalty_system/internal/storage/memory/balances"
+	"github.com/ry461ch/loyalty_system/internal/storage/memory/ledger"
 	"github.com/ry461ch/loyalty_system/internal/storage/memory/orders"
 	"github.com/ry461ch/loyalty_system/internal/storage/memory/withdrawals"
 	"github.com/ry461ch/loyalty_system/pkg/logging"
@@ -21,7 +23,7 @@ import (
 func TestUpdater(t *testing.T) {
 	logging.Initialize("INFO")
 	existingUserID := uuid.New()
-	accrual := float64(200)
+	accrual := money.New(200)
 	expectedOrders := []order.Order{
 		{
 			ID:     "1115",
@@ -38,8 +40,8 @@ func TestUpdater(t *testing.T) {
 		},
 	}
 	existingBalance := balance.Balance{
-		Current:   200,
-		Withdrawn: 200,
+		Current:   money.New(200),
+		Withdrawn: money.New(200),
 	}
 
 	orderStorage := ordermemstorage.NewOrderMemStorage()
@@ -57,7 +59,7 @@ func TestUpdater(t *testing.T) {
 	}
 	close(updatedOrdersChannel)
 
-	moneyService := moneyservice.NewMoneyService(balanceStorage, withdrawalStorage)
+	moneyService := moneyservice.NewMoneyService(balanceStorage, withdrawalStorage, ledgermemstorage.NewLedgerMemStorage(), balance.Expiry{}, balance.Clawback{})
 	orderService := orderservice.NewOrderService(orderStorage, moneyService)
 	updater := OrderUpdater{
 		orderService: orderService,
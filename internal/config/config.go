@@ -5,29 +5,75 @@ import (
 	"encoding/hex"
 	"flag"
 	"log"
+	"os"
+	"strings"
 	"time"
 
 	"github.com/caarlos0/env/v11"
 
 	"github.com/ry461ch/loyalty_system/internal/models/netaddr"
+	"github.com/ry461ch/loyalty_system/pkg/password"
+)
+
+const (
+	PostgresStorage = "postgres"
+	MemoryStorage   = "memory"
+)
+
+const (
+	ClawbackDebt = "debt"
+	ClawbackCap  = "cap"
 )
 
 type Config struct {
-	DBDsn                     string             `env:"DATABASE_URI"`
-	Addr                      netaddr.NetAddress `env:"RUN_ADDRESS"`
-	AccuralSystemAddr         netaddr.NetAddress `env:"ACCRUAL_SYSTEM_ADDRESS"`
-	LogLevel                  string             `env:"LOG_LEVEL"`
-	JWTSecretKey              string             `env:"SECRET_KEY"`
-	TokenExp                  time.Duration      `env:"TOKEN_EXP"`
-	ConnectionsLimit          int                `env:"CONNECTIONS_LIMIT"`
-	OrderUpdaterRateLimit     int                `env:"ORDER_UPDATER_RATE_LIMIT"`
-	OrderGetterOrdersLimit    int                `env:"ORDER_GETTER_ORDERS_LIMIT"`
-	OrderGetterRateLimit      int                `env:"ORDER_GETTER_RATE_LIMIT"`
-	OrderSenderRateLimit      int                `env:"ORDER_SENDER_RATE_LIMIT"`
-	OrderSenderAccrualTimeout time.Duration      `env:"ORDER_SENDER_ACCRUAL_TIMEOUT"`
-	OrderSenderAccrualRetries int                `env:"ORDER_SENDER_ACCRUAL_RETRIES"`
-	OrderEnricherTimeout      time.Duration      `env:"ORDER_ENRICHER_TIMEOUT"`
-	OrderEnricherPeriod       time.Duration      `env:"ORDER_ENRICHER_PERIOD"`
+	DBDsn                      string             `env:"DATABASE_URI"`
+	StorageType                string             `env:"STORAGE"`
+	Addr                       netaddr.NetAddress `env:"RUN_ADDRESS"`
+	AccuralSystemAddr          netaddr.NetAddress `env:"ACCRUAL_SYSTEM_ADDRESS"`
+	AccrualCallbackSecretKey   string             `env:"ACCRUAL_CALLBACK_SECRET_KEY"`
+	MerchantSecretKey          string             `env:"MERCHANT_SECRET_KEY"`
+	OpsSecretKey               string             `env:"OPS_SECRET_KEY"`
+	LogLevel                   string             `env:"LOG_LEVEL"`
+	JWTSecretKey               string             `env:"SECRET_KEY"`
+	JWTSigningKeyFile          string             `env:"JWT_SIGNING_KEY_FILE"`
+	JWTVerificationKeyFiles    []string           `env:"JWT_VERIFICATION_KEY_FILES" envSeparator:","`
+	TokenExp                   time.Duration      `env:"TOKEN_EXP"`
+	RefreshTokenExp            time.Duration      `env:"REFRESH_TOKEN_EXP"`
+	LoginFreeAttempts          int                `env:"LOGIN_FREE_ATTEMPTS"`
+	LoginAddrFreeAttempts      int                `env:"LOGIN_ADDR_FREE_ATTEMPTS"`
+	LoginBackoffBaseDelay      time.Duration      `env:"LOGIN_BACKOFF_BASE_DELAY"`
+	LoginLockout               time.Duration      `env:"LOGIN_LOCKOUT"`
+	LoginAttemptsWindow        time.Duration      `env:"LOGIN_ATTEMPTS_WINDOW"`
+	LoginAttemptsPrunerPeriod  time.Duration      `env:"LOGIN_ATTEMPTS_PRUNER_PERIOD"`
+	PasswordHashMemory         uint               `env:"PASSWORD_HASH_MEMORY"`
+	PasswordHashIterations     uint               `env:"PASSWORD_HASH_ITERATIONS"`
+	PasswordHashParallelism    uint               `env:"PASSWORD_HASH_PARALLELISM"`
+	ConnectionsLimit           int                `env:"CONNECTIONS_LIMIT"`
+	OrderUpdaterRateLimit      int                `env:"ORDER_UPDATER_RATE_LIMIT"`
+	OrderGetterOrdersLimit     int                `env:"ORDER_GETTER_ORDERS_LIMIT"`
+	OrderGetterRateLimit       int                `env:"ORDER_GETTER_RATE_LIMIT"`
+	OrderSenderRateLimit       int                `env:"ORDER_SENDER_RATE_LIMIT"`
+	OrderSenderRPS             float64            `env:"ORDER_SENDER_RPS"`
+	OrderSenderAccrualTimeout  time.Duration      `env:"ORDER_SENDER_ACCRUAL_TIMEOUT"`
+	OrderSenderAccrualRetries  int                `env:"ORDER_SENDER_ACCRUAL_RETRIES"`
+	AccrualBreakerFailureRatio float64            `env:"ACCRUAL_BREAKER_FAILURE_RATIO"`
+	AccrualBreakerMinRequests  int                `env:"ACCRUAL_BREAKER_MIN_REQUESTS"`
+	AccrualBreakerInterval     time.Duration      `env:"ACCRUAL_BREAKER_INTERVAL"`
+	AccrualBreakerOpenTimeout  time.Duration      `env:"ACCRUAL_BREAKER_OPEN_TIMEOUT"`
+	OrderEnricherTimeout       time.Duration      `env:"ORDER_ENRICHER_TIMEOUT"`
+	OrderEnricherPeriod        time.Duration      `env:"ORDER_ENRICHER_PERIOD"`
+	OrderLeaseTTL              time.Duration      `env:"ORDER_LEASE_TTL"`
+	OrderRetryBaseDelay        time.Duration      `env:"ORDER_RETRY_BASE_DELAY"`
+	OrderRetryMaxDelay         time.Duration      `env:"ORDER_RETRY_MAX_DELAY"`
+	OrderGiveUpAfter           time.Duration      `env:"ORDER_GIVE_UP_AFTER"`
+	PointsLifetime             int                `env:"POINTS_LIFETIME"`
+	PointsExpiringSoonWindow   time.Duration      `env:"POINTS_EXPIRING_SOON_WINDOW"`
+	PointExpirerPeriod         time.Duration      `env:"POINT_EXPIRER_PERIOD"`
+	PointExpirerTimeout        time.Duration      `env:"POINT_EXPIRER_TIMEOUT"`
+	PointExpirerBatchSize      int                `env:"POINT_EXPIRER_BATCH_SIZE"`
+	ClawbackPolicy             string             `env:"CLAWBACK_POLICY"`
+	InstanceID                 string             `env:"INSTANCE_ID"`
+	Args                       []string
 }
 
 func generateJWTKey() string {
@@ -36,6 +82,16 @@ func generateJWTKey() string {
 	return hex.EncodeToString(defaultSecretKey)
 }
 
+func generateInstanceID() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "gophermart"
+	}
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+	return hostname + "-" + hex.EncodeToString(suffix)
+}
+
 func New() *Config {
 	addr := netaddr.NetAddress{Host: "localhost", Port: 8080}
 	defaultSecretKey := make([]byte, 16)
@@ -44,30 +100,76 @@ func New() *Config {
 		LogLevel:     "INFO",
 		Addr:         addr,
 		JWTSecretKey: generateJWTKey(),
-		TokenExp:     time.Hour * 24,
+		TokenExp:     time.Minute * 15,
 	}
 	parseArgs(cfg)
 	parseEnv(cfg)
+	if cfg.StorageType == "" {
+		cfg.StorageType = defaultStorageType(cfg.DBDsn)
+	}
 	return cfg
 }
 
+func defaultStorageType(DBDsn string) string {
+	if DBDsn == "" {
+		return MemoryStorage
+	}
+	return PostgresStorage
+}
+
 func parseArgs(cfg *Config) {
 	flag.Var(&cfg.Addr, "a", "Net address host:port")
 	flag.Var(&cfg.AccuralSystemAddr, "r", "Net address of AccuralSystemService host:port")
+	flag.StringVar(&cfg.AccrualCallbackSecretKey, "accrual-callback-secret-key", "", "HMAC key of accrual system callbacks, empty disables callback endpoint")
+	flag.StringVar(&cfg.MerchantSecretKey, "merchant-secret-key", "", "HMAC key of merchant requests refunding withdrawals and returning orders, empty disables these endpoints")
+	flag.StringVar(&cfg.OpsSecretKey, "ops-secret-key", "", "HMAC key of operator requests to internal endpoints like status, empty disables these endpoints")
 	flag.StringVar(&cfg.DBDsn, "d", "", "database connection string")
+	flag.StringVar(&cfg.StorageType, "storage", "", "storage type: postgres or memory (default: memory if database connection string is empty)")
 	flag.StringVar(&cfg.LogLevel, "log-level", "INFO", "Log level")
 	flag.StringVar(&cfg.JWTSecretKey, "secret-key", generateJWTKey(), "jwt secret key")
-	flag.DurationVar(&cfg.TokenExp, "token-exp", time.Hour*24, "token expiration time")
+	flag.StringVar(&cfg.JWTSigningKeyFile, "jwt-signing-key-file", "", "PEM file with RSA or Ed25519 private key signing jwt, empty means HS256 with secret key")
+	flag.Func("jwt-verification-key-files", "comma separated PEM files with previous jwt keys still accepted for verification", func(value string) error {
+		cfg.JWTVerificationKeyFiles = strings.Split(value, ",")
+		return nil
+	})
+	flag.DurationVar(&cfg.TokenExp, "token-exp", time.Minute*15, "access token expiration time")
+	flag.DurationVar(&cfg.RefreshTokenExp, "refresh-token-exp", time.Hour*24*30, "refresh token expiration time, prolonged on every refresh")
+	flag.IntVar(&cfg.LoginFreeAttempts, "login-free-attempts", 5, "failed logins in a row for one login before delays start")
+	flag.IntVar(&cfg.LoginAddrFreeAttempts, "login-addr-free-attempts", 20, "failed logins in a row from one client address before delays start")
+	flag.DurationVar(&cfg.LoginBackoffBaseDelay, "login-backoff-base-delay", time.Second, "delay after the first failed login over free attempts, doubled for every next one")
+	flag.DurationVar(&cfg.LoginLockout, "login-lockout", time.Minute*15, "max delay between failed logins, i.e. lockout time")
+	flag.DurationVar(&cfg.LoginAttemptsWindow, "login-attempts-window", time.Hour, "time after which failed logins are forgotten")
+	flag.DurationVar(&cfg.LoginAttemptsPrunerPeriod, "login-attempts-pruner-period", time.Minute*10, "period of deleting forgotten failed logins")
+	flag.UintVar(&cfg.PasswordHashMemory, "password-hash-memory", uint(password.DefaultParams.Memory), "memory in KiB used by argon2id for password hashing")
+	flag.UintVar(&cfg.PasswordHashIterations, "password-hash-iterations", uint(password.DefaultParams.Iterations), "iterations of argon2id for password hashing")
+	flag.UintVar(&cfg.PasswordHashParallelism, "password-hash-parallelism", uint(password.DefaultParams.Parallelism), "threads used by argon2id for password hashing")
 	flag.IntVar(&cfg.ConnectionsLimit, "connections-limit", 100, "limit of postgres connections")
 	flag.DurationVar(&cfg.OrderEnricherPeriod, "order-enricher-period", time.Second*10, "period of running order enricher")
 	flag.DurationVar(&cfg.OrderEnricherTimeout, "order-enricher-timeout", time.Second*10, "timeout for one iteration in order enricher")
 	flag.IntVar(&cfg.OrderSenderAccrualRetries, "order-sender-accrual-retries", 3, "retries num for send orders to accrual service in order sender")
-	flag.IntVar(&cfg.OrderSenderRateLimit, "order-sender-rate-limit", 10, "rate limit for send orders to accrual service in order sender")
+	flag.IntVar(&cfg.OrderSenderRateLimit, "order-sender-rate-limit", 10, "num of workers sending orders to accrual service in order sender")
+	flag.Float64Var(&cfg.OrderSenderRPS, "order-sender-rps", 10, "requests per second to accrual service shared by all order sender workers, 0 disables limit")
 	flag.DurationVar(&cfg.OrderSenderAccrualTimeout, "order-sender-accrual-timeout", time.Millisecond*500, "timeout for single request in order sender")
+	flag.Float64Var(&cfg.AccrualBreakerFailureRatio, "accrual-breaker-failure-ratio", 0.5, "ratio of failed requests to accrual service which opens circuit breaker")
+	flag.IntVar(&cfg.AccrualBreakerMinRequests, "accrual-breaker-min-requests", 10, "min num of requests to accrual service before circuit breaker may open")
+	flag.DurationVar(&cfg.AccrualBreakerInterval, "accrual-breaker-interval", time.Minute, "period of resetting failure counters of closed circuit breaker")
+	flag.DurationVar(&cfg.AccrualBreakerOpenTimeout, "accrual-breaker-open-timeout", time.Second*30, "time after which open circuit breaker probes accrual service")
 	flag.IntVar(&cfg.OrderUpdaterRateLimit, "order-updater-rate-limit", 10, "rate limit for updating db in order updater")
 	flag.IntVar(&cfg.OrderGetterOrdersLimit, "order-getter-orders-limit", 1000, "num of orders in one iteration in order getter")
 	flag.IntVar(&cfg.OrderGetterRateLimit, "order-getter-rate-limit", 10, "rate limit for getting orders in order getter")
+	flag.DurationVar(&cfg.OrderLeaseTTL, "order-lease-ttl", time.Minute, "time for which orders claimed by order getter are hidden from other instances")
+	flag.DurationVar(&cfg.OrderRetryBaseDelay, "order-retry-base-delay", time.Second*10, "delay before the second check of an order in accrual service, doubled for every next check")
+	flag.DurationVar(&cfg.OrderRetryMaxDelay, "order-retry-max-delay", time.Hour, "max delay between checks of an order in accrual service")
+	flag.DurationVar(&cfg.OrderGiveUpAfter, "order-give-up-after", time.Hour*72, "time after which order not accepted by accrual system becomes INVALID, 0 disables giving up")
+	flag.IntVar(&cfg.PointsLifetime, "points-lifetime", 0, "months after accrual in which points expire, 0 disables expiration")
+	flag.DurationVar(&cfg.PointsExpiringSoonWindow, "points-expiring-soon-window", time.Hour*24*30, "points expiring within this time are shown as expiring soon in balance")
+	flag.DurationVar(&cfg.PointExpirerPeriod, "point-expirer-period", time.Minute, "period of running point expirer")
+	flag.DurationVar(&cfg.PointExpirerTimeout, "point-expirer-timeout", time.Second*30, "timeout for one iteration in point expirer")
+	flag.IntVar(&cfg.PointExpirerBatchSize, "point-expirer-batch-size", 100, "num of users whose points are expired in one transaction by point expirer")
+	flag.StringVar(&cfg.ClawbackPolicy, "clawback-policy", ClawbackDebt, "what to do with spent points of returned orders: debt repaid by next accruals or cap taking back at most current balance")
+	flag.StringVar(&cfg.InstanceID, "instance-id", generateInstanceID(), "unique id of this instance, used as owner of order leases")
 	flag.Parse()
+	cfg.Args = flag.Args()
 }
 
 func parseEnv(cfg *Config) {
@@ -75,4 +177,10 @@ func parseEnv(cfg *Config) {
 	if err != nil {
 		log.Fatalf("Can't parse env variables: %s", err)
 	}
+	if cfg.StorageType != "" && cfg.StorageType != PostgresStorage && cfg.StorageType != MemoryStorage {
+		log.Fatalf("Unknown storage type: %s", cfg.StorageType)
+	}
+	if cfg.ClawbackPolicy != ClawbackDebt && cfg.ClawbackPolicy != ClawbackCap {
+		log.Fatalf("Unknown clawback policy: %s", cfg.ClawbackPolicy)
+	}
 }
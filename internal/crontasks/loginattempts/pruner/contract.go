@@ -0,0 +1,7 @@
+package loginattemptpruner
+
+import "context"
+
+type LoginGuardService interface {
+	PruneAttempts(ctx context.Context) (int, error)
+}
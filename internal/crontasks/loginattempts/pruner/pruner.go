@@ -0,0 +1,47 @@
+package loginattemptpruner
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/ry461ch/loyalty_system/internal/config"
+	"github.com/ry461ch/loyalty_system/pkg/logging"
+)
+
+// LoginAttemptPruner deletes forgotten login attempts, every login string sent by clients leaves one.
+type LoginAttemptPruner struct {
+	loginGuardService LoginGuardService
+	iterationPeriod   time.Duration
+}
+
+func NewLoginAttemptPruner(loginGuardService LoginGuardService, cfg *config.Config) *LoginAttemptPruner {
+	return &LoginAttemptPruner{
+		loginGuardService: loginGuardService,
+		iterationPeriod:   cfg.LoginAttemptsPrunerPeriod,
+	}
+}
+
+func (lap *LoginAttemptPruner) runIteration(ctx context.Context) {
+	pruned, err := lap.loginGuardService.PruneAttempts(ctx)
+	if err != nil {
+		logging.Logger.Errorf("Login Attempt Pruner: internal error: %v", err)
+		return
+	}
+	logging.Logger.Infof("Login Attempt Pruner: %d keys pruned", pruned)
+}
+
+func (lap *LoginAttemptPruner) Run(ctx context.Context) error {
+	logging.Logger.Infof("Login Attempt Pruner: started")
+	ticker := time.NewTicker(lap.iterationPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return errors.New("login attempt pruner: graceful shutdown")
+		case <-ticker.C:
+			lap.runIteration(ctx)
+		}
+	}
+}
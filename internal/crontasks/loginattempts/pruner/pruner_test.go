@@ -0,0 +1,51 @@
+package loginattemptpruner
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ry461ch/loyalty_system/internal/config"
+	"github.com/ry461ch/loyalty_system/pkg/logging"
+)
+
+type mockLoginGuardService struct {
+	err         error
+	timesCalled int
+}
+
+func (m *mockLoginGuardService) PruneAttempts(ctx context.Context) (int, error) {
+	m.timesCalled += 1
+	if m.err != nil {
+		return 0, m.err
+	}
+	return 3, nil
+}
+
+func TestRunIteration(t *testing.T) {
+	logging.Initialize("INFO")
+
+	testCases := []struct {
+		testName          string
+		loginGuardService *mockLoginGuardService
+	}{
+		{
+			testName:          "pruned",
+			loginGuardService: &mockLoginGuardService{},
+		},
+		{
+			testName:          "failed prune",
+			loginGuardService: &mockLoginGuardService{err: errors.New("storage is down")},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			pruner := NewLoginAttemptPruner(tc.loginGuardService, &config.Config{})
+			pruner.runIteration(context.TODO())
+			assert.Equal(t, 1, tc.loginGuardService.timesCalled, "login guard calls don't match")
+		})
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 
 	"github.com/ry461ch/loyalty_system/internal/models/order"
+	"github.com/ry461ch/loyalty_system/pkg/circuitbreaker"
 )
 
 type OrderUpdater interface {
@@ -12,8 +13,10 @@ type OrderUpdater interface {
 
 type OrderGetter interface {
 	GetWaitingOrderIdsGenerator(ctx context.Context) chan string
+	ReleaseOrders(ctx context.Context, orderIDs []string)
 }
 
 type OrderSender interface {
-	SendOrdersGenerator(ctx context.Context, orderIDsChannel <-chan string) chan order.Order
+	SendOrdersGenerator(ctx context.Context, orderIDsChannel <-chan string, skippedOrderIDs chan<- string) chan order.Order
+	AccrualState() circuitbreaker.State
 }
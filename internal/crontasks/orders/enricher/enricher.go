@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/ry461ch/loyalty_system/internal/config"
+	"github.com/ry461ch/loyalty_system/pkg/circuitbreaker"
 	"github.com/ry461ch/loyalty_system/pkg/logging"
 )
 
@@ -33,13 +34,43 @@ func NewOrderEnricher(
 }
 
 func (oe *OrderEnricher) runIteration(ctx context.Context) {
+	if oe.orderSender.AccrualState() == circuitbreaker.Open {
+		logging.Logger.Warnf("Order Enricher: accrual circuit breaker is open, iteration skipped")
+		return
+	}
 	logging.Logger.Infof("Order Enricher: start iteration")
 
-	orderIDsChannel := oe.orderGetter.GetWaitingOrderIdsGenerator(ctx)
+	getterCtx, stopGetter := context.WithCancel(ctx)
+	defer stopGetter()
+	orderIDsChannel := oe.orderGetter.GetWaitingOrderIdsGenerator(getterCtx)
+
+	// orders skipped by the breaker opened during the iteration are claimed but never polled,
+	// no more orders are claimed and skipped ones are released without backoff
+	skippedOrderIDs := make(chan string)
+	skippedOrdersChannel := make(chan []string)
+	go func() {
+		skippedOrders := []string{}
+		for orderID := range skippedOrderIDs {
+			if len(skippedOrders) == 0 {
+				logging.Logger.Warnf("Order Enricher: accrual circuit breaker opened, stop claiming orders")
+				stopGetter()
+			}
+			skippedOrders = append(skippedOrders, orderID)
+		}
+		skippedOrdersChannel <- skippedOrders
+	}()
 
-	updatedOrders := oe.orderSender.SendOrdersGenerator(ctx, orderIDsChannel)
+	updatedOrders := oe.orderSender.SendOrdersGenerator(ctx, orderIDsChannel, skippedOrderIDs)
 
 	oe.orderUpdater.UpdateOrders(ctx, updatedOrders)
+	// updater stops on timeout, sender has to finish before skipped orders are collected
+	for range updatedOrders {
+	}
+	close(skippedOrderIDs)
+
+	if skippedOrders := <-skippedOrdersChannel; len(skippedOrders) > 0 {
+		oe.orderGetter.ReleaseOrders(context.WithoutCancel(ctx), skippedOrders)
+	}
 
 	logging.Logger.Infof("Order Enricher: end iteration")
 }
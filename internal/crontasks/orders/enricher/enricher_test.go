@@ -14,19 +14,32 @@ import (
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 
+	"github.com/ry461ch/loyalty_system/internal/accrual/handlers/goods"
+	"github.com/ry461ch/loyalty_system/internal/accrual/handlers/orders"
+	"github.com/ry461ch/loyalty_system/internal/accrual/models/order"
+	"github.com/ry461ch/loyalty_system/internal/accrual/models/reward"
+	"github.com/ry461ch/loyalty_system/internal/accrual/router"
+	"github.com/ry461ch/loyalty_system/internal/accrual/services/accrual"
+	"github.com/ry461ch/loyalty_system/internal/accrual/storage/memory/orders"
+	"github.com/ry461ch/loyalty_system/internal/accrual/storage/memory/rewards"
 	"github.com/ry461ch/loyalty_system/internal/components/orders/getter"
 	"github.com/ry461ch/loyalty_system/internal/components/orders/sender"
 	"github.com/ry461ch/loyalty_system/internal/components/orders/updater"
 	"github.com/ry461ch/loyalty_system/internal/config"
+	"github.com/ry461ch/loyalty_system/internal/helpers/retry"
 	"github.com/ry461ch/loyalty_system/internal/models/balance"
+	"github.com/ry461ch/loyalty_system/internal/models/money"
 	"github.com/ry461ch/loyalty_system/internal/models/netaddr"
 	"github.com/ry461ch/loyalty_system/internal/models/order"
 	"github.com/ry461ch/loyalty_system/internal/services/money"
 	"github.com/ry461ch/loyalty_system/internal/services/order"
 	"github.com/ry461ch/loyalty_system/internal/storage/memory/balances"
+	"github.com/ry461ch/loyalty_system/internal/storage/memory/ledger"
 	"github.com/ry461ch/loyalty_system/internal/storage/memory/orders"
 	"github.com/ry461ch/loyalty_system/internal/storage/memory/withdrawals"
+	"github.com/ry461ch/loyalty_system/pkg/circuitbreaker"
 	"github.com/ry461ch/loyalty_system/pkg/logging"
+	"github.com/ry461ch/loyalty_system/pkg/middlewares/throttle"
 )
 
 type MockServerStorage struct {
@@ -87,7 +100,7 @@ func TestEnricher(t *testing.T) {
 	srv := httptest.NewServer(router)
 	defer srv.Close()
 
-	accrual := float64(100)
+	accrual := money.New(100)
 	existingUserID := uuid.New()
 	existingOrders := []order.Order{
 		{
@@ -136,7 +149,7 @@ func TestEnricher(t *testing.T) {
 			orderStorage.UpdateOrder(context.TODO(), &existingOrder, nil)
 		}
 	}
-	moneyService := moneyservice.NewMoneyService(balanceStorage, withdrawalStorage)
+	moneyService := moneyservice.NewMoneyService(balanceStorage, withdrawalStorage, ledgermemstorage.NewLedgerMemStorage(), balance.Expiry{}, balance.Clawback{})
 	orderService := orderservice.NewOrderService(orderStorage, moneyService)
 
 	cfg := config.Config{
@@ -182,3 +195,211 @@ func TestEnricher(t *testing.T) {
 	userBalance, _ := balanceStorage.GetBalance(context.TODO(), existingUserID)
 	assert.Equal(t, expectedBalance, *userBalance, "balances not equal")
 }
+
+func TestEnricherWithAccrualService(t *testing.T) {
+	logging.Initialize("INFO")
+	accrualService := accrualservice.NewAccrualService(rewardmemstorage.NewRewardMemStorage(), accrualordermemstorage.NewOrderMemStorage())
+	accrualRouter := accrualrouter.NewRouter(
+		goodshandlers.NewGoodsHandlers(accrualService),
+		accrualorderhandlers.NewOrderHandlers(accrualService),
+		throttle.New(0),
+	)
+	srv := httptest.NewServer(accrualRouter)
+	defer srv.Close()
+
+	accrualService.RegisterReward(context.TODO(), &reward.Reward{Match: "Bork", Reward: 10, RewardType: reward.PERCENT})
+	for _, orderID := range []string{"1115", "1214"} {
+		accrualService.RegisterOrder(context.TODO(), &accrualorder.InputOrder{
+			ID:    orderID,
+			Goods: []accrualorder.Good{{Description: "Чайник Bork", Price: 7000}},
+		})
+	}
+	registeredOrders, _ := accrualService.PopRegisteredOrders(context.TODO(), 2)
+	accrualService.CalculateOrder(context.TODO(), &registeredOrders[0])
+
+	accrual := money.New(700)
+	existingUserID := uuid.New()
+	expectedOrders := []order.Order{
+		{
+			ID:      "1115",
+			Status:  order.PROCESSED,
+			Accrual: &accrual,
+		},
+		{
+			ID:     "1214",
+			Status: order.PROCESSING,
+		},
+		{
+			ID:     "1313",
+			Status: order.NEW,
+		},
+	}
+
+	orderStorage := ordermemstorage.NewOrderMemStorage()
+	balanceStorage := balancememstorage.NewBalanceMemStorage()
+	withdrawalStorage := withdrawalmemstorage.NewWithdrawalMemStorage()
+	for _, expectedOrder := range expectedOrders {
+		orderStorage.InsertOrder(context.TODO(), existingUserID, expectedOrder.ID, nil)
+	}
+	moneyService := moneyservice.NewMoneyService(balanceStorage, withdrawalStorage, ledgermemstorage.NewLedgerMemStorage(), balance.Expiry{}, balance.Clawback{})
+	orderService := orderservice.NewOrderService(orderStorage, moneyService)
+
+	cfg := config.Config{
+		AccuralSystemAddr:         *splitURL(srv.URL),
+		OrderUpdaterRateLimit:     10,
+		OrderGetterOrdersLimit:    10,
+		OrderGetterRateLimit:      1,
+		OrderSenderRateLimit:      3,
+		OrderSenderAccrualTimeout: time.Millisecond * 500,
+		OrderSenderAccrualRetries: 3,
+	}
+
+	sender := ordersender.NewOrderSender(&cfg)
+	updater := orderupdater.NewOrderUpdater(orderService, &cfg)
+	getter := ordergetter.NewOrderGetter(orderService, &cfg)
+
+	enricher := NewOrderEnricher(getter, sender, updater, &cfg)
+	enricher.runIteration(context.TODO())
+
+	updatedOrdersList, _ := orderStorage.GetUserOrders(context.TODO(), existingUserID)
+
+	updatedOrders := map[string]order.Order{}
+	for _, updatedOrder := range updatedOrdersList {
+		updatedOrders[updatedOrder.ID] = updatedOrder
+	}
+
+	for _, expectedOrder := range expectedOrders {
+		updatedOrder, ok := updatedOrders[expectedOrder.ID]
+		assert.True(t, ok, "orser was not in updated list")
+		assert.Equal(t, expectedOrder.Status, updatedOrder.Status, "statuses not equal")
+		assert.Equal(t, expectedOrder.Accrual, updatedOrder.Accrual, "accrual nor equal")
+	}
+
+	expectedBalance := balance.Balance{
+		Current:   accrual,
+		Withdrawn: 0,
+	}
+	userBalance, _ := balanceStorage.GetBalance(context.TODO(), existingUserID)
+	assert.Equal(t, expectedBalance, *userBalance, "balances not equal")
+}
+
+func TestEnricherReleasesOrdersWhenBreakerOpens(t *testing.T) {
+	logging.Initialize("INFO")
+	router := chi.NewRouter()
+	router.Get("/api/orders/{order_id:[0-9]+}", func(res http.ResponseWriter, req *http.Request) {
+		res.WriteHeader(http.StatusServiceUnavailable)
+	})
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+
+	existingUserID := uuid.New()
+	orderStorage := ordermemstorage.NewOrderMemStorage()
+	for _, orderID := range []string{"1115", "1321", "1214", "1313", "1123"} {
+		orderStorage.InsertOrder(context.TODO(), existingUserID, orderID, nil)
+	}
+	moneyService := moneyservice.NewMoneyService(balancememstorage.NewBalanceMemStorage(), withdrawalmemstorage.NewWithdrawalMemStorage(), ledgermemstorage.NewLedgerMemStorage(), balance.Expiry{}, balance.Clawback{})
+	orderService := orderservice.NewOrderService(orderStorage, moneyService)
+
+	cfg := config.Config{
+		AccuralSystemAddr:          *splitURL(srv.URL),
+		InstanceID:                 "instance",
+		OrderLeaseTTL:              time.Minute,
+		OrderRetryBaseDelay:        time.Minute,
+		OrderUpdaterRateLimit:      1,
+		OrderGetterOrdersLimit:     2,
+		OrderGetterRateLimit:       100,
+		OrderSenderRateLimit:       1,
+		OrderSenderAccrualTimeout:  time.Millisecond * 500,
+		AccrualBreakerFailureRatio: 0.5,
+		AccrualBreakerMinRequests:  2,
+		AccrualBreakerOpenTimeout:  time.Minute,
+	}
+
+	sender := ordersender.NewOrderSender(&cfg)
+	enricher := NewOrderEnricher(ordergetter.NewOrderGetter(orderService, &cfg), sender, orderupdater.NewOrderUpdater(orderService, &cfg), &cfg)
+	enricher.runIteration(context.TODO())
+	assert.Equal(t, circuitbreaker.Open, sender.AccrualState(), "breaker wasn't opened")
+
+	userOrders, _ := orderStorage.GetUserOrders(context.TODO(), existingUserID)
+	polledOrders := 0
+	for _, userOrder := range userOrders {
+		if userOrder.Attempts == 0 {
+			assert.Nil(t, userOrder.NextCheckAt, "not polled order was postponed")
+			continue
+		}
+		assert.Equal(t, 1, userOrder.Attempts, "attempts don't match")
+		polledOrders++
+	}
+	assert.Equal(t, 2, polledOrders, "only requests before breaker opened are attempts")
+
+	// leases of not polled orders are dropped, other instance claims them right away
+	claimedOrders, _ := orderStorage.ClaimWaitingOrders(context.TODO(), order.Lease{Owner: "other", TTL: time.Minute}, retry.Policy{}, 10, nil)
+	assert.Equal(t, 3, len(claimedOrders), "not polled orders weren't released")
+}
+
+type mockOrderGetter struct {
+	timesCalled int
+}
+
+func (m *mockOrderGetter) GetWaitingOrderIdsGenerator(ctx context.Context) chan string {
+	m.timesCalled++
+	orderIDsChannel := make(chan string)
+	close(orderIDsChannel)
+	return orderIDsChannel
+}
+
+func (m *mockOrderGetter) ReleaseOrders(ctx context.Context, orderIDs []string) {}
+
+type mockOrderSender struct {
+	state circuitbreaker.State
+}
+
+func (m *mockOrderSender) SendOrdersGenerator(ctx context.Context, orderIDsChannel <-chan string, skippedOrderIDs chan<- string) chan order.Order {
+	updatedOrders := make(chan order.Order)
+	close(updatedOrders)
+	return updatedOrders
+}
+
+func (m *mockOrderSender) AccrualState() circuitbreaker.State {
+	return m.state
+}
+
+type mockOrderUpdater struct{}
+
+func (m *mockOrderUpdater) UpdateOrders(ctx context.Context, updatedOrders <-chan order.Order) {}
+
+func TestEnricherSkipsIterationWhenBreakerOpen(t *testing.T) {
+	logging.Initialize("INFO")
+
+	testCases := []struct {
+		testName            string
+		state               circuitbreaker.State
+		expectedGetterCalls int
+	}{
+		{
+			testName:            "closed breaker",
+			state:               circuitbreaker.Closed,
+			expectedGetterCalls: 1,
+		},
+		{
+			testName:            "half-open breaker lets probe through",
+			state:               circuitbreaker.HalfOpen,
+			expectedGetterCalls: 1,
+		},
+		{
+			testName:            "open breaker",
+			state:               circuitbreaker.Open,
+			expectedGetterCalls: 0,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			getter := &mockOrderGetter{}
+			enricher := NewOrderEnricher(getter, &mockOrderSender{state: tc.state}, &mockOrderUpdater{}, &config.Config{})
+
+			enricher.runIteration(context.TODO())
+			assert.Equal(t, tc.expectedGetterCalls, getter.timesCalled, "getter calls don't match")
+		})
+	}
+}
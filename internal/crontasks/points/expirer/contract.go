@@ -0,0 +1,10 @@
+package pointexpirer
+
+import (
+	"context"
+	"time"
+)
+
+type MoneyService interface {
+	ExpirePoints(ctx context.Context, expiredAt time.Time, limit int) (int, error)
+}
@@ -0,0 +1,65 @@
+package pointexpirer
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/ry461ch/loyalty_system/internal/config"
+	"github.com/ry461ch/loyalty_system/pkg/logging"
+)
+
+type PointExpirer struct {
+	moneyService     MoneyService
+	batchSize        int
+	iterationTimeout time.Duration
+	iterationPeriod  time.Duration
+}
+
+func NewPointExpirer(moneyService MoneyService, cfg *config.Config) *PointExpirer {
+	return &PointExpirer{
+		moneyService:     moneyService,
+		batchSize:        cfg.PointExpirerBatchSize,
+		iterationTimeout: cfg.PointExpirerTimeout,
+		iterationPeriod:  cfg.PointExpirerPeriod,
+	}
+}
+
+// runIteration expires points batch by batch until there are no expired lots left,
+// every batch is a separate transaction so a failure doesn't roll back the previous ones.
+func (pe *PointExpirer) runIteration(ctx context.Context) {
+	logging.Logger.Infof("Point Expirer: start iteration")
+
+	expiredAt := time.Now().UTC()
+	expiredLots := 0
+	for ctx.Err() == nil {
+		expired, err := pe.moneyService.ExpirePoints(ctx, expiredAt, pe.batchSize)
+		if err != nil {
+			logging.Logger.Errorf("Point Expirer: internal error: %v", err)
+			break
+		}
+		expiredLots += expired
+		if expired == 0 {
+			break
+		}
+	}
+
+	logging.Logger.Infof("Point Expirer: end iteration, %d lots expired", expiredLots)
+}
+
+func (pe *PointExpirer) Run(ctx context.Context) error {
+	logging.Logger.Infof("Point Expirer: started")
+	ticker := time.NewTicker(pe.iterationPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return errors.New("point expirer: graceful shutdown")
+		case <-ticker.C:
+			iterationCtx, iterationCtxCancel := context.WithTimeout(ctx, pe.iterationTimeout)
+			pe.runIteration(iterationCtx)
+			iterationCtxCancel()
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package pointexpirer
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ry461ch/loyalty_system/internal/config"
+	"github.com/ry461ch/loyalty_system/pkg/logging"
+)
+
+type mockMoneyService struct {
+	batches     []int
+	err         error
+	timesCalled int
+}
+
+func (m *mockMoneyService) ExpirePoints(ctx context.Context, expiredAt time.Time, limit int) (int, error) {
+	m.timesCalled += 1
+	if m.err != nil {
+		return 0, m.err
+	}
+	if len(m.batches) == 0 {
+		return 0, nil
+	}
+	expired := m.batches[0]
+	m.batches = m.batches[1:]
+	return expired, nil
+}
+
+func TestRunIteration(t *testing.T) {
+	logging.Initialize("INFO")
+
+	testCases := []struct {
+		testName            string
+		moneyService        *mockMoneyService
+		expectedTimesCalled int
+	}{
+		{
+			testName:            "nothing expired",
+			moneyService:        &mockMoneyService{},
+			expectedTimesCalled: 1,
+		},
+		{
+			testName:            "batches until nothing left",
+			moneyService:        &mockMoneyService{batches: []int{10, 10, 3}},
+			expectedTimesCalled: 4,
+		},
+		{
+			testName:            "failed batch stops iteration",
+			moneyService:        &mockMoneyService{err: errors.New("storage is down")},
+			expectedTimesCalled: 1,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			expirer := NewPointExpirer(tc.moneyService, &config.Config{PointExpirerBatchSize: 10})
+			expirer.runIteration(context.TODO())
+			assert.Equal(t, tc.expectedTimesCalled, tc.moneyService.timesCalled, "money service calls don't match")
+		})
+	}
+}
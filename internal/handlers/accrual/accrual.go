@@ -0,0 +1,57 @@
+package accrualhandlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/ry461ch/loyalty_system/internal/models/exceptions"
+	"github.com/ry461ch/loyalty_system/internal/models/order"
+	"github.com/ry461ch/loyalty_system/pkg/logging"
+)
+
+type AccrualHandlers struct {
+	orderService OrderService
+}
+
+func NewAccrualHandlers(orderService OrderService) *AccrualHandlers {
+	return &AccrualHandlers{
+		orderService: orderService,
+	}
+}
+
+// PostCallback applies order status pushed by accrual system, the body has the same format
+// as GET /api/orders/{number} response of accrual system.
+func (ah *AccrualHandlers) PostCallback(res http.ResponseWriter, req *http.Request) {
+	reqBody, err := io.ReadAll(req.Body)
+	if err != nil {
+		res.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	var updatedOrder order.Order
+	err = json.Unmarshal(reqBody, &updatedOrder)
+	if err != nil || updatedOrder.ID == "" {
+		res.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	err = ah.orderService.UpdateOrder(req.Context(), &updatedOrder)
+	if err == nil {
+		res.WriteHeader(http.StatusOK)
+		return
+	}
+
+	switch {
+	case errors.Is(err, exceptions.ErrOrderNotFound):
+		res.WriteHeader(http.StatusNotFound)
+	case errors.Is(err, exceptions.ErrOrderBadStatusTransition):
+		res.WriteHeader(http.StatusConflict)
+	case errors.Is(err, exceptions.ErrBalanceBadAmountFormat):
+		res.WriteHeader(http.StatusBadRequest)
+	default:
+		logging.Logger.Errorf("Accrual callback: internal error: %v", err)
+		res.WriteHeader(http.StatusInternalServerError)
+	}
+}
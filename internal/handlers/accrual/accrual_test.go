@@ -0,0 +1,121 @@
+package accrualhandlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-resty/resty/v2"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ry461ch/loyalty_system/internal/models/balance"
+	"github.com/ry461ch/loyalty_system/internal/models/money"
+	"github.com/ry461ch/loyalty_system/internal/models/order"
+	"github.com/ry461ch/loyalty_system/internal/services/money"
+	"github.com/ry461ch/loyalty_system/internal/services/order"
+	"github.com/ry461ch/loyalty_system/internal/storage/memory/balances"
+	"github.com/ry461ch/loyalty_system/internal/storage/memory/ledger"
+	"github.com/ry461ch/loyalty_system/internal/storage/memory/orders"
+	"github.com/ry461ch/loyalty_system/internal/storage/memory/withdrawals"
+	"github.com/ry461ch/loyalty_system/pkg/logging"
+)
+
+func TestPostCallback(t *testing.T) {
+	logging.Initialize("INFO")
+	existingUserID := uuid.New()
+	processedOrderID := "1321"
+
+	testCases := []struct {
+		testName        string
+		body            string
+		expectedCode    int
+		expectedStatus  order.Status
+		expectedBalance balance.Balance
+	}{
+		{
+			testName:        "processed order",
+			body:            `{"order": "1115", "status": "PROCESSED", "accrual": 100.5}`,
+			expectedCode:    http.StatusOK,
+			expectedStatus:  order.PROCESSED,
+			expectedBalance: balance.Balance{Current: money.FromMinor(20050)},
+		},
+		{
+			testName:        "registered order",
+			body:            `{"order": "1115", "status": "REGISTERED"}`,
+			expectedCode:    http.StatusOK,
+			expectedStatus:  order.NEW,
+			expectedBalance: balance.Balance{Current: money.New(100)},
+		},
+		{
+			testName:        "invalid order",
+			body:            `{"order": "1115", "status": "INVALID"}`,
+			expectedCode:    http.StatusOK,
+			expectedStatus:  order.INVALID,
+			expectedBalance: balance.Balance{Current: money.New(100)},
+		},
+		{
+			testName:        "unknown order",
+			body:            `{"order": "1214", "status": "PROCESSED", "accrual": 100}`,
+			expectedCode:    http.StatusNotFound,
+			expectedStatus:  order.NEW,
+			expectedBalance: balance.Balance{Current: money.New(100)},
+		},
+		{
+			testName:        "bad status",
+			body:            `{"order": "1115", "status": "DONE"}`,
+			expectedCode:    http.StatusBadRequest,
+			expectedStatus:  order.NEW,
+			expectedBalance: balance.Balance{Current: money.New(100)},
+		},
+		{
+			testName:        "empty order number",
+			body:            `{"status": "PROCESSED", "accrual": 100}`,
+			expectedCode:    http.StatusBadRequest,
+			expectedStatus:  order.NEW,
+			expectedBalance: balance.Balance{Current: money.New(100)},
+		},
+		{
+			testName:        "repeated callback for processed order",
+			body:            `{"order": "1321", "status": "PROCESSED", "accrual": 100}`,
+			expectedCode:    http.StatusConflict,
+			expectedStatus:  order.NEW,
+			expectedBalance: balance.Balance{Current: money.New(100)},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			orderStorage := ordermemstorage.NewOrderMemStorage()
+			balanceStorage := balancememstorage.NewBalanceMemStorage()
+			moneyService := moneyservice.NewMoneyService(balanceStorage, withdrawalmemstorage.NewWithdrawalMemStorage(), ledgermemstorage.NewLedgerMemStorage(), balance.Expiry{}, balance.Clawback{})
+			orderService := orderservice.NewOrderService(orderStorage, moneyService)
+			orderStorage.InsertOrder(context.TODO(), existingUserID, "1115", nil)
+			orderStorage.InsertOrder(context.TODO(), existingUserID, processedOrderID, nil)
+			accrual := money.New(100)
+			orderService.UpdateOrder(context.TODO(), &order.Order{ID: processedOrderID, Status: order.PROCESSED, Accrual: &accrual})
+
+			router := chi.NewRouter()
+			router.Post("/api/internal/accrual/callback", NewAccrualHandlers(orderService).PostCallback)
+			srv := httptest.NewServer(router)
+			defer srv.Close()
+
+			resp, _ := resty.New().R().
+				SetHeader("Content-Type", "application/json").
+				SetBody(tc.body).
+				Post(srv.URL + "/api/internal/accrual/callback")
+			assert.Equal(t, tc.expectedCode, resp.StatusCode(), "Код ответа не совпадает с ожидаемым")
+
+			userOrders, _ := orderService.GetUserOrders(context.TODO(), existingUserID)
+			for _, userOrder := range userOrders {
+				if userOrder.ID == "1115" {
+					assert.Equal(t, tc.expectedStatus, userOrder.Status, "statuses don't match")
+				}
+			}
+			userBalance, _ := balanceStorage.GetBalance(context.TODO(), existingUserID)
+			assert.Equal(t, tc.expectedBalance.Current, userBalance.Current, "balances don't match")
+		})
+	}
+}
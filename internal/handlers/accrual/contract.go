@@ -0,0 +1,11 @@
+package accrualhandlers
+
+import (
+	"context"
+
+	"github.com/ry461ch/loyalty_system/internal/models/order"
+)
+
+type OrderService interface {
+	UpdateOrder(ctx context.Context, inputOrder *order.Order) error
+}
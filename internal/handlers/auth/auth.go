@@ -4,20 +4,28 @@ import (
 	"encoding/json"
 	"errors"
 	"io"
+	"math"
+	"net"
 	"net/http"
+	"strconv"
+
+	"github.com/google/uuid"
 
 	"github.com/ry461ch/loyalty_system/internal/models/exceptions"
+	"github.com/ry461ch/loyalty_system/internal/models/session"
 	"github.com/ry461ch/loyalty_system/internal/models/user"
 	"github.com/ry461ch/loyalty_system/pkg/logging"
 )
 
 type AuthHandlers struct {
-	userService UserService
+	userService    UserService
+	sessionService SessionService
 }
 
-func NewAuthHandlers(userService UserService) *AuthHandlers {
+func NewAuthHandlers(userService UserService, sessionService SessionService) *AuthHandlers {
 	return &AuthHandlers{
-		userService: userService,
+		userService:    userService,
+		sessionService: sessionService,
 	}
 }
 
@@ -35,10 +43,9 @@ func (ah *AuthHandlers) Register(res http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	tokenStr, err := ah.userService.Register(req.Context(), &inputUser)
+	tokens, err := ah.userService.Register(req.Context(), &inputUser)
 	if err == nil {
-		res.Header().Set("Authorization", *tokenStr)
-		res.WriteHeader(http.StatusOK)
+		writeTokens(res, tokens)
 		return
 	}
 
@@ -65,15 +72,18 @@ func (ah *AuthHandlers) Login(res http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	tokenStr, err := ah.userService.Login(req.Context(), &inputUser)
+	tokens, err := ah.userService.Login(req.Context(), &inputUser, clientAddr(req))
 
 	if err == nil {
-		res.Header().Set("Authorization", *tokenStr)
-		res.WriteHeader(http.StatusOK)
+		writeTokens(res, tokens)
 		return
 	}
 
+	var lockedErr *exceptions.LockedError
 	switch {
+	case errors.As(err, &lockedErr):
+		res.Header().Set("Retry-After", strconv.FormatInt(int64(math.Ceil(lockedErr.RetryAfter.Seconds())), 10))
+		res.WriteHeader(http.StatusTooManyRequests)
 	case errors.Is(err, exceptions.ErrUserAuthentication):
 		res.WriteHeader(http.StatusUnauthorized)
 	default:
@@ -81,3 +91,161 @@ func (ah *AuthHandlers) Login(res http.ResponseWriter, req *http.Request) {
 		res.WriteHeader(http.StatusInternalServerError)
 	}
 }
+
+func (ah *AuthHandlers) Refresh(res http.ResponseWriter, req *http.Request) {
+	reqBody, err := io.ReadAll(req.Body)
+	if err != nil {
+		res.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	var refreshRequest session.RefreshRequest
+	err = json.Unmarshal(reqBody, &refreshRequest)
+	if err != nil {
+		res.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	tokens, err := ah.sessionService.Refresh(req.Context(), refreshRequest.RefreshToken)
+	if err == nil {
+		writeTokens(res, tokens)
+		return
+	}
+
+	switch {
+	case errors.Is(err, exceptions.ErrUserAuthentication):
+		res.WriteHeader(http.StatusUnauthorized)
+	default:
+		logging.Logger.Errorf("Refresh: internal error: %v", err)
+		res.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+func (ah *AuthHandlers) Logout(res http.ResponseWriter, req *http.Request) {
+	sessionID, err := uuid.Parse(req.Header.Get("X-Session-Id"))
+	if err != nil {
+		logging.Logger.Errorf("Logout: internal error: %v", err)
+		res.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	err = ah.sessionService.RevokeSession(req.Context(), sessionID)
+	if err != nil {
+		logging.Logger.Errorf("Logout: internal error: %v", err)
+		res.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	res.WriteHeader(http.StatusOK)
+}
+
+func (ah *AuthHandlers) LogoutAll(res http.ResponseWriter, req *http.Request) {
+	userID, err := uuid.Parse(req.Header.Get("X-User-Id"))
+	if err != nil {
+		logging.Logger.Errorf("Logout all: internal error: %v", err)
+		res.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	err = ah.sessionService.RevokeUserSessions(req.Context(), userID)
+	if err != nil {
+		logging.Logger.Errorf("Logout all: internal error: %v", err)
+		res.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	res.WriteHeader(http.StatusOK)
+}
+
+func (ah *AuthHandlers) ChangePassword(res http.ResponseWriter, req *http.Request) {
+	userID, err := uuid.Parse(req.Header.Get("X-User-Id"))
+	if err != nil {
+		logging.Logger.Errorf("Change password: internal error: %v", err)
+		res.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	sessionID, err := uuid.Parse(req.Header.Get("X-Session-Id"))
+	if err != nil {
+		logging.Logger.Errorf("Change password: internal error: %v", err)
+		res.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	reqBody, err := io.ReadAll(req.Body)
+	if err != nil {
+		res.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	var passwordChange user.PasswordChange
+	err = json.Unmarshal(reqBody, &passwordChange)
+	if err != nil {
+		res.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	err = ah.userService.ChangePassword(req.Context(), userID, sessionID, &passwordChange, clientAddr(req))
+	if err == nil {
+		res.WriteHeader(http.StatusOK)
+		return
+	}
+
+	var lockedErr *exceptions.LockedError
+	switch {
+	case errors.As(err, &lockedErr):
+		res.Header().Set("Retry-After", strconv.FormatInt(int64(math.Ceil(lockedErr.RetryAfter.Seconds())), 10))
+		res.WriteHeader(http.StatusTooManyRequests)
+	case errors.Is(err, exceptions.ErrUserAuthentication):
+		res.WriteHeader(http.StatusForbidden)
+	case errors.Is(err, exceptions.ErrUserNotFound):
+		res.WriteHeader(http.StatusUnauthorized)
+	default:
+		logging.Logger.Errorf("Change password: internal error: %v", err)
+		res.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+func (ah *AuthHandlers) DeleteUser(res http.ResponseWriter, req *http.Request) {
+	userID, err := uuid.Parse(req.Header.Get("X-User-Id"))
+	if err != nil {
+		logging.Logger.Errorf("Delete user: internal error: %v", err)
+		res.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	err = ah.userService.DeleteUser(req.Context(), userID)
+	if err == nil {
+		res.WriteHeader(http.StatusOK)
+		return
+	}
+
+	switch {
+	case errors.Is(err, exceptions.ErrUserNotFound):
+		res.WriteHeader(http.StatusUnauthorized)
+	default:
+		logging.Logger.Errorf("Delete user: internal error: %v", err)
+		res.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// clientAddr is the host of the direct peer, forwarding headers are ignored as they are set by the client.
+func clientAddr(req *http.Request) string {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+	return host
+}
+
+// writeTokens keeps access token in Authorization header for clients which don't read the body.
+func writeTokens(res http.ResponseWriter, tokens *session.Tokens) {
+	resp, err := json.Marshal(tokens)
+	if err != nil {
+		logging.Logger.Errorf("Write tokens: internal error: %v", err)
+		res.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	res.Header().Set("Authorization", tokens.AccessToken)
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(http.StatusOK)
+	res.Write(resp)
+}
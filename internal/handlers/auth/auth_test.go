@@ -12,20 +12,44 @@ import (
 	"github.com/go-resty/resty/v2"
 	"github.com/stretchr/testify/assert"
 
+	"github.com/ry461ch/loyalty_system/internal/helpers/retry"
+	"github.com/ry461ch/loyalty_system/internal/models/loginattempt"
+	"github.com/ry461ch/loyalty_system/internal/models/session"
 	"github.com/ry461ch/loyalty_system/internal/models/user"
+	"github.com/ry461ch/loyalty_system/internal/services/loginguard"
+	"github.com/ry461ch/loyalty_system/internal/services/session"
 	"github.com/ry461ch/loyalty_system/internal/services/user"
+	"github.com/ry461ch/loyalty_system/internal/storage/memory/loginattempts"
+	"github.com/ry461ch/loyalty_system/internal/storage/memory/sessions"
 	"github.com/ry461ch/loyalty_system/internal/storage/memory/users"
 	"github.com/ry461ch/loyalty_system/pkg/authentication"
 	"github.com/ry461ch/loyalty_system/pkg/logging"
+	"github.com/ry461ch/loyalty_system/pkg/password"
 )
 
 func mockRouter(authHandlers *AuthHandlers) chi.Router {
 	router := chi.NewRouter()
 	router.Post("/api/user/register", authHandlers.Register)
 	router.Post("/api/user/login", authHandlers.Login)
+	router.Post("/api/user/token/refresh", authHandlers.Refresh)
+	router.Post("/api/user/logout", authHandlers.Logout)
+	router.Post("/api/user/logout-all", authHandlers.LogoutAll)
+	router.Put("/api/user/password", authHandlers.ChangePassword)
+	router.Delete("/api/user", authHandlers.DeleteUser)
 	return router
 }
 
+var testPasswordParams = password.Params{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+
+func newTestLoginGuard() *loginguardservice.LoginGuardService {
+	limits := loginattempt.Limits{
+		FreeAttempts: 3,
+		Backoff:      retry.Policy{BaseDelay: time.Minute, MaxDelay: time.Hour},
+		Window:       time.Hour,
+	}
+	return loginguardservice.NewLoginGuardService(loginattemptmemstorage.NewLoginAttemptMemStorage(), limits, limits)
+}
+
 func TestRegister(t *testing.T) {
 	logging.Initialize("INFO")
 	existingUser := user.InputUser{
@@ -34,10 +58,11 @@ func TestRegister(t *testing.T) {
 	}
 
 	secretKey := "test_secret_key"
-	storage := usermemstorage.NewUserMemStorage()
+	storage := usermemstorage.NewUserMemStorage(sessionmemstorage.NewSessionMemStorage(), loginattemptmemstorage.NewLoginAttemptMemStorage())
 	authenticator := authentication.NewAuthenticator(secretKey, time.Hour)
-	userService := userservice.NewUserService(storage, authenticator)
-	handlers := NewAuthHandlers(userService)
+	sessionService := sessionservice.NewSessionService(sessionmemstorage.NewSessionMemStorage(), authenticator, time.Hour)
+	userService := userservice.NewUserService(storage, sessionService, newTestLoginGuard(), password.NewHasher(testPasswordParams))
+	handlers := NewAuthHandlers(userService, sessionService)
 	router := mockRouter(handlers)
 	srv := httptest.NewServer(router)
 	defer srv.Close()
@@ -99,10 +124,11 @@ func TestLogin(t *testing.T) {
 	}
 
 	secretKey := "test_secret_key"
-	storage := usermemstorage.NewUserMemStorage()
+	storage := usermemstorage.NewUserMemStorage(sessionmemstorage.NewSessionMemStorage(), loginattemptmemstorage.NewLoginAttemptMemStorage())
 	authenticator := authentication.NewAuthenticator(secretKey, time.Hour)
-	userService := userservice.NewUserService(storage, authenticator)
-	handlers := NewAuthHandlers(userService)
+	sessionService := sessionservice.NewSessionService(sessionmemstorage.NewSessionMemStorage(), authenticator, time.Hour)
+	userService := userservice.NewUserService(storage, sessionService, newTestLoginGuard(), password.NewHasher(testPasswordParams))
+	handlers := NewAuthHandlers(userService, sessionService)
 	router := mockRouter(handlers)
 	srv := httptest.NewServer(router)
 	defer srv.Close()
@@ -163,3 +189,249 @@ func TestLogin(t *testing.T) {
 		})
 	}
 }
+
+func TestRefresh(t *testing.T) {
+	logging.Initialize("INFO")
+	existingUser := user.InputUser{
+		Login:    "test",
+		Password: "test",
+	}
+
+	authenticator := authentication.NewAuthenticator("test_secret_key", time.Hour)
+	sessionService := sessionservice.NewSessionService(sessionmemstorage.NewSessionMemStorage(), authenticator, time.Hour)
+	userService := userservice.NewUserService(usermemstorage.NewUserMemStorage(sessionmemstorage.NewSessionMemStorage(), loginattemptmemstorage.NewLoginAttemptMemStorage()), sessionService, newTestLoginGuard(), password.NewHasher(testPasswordParams))
+	handlers := NewAuthHandlers(userService, sessionService)
+	router := mockRouter(handlers)
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+	client := resty.New()
+
+	tokens, _ := userService.Register(context.TODO(), &existingUser)
+
+	testCases := []struct {
+		testName     string
+		requestBody  string
+		expectedCode int
+	}{
+		{
+			testName:     "successful refresh",
+			requestBody:  `{"refresh_token": "` + tokens.RefreshToken + `"}`,
+			expectedCode: http.StatusOK,
+		},
+		{
+			testName:     "already used refresh token",
+			requestBody:  `{"refresh_token": "` + tokens.RefreshToken + `"}`,
+			expectedCode: http.StatusUnauthorized,
+		},
+		{
+			testName:     "unknown refresh token",
+			requestBody:  `{"refresh_token": "invalid_token"}`,
+			expectedCode: http.StatusUnauthorized,
+		},
+		{
+			testName:     "bad request",
+			requestBody:  `{}`,
+			expectedCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			resp, _ := client.R().
+				SetHeader("Content-Type", "application/json").
+				SetBody(tc.requestBody).
+				Execute(http.MethodPost, srv.URL+"/api/user/token/refresh")
+			assert.Equal(t, tc.expectedCode, resp.StatusCode(), "Код ответа не совпадает с ожидаемым")
+			if tc.expectedCode == http.StatusOK {
+				var newTokens session.Tokens
+				err := json.Unmarshal(resp.Body(), &newTokens)
+				assert.NoError(t, err, "invalid response body")
+				assert.Equal(t, newTokens.AccessToken, resp.Header().Get("Authorization"), "access tokens don't match")
+				assert.NotEqual(t, tokens.RefreshToken, newTokens.RefreshToken, "refresh token wasn't rotated")
+			}
+		})
+	}
+}
+
+func TestLogout(t *testing.T) {
+	logging.Initialize("INFO")
+	existingUser := user.InputUser{
+		Login:    "test",
+		Password: "test",
+	}
+
+	authenticator := authentication.NewAuthenticator("test_secret_key", time.Hour)
+	sessionService := sessionservice.NewSessionService(sessionmemstorage.NewSessionMemStorage(), authenticator, time.Hour)
+	userService := userservice.NewUserService(usermemstorage.NewUserMemStorage(sessionmemstorage.NewSessionMemStorage(), loginattemptmemstorage.NewLoginAttemptMemStorage()), sessionService, newTestLoginGuard(), password.NewHasher(testPasswordParams))
+	handlers := NewAuthHandlers(userService, sessionService)
+	router := mockRouter(handlers)
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+	client := resty.New()
+
+	firstTokens, _ := userService.Register(context.TODO(), &existingUser)
+	secondTokens, _ := userService.Login(context.TODO(), &existingUser, "127.0.0.1")
+	thirdTokens, _ := userService.Login(context.TODO(), &existingUser, "127.0.0.1")
+	firstClaims, _ := authenticator.GetClaims(firstTokens.AccessToken)
+	firstSessionID, _ := firstClaims.GetSessionID()
+	secondClaims, _ := authenticator.GetClaims(secondTokens.AccessToken)
+	thirdClaims, _ := authenticator.GetClaims(thirdTokens.AccessToken)
+	thirdSessionID, _ := thirdClaims.GetSessionID()
+
+	resp, _ := client.R().
+		SetHeader("X-Session-Id", firstSessionID.String()).
+		SetHeader("X-User-Id", firstClaims.UserID.String()).
+		Execute(http.MethodPost, srv.URL+"/api/user/logout")
+	assert.Equal(t, http.StatusOK, resp.StatusCode(), "Код ответа не совпадает с ожидаемым")
+	active, _ := sessionService.IsSessionActive(context.TODO(), firstSessionID)
+	assert.False(t, active, "session wasn't revoked")
+	active, _ = sessionService.IsSessionActive(context.TODO(), thirdSessionID)
+	assert.True(t, active, "another session was revoked")
+
+	resp, _ = client.R().
+		SetHeader("X-Session-Id", firstSessionID.String()).
+		SetHeader("X-User-Id", secondClaims.UserID.String()).
+		Execute(http.MethodPost, srv.URL+"/api/user/logout-all")
+	assert.Equal(t, http.StatusOK, resp.StatusCode(), "Код ответа не совпадает с ожидаемым")
+	active, _ = sessionService.IsSessionActive(context.TODO(), thirdSessionID)
+	assert.False(t, active, "session wasn't revoked")
+	_, err := sessionService.Refresh(context.TODO(), secondTokens.RefreshToken)
+	assert.Error(t, err, "refresh token of revoked session must be rejected")
+}
+
+func TestLoginLocked(t *testing.T) {
+	logging.Initialize("INFO")
+	existingUser := user.InputUser{
+		Login:    "test",
+		Password: "test",
+	}
+
+	authenticator := authentication.NewAuthenticator("test_secret_key", time.Hour)
+	sessionService := sessionservice.NewSessionService(sessionmemstorage.NewSessionMemStorage(), authenticator, time.Hour)
+	userService := userservice.NewUserService(usermemstorage.NewUserMemStorage(sessionmemstorage.NewSessionMemStorage(), loginattemptmemstorage.NewLoginAttemptMemStorage()), sessionService, newTestLoginGuard(), password.NewHasher(testPasswordParams))
+	handlers := NewAuthHandlers(userService, sessionService)
+	router := mockRouter(handlers)
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+	client := resty.New()
+
+	userService.Register(context.TODO(), &existingUser)
+	invalidReq, _ := json.Marshal(user.InputUser{Login: existingUser.Login, Password: "invalid_password"})
+	validReq, _ := json.Marshal(existingUser)
+
+	expectedCodes := []int{http.StatusUnauthorized, http.StatusUnauthorized, http.StatusUnauthorized, http.StatusUnauthorized, http.StatusTooManyRequests}
+	for _, expectedCode := range expectedCodes {
+		resp, _ := client.R().
+			SetHeader("Content-Type", "application/json").
+			SetBody(invalidReq).
+			Execute(http.MethodPost, srv.URL+"/api/user/login")
+		assert.Equal(t, expectedCode, resp.StatusCode(), "Код ответа не совпадает с ожидаемым")
+	}
+
+	resp, _ := client.R().
+		SetHeader("Content-Type", "application/json").
+		SetBody(validReq).
+		Execute(http.MethodPost, srv.URL+"/api/user/login")
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode(), "valid password mustn't be checked while locked")
+	assert.Equal(t, "60", resp.Header().Get("Retry-After"), "unexpected Retry-After")
+}
+
+func TestChangePassword(t *testing.T) {
+	logging.Initialize("INFO")
+	existingUser := user.InputUser{
+		Login:    "test",
+		Password: "test",
+	}
+
+	authenticator := authentication.NewAuthenticator("test_secret_key", time.Hour)
+	sessionService := sessionservice.NewSessionService(sessionmemstorage.NewSessionMemStorage(), authenticator, time.Hour)
+	userService := userservice.NewUserService(usermemstorage.NewUserMemStorage(sessionmemstorage.NewSessionMemStorage(), loginattemptmemstorage.NewLoginAttemptMemStorage()), sessionService, newTestLoginGuard(), password.NewHasher(testPasswordParams))
+	handlers := NewAuthHandlers(userService, sessionService)
+	router := mockRouter(handlers)
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+	client := resty.New()
+
+	tokens, _ := userService.Register(context.TODO(), &existingUser)
+	claims, _ := authenticator.GetClaims(tokens.AccessToken)
+	sessionID, _ := claims.GetSessionID()
+
+	testCases := []struct {
+		testName     string
+		requestBody  string
+		expectedCode int
+	}{
+		{
+			testName:     "empty new password",
+			requestBody:  `{"current_password": "test", "new_password": ""}`,
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			testName:     "invalid json",
+			requestBody:  `{"current_password": "test"`,
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			testName:     "bad current password",
+			requestBody:  `{"current_password": "invalid_password", "new_password": "new_password"}`,
+			expectedCode: http.StatusForbidden,
+		},
+		{
+			testName:     "successfully changed",
+			requestBody:  `{"current_password": "test", "new_password": "new_password"}`,
+			expectedCode: http.StatusOK,
+		},
+		{
+			testName:     "old password after change",
+			requestBody:  `{"current_password": "test", "new_password": "another_password"}`,
+			expectedCode: http.StatusForbidden,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			resp, _ := client.R().
+				SetHeader("Content-Type", "application/json").
+				SetHeader("X-Session-Id", sessionID.String()).
+				SetHeader("X-User-Id", claims.UserID.String()).
+				SetBody(tc.requestBody).
+				Execute(http.MethodPut, srv.URL+"/api/user/password")
+			assert.Equal(t, tc.expectedCode, resp.StatusCode(), "Код ответа не совпадает с ожидаемым")
+		})
+	}
+}
+
+func TestDeleteUser(t *testing.T) {
+	logging.Initialize("INFO")
+	existingUser := user.InputUser{
+		Login:    "test",
+		Password: "test",
+	}
+
+	authenticator := authentication.NewAuthenticator("test_secret_key", time.Hour)
+	sessionService := sessionservice.NewSessionService(sessionmemstorage.NewSessionMemStorage(), authenticator, time.Hour)
+	userService := userservice.NewUserService(usermemstorage.NewUserMemStorage(sessionmemstorage.NewSessionMemStorage(), loginattemptmemstorage.NewLoginAttemptMemStorage()), sessionService, newTestLoginGuard(), password.NewHasher(testPasswordParams))
+	handlers := NewAuthHandlers(userService, sessionService)
+	router := mockRouter(handlers)
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+	client := resty.New()
+
+	tokens, _ := userService.Register(context.TODO(), &existingUser)
+	claims, _ := authenticator.GetClaims(tokens.AccessToken)
+	sessionID, _ := claims.GetSessionID()
+
+	resp, _ := client.R().
+		SetHeader("X-Session-Id", sessionID.String()).
+		SetHeader("X-User-Id", claims.UserID.String()).
+		Execute(http.MethodDelete, srv.URL+"/api/user")
+	assert.Equal(t, http.StatusOK, resp.StatusCode(), "Код ответа не совпадает с ожидаемым")
+	active, _ := sessionService.IsSessionActive(context.TODO(), sessionID)
+	assert.False(t, active, "session wasn't revoked")
+
+	resp, _ = client.R().
+		SetHeader("X-Session-Id", sessionID.String()).
+		SetHeader("X-User-Id", claims.UserID.String()).
+		Execute(http.MethodDelete, srv.URL+"/api/user")
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode(), "Код ответа не совпадает с ожидаемым")
+}
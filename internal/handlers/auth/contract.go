@@ -3,10 +3,21 @@ package authhandlers
 import (
 	"context"
 
+	"github.com/google/uuid"
+
+	"github.com/ry461ch/loyalty_system/internal/models/session"
 	"github.com/ry461ch/loyalty_system/internal/models/user"
 )
 
 type UserService interface {
-	Login(ctx context.Context, inputUser *user.InputUser) (*string, error)
-	Register(ctx context.Context, inputUser *user.InputUser) (*string, error)
+	Login(ctx context.Context, inputUser *user.InputUser, clientAddr string) (*session.Tokens, error)
+	Register(ctx context.Context, inputUser *user.InputUser) (*session.Tokens, error)
+	ChangePassword(ctx context.Context, userID uuid.UUID, sessionID uuid.UUID, passwordChange *user.PasswordChange, clientAddr string) error
+	DeleteUser(ctx context.Context, userID uuid.UUID) error
+}
+
+type SessionService interface {
+	Refresh(ctx context.Context, refreshToken string) (*session.Tokens, error)
+	RevokeSession(ctx context.Context, sessionID uuid.UUID) error
+	RevokeUserSessions(ctx context.Context, userID uuid.UUID) error
 }
@@ -0,0 +1,11 @@
+package handlers
+
+import (
+	"github.com/ry461ch/loyalty_system/internal/handlers/accrual"
+	"github.com/ry461ch/loyalty_system/internal/handlers/orders"
+)
+
+type OrderService interface {
+	orderhandlers.OrderService
+	accrualhandlers.OrderService
+}
@@ -0,0 +1,153 @@
+package exporthandlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/ry461ch/loyalty_system/internal/helpers/stream"
+	"github.com/ry461ch/loyalty_system/internal/models/exceptions"
+	"github.com/ry461ch/loyalty_system/internal/models/export"
+	"github.com/ry461ch/loyalty_system/pkg/logging"
+)
+
+type ExportHandlers struct {
+	exportService ExportService
+}
+
+func NewExportHandlers(exportService ExportService) *ExportHandlers {
+	return &ExportHandlers{
+		exportService: exportService,
+	}
+}
+
+// GetExport streams the whole history of the user without loading it in memory,
+// so an error after the first row can only be logged and the response is cut.
+func (eh *ExportHandlers) GetExport(res http.ResponseWriter, req *http.Request) {
+	userID, err := uuid.Parse(req.Header.Get("X-User-Id"))
+	if err != nil {
+		logging.Logger.Errorf("Export: internal error: %v", err)
+		res.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	format, query, err := parseExportQuery(req.URL.Query())
+	if err != nil {
+		res.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	entries, err := eh.exportService.Export(req.Context(), userID, query)
+	if err != nil {
+		if errors.Is(err, exceptions.ErrExportBadPeriod) {
+			res.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		logging.Logger.Errorf("Export: internal error: %v", err)
+		res.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	defer entries.Close()
+
+	// the first row is read before the status is sent, so failed queries are still reported with 500
+	hasEntries := entries.Next()
+	if !hasEntries && entries.Err() != nil {
+		logging.Logger.Errorf("Export: internal error: %v", entries.Err())
+		res.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	switch format {
+	case export.CSV:
+		res.Header().Set("Content-Type", "text/csv")
+	default:
+		res.Header().Set("Content-Type", "application/json")
+	}
+	res.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"loyalty-export.%s\"", format))
+	res.WriteHeader(http.StatusOK)
+
+	switch format {
+	case export.CSV:
+		err = writeCSV(res, entries, hasEntries)
+	default:
+		err = writeJSON(res, entries, hasEntries)
+	}
+	if err != nil {
+		logging.Logger.Errorf("Export: internal error: %v", err)
+	}
+}
+
+func writeCSV(res http.ResponseWriter, entries stream.Rows[export.Entry], hasEntries bool) error {
+	writer := csv.NewWriter(res)
+	err := writer.Write(export.CSVHeader)
+	if err != nil {
+		return err
+	}
+	for ; hasEntries; hasEntries = entries.Next() {
+		entry := entries.Value()
+		err = writer.Write(entry.CSVRecord())
+		if err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	if err = writer.Error(); err != nil {
+		return err
+	}
+	return entries.Err()
+}
+
+// writeJSON writes entries as a JSON array, the array isn't closed if the stream fails.
+func writeJSON(res http.ResponseWriter, entries stream.Rows[export.Entry], hasEntries bool) error {
+	_, err := res.Write([]byte("["))
+	if err != nil {
+		return err
+	}
+	for separator := ""; hasEntries; hasEntries = entries.Next() {
+		entry, err := json.Marshal(entries.Value())
+		if err != nil {
+			return err
+		}
+		_, err = res.Write(append([]byte(separator), entry...))
+		if err != nil {
+			return err
+		}
+		separator = ","
+	}
+	if err = entries.Err(); err != nil {
+		return err
+	}
+	_, err = res.Write([]byte("]"))
+	return err
+}
+
+// parseExportQuery reads format and period, from and to are RFC3339 timestamps.
+func parseExportQuery(values url.Values) (export.Format, export.Query, error) {
+	format, err := export.ParseFormat(values.Get("format"))
+	if err != nil {
+		return "", export.Query{}, err
+	}
+
+	query := export.Query{}
+	if from := values.Get("from"); from != "" {
+		parsedTime, err := time.Parse(time.RFC3339, from)
+		if err != nil {
+			return "", export.Query{}, err
+		}
+		query.From = &parsedTime
+	}
+	if to := values.Get("to"); to != "" {
+		parsedTime, err := time.Parse(time.RFC3339, to)
+		if err != nil {
+			return "", export.Query{}, err
+		}
+		query.To = &parsedTime
+	}
+	return format, query, nil
+}
@@ -0,0 +1,137 @@
+package exporthandlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-resty/resty/v2"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ry461ch/loyalty_system/internal/helpers/stream"
+	"github.com/ry461ch/loyalty_system/internal/models/export"
+	"github.com/ry461ch/loyalty_system/internal/models/money"
+	"github.com/ry461ch/loyalty_system/pkg/logging"
+)
+
+var errStorage = errors.New("storage is down")
+
+type brokenRows struct {
+	stream.Rows[export.Entry]
+}
+
+func (*brokenRows) Next() bool {
+	return false
+}
+
+func (*brokenRows) Err() error {
+	return errStorage
+}
+
+type MockExportService struct {
+	entries []export.Entry
+	broken  bool
+}
+
+func (mes *MockExportService) Export(ctx context.Context, userID uuid.UUID, query export.Query) (stream.Rows[export.Entry], error) {
+	err := query.Validate()
+	if err != nil {
+		return nil, err
+	}
+	if mes.broken {
+		return &brokenRows{stream.FromSlice(mes.entries)}, nil
+	}
+	return stream.FromSlice(mes.entries), nil
+}
+
+func mockRouter(exportHandlers *ExportHandlers) chi.Router {
+	router := chi.NewRouter()
+	router.Get("/api/user/export", exportHandlers.GetExport)
+	return router
+}
+
+func TestGetExport(t *testing.T) {
+	logging.Initialize("INFO")
+	uploadedAt := time.Date(2024, 9, 1, 12, 0, 0, 0, time.UTC)
+	amount := money.FromMinor(50050)
+	entries := []export.Entry{
+		{Type: export.ORDER, At: uploadedAt, OrderID: "1115", Status: "PROCESSED"},
+		{Type: export.ACCRUAL, At: uploadedAt.Add(time.Second), OrderID: "1115", Amount: &amount},
+	}
+
+	testCases := []struct {
+		testName            string
+		query               string
+		broken              bool
+		expectedCode        int
+		expectedContentType string
+		expectedBody        string
+	}{
+		{
+			testName:            "csv",
+			query:               "?format=csv",
+			expectedCode:        http.StatusOK,
+			expectedContentType: "text/csv",
+			expectedBody: "type,at,order,status,amount\n" +
+				"ORDER,2024-09-01T12:00:00Z,1115,PROCESSED,\n" +
+				"ACCRUAL,2024-09-01T12:00:01Z,1115,,500.5\n",
+		},
+		{
+			testName:            "json by default",
+			query:               "?from=2024-09-01T00:00:00Z",
+			expectedCode:        http.StatusOK,
+			expectedContentType: "application/json",
+			expectedBody: `[{"type":"ORDER","at":"2024-09-01T12:00:00Z","order":"1115","status":"PROCESSED"},` +
+				`{"type":"ACCRUAL","at":"2024-09-01T12:00:01Z","order":"1115","amount":500.5}]`,
+		},
+		{
+			testName:     "bad format",
+			query:        "?format=xml",
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			testName:     "bad period bound",
+			query:        "?to=tomorrow",
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			testName:     "empty period",
+			query:        "?from=2024-09-02T00:00:00Z&to=2024-09-01T00:00:00Z",
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			testName:     "storage failure before the first row",
+			query:        "?format=csv",
+			broken:       true,
+			expectedCode: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			handlers := NewExportHandlers(&MockExportService{entries: entries, broken: tc.broken})
+			srv := httptest.NewServer(mockRouter(handlers))
+			defer srv.Close()
+
+			resp, _ := resty.New().R().
+				SetHeader("X-User-Id", uuid.New().String()).
+				Execute(http.MethodGet, srv.URL+"/api/user/export"+tc.query)
+			assert.Equal(t, tc.expectedCode, resp.StatusCode(), "Код ответа не совпадает с ожидаемым")
+			if tc.expectedCode != http.StatusOK {
+				return
+			}
+
+			assert.Equal(t, tc.expectedContentType, resp.Header().Get("Content-Type"), "content types don't match")
+			assert.Equal(t, tc.expectedBody, string(resp.Body()), "bodies don't match")
+			if tc.expectedContentType == "application/json" {
+				assert.True(t, json.Valid(resp.Body()), "body isn't valid json")
+			}
+		})
+	}
+}
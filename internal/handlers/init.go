@@ -1,25 +1,41 @@
 package handlers
 
 import (
+	"github.com/ry461ch/loyalty_system/internal/handlers/accrual"
 	"github.com/ry461ch/loyalty_system/internal/handlers/auth"
+	"github.com/ry461ch/loyalty_system/internal/handlers/export"
+	"github.com/ry461ch/loyalty_system/internal/handlers/keys"
 	"github.com/ry461ch/loyalty_system/internal/handlers/money"
 	"github.com/ry461ch/loyalty_system/internal/handlers/orders"
+	"github.com/ry461ch/loyalty_system/internal/handlers/status"
 )
 
 type Handlers struct {
-	AuthHandlers   *authhandlers.AuthHandlers
-	MoneyHandlers  *moneyhandlers.MoneyHandlers
-	OrdersHandlers *orderhandlers.OrderHandlers
+	AccrualHandlers *accrualhandlers.AccrualHandlers
+	AuthHandlers    *authhandlers.AuthHandlers
+	ExportHandlers  *exporthandlers.ExportHandlers
+	KeysHandlers    *keyshandlers.KeysHandlers
+	MoneyHandlers   *moneyhandlers.MoneyHandlers
+	OrdersHandlers  *orderhandlers.OrderHandlers
+	StatusHandlers  *statushandlers.StatusHandlers
 }
 
 func NewHandlers(
 	moneyService moneyhandlers.MoneyService,
-	orderService orderhandlers.OrderService,
+	orderService OrderService,
 	userService authhandlers.UserService,
+	sessionService authhandlers.SessionService,
+	accrualStatus statushandlers.AccrualStatus,
+	keyProvider keyshandlers.KeyProvider,
+	exportService exporthandlers.ExportService,
 ) *Handlers {
 	return &Handlers{
-		AuthHandlers:   authhandlers.NewAuthHandlers(userService),
-		MoneyHandlers:  moneyhandlers.NewMoneyHandlers(moneyService),
-		OrdersHandlers: orderhandlers.NewOrderHandlers(orderService),
+		AccrualHandlers: accrualhandlers.NewAccrualHandlers(orderService),
+		AuthHandlers:    authhandlers.NewAuthHandlers(userService, sessionService),
+		ExportHandlers:  exporthandlers.NewExportHandlers(exportService),
+		KeysHandlers:    keyshandlers.NewKeysHandlers(keyProvider),
+		MoneyHandlers:   moneyhandlers.NewMoneyHandlers(moneyService),
+		OrdersHandlers:  orderhandlers.NewOrderHandlers(orderService),
+		StatusHandlers:  statushandlers.NewStatusHandlers(accrualStatus),
 	}
 }
@@ -0,0 +1,7 @@
+package keyshandlers
+
+import "github.com/ry461ch/loyalty_system/pkg/authentication"
+
+type KeyProvider interface {
+	JWKS() authentication.JWKSet
+}
@@ -0,0 +1,35 @@
+package keyshandlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/ry461ch/loyalty_system/pkg/logging"
+)
+
+// keys are rotated rarely, but verifiers should notice a new key within minutes
+const jwksCacheControl = "public, max-age=300"
+
+type KeysHandlers struct {
+	keyProvider KeyProvider
+}
+
+func NewKeysHandlers(keyProvider KeyProvider) *KeysHandlers {
+	return &KeysHandlers{
+		keyProvider: keyProvider,
+	}
+}
+
+func (kh *KeysHandlers) GetJWKS(res http.ResponseWriter, req *http.Request) {
+	resp, err := json.Marshal(kh.keyProvider.JWKS())
+	if err != nil {
+		logging.Logger.Errorf("Get jwks: internal error: %v", err)
+		res.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	res.Header().Set("Content-Type", "application/json")
+	res.Header().Set("Cache-Control", jwksCacheControl)
+	res.WriteHeader(http.StatusOK)
+	res.Write(resp)
+}
@@ -0,0 +1,61 @@
+package keyshandlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-resty/resty/v2"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ry461ch/loyalty_system/pkg/authentication"
+	"github.com/ry461ch/loyalty_system/pkg/logging"
+)
+
+type mockKeyProvider struct {
+	jwks authentication.JWKSet
+}
+
+func (m *mockKeyProvider) JWKS() authentication.JWKSet {
+	return m.jwks
+}
+
+func TestGetJWKS(t *testing.T) {
+	logging.Initialize("INFO")
+
+	testCases := []struct {
+		testName     string
+		jwks         authentication.JWKSet
+		expectedBody string
+	}{
+		{
+			testName:     "no public keys",
+			jwks:         authentication.JWKSet{Keys: []authentication.JWK{}},
+			expectedBody: `{"keys": []}`,
+		},
+		{
+			testName: "ed25519 key",
+			jwks: authentication.JWKSet{Keys: []authentication.JWK{
+				{Kty: "OKP", Crv: "Ed25519", X: "11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo", Kid: "kid_1", Alg: "EdDSA", Use: "sig"},
+			}},
+			expectedBody: `{"keys": [{"kty": "OKP", "crv": "Ed25519", "x": "11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo", "kid": "kid_1", "alg": "EdDSA", "use": "sig"}]}`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			router := chi.NewRouter()
+			router.Get("/.well-known/jwks.json", NewKeysHandlers(&mockKeyProvider{jwks: tc.jwks}).GetJWKS)
+			srv := httptest.NewServer(router)
+			defer srv.Close()
+
+			resp, err := resty.New().R().Get(srv.URL + "/.well-known/jwks.json")
+			assert.NoError(t, err, "unexpected error")
+			assert.Equal(t, http.StatusOK, resp.StatusCode(), "Код ответа не совпадает с ожидаемым")
+			assert.Equal(t, "application/json", resp.Header().Get("Content-Type"))
+			assert.Equal(t, jwksCacheControl, resp.Header().Get("Cache-Control"))
+			assert.JSONEq(t, tc.expectedBody, string(resp.Body()))
+		})
+	}
+}
@@ -5,12 +5,17 @@ import (
 
 	"github.com/google/uuid"
 
+	"github.com/ry461ch/loyalty_system/internal/helpers/pagination"
 	"github.com/ry461ch/loyalty_system/internal/models/balance"
+	"github.com/ry461ch/loyalty_system/internal/models/ledger"
 	"github.com/ry461ch/loyalty_system/internal/models/withdrawal"
 )
 
 type MoneyService interface {
-	GetWithdrawals(ctx context.Context, userID uuid.UUID) ([]withdrawal.Withdrawal, error)
+	ListWithdrawalsWithSummary(ctx context.Context, userID uuid.UUID, query withdrawal.ListQuery) ([]withdrawal.Withdrawal, *pagination.Cursor, *withdrawal.Summary, error)
 	GetBalance(ctx context.Context, userID uuid.UUID) (*balance.Balance, error)
 	Withdraw(ctx context.Context, withdrawal *withdrawal.Withdrawal) error
+	RefundWithdrawal(ctx context.Context, withdrawalID uuid.UUID) (*withdrawal.Withdrawal, error)
+	GetBalanceHistory(ctx context.Context, userID uuid.UUID) ([]ledger.Movement, error)
+	VerifyBalance(ctx context.Context, userID uuid.UUID) error
 }
@@ -3,11 +3,18 @@ package moneyhandlers
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"strconv"
+	"time"
 
+	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
 
+	"github.com/ry461ch/loyalty_system/internal/helpers/order"
+	"github.com/ry461ch/loyalty_system/internal/helpers/pagination"
 	"github.com/ry461ch/loyalty_system/internal/models/exceptions"
 	"github.com/ry461ch/loyalty_system/internal/models/withdrawal"
 	"github.com/ry461ch/loyalty_system/pkg/logging"
@@ -75,6 +82,54 @@ func (mh *MoneyHandlers) PostWithdrawal(res http.ResponseWriter, req *http.Reque
 	}
 }
 
+// PostRefund reverses the withdrawal on request of a merchant, the request is authenticated by its signature.
+func (mh *MoneyHandlers) PostRefund(res http.ResponseWriter, req *http.Request) {
+	withdrawalID, err := uuid.Parse(chi.URLParam(req, "id"))
+	if err != nil {
+		res.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	reqBody, err := io.ReadAll(req.Body)
+	if err != nil {
+		res.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	var refund withdrawal.Refund
+	err = json.Unmarshal(reqBody, &refund)
+	if err != nil || refund.WithdrawalID != withdrawalID {
+		res.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	refundedWithdrawal, err := mh.moneyService.RefundWithdrawal(req.Context(), withdrawalID)
+	if err != nil {
+		switch {
+		case errors.Is(err, exceptions.ErrWithdrawalNotFound):
+			res.WriteHeader(http.StatusNotFound)
+		case errors.Is(err, exceptions.ErrWithdrawalRefunded):
+			res.WriteHeader(http.StatusConflict)
+		default:
+			logging.Logger.Errorf("Refund: internal error: %v", err)
+			res.WriteHeader(http.StatusInternalServerError)
+		}
+		return
+	}
+	logging.Logger.Infof("Audit: withdrawal %s of user %s refunded", withdrawalID, refundedWithdrawal.UserID)
+
+	resp, err := json.Marshal(refundedWithdrawal)
+	if err != nil {
+		logging.Logger.Errorf("Refund: internal error: %v", err)
+		res.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(http.StatusOK)
+	res.Write(resp)
+}
+
 func (mh *MoneyHandlers) GetWithdrawals(res http.ResponseWriter, req *http.Request) {
 	userID, err := uuid.Parse(req.Header.Get("X-User-Id"))
 	if err != nil {
@@ -83,13 +138,21 @@ func (mh *MoneyHandlers) GetWithdrawals(res http.ResponseWriter, req *http.Reque
 		return
 	}
 
-	userWithdrawals, err := mh.moneyService.GetWithdrawals(req.Context(), userID)
+	query, err := parseWithdrawalsQuery(req.URL.Query())
+	if err != nil {
+		res.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	userWithdrawals, next, summary, err := mh.moneyService.ListWithdrawalsWithSummary(req.Context(), userID, query)
 	if err != nil {
 		logging.Logger.Errorf("Get withdrawals: internal error: %v", err)
 		res.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
+	res.Header().Set("X-Total-Count", strconv.Itoa(summary.Count))
+	res.Header().Set("X-Total-Sum", summary.Sum.String())
 	if len(userWithdrawals) == 0 {
 		res.WriteHeader(http.StatusNoContent)
 		return
@@ -102,6 +165,10 @@ func (mh *MoneyHandlers) GetWithdrawals(res http.ResponseWriter, req *http.Reque
 		return
 	}
 
+	if next != nil {
+		res.Header().Set("Link", fmt.Sprintf("<%s>; rel=\"next\"", pagination.NextLink(req.URL, *next)))
+		res.Header().Set("X-Next-Cursor", next.Encode())
+	}
 	res.Header().Set("Content-Type", "application/json")
 	res.WriteHeader(http.StatusOK)
 	res.Write(resp)
@@ -133,3 +200,99 @@ func (mh *MoneyHandlers) GetBalance(res http.ResponseWriter, req *http.Request)
 	res.WriteHeader(http.StatusOK)
 	res.Write(resp)
 }
+
+func (mh *MoneyHandlers) GetBalanceHistory(res http.ResponseWriter, req *http.Request) {
+	userID, err := uuid.Parse(req.Header.Get("X-User-Id"))
+	if err != nil {
+		logging.Logger.Errorf("Get balance history: internal error: %v", err)
+		res.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	movements, err := mh.moneyService.GetBalanceHistory(req.Context(), userID)
+	if err != nil {
+		logging.Logger.Errorf("Get balance history: internal error: %v", err)
+		res.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if len(movements) == 0 {
+		res.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	resp, err := json.Marshal(movements)
+	if err != nil {
+		logging.Logger.Errorf("Get balance history: internal error: %v", err)
+		res.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(http.StatusOK)
+	res.Write(resp)
+}
+
+// GetBalanceVerification compares the stored balance of the user with the one derived from the ledger,
+// it is called by operators, the request is authenticated by its signature.
+func (mh *MoneyHandlers) GetBalanceVerification(res http.ResponseWriter, req *http.Request) {
+	userID, err := uuid.Parse(chi.URLParam(req, "id"))
+	if err != nil {
+		res.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	err = mh.moneyService.VerifyBalance(req.Context(), userID)
+	if err != nil {
+		if !errors.Is(err, exceptions.ErrBalanceMismatch) {
+			logging.Logger.Errorf("Verify balance: internal error: %v", err)
+			res.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		logging.Logger.Warnf("Audit: balance of user %s: %v", userID, err)
+		res.Header().Set("Content-Type", "text/plain")
+		res.WriteHeader(http.StatusConflict)
+		res.Write([]byte(exceptions.ErrBalanceMismatch.Error()))
+		return
+	}
+
+	res.WriteHeader(http.StatusOK)
+}
+
+// parseWithdrawalsQuery reads page and filters, processed_from and processed_to are RFC3339 timestamps.
+func parseWithdrawalsQuery(values url.Values) (withdrawal.ListQuery, error) {
+	page, err := pagination.ParsePage(values)
+	if err != nil {
+		return withdrawal.ListQuery{}, err
+	}
+	if page.Cursor != nil {
+		// withdrawals are keyed by UUID, storages compare the cursor id as UUID
+		_, err := uuid.Parse(page.Cursor.ID)
+		if err != nil {
+			return withdrawal.ListQuery{}, exceptions.ErrPaginationBadCursor
+		}
+	}
+	query := withdrawal.ListQuery{Page: page}
+
+	if orderID := values.Get("order"); orderID != "" {
+		if !orderhelpers.ValidateOrderID(orderID) {
+			return withdrawal.ListQuery{}, exceptions.ErrOrderBadIDFormat
+		}
+		query.OrderID = orderID
+	}
+	if processedFrom := values.Get("processed_from"); processedFrom != "" {
+		parsedTime, err := time.Parse(time.RFC3339, processedFrom)
+		if err != nil {
+			return withdrawal.ListQuery{}, err
+		}
+		query.ProcessedFrom = &parsedTime
+	}
+	if processedTo := values.Get("processed_to"); processedTo != "" {
+		parsedTime, err := time.Parse(time.RFC3339, processedTo)
+		if err != nil {
+			return withdrawal.ListQuery{}, err
+		}
+		query.ProcessedTo = &parsedTime
+	}
+	return query, nil
+}
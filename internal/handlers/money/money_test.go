@@ -5,19 +5,26 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-resty/resty/v2"
 	"github.com/google/uuid"
+	_ "github.com/jackc/pgx/v5/stdlib"
 	"github.com/stretchr/testify/assert"
 
+	"github.com/ry461ch/loyalty_system/internal/helpers/pagination"
 	"github.com/ry461ch/loyalty_system/internal/models/balance"
+	"github.com/ry461ch/loyalty_system/internal/models/money"
 	"github.com/ry461ch/loyalty_system/internal/models/withdrawal"
 	"github.com/ry461ch/loyalty_system/internal/services/money"
 	"github.com/ry461ch/loyalty_system/internal/storage/memory/balances"
+	"github.com/ry461ch/loyalty_system/internal/storage/memory/ledger"
 	"github.com/ry461ch/loyalty_system/internal/storage/memory/withdrawals"
+	"github.com/ry461ch/loyalty_system/internal/storage/postgres"
 	"github.com/ry461ch/loyalty_system/pkg/logging"
 )
 
@@ -26,6 +33,9 @@ func mockRouter(moneyHandlers *MoneyHandlers) chi.Router {
 	router.Get("/api/user/balance", moneyHandlers.GetBalance)
 	router.Post("/api/user/balance/withdraw", moneyHandlers.PostWithdrawal)
 	router.Get("/api/user/withdrawals", moneyHandlers.GetWithdrawals)
+	router.Get("/api/user/balance/history", moneyHandlers.GetBalanceHistory)
+	router.Post("/api/user/withdrawals/{id}/refund", moneyHandlers.PostRefund)
+	router.Get("/api/internal/users/{id}/balance/verify", moneyHandlers.GetBalanceVerification)
 	return router
 }
 
@@ -33,8 +43,8 @@ func TestGetBalance(t *testing.T) {
 	logging.Initialize("INFO")
 	existingUserID := uuid.New()
 	existingBalance := balance.Balance{
-		Current:   200,
-		Withdrawn: 300,
+		Current:   money.New(200),
+		Withdrawn: money.New(300),
 	}
 	existingWithdrawalID := uuid.New()
 	createdAt := time.Now().UTC()
@@ -48,7 +58,7 @@ func TestGetBalance(t *testing.T) {
 
 	balanceStorage := balancememstorage.NewBalanceMemStorage()
 	withdrawalStorage := withdrawalmemstorage.NewWithdrawalMemStorage()
-	moneyService := moneyservice.NewMoneyService(balanceStorage, withdrawalStorage)
+	moneyService := moneyservice.NewMoneyService(balanceStorage, withdrawalStorage, ledgermemstorage.NewLedgerMemStorage(), balance.Expiry{}, balance.Clawback{})
 	handlers := NewMoneyHandlers(moneyService)
 	router := mockRouter(handlers)
 	srv := httptest.NewServer(router)
@@ -108,18 +118,18 @@ func TestGetWithdrawals(t *testing.T) {
 		ID:      &existingWithdrawalID1,
 		OrderID: "1115",
 		UserID:  &existingUserID,
-		Sum:     300,
+		Sum:     money.New(300),
 	}
 	existingWithdrawal2 := withdrawal.Withdrawal{
 		ID:      &existingWithdrawalID2,
 		UserID:  &existingUserID,
 		OrderID: "1321",
-		Sum:     200,
+		Sum:     money.New(200),
 	}
 
 	balanceStorage := balancememstorage.NewBalanceMemStorage()
 	withdrawalStorage := withdrawalmemstorage.NewWithdrawalMemStorage()
-	moneyService := moneyservice.NewMoneyService(balanceStorage, withdrawalStorage)
+	moneyService := moneyservice.NewMoneyService(balanceStorage, withdrawalStorage, ledgermemstorage.NewLedgerMemStorage(), balance.Expiry{}, balance.Clawback{})
 	handlers := NewMoneyHandlers(moneyService)
 	router := mockRouter(handlers)
 	srv := httptest.NewServer(router)
@@ -169,21 +179,115 @@ func TestGetWithdrawals(t *testing.T) {
 	}
 }
 
+func TestGetWithdrawalsPages(t *testing.T) {
+	logging.Initialize("INFO")
+	existingUserID := uuid.New()
+
+	balanceStorage := balancememstorage.NewBalanceMemStorage()
+	moneyService := moneyservice.NewMoneyService(balanceStorage, withdrawalmemstorage.NewWithdrawalMemStorage(), ledgermemstorage.NewLedgerMemStorage(), balance.Expiry{}, balance.Clawback{})
+	handlers := NewMoneyHandlers(moneyService)
+	router := mockRouter(handlers)
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+	client := resty.New()
+
+	balanceStorage.AddBalance(context.TODO(), existingUserID, money.New(1000), nil)
+	for _, orderID := range []string{"1115", "1321", "1115"} {
+		withdrawalID := uuid.New()
+		err := moneyService.Withdraw(context.TODO(), &withdrawal.Withdrawal{ID: &withdrawalID, UserID: &existingUserID, OrderID: orderID, Sum: money.New(100)})
+		assert.Nil(t, err)
+	}
+
+	testCases := []struct {
+		testName               string
+		query                  string
+		expectedWithdrawalsNum int
+		expectedCode           int
+		expectedNextPage       bool
+		expectedTotalCount     string
+		expectedTotalSum       string
+	}{
+		{
+			testName:               "first page",
+			query:                  "?limit=2",
+			expectedWithdrawalsNum: 2,
+			expectedCode:           http.StatusOK,
+			expectedNextPage:       true,
+			expectedTotalCount:     "3",
+			expectedTotalSum:       "300",
+		},
+		{
+			testName:               "filter by order",
+			query:                  "?order=1115",
+			expectedWithdrawalsNum: 2,
+			expectedCode:           http.StatusOK,
+			expectedTotalCount:     "2",
+			expectedTotalSum:       "200",
+		},
+		{
+			testName:           "filter by processing time without withdrawals",
+			query:              "?processed_to=2000-01-01T00:00:00Z",
+			expectedCode:       http.StatusNoContent,
+			expectedTotalCount: "0",
+			expectedTotalSum:   "0",
+		},
+		{
+			testName:     "bad order number",
+			query:        "?order=1111",
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			testName:     "bad processing time",
+			query:        "?processed_from=yesterday",
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			testName:     "bad limit",
+			query:        "?limit=many",
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			testName:     "cursor id isn't uuid",
+			query:        "?cursor=" + pagination.Cursor{CreatedAt: time.Now(), ID: "1115"}.Encode(),
+			expectedCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			resp, _ := client.R().
+				SetHeader("Content-Type", "application/json").
+				SetHeader("X-User-Id", existingUserID.String()).
+				Execute(http.MethodGet, srv.URL+"/api/user/withdrawals"+tc.query)
+			assert.Equal(t, tc.expectedCode, resp.StatusCode(), "Код ответа не совпадает с ожидаемым")
+			assert.Equal(t, tc.expectedNextPage, resp.Header().Get("X-Next-Cursor") != "", "unexpected next cursor")
+			assert.Equal(t, tc.expectedTotalCount, resp.Header().Get("X-Total-Count"), "total counts don't match")
+			assert.Equal(t, tc.expectedTotalSum, resp.Header().Get("X-Total-Sum"), "total sums don't match")
+
+			if tc.expectedWithdrawalsNum != 0 {
+				var respWithdrawals []outputWithdrawal
+				json.Unmarshal(resp.Body(), &respWithdrawals)
+				assert.Equal(t, tc.expectedWithdrawalsNum, len(respWithdrawals), "withdrawals not equal")
+			}
+		})
+	}
+}
+
 type InputWithdrawal struct {
-	OrderID string  `json:"order"`
-	Sum     float64 `json:"sum"`
+	OrderID string      `json:"order"`
+	Sum     money.Money `json:"sum"`
 }
 
 func TestPostWithdraw(t *testing.T) {
 	logging.Initialize("INFO")
 	existingUserID := uuid.New()
-	existingBalanceCurrent := float64(200)
+	existingBalanceCurrent := money.New(200)
 	existingWithdrawalID := uuid.New()
 	existingWithdrawal := withdrawal.Withdrawal{
 		ID:      &existingWithdrawalID,
 		OrderID: "1115",
 		UserID:  &existingUserID,
-		Sum:     300,
+		Sum:     money.New(300),
 	}
 
 	testCases := []struct {
@@ -198,7 +302,7 @@ func TestPostWithdraw(t *testing.T) {
 			inputIdempotencyToken: uuid.NewString(),
 			inputWithdrawal: &InputWithdrawal{
 				OrderID: "1321",
-				Sum:     existingBalanceCurrent - 100,
+				Sum:     existingBalanceCurrent - money.New(100),
 			},
 			expectedWithdrawalsNum: 2,
 			expectedCode:           http.StatusOK,
@@ -225,7 +329,7 @@ func TestPostWithdraw(t *testing.T) {
 			inputIdempotencyToken: uuid.NewString(),
 			inputWithdrawal: &InputWithdrawal{
 				OrderID: "1321",
-				Sum:     existingBalanceCurrent + 100,
+				Sum:     existingBalanceCurrent + money.New(100),
 			},
 			expectedWithdrawalsNum: 1,
 			expectedCode:           http.StatusPaymentRequired,
@@ -235,7 +339,7 @@ func TestPostWithdraw(t *testing.T) {
 			inputIdempotencyToken: uuid.NewString(),
 			inputWithdrawal: &InputWithdrawal{
 				OrderID: "1322",
-				Sum:     existingBalanceCurrent - 100,
+				Sum:     existingBalanceCurrent - money.New(100),
 			},
 			expectedWithdrawalsNum: 1,
 			expectedCode:           http.StatusUnprocessableEntity,
@@ -245,7 +349,7 @@ func TestPostWithdraw(t *testing.T) {
 			inputIdempotencyToken: existingWithdrawal.ID.String(),
 			inputWithdrawal: &InputWithdrawal{
 				OrderID: "1321",
-				Sum:     existingBalanceCurrent - 100,
+				Sum:     existingBalanceCurrent - money.New(100),
 			},
 			expectedWithdrawalsNum: 1,
 			expectedCode:           http.StatusOK,
@@ -255,7 +359,7 @@ func TestPostWithdraw(t *testing.T) {
 			inputIdempotencyToken: "invalid",
 			inputWithdrawal: &InputWithdrawal{
 				OrderID: "1321",
-				Sum:     existingBalanceCurrent - 100,
+				Sum:     existingBalanceCurrent - money.New(100),
 			},
 			expectedWithdrawalsNum: 1,
 			expectedCode:           http.StatusBadRequest,
@@ -265,7 +369,7 @@ func TestPostWithdraw(t *testing.T) {
 			inputIdempotencyToken: "",
 			inputWithdrawal: &InputWithdrawal{
 				OrderID: "1321",
-				Sum:     existingBalanceCurrent - 100,
+				Sum:     existingBalanceCurrent - money.New(100),
 			},
 			expectedWithdrawalsNum: 2,
 			expectedCode:           http.StatusOK,
@@ -276,7 +380,7 @@ func TestPostWithdraw(t *testing.T) {
 		t.Run(tc.testName, func(t *testing.T) {
 			balanceStorage := balancememstorage.NewBalanceMemStorage()
 			withdrawalStorage := withdrawalmemstorage.NewWithdrawalMemStorage()
-			moneyService := moneyservice.NewMoneyService(balanceStorage, withdrawalStorage)
+			moneyService := moneyservice.NewMoneyService(balanceStorage, withdrawalStorage, ledgermemstorage.NewLedgerMemStorage(), balance.Expiry{}, balance.Clawback{})
 			handlers := NewMoneyHandlers(moneyService)
 			router := mockRouter(handlers)
 			srv := httptest.NewServer(router)
@@ -306,3 +410,315 @@ func TestPostWithdraw(t *testing.T) {
 		})
 	}
 }
+
+func TestPostRefund(t *testing.T) {
+	logging.Initialize("INFO")
+	existingUserID := uuid.New()
+	existingWithdrawalID := uuid.New()
+	refundedWithdrawalID := uuid.New()
+	unknownWithdrawalID := uuid.New()
+
+	testCases := []struct {
+		testName        string
+		pathID          string
+		inputRefundID   string
+		expectedCode    int
+		expectedCurrent money.Money
+	}{
+		{
+			testName:        "successful refund",
+			pathID:          existingWithdrawalID.String(),
+			inputRefundID:   existingWithdrawalID.String(),
+			expectedCode:    http.StatusOK,
+			expectedCurrent: money.New(600),
+		},
+		{
+			testName:        "already refunded withdrawal",
+			pathID:          refundedWithdrawalID.String(),
+			inputRefundID:   refundedWithdrawalID.String(),
+			expectedCode:    http.StatusConflict,
+			expectedCurrent: money.New(400),
+		},
+		{
+			testName:        "unknown withdrawal",
+			pathID:          unknownWithdrawalID.String(),
+			inputRefundID:   unknownWithdrawalID.String(),
+			expectedCode:    http.StatusNotFound,
+			expectedCurrent: money.New(400),
+		},
+		{
+			testName:        "body doesn't match path",
+			pathID:          existingWithdrawalID.String(),
+			inputRefundID:   refundedWithdrawalID.String(),
+			expectedCode:    http.StatusBadRequest,
+			expectedCurrent: money.New(400),
+		},
+		{
+			testName:        "invalid withdrawal id",
+			pathID:          "invalid",
+			inputRefundID:   existingWithdrawalID.String(),
+			expectedCode:    http.StatusBadRequest,
+			expectedCurrent: money.New(400),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			balanceStorage := balancememstorage.NewBalanceMemStorage()
+			withdrawalStorage := withdrawalmemstorage.NewWithdrawalMemStorage()
+			moneyService := moneyservice.NewMoneyService(balanceStorage, withdrawalStorage, ledgermemstorage.NewLedgerMemStorage(), balance.Expiry{}, balance.Clawback{})
+			handlers := NewMoneyHandlers(moneyService)
+			router := mockRouter(handlers)
+			srv := httptest.NewServer(router)
+			defer srv.Close()
+			client := resty.New()
+
+			balanceStorage.AddBalance(context.TODO(), existingUserID, money.New(600), nil)
+			moneyService.Withdraw(context.TODO(), &withdrawal.Withdrawal{ID: &existingWithdrawalID, OrderID: "1115", UserID: &existingUserID, Sum: money.New(200)})
+			moneyService.Withdraw(context.TODO(), &withdrawal.Withdrawal{ID: &refundedWithdrawalID, OrderID: "1321", UserID: &existingUserID, Sum: money.New(100)})
+			moneyService.RefundWithdrawal(context.TODO(), refundedWithdrawalID)
+
+			req, _ := json.Marshal(map[string]string{"withdrawal": tc.inputRefundID})
+			resp, _ := client.R().
+				SetHeader("Content-Type", "application/json").
+				SetBody(req).
+				Execute(http.MethodPost, srv.URL+"/api/user/withdrawals/"+tc.pathID+"/refund")
+			assert.Equal(t, tc.expectedCode, resp.StatusCode(), "Код ответа не совпадает с ожидаемым")
+
+			userBalance, _ := moneyService.GetBalance(context.TODO(), existingUserID)
+			assert.Equal(t, tc.expectedCurrent, userBalance.Current, "balances don't match")
+		})
+	}
+}
+
+func TestGetBalanceVerification(t *testing.T) {
+	logging.Initialize("INFO")
+	consistentUserID := uuid.New()
+	mismatchedUserID := uuid.New()
+
+	balanceStorage := balancememstorage.NewBalanceMemStorage()
+	moneyService := moneyservice.NewMoneyService(balanceStorage, withdrawalmemstorage.NewWithdrawalMemStorage(), ledgermemstorage.NewLedgerMemStorage(), balance.Expiry{}, balance.Clawback{})
+	moneyService.AddAccrual(context.TODO(), consistentUserID, "1115", money.New(100), nil)
+	// balance changed past the ledger
+	balanceStorage.AddBalance(context.TODO(), mismatchedUserID, money.New(100), nil)
+
+	handlers := NewMoneyHandlers(moneyService)
+	router := mockRouter(handlers)
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+	client := resty.New()
+
+	testCases := []struct {
+		testName     string
+		userID       string
+		expectedCode int
+		expectedBody string
+	}{
+		{
+			testName:     "balance matches ledger",
+			userID:       consistentUserID.String(),
+			expectedCode: http.StatusOK,
+		},
+		{
+			testName:     "user without movements",
+			userID:       uuid.NewString(),
+			expectedCode: http.StatusOK,
+		},
+		{
+			testName:     "balance doesn't match ledger",
+			userID:       mismatchedUserID.String(),
+			expectedCode: http.StatusConflict,
+			expectedBody: "balance doesn't match ledger",
+		},
+		{
+			testName:     "invalid user id",
+			userID:       "invalid",
+			expectedCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			resp, _ := client.R().Execute(http.MethodGet, srv.URL+"/api/internal/users/"+tc.userID+"/balance/verify")
+			assert.Equal(t, tc.expectedCode, resp.StatusCode(), "Код ответа не совпадает с ожидаемым")
+			if tc.expectedBody != "" {
+				assert.Equal(t, tc.expectedBody, string(resp.Body()), "body doesn't match")
+			}
+		})
+	}
+}
+
+type outputMovement struct {
+	Type        string    `json:"type"`
+	OrderID     string    `json:"order"`
+	Amount      float64   `json:"amount"`
+	ProcessedAt time.Time `json:"processed_at"`
+}
+
+func TestGetBalanceHistory(t *testing.T) {
+	logging.Initialize("INFO")
+	existingUserID := uuid.New()
+	existingWithdrawalID := uuid.New()
+
+	balanceStorage := balancememstorage.NewBalanceMemStorage()
+	withdrawalStorage := withdrawalmemstorage.NewWithdrawalMemStorage()
+	moneyService := moneyservice.NewMoneyService(balanceStorage, withdrawalStorage, ledgermemstorage.NewLedgerMemStorage(), balance.Expiry{}, balance.Clawback{})
+	handlers := NewMoneyHandlers(moneyService)
+	router := mockRouter(handlers)
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+	client := resty.New()
+
+	moneyService.AddAccrual(context.TODO(), existingUserID, "1115", money.FromMinor(50050), nil)
+	moneyService.Withdraw(context.TODO(), &withdrawal.Withdrawal{
+		ID:      &existingWithdrawalID,
+		UserID:  &existingUserID,
+		OrderID: "1321",
+		Sum:     money.New(200),
+	})
+
+	testCases := []struct {
+		testName          string
+		inputUserID       uuid.UUID
+		expectedMovements map[string]outputMovement
+		expectedCode      int
+	}{
+		{
+			testName:    "successful get history of existing user",
+			inputUserID: existingUserID,
+			expectedMovements: map[string]outputMovement{
+				"1115": {Type: "ACCRUAL", OrderID: "1115", Amount: 500.5},
+				"1321": {Type: "WITHDRAWAL", OrderID: "1321", Amount: -200},
+			},
+			expectedCode: http.StatusOK,
+		},
+		{
+			testName:          "successful get history of new user",
+			inputUserID:       uuid.New(),
+			expectedMovements: map[string]outputMovement{},
+			expectedCode:      http.StatusNoContent,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			resp, _ := client.R().
+				SetHeader("Content-Type", "application/json").
+				SetHeader("X-User-Id", tc.inputUserID.String()).
+				Execute(http.MethodGet, srv.URL+"/api/user/balance/history")
+			assert.Equal(t, tc.expectedCode, resp.StatusCode(), "Код ответа не совпадает с ожидаемым")
+
+			if len(tc.expectedMovements) != 0 {
+				var respMovements []outputMovement
+				json.Unmarshal(resp.Body(), &respMovements)
+				assert.Equal(t, len(tc.expectedMovements), len(respMovements), "movements not equal")
+				for _, respMovement := range respMovements {
+					expectedMovement := tc.expectedMovements[respMovement.OrderID]
+					assert.Equal(t, expectedMovement.Type, respMovement.Type, "types not equal")
+					assert.Equal(t, expectedMovement.Amount, respMovement.Amount, "amounts not equal")
+					assert.False(t, respMovement.ProcessedAt.IsZero(), "processed_at is empty")
+				}
+			}
+		})
+	}
+}
+
+func runConcurrentWithdrawals(t *testing.T, moneyService *moneyservice.MoneyService, userID uuid.UUID) {
+	const (
+		requestsNum      = 50
+		withdrawalAmount = 10
+		expectedSuccess  = 10
+	)
+
+	handlers := NewMoneyHandlers(moneyService)
+	router := mockRouter(handlers)
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+	client := resty.New()
+
+	req, _ := json.Marshal(InputWithdrawal{
+		OrderID: "1321",
+		Sum:     money.New(withdrawalAmount),
+	})
+
+	codes := make(chan int, requestsNum)
+	var wg sync.WaitGroup
+	for range requestsNum {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := client.R().
+				SetHeader("Content-Type", "application/json").
+				SetHeader("X-User-Id", userID.String()).
+				SetHeader("Idempotency-Key", uuid.NewString()).
+				SetBody(req).
+				Execute(http.MethodPost, srv.URL+"/api/user/balance/withdraw")
+			if err != nil {
+				codes <- 0
+				return
+			}
+			codes <- resp.StatusCode()
+		}()
+	}
+	wg.Wait()
+	close(codes)
+
+	codesCount := map[int]int{}
+	for code := range codes {
+		codesCount[code]++
+	}
+	assert.Equal(t, map[int]int{
+		http.StatusOK:              expectedSuccess,
+		http.StatusPaymentRequired: requestsNum - expectedSuccess,
+	}, codesCount, "response codes don't match")
+
+	userBalance, err := moneyService.GetBalance(context.TODO(), userID)
+	assert.NoError(t, err)
+	assert.Equal(t, balance.Balance{
+		Current:   0,
+		Withdrawn: money.New(withdrawalAmount * expectedSuccess),
+	}, *userBalance, "balances don't match")
+
+	userWithdrawals, _ := moneyService.GetWithdrawals(context.TODO(), userID)
+	assert.Equal(t, expectedSuccess, len(userWithdrawals), "num of withdrawals don't match")
+	assert.NoError(t, moneyService.VerifyBalance(context.TODO(), userID))
+}
+
+func TestConcurrentWithdrawals(t *testing.T) {
+	logging.Initialize("INFO")
+	userID := uuid.New()
+
+	balanceStorage := balancememstorage.NewBalanceMemStorage()
+	withdrawalStorage := withdrawalmemstorage.NewWithdrawalMemStorage()
+	ledgerStorage := ledgermemstorage.NewLedgerMemStorage()
+	moneyService := moneyservice.NewMoneyService(balanceStorage, withdrawalStorage, ledgerStorage, balance.Expiry{}, balance.Clawback{})
+	moneyService.AddAccrual(context.TODO(), userID, "1115", money.New(100), nil)
+
+	runConcurrentWithdrawals(t, moneyService, userID)
+}
+
+func TestConcurrentWithdrawalsPostgres(t *testing.T) {
+	dsn := os.Getenv("TEST_DATABASE_URI")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URI is not set")
+	}
+	logging.Initialize("INFO")
+	userID := uuid.New()
+
+	storage := pgstorage.NewPGStorage(dsn, 10)
+	err := storage.Init(context.TODO())
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer storage.Close()
+
+	moneyService := moneyservice.NewMoneyService(storage.BalanceStorage, storage.WithdrawalStorage, storage.LedgerStorage, balance.Expiry{}, balance.Clawback{})
+	tx, err := storage.BalanceStorage.BeginTx(context.TODO())
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NoError(t, moneyService.AddAccrual(context.TODO(), userID, "1115", money.New(100), tx))
+	assert.NoError(t, tx.Commit())
+
+	runConcurrentWithdrawals(t, moneyService, userID)
+}
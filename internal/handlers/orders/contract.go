@@ -5,10 +5,14 @@ import (
 
 	"github.com/google/uuid"
 
+	"github.com/ry461ch/loyalty_system/internal/helpers/pagination"
 	"github.com/ry461ch/loyalty_system/internal/models/order"
 )
 
 type OrderService interface {
-	GetUserOrders(ctx context.Context, userID uuid.UUID) ([]order.Order, error)
+	ListUserOrders(ctx context.Context, userID uuid.UUID, query order.ListQuery) ([]order.Order, *pagination.Cursor, error)
 	InsertOrder(ctx context.Context, userID uuid.UUID, orderID string) error
+	InsertOrders(ctx context.Context, userID uuid.UUID, orderIDs []string) ([]order.UploadResult, error)
+	GetOrderDetails(ctx context.Context, userID uuid.UUID, orderID string) (*order.Details, error)
+	ReturnOrder(ctx context.Context, orderReturn *order.Return) error
 }
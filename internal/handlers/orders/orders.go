@@ -3,12 +3,19 @@ package orderhandlers
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"strings"
+	"time"
 
+	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
 
+	"github.com/ry461ch/loyalty_system/internal/helpers/pagination"
 	"github.com/ry461ch/loyalty_system/internal/models/exceptions"
+	"github.com/ry461ch/loyalty_system/internal/models/order"
 	"github.com/ry461ch/loyalty_system/pkg/logging"
 )
 
@@ -56,6 +63,53 @@ func (oh *OrderHandlers) PostOrder(res http.ResponseWriter, req *http.Request) {
 	}
 }
 
+func (oh *OrderHandlers) PostOrdersBatch(res http.ResponseWriter, req *http.Request) {
+	userID, err := uuid.Parse(req.Header.Get("X-User-Id"))
+	if err != nil {
+		logging.Logger.Errorf("New orders batch: internal error: %v", err)
+		res.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	reqBody, err := io.ReadAll(http.MaxBytesReader(res, req.Body, order.MaxBatchBodySize))
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			res.WriteHeader(http.StatusRequestEntityTooLarge)
+			return
+		}
+		res.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	orderIDs, err := parseBatch(req.Header.Get("Content-Type"), reqBody)
+	if err != nil || len(orderIDs) == 0 {
+		res.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if len(orderIDs) > order.MaxBatchSize {
+		res.WriteHeader(http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	results, err := oh.orderService.InsertOrders(req.Context(), userID, orderIDs)
+	if err != nil {
+		logging.Logger.Errorf("New orders batch: internal error: %v", err)
+		res.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	resp, err := json.Marshal(results)
+	if err != nil {
+		logging.Logger.Errorf("New orders batch: internal error: %v", err)
+		res.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(http.StatusOK)
+	res.Write(resp)
+}
+
 func (oh *OrderHandlers) GetOrders(res http.ResponseWriter, req *http.Request) {
 	userID, err := uuid.Parse(req.Header.Get("X-User-Id"))
 	if err != nil {
@@ -63,7 +117,13 @@ func (oh *OrderHandlers) GetOrders(res http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	orders, err := oh.orderService.GetUserOrders(req.Context(), userID)
+	query, err := parseListQuery(req.URL.Query())
+	if err != nil {
+		res.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	orders, next, err := oh.orderService.ListUserOrders(req.Context(), userID, query)
 	if err != nil {
 		logging.Logger.Errorf("Get orders: internal error: %v", err)
 		res.WriteHeader(http.StatusInternalServerError)
@@ -82,7 +142,137 @@ func (oh *OrderHandlers) GetOrders(res http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	if next != nil {
+		res.Header().Set("Link", fmt.Sprintf("<%s>; rel=\"next\"", pagination.NextLink(req.URL, *next)))
+		res.Header().Set("X-Next-Cursor", next.Encode())
+	}
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(http.StatusOK)
+	res.Write(resp)
+}
+
+func (oh *OrderHandlers) GetOrder(res http.ResponseWriter, req *http.Request) {
+	userID, err := uuid.Parse(req.Header.Get("X-User-Id"))
+	if err != nil {
+		res.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	orderDetails, err := oh.orderService.GetOrderDetails(req.Context(), userID, chi.URLParam(req, "number"))
+	if err != nil {
+		switch {
+		case errors.Is(err, exceptions.ErrOrderBadIDFormat):
+			res.WriteHeader(http.StatusUnprocessableEntity)
+		case errors.Is(err, exceptions.ErrOrderNotFound):
+			res.WriteHeader(http.StatusNotFound)
+		default:
+			logging.Logger.Errorf("Get order: internal error: %v", err)
+			res.WriteHeader(http.StatusInternalServerError)
+		}
+		return
+	}
+
+	resp, err := json.Marshal(orderDetails)
+	if err != nil {
+		logging.Logger.Errorf("Get order: internal error: %v", err)
+		res.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
 	res.Header().Set("Content-Type", "application/json")
 	res.WriteHeader(http.StatusOK)
 	res.Write(resp)
 }
+
+// PostReturn returns the processed order by merchant request and takes its accrual back.
+func (oh *OrderHandlers) PostReturn(res http.ResponseWriter, req *http.Request) {
+	reqBody, err := io.ReadAll(req.Body)
+	if err != nil {
+		res.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	var orderReturn order.Return
+	err = json.Unmarshal(reqBody, &orderReturn)
+	if err != nil || orderReturn.ID != chi.URLParam(req, "number") {
+		res.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	err = oh.orderService.ReturnOrder(req.Context(), &orderReturn)
+	if err != nil {
+		switch {
+		case errors.Is(err, exceptions.ErrOrderBadIDFormat):
+			res.WriteHeader(http.StatusUnprocessableEntity)
+		case errors.Is(err, exceptions.ErrOrderNotFound):
+			res.WriteHeader(http.StatusNotFound)
+		case errors.Is(err, exceptions.ErrOrderBadStatusTransition):
+			res.WriteHeader(http.StatusConflict)
+		default:
+			logging.Logger.Errorf("Return order: internal error: %v", err)
+			res.WriteHeader(http.StatusInternalServerError)
+		}
+		return
+	}
+	logging.Logger.Infof("Audit: order %s returned", orderReturn.ID)
+	res.WriteHeader(http.StatusOK)
+}
+
+// parseBatch reads order numbers from JSON array or from plain text with one number per line.
+func parseBatch(contentType string, body []byte) ([]string, error) {
+	switch contentType {
+	case "application/json":
+		var orderIDs []string
+		err := json.Unmarshal(body, &orderIDs)
+		if err != nil {
+			return nil, err
+		}
+		return orderIDs, nil
+	case "", "text/plain":
+		orderIDs := []string{}
+		for _, line := range strings.Split(string(body), "\n") {
+			if orderID := strings.TrimSpace(line); orderID != "" {
+				orderIDs = append(orderIDs, orderID)
+			}
+		}
+		return orderIDs, nil
+	default:
+		return nil, fmt.Errorf("unsupported content type %q", contentType)
+	}
+}
+
+// parseListQuery reads page and filters, statuses may be repeated or comma separated,
+// uploaded_from and uploaded_to are RFC3339 timestamps.
+func parseListQuery(values url.Values) (order.ListQuery, error) {
+	page, err := pagination.ParsePage(values)
+	if err != nil {
+		return order.ListQuery{}, err
+	}
+	query := order.ListQuery{Page: page}
+
+	for _, statuses := range values["status"] {
+		for _, statusName := range strings.Split(statuses, ",") {
+			status, err := order.ParseStatus(strings.TrimSpace(statusName))
+			if err != nil {
+				return order.ListQuery{}, err
+			}
+			query.Statuses = append(query.Statuses, status)
+		}
+	}
+
+	if uploadedFrom := values.Get("uploaded_from"); uploadedFrom != "" {
+		parsedTime, err := time.Parse(time.RFC3339, uploadedFrom)
+		if err != nil {
+			return order.ListQuery{}, err
+		}
+		query.UploadedFrom = &parsedTime
+	}
+	if uploadedTo := values.Get("uploaded_to"); uploadedTo != "" {
+		parsedTime, err := time.Parse(time.RFC3339, uploadedTo)
+		if err != nil {
+			return order.ListQuery{}, err
+		}
+		query.UploadedTo = &parsedTime
+	}
+	return query, nil
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
@@ -13,9 +14,13 @@ import (
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 
+	"github.com/ry461ch/loyalty_system/internal/models/balance"
+	"github.com/ry461ch/loyalty_system/internal/models/money"
+	"github.com/ry461ch/loyalty_system/internal/models/order"
 	"github.com/ry461ch/loyalty_system/internal/services/money"
 	"github.com/ry461ch/loyalty_system/internal/services/order"
 	"github.com/ry461ch/loyalty_system/internal/storage/memory/balances"
+	"github.com/ry461ch/loyalty_system/internal/storage/memory/ledger"
 	"github.com/ry461ch/loyalty_system/internal/storage/memory/orders"
 	"github.com/ry461ch/loyalty_system/internal/storage/memory/withdrawals"
 	"github.com/ry461ch/loyalty_system/pkg/logging"
@@ -25,6 +30,9 @@ func mockRouter(orderHandlers *OrderHandlers) chi.Router {
 	router := chi.NewRouter()
 	router.Get("/api/user/orders", orderHandlers.GetOrders)
 	router.Post("/api/user/orders", orderHandlers.PostOrder)
+	router.Post("/api/user/orders/batch", orderHandlers.PostOrdersBatch)
+	router.Get("/api/user/orders/{number}", orderHandlers.GetOrder)
+	router.Post("/api/internal/orders/{number}/return", orderHandlers.PostReturn)
 	return router
 }
 
@@ -66,7 +74,7 @@ func TestGetOrders(t *testing.T) {
 			orderStorage := ordermemstorage.NewOrderMemStorage()
 			balanceStorage := balancememstorage.NewBalanceMemStorage()
 			withdrawalStorage := withdrawalmemstorage.NewWithdrawalMemStorage()
-			moneyService := moneyservice.NewMoneyService(balanceStorage, withdrawalStorage)
+			moneyService := moneyservice.NewMoneyService(balanceStorage, withdrawalStorage, ledgermemstorage.NewLedgerMemStorage(), balance.Expiry{}, balance.Clawback{})
 			orderService := orderservice.NewOrderService(orderStorage, moneyService)
 			handlers := NewOrderHandlers(orderService)
 			router := mockRouter(handlers)
@@ -137,7 +145,7 @@ func TestPostOrder(t *testing.T) {
 			orderStorage := ordermemstorage.NewOrderMemStorage()
 			balanceStorage := balancememstorage.NewBalanceMemStorage()
 			withdrawalStorage := withdrawalmemstorage.NewWithdrawalMemStorage()
-			moneyService := moneyservice.NewMoneyService(balanceStorage, withdrawalStorage)
+			moneyService := moneyservice.NewMoneyService(balanceStorage, withdrawalStorage, ledgermemstorage.NewLedgerMemStorage(), balance.Expiry{}, balance.Clawback{})
 			orderService := orderservice.NewOrderService(orderStorage, moneyService)
 			handlers := NewOrderHandlers(orderService)
 			router := mockRouter(handlers)
@@ -156,3 +164,390 @@ func TestPostOrder(t *testing.T) {
 		})
 	}
 }
+
+func TestGetOrdersPages(t *testing.T) {
+	logging.Initialize("INFO")
+	existingUserID := uuid.New()
+
+	orderStorage := ordermemstorage.NewOrderMemStorage()
+	moneyService := moneyservice.NewMoneyService(balancememstorage.NewBalanceMemStorage(), withdrawalmemstorage.NewWithdrawalMemStorage(), ledgermemstorage.NewLedgerMemStorage(), balance.Expiry{}, balance.Clawback{})
+	orderService := orderservice.NewOrderService(orderStorage, moneyService)
+	handlers := NewOrderHandlers(orderService)
+	router := mockRouter(handlers)
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+	client := resty.New()
+
+	for _, orderID := range []string{"1115", "1321", "79927398713"} {
+		orderService.InsertOrder(context.TODO(), existingUserID, orderID)
+	}
+
+	testCases := []struct {
+		testName          string
+		query             string
+		expectedOrdersNum int
+		expectedCode      int
+		expectedNextPage  bool
+	}{
+		{
+			testName:          "first page",
+			query:             "?limit=2",
+			expectedOrdersNum: 2,
+			expectedCode:      http.StatusOK,
+			expectedNextPage:  true,
+		},
+		{
+			testName:          "whole listing in one page",
+			query:             "?limit=3",
+			expectedOrdersNum: 3,
+			expectedCode:      http.StatusOK,
+		},
+		{
+			testName:          "filter by status",
+			query:             "?status=NEW,PROCESSING&limit=2",
+			expectedOrdersNum: 2,
+			expectedCode:      http.StatusOK,
+			expectedNextPage:  true,
+		},
+		{
+			testName:     "filter by status without orders",
+			query:        "?status=PROCESSED",
+			expectedCode: http.StatusNoContent,
+		},
+		{
+			testName:     "filter by upload time without orders",
+			query:        "?uploaded_to=2000-01-01T00:00:00Z",
+			expectedCode: http.StatusNoContent,
+		},
+		{
+			testName:     "bad limit",
+			query:        "?limit=0",
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			testName:     "bad cursor",
+			query:        "?cursor=bad",
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			testName:     "bad status",
+			query:        "?status=REGISTERED",
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			testName:     "bad upload time",
+			query:        "?uploaded_from=yesterday",
+			expectedCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			resp, _ := client.R().
+				SetHeader("X-User-Id", existingUserID.String()).
+				Execute(http.MethodGet, srv.URL+"/api/user/orders"+tc.query)
+			assert.Equal(t, tc.expectedCode, resp.StatusCode(), "Код ответа не совпадает с ожидаемым")
+			assert.Equal(t, tc.expectedNextPage, resp.Header().Get("X-Next-Cursor") != "", "unexpected next cursor")
+			assert.Equal(t, tc.expectedNextPage, resp.Header().Get("Link") != "", "unexpected link")
+
+			if tc.expectedOrdersNum == 0 {
+				return
+			}
+			var respOrders []outputOrder
+			json.Unmarshal(resp.Body(), &respOrders)
+			assert.Equal(t, tc.expectedOrdersNum, len(respOrders), "num of orders not equal")
+		})
+	}
+
+	seenOrders := map[string]bool{}
+	nextURL := srv.URL + "/api/user/orders?limit=2"
+	for nextURL != "" {
+		resp, _ := client.R().
+			SetHeader("X-User-Id", existingUserID.String()).
+			Execute(http.MethodGet, nextURL)
+		assert.Equal(t, http.StatusOK, resp.StatusCode(), "Код ответа не совпадает с ожидаемым")
+
+		var respOrders []outputOrder
+		json.Unmarshal(resp.Body(), &respOrders)
+		for _, respOrder := range respOrders {
+			assert.False(t, seenOrders[respOrder.ID], "order is repeated in pages")
+			seenOrders[respOrder.ID] = true
+		}
+
+		nextURL = ""
+		if link := resp.Header().Get("Link"); link != "" {
+			nextURL = srv.URL + strings.TrimSuffix(strings.TrimPrefix(link, "<"), ">; rel=\"next\"")
+		}
+	}
+	assert.Equal(t, 3, len(seenOrders), "all orders must be listed by pages")
+}
+
+func TestGetOrder(t *testing.T) {
+	logging.Initialize("INFO")
+	existingUserID := uuid.New()
+	existingOrderID := "1115"
+
+	orderStorage := ordermemstorage.NewOrderMemStorage()
+	moneyService := moneyservice.NewMoneyService(balancememstorage.NewBalanceMemStorage(), withdrawalmemstorage.NewWithdrawalMemStorage(), ledgermemstorage.NewLedgerMemStorage(), balance.Expiry{}, balance.Clawback{})
+	orderService := orderservice.NewOrderService(orderStorage, moneyService)
+	handlers := NewOrderHandlers(orderService)
+	router := mockRouter(handlers)
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+	client := resty.New()
+
+	orderService.InsertOrder(context.TODO(), existingUserID, existingOrderID)
+	orderService.UpdateOrder(context.TODO(), &order.Order{ID: existingOrderID, Status: order.PROCESSING})
+
+	testCases := []struct {
+		testName           string
+		inputUserID        uuid.UUID
+		inputOrderID       string
+		expectedCode       int
+		expectedHistoryLen int
+	}{
+		{
+			testName:           "order of the user",
+			inputUserID:        existingUserID,
+			inputOrderID:       existingOrderID,
+			expectedCode:       http.StatusOK,
+			expectedHistoryLen: 2,
+		},
+		{
+			testName:     "order of another user",
+			inputUserID:  uuid.New(),
+			inputOrderID: existingOrderID,
+			expectedCode: http.StatusNotFound,
+		},
+		{
+			testName:     "unknown order",
+			inputUserID:  existingUserID,
+			inputOrderID: "1321",
+			expectedCode: http.StatusNotFound,
+		},
+		{
+			testName:     "invalid order id",
+			inputUserID:  existingUserID,
+			inputOrderID: "1111",
+			expectedCode: http.StatusUnprocessableEntity,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			resp, _ := client.R().
+				SetHeader("X-User-Id", tc.inputUserID.String()).
+				Execute(http.MethodGet, srv.URL+"/api/user/orders/"+tc.inputOrderID)
+			assert.Equal(t, tc.expectedCode, resp.StatusCode(), "Код ответа не совпадает с ожидаемым")
+
+			if tc.expectedCode != http.StatusOK {
+				return
+			}
+			var respOrder struct {
+				ID           string `json:"number"`
+				Status       string `json:"status"`
+				AccrualPolls int    `json:"accrual_polls"`
+				History      []struct {
+					Status    string    `json:"status"`
+					ChangedAt time.Time `json:"changed_at"`
+				} `json:"history"`
+			}
+			json.Unmarshal(resp.Body(), &respOrder)
+			assert.Equal(t, tc.inputOrderID, respOrder.ID, "order ids don't match")
+			assert.Equal(t, "PROCESSING", respOrder.Status, "statuses don't match")
+			assert.Equal(t, tc.expectedHistoryLen, len(respOrder.History), "history lengths don't match")
+			assert.Equal(t, "NEW", respOrder.History[0].Status, "history must start with NEW")
+		})
+	}
+}
+
+func TestPostReturn(t *testing.T) {
+	logging.Initialize("INFO")
+	existingUserID := uuid.New()
+	processedOrderID := "1115"
+	processingOrderID := "1321"
+	accrual := money.New(500)
+
+	orderStorage := ordermemstorage.NewOrderMemStorage()
+	balanceStorage := balancememstorage.NewBalanceMemStorage()
+	moneyService := moneyservice.NewMoneyService(balanceStorage, withdrawalmemstorage.NewWithdrawalMemStorage(), ledgermemstorage.NewLedgerMemStorage(), balance.Expiry{}, balance.Clawback{})
+	orderService := orderservice.NewOrderService(orderStorage, moneyService)
+	handlers := NewOrderHandlers(orderService)
+	router := mockRouter(handlers)
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+	client := resty.New()
+
+	orderService.InsertOrder(context.TODO(), existingUserID, processedOrderID)
+	orderService.UpdateOrder(context.TODO(), &order.Order{ID: processedOrderID, Status: order.PROCESSED, Accrual: &accrual})
+	orderService.InsertOrder(context.TODO(), existingUserID, processingOrderID)
+	orderService.UpdateOrder(context.TODO(), &order.Order{ID: processingOrderID, Status: order.PROCESSING})
+
+	testCases := []struct {
+		testName     string
+		pathOrderID  string
+		inputOrderID string
+		expectedCode int
+	}{
+		{
+			testName:     "body doesn't match path",
+			pathOrderID:  processedOrderID,
+			inputOrderID: processingOrderID,
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			testName:     "processed order",
+			pathOrderID:  processedOrderID,
+			inputOrderID: processedOrderID,
+			expectedCode: http.StatusOK,
+		},
+		{
+			testName:     "already returned order",
+			pathOrderID:  processedOrderID,
+			inputOrderID: processedOrderID,
+			expectedCode: http.StatusConflict,
+		},
+		{
+			testName:     "not processed order",
+			pathOrderID:  processingOrderID,
+			inputOrderID: processingOrderID,
+			expectedCode: http.StatusConflict,
+		},
+		{
+			testName:     "unknown order",
+			pathOrderID:  "79927398713",
+			inputOrderID: "79927398713",
+			expectedCode: http.StatusNotFound,
+		},
+		{
+			testName:     "invalid order id",
+			pathOrderID:  "1111",
+			inputOrderID: "1111",
+			expectedCode: http.StatusUnprocessableEntity,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			req, _ := json.Marshal(order.Return{ID: tc.inputOrderID, Reason: "cancelled"})
+			resp, _ := client.R().
+				SetHeader("Content-Type", "application/json").
+				SetBody(req).
+				Execute(http.MethodPost, srv.URL+"/api/internal/orders/"+tc.pathOrderID+"/return")
+			assert.Equal(t, tc.expectedCode, resp.StatusCode(), "Код ответа не совпадает с ожидаемым")
+		})
+	}
+
+	balanceInDB, _ := balanceStorage.GetBalance(context.TODO(), existingUserID)
+	assert.Equal(t, balance.Balance{}, *balanceInDB, "accrual wasn't taken back")
+}
+
+func TestPostOrdersBatch(t *testing.T) {
+	logging.Initialize("INFO")
+	existingUserID := uuid.New()
+
+	tooBigBatch := make([]string, order.MaxBatchSize+1)
+	for idx := range tooBigBatch {
+		tooBigBatch[idx] = "1115"
+	}
+	tooBigBatchBody, _ := json.Marshal(tooBigBatch)
+	tooLongBatchBody := "[\"1115\"" + strings.Repeat(" ", order.MaxBatchBodySize) + "]"
+
+	testCases := []struct {
+		testName          string
+		contentType       string
+		requestBody       string
+		expectedCode      int
+		expectedResults   []order.UploadResult
+		expectedOrdersNum int
+	}{
+		{
+			testName:     "json batch",
+			contentType:  "application/json",
+			requestBody:  `["1321", "1115", "1111"]`,
+			expectedCode: http.StatusOK,
+			expectedResults: []order.UploadResult{
+				{ID: "1321", Status: order.UploadAccepted},
+				{ID: "1115", Status: order.UploadDuplicate},
+				{ID: "1111", Status: order.UploadInvalid},
+			},
+			expectedOrdersNum: 2,
+		},
+		{
+			testName:     "plain text batch",
+			contentType:  "text/plain",
+			requestBody:  "1321\n\n79927398713\r\n",
+			expectedCode: http.StatusOK,
+			expectedResults: []order.UploadResult{
+				{ID: "1321", Status: order.UploadAccepted},
+				{ID: "79927398713", Status: order.UploadAccepted},
+			},
+			expectedOrdersNum: 3,
+		},
+		{
+			testName:          "empty batch",
+			contentType:       "application/json",
+			requestBody:       `[]`,
+			expectedCode:      http.StatusBadRequest,
+			expectedOrdersNum: 1,
+		},
+		{
+			testName:          "invalid json",
+			contentType:       "application/json",
+			requestBody:       `["1321"`,
+			expectedCode:      http.StatusBadRequest,
+			expectedOrdersNum: 1,
+		},
+		{
+			testName:          "unsupported content type",
+			contentType:       "text/csv",
+			requestBody:       "1321",
+			expectedCode:      http.StatusBadRequest,
+			expectedOrdersNum: 1,
+		},
+		{
+			testName:          "too big batch",
+			contentType:       "application/json",
+			requestBody:       string(tooBigBatchBody),
+			expectedCode:      http.StatusRequestEntityTooLarge,
+			expectedOrdersNum: 1,
+		},
+		{
+			testName:          "too long body",
+			contentType:       "application/json",
+			requestBody:       tooLongBatchBody,
+			expectedCode:      http.StatusRequestEntityTooLarge,
+			expectedOrdersNum: 1,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			orderStorage := ordermemstorage.NewOrderMemStorage()
+			moneyService := moneyservice.NewMoneyService(balancememstorage.NewBalanceMemStorage(), withdrawalmemstorage.NewWithdrawalMemStorage(), ledgermemstorage.NewLedgerMemStorage(), balance.Expiry{}, balance.Clawback{})
+			orderService := orderservice.NewOrderService(orderStorage, moneyService)
+			handlers := NewOrderHandlers(orderService)
+			router := mockRouter(handlers)
+			srv := httptest.NewServer(router)
+			defer srv.Close()
+			client := resty.New()
+
+			orderService.InsertOrder(context.TODO(), existingUserID, "1115")
+
+			resp, _ := client.R().
+				SetHeader("Content-Type", tc.contentType).
+				SetHeader("X-User-Id", existingUserID.String()).
+				SetBody(tc.requestBody).
+				Execute(http.MethodPost, srv.URL+"/api/user/orders/batch")
+			assert.Equal(t, tc.expectedCode, resp.StatusCode(), "Код ответа не совпадает с ожидаемым")
+
+			if tc.expectedResults != nil {
+				var results []order.UploadResult
+				json.Unmarshal(resp.Body(), &results)
+				assert.Equal(t, tc.expectedResults, results, "results don't match")
+			}
+			userOrders, _ := orderService.GetUserOrders(context.TODO(), existingUserID)
+			assert.Equal(t, tc.expectedOrdersNum, len(userOrders), "num of orders doesn't match")
+		})
+	}
+}
@@ -0,0 +1,7 @@
+package statushandlers
+
+import "github.com/ry461ch/loyalty_system/pkg/circuitbreaker"
+
+type AccrualStatus interface {
+	AccrualState() circuitbreaker.State
+}
@@ -0,0 +1,44 @@
+package statushandlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/ry461ch/loyalty_system/pkg/circuitbreaker"
+	"github.com/ry461ch/loyalty_system/pkg/logging"
+)
+
+type accrualStatus struct {
+	CircuitBreaker circuitbreaker.State `json:"circuit_breaker"`
+}
+
+type status struct {
+	Accrual accrualStatus `json:"accrual"`
+}
+
+type StatusHandlers struct {
+	accrualStatus AccrualStatus
+}
+
+func NewStatusHandlers(accrualStatus AccrualStatus) *StatusHandlers {
+	return &StatusHandlers{
+		accrualStatus: accrualStatus,
+	}
+}
+
+func (sh *StatusHandlers) GetStatus(res http.ResponseWriter, req *http.Request) {
+	resp, err := json.Marshal(status{
+		Accrual: accrualStatus{
+			CircuitBreaker: sh.accrualStatus.AccrualState(),
+		},
+	})
+	if err != nil {
+		logging.Logger.Errorf("Get status: internal error: %v", err)
+		res.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(http.StatusOK)
+	res.Write(resp)
+}
@@ -0,0 +1,62 @@
+package statushandlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-resty/resty/v2"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ry461ch/loyalty_system/pkg/circuitbreaker"
+	"github.com/ry461ch/loyalty_system/pkg/logging"
+)
+
+type mockAccrualStatus struct {
+	state circuitbreaker.State
+}
+
+func (m *mockAccrualStatus) AccrualState() circuitbreaker.State {
+	return m.state
+}
+
+func TestGetStatus(t *testing.T) {
+	logging.Initialize("INFO")
+
+	testCases := []struct {
+		testName     string
+		state        circuitbreaker.State
+		expectedBody string
+	}{
+		{
+			testName:     "closed breaker",
+			state:        circuitbreaker.Closed,
+			expectedBody: `{"accrual": {"circuit_breaker": "closed"}}`,
+		},
+		{
+			testName:     "open breaker",
+			state:        circuitbreaker.Open,
+			expectedBody: `{"accrual": {"circuit_breaker": "open"}}`,
+		},
+		{
+			testName:     "half-open breaker",
+			state:        circuitbreaker.HalfOpen,
+			expectedBody: `{"accrual": {"circuit_breaker": "half-open"}}`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			handlers := NewStatusHandlers(&mockAccrualStatus{state: tc.state})
+			router := chi.NewRouter()
+			router.Get("/api/internal/status", handlers.GetStatus)
+			srv := httptest.NewServer(router)
+			defer srv.Close()
+
+			resp, _ := resty.New().R().Get(srv.URL + "/api/internal/status")
+			assert.Equal(t, http.StatusOK, resp.StatusCode(), "Код ответа не совпадает с ожидаемым")
+			assert.JSONEq(t, tc.expectedBody, string(resp.Body()), "bodies don't match")
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package pagination
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/ry461ch/loyalty_system/internal/models/exceptions"
+)
+
+// MaxLimit bounds the page size requested by clients.
+const MaxLimit = 1000
+
+// Cursor points to the last item of the page, items are ordered by CreatedAt DESC, ID DESC.
+type Cursor struct {
+	CreatedAt time.Time `json:"t"`
+	ID        string    `json:"id"`
+}
+
+// After reports whether the item goes after the cursor in the listing order.
+func (c *Cursor) After(createdAt time.Time, ID string) bool {
+	if c == nil {
+		return true
+	}
+	if !createdAt.Equal(c.CreatedAt) {
+		return createdAt.Before(c.CreatedAt)
+	}
+	return ID < c.ID
+}
+
+// Encode makes an opaque token of the cursor for clients.
+func (c Cursor) Encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func DecodeCursor(token string) (*Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, exceptions.ErrPaginationBadCursor
+	}
+	var cursor Cursor
+	err = json.Unmarshal(data, &cursor)
+	if err != nil || cursor.ID == "" || cursor.CreatedAt.IsZero() {
+		return nil, exceptions.ErrPaginationBadCursor
+	}
+	return &cursor, nil
+}
+
+// Page is a requested slice of listing, zero Limit means the whole listing.
+type Page struct {
+	Limit  int
+	Cursor *Cursor
+}
+
+// ParsePage reads "limit" and "cursor" query params.
+func ParsePage(query url.Values) (Page, error) {
+	var page Page
+	if limit := query.Get("limit"); limit != "" {
+		parsedLimit, err := strconv.Atoi(limit)
+		if err != nil || parsedLimit < 1 || parsedLimit > MaxLimit {
+			return Page{}, exceptions.ErrPaginationBadLimit
+		}
+		page.Limit = parsedLimit
+	}
+	if cursor := query.Get("cursor"); cursor != "" {
+		parsedCursor, err := DecodeCursor(cursor)
+		if err != nil {
+			return Page{}, err
+		}
+		page.Cursor = parsedCursor
+	}
+	return page, nil
+}
+
+// Cut trims items fetched with one extra over Limit and returns cursor of the next page if there is one.
+func Cut[T any](items []T, limit int, cursorOf func(item T) Cursor) ([]T, *Cursor) {
+	if limit <= 0 || len(items) <= limit {
+		return items, nil
+	}
+	items = items[:limit]
+	next := cursorOf(items[limit-1])
+	return items, &next
+}
+
+// NextLink is the request URL with cursor of the next page, other query params are kept.
+func NextLink(requestURL *url.URL, next Cursor) string {
+	query := requestURL.Query()
+	query.Set("cursor", next.Encode())
+	link := url.URL{Path: requestURL.Path, RawQuery: query.Encode()}
+	return link.String()
+}
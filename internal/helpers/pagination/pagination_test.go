@@ -0,0 +1,118 @@
+package pagination
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ry461ch/loyalty_system/internal/models/exceptions"
+)
+
+func TestParsePage(t *testing.T) {
+	cursor := Cursor{CreatedAt: time.Date(2024, 9, 1, 12, 0, 0, 123456000, time.UTC), ID: "1115"}
+
+	testCases := []struct {
+		testName      string
+		query         url.Values
+		expectedPage  Page
+		expectedError error
+	}{
+		{
+			testName:     "no params",
+			query:        url.Values{},
+			expectedPage: Page{},
+		},
+		{
+			testName:     "limit and cursor",
+			query:        url.Values{"limit": {"10"}, "cursor": {cursor.Encode()}},
+			expectedPage: Page{Limit: 10, Cursor: &cursor},
+		},
+		{
+			testName:      "zero limit",
+			query:         url.Values{"limit": {"0"}},
+			expectedError: exceptions.ErrPaginationBadLimit,
+		},
+		{
+			testName:      "too big limit",
+			query:         url.Values{"limit": {"1001"}},
+			expectedError: exceptions.ErrPaginationBadLimit,
+		},
+		{
+			testName:      "not base64 cursor",
+			query:         url.Values{"cursor": {"@@@"}},
+			expectedError: exceptions.ErrPaginationBadCursor,
+		},
+		{
+			testName:      "empty cursor data",
+			query:         url.Values{"cursor": {Cursor{}.Encode()}},
+			expectedError: exceptions.ErrPaginationBadCursor,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			page, err := ParsePage(tc.query)
+			assert.ErrorIs(t, err, tc.expectedError, "exceptions don't match")
+			assert.Equal(t, tc.expectedPage.Limit, page.Limit, "limits don't match")
+			if tc.expectedPage.Cursor == nil {
+				assert.Nil(t, page.Cursor, "unexpected cursor")
+			} else {
+				assert.True(t, tc.expectedPage.Cursor.CreatedAt.Equal(page.Cursor.CreatedAt), "cursor times don't match")
+				assert.Equal(t, tc.expectedPage.Cursor.ID, page.Cursor.ID, "cursor ids don't match")
+			}
+		})
+	}
+}
+
+func TestCut(t *testing.T) {
+	createdAt := time.Now().UTC()
+	cursorOf := func(ID string) Cursor { return Cursor{CreatedAt: createdAt, ID: ID} }
+
+	testCases := []struct {
+		testName      string
+		items         []string
+		limit         int
+		expectedItems []string
+		expectedNext  *Cursor
+	}{
+		{
+			testName:      "no limit",
+			items:         []string{"3", "2", "1"},
+			expectedItems: []string{"3", "2", "1"},
+		},
+		{
+			testName:      "last page",
+			items:         []string{"3", "2"},
+			limit:         2,
+			expectedItems: []string{"3", "2"},
+		},
+		{
+			testName:      "extra item",
+			items:         []string{"3", "2", "1"},
+			limit:         2,
+			expectedItems: []string{"3", "2"},
+			expectedNext:  &Cursor{CreatedAt: createdAt, ID: "2"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			items, next := Cut(tc.items, tc.limit, cursorOf)
+			assert.Equal(t, tc.expectedItems, items, "items don't match")
+			assert.Equal(t, tc.expectedNext, next, "next cursors don't match")
+		})
+	}
+}
+
+func TestNextLink(t *testing.T) {
+	requestURL, _ := url.Parse("http://localhost/api/user/orders?limit=2&status=NEW&cursor=old")
+	next := Cursor{CreatedAt: time.Now().UTC(), ID: "1115"}
+
+	link, _ := url.Parse(NextLink(requestURL, next))
+	assert.Equal(t, "/api/user/orders", link.Path, "paths don't match")
+	assert.Equal(t, "2", link.Query().Get("limit"), "limit must be kept")
+	assert.Equal(t, "NEW", link.Query().Get("status"), "filters must be kept")
+	assert.Equal(t, next.Encode(), link.Query().Get("cursor"), "cursor must be replaced")
+}
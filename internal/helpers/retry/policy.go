@@ -0,0 +1,34 @@
+package retry
+
+import (
+	"math"
+	"time"
+)
+
+// Policy is an exponential backoff: the delay after attempt n is BaseDelay * 2^(n-1),
+// capped by MaxDelay. Non-positive MaxDelay means no cap.
+type Policy struct {
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+}
+
+// Delay returns the time to wait after the given attempt, attempts are counted from 1.
+func (p Policy) Delay(attempt int) time.Duration {
+	if attempt < 1 || p.BaseDelay <= 0 {
+		return 0
+	}
+
+	maxDelay := p.MaxDelay
+	if maxDelay <= 0 {
+		maxDelay = math.MaxInt64
+	}
+
+	delay := p.BaseDelay
+	for i := 1; i < attempt; i++ {
+		if delay > maxDelay/2 {
+			return maxDelay
+		}
+		delay *= 2
+	}
+	return min(delay, maxDelay)
+}
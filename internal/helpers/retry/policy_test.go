@@ -0,0 +1,66 @@
+package retry
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDelay(t *testing.T) {
+	testCases := []struct {
+		testName      string
+		policy        Policy
+		attempt       int
+		expectedDelay time.Duration
+	}{
+		{
+			testName:      "first attempt",
+			policy:        Policy{BaseDelay: time.Second, MaxDelay: time.Minute},
+			attempt:       1,
+			expectedDelay: time.Second,
+		},
+		{
+			testName:      "fourth attempt",
+			policy:        Policy{BaseDelay: time.Second, MaxDelay: time.Minute},
+			attempt:       4,
+			expectedDelay: 8 * time.Second,
+		},
+		{
+			testName:      "capped by max delay",
+			policy:        Policy{BaseDelay: time.Second, MaxDelay: time.Minute},
+			attempt:       10,
+			expectedDelay: time.Minute,
+		},
+		{
+			testName:      "huge attempt doesn't overflow",
+			policy:        Policy{BaseDelay: time.Hour, MaxDelay: 24 * time.Hour},
+			attempt:       1000,
+			expectedDelay: 24 * time.Hour,
+		},
+		{
+			testName:      "without max delay",
+			policy:        Policy{BaseDelay: time.Second},
+			attempt:       11,
+			expectedDelay: 1024 * time.Second,
+		},
+		{
+			testName:      "zero attempt",
+			policy:        Policy{BaseDelay: time.Second, MaxDelay: time.Minute},
+			attempt:       0,
+			expectedDelay: 0,
+		},
+		{
+			testName:      "zero policy",
+			policy:        Policy{},
+			attempt:       5,
+			expectedDelay: 0,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			assert.Equal(t, tc.expectedDelay, tc.policy.Delay(tc.attempt), "delays don't match")
+		})
+	}
+}
@@ -0,0 +1,162 @@
+package stream
+
+import "database/sql"
+
+// Rows is a forward-only cursor over a listing which isn't loaded in memory at once.
+// Usage is the same as of sql.Rows: call Next before every Value, check Err after the loop, Close at the end.
+type Rows[T any] interface {
+	Next() bool
+	Value() T
+	Err() error
+	Close() error
+}
+
+type sliceRows[T any] struct {
+	items []T
+	idx   int
+}
+
+// FromSlice streams items of in-memory storages.
+func FromSlice[T any](items []T) Rows[T] {
+	return &sliceRows[T]{items: items, idx: -1}
+}
+
+func (r *sliceRows[T]) Next() bool {
+	if r.idx+1 >= len(r.items) {
+		return false
+	}
+	r.idx++
+	return true
+}
+
+func (r *sliceRows[T]) Value() T {
+	return r.items[r.idx]
+}
+
+func (*sliceRows[T]) Err() error {
+	return nil
+}
+
+func (*sliceRows[T]) Close() error {
+	return nil
+}
+
+type sqlRows[T any] struct {
+	rows    *sql.Rows
+	scan    func(rows *sql.Rows) (T, error)
+	current T
+	err     error
+}
+
+// FromSQL streams rows of the query, every row is converted by scan.
+// The connection is held until Close.
+func FromSQL[T any](rows *sql.Rows, scan func(rows *sql.Rows) (T, error)) Rows[T] {
+	return &sqlRows[T]{rows: rows, scan: scan}
+}
+
+func (r *sqlRows[T]) Next() bool {
+	if r.err != nil || !r.rows.Next() {
+		return false
+	}
+	r.current, r.err = r.scan(r.rows)
+	return r.err == nil
+}
+
+func (r *sqlRows[T]) Value() T {
+	return r.current
+}
+
+func (r *sqlRows[T]) Err() error {
+	if r.err != nil {
+		return r.err
+	}
+	return r.rows.Err()
+}
+
+func (r *sqlRows[T]) Close() error {
+	return r.rows.Close()
+}
+
+type mappedRows[T, U any] struct {
+	Rows[T]
+	fn func(T) U
+}
+
+// Map converts every value of rows by fn.
+func Map[T, U any](rows Rows[T], fn func(T) U) Rows[U] {
+	return &mappedRows[T, U]{Rows: rows, fn: fn}
+}
+
+func (r *mappedRows[T, U]) Value() U {
+	return r.fn(r.Rows.Value())
+}
+
+type mergedRows[T any] struct {
+	less    func(left, right T) bool
+	sources []Rows[T]
+	pending []bool
+	started bool
+	last    int
+	err     error
+}
+
+// Merge interleaves sources sorted by less into one sorted stream,
+// on equal values the earlier source goes first. The first error of sources stops the stream.
+func Merge[T any](less func(left, right T) bool, sources ...Rows[T]) Rows[T] {
+	return &mergedRows[T]{less: less, sources: sources, pending: make([]bool, len(sources))}
+}
+
+func (r *mergedRows[T]) Next() bool {
+	if r.err != nil {
+		return false
+	}
+	if !r.started {
+		r.started = true
+		for idx := range r.sources {
+			if !r.advance(idx) {
+				return false
+			}
+		}
+	} else if !r.advance(r.last) {
+		return false
+	}
+
+	next := -1
+	for idx, source := range r.sources {
+		if r.pending[idx] && (next < 0 || r.less(source.Value(), r.sources[next].Value())) {
+			next = idx
+		}
+	}
+	if next < 0 {
+		return false
+	}
+	r.last = next
+	return true
+}
+
+// advance moves the source to its next value, false means the source failed.
+func (r *mergedRows[T]) advance(idx int) bool {
+	r.pending[idx] = r.sources[idx].Next()
+	if !r.pending[idx] {
+		r.err = r.sources[idx].Err()
+	}
+	return r.err == nil
+}
+
+func (r *mergedRows[T]) Value() T {
+	return r.sources[r.last].Value()
+}
+
+func (r *mergedRows[T]) Err() error {
+	return r.err
+}
+
+func (r *mergedRows[T]) Close() error {
+	var err error
+	for _, source := range r.sources {
+		if closeErr := source.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
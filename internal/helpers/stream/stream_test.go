@@ -0,0 +1,84 @@
+package stream
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var errBroken = errors.New("broken stream")
+
+type brokenRows struct {
+	Rows[int]
+}
+
+func (r *brokenRows) Next() bool {
+	return r.Rows.Next()
+}
+
+func (r *brokenRows) Err() error {
+	return errBroken
+}
+
+func collect[T any](rows Rows[T]) []T {
+	values := []T{}
+	for rows.Next() {
+		values = append(values, rows.Value())
+	}
+	return values
+}
+
+func TestMerge(t *testing.T) {
+	testCases := []struct {
+		testName       string
+		sources        func() []Rows[int]
+		expectedValues []int
+		expectedError  error
+	}{
+		{
+			testName:       "no sources",
+			sources:        func() []Rows[int] { return nil },
+			expectedValues: []int{},
+		},
+		{
+			testName: "empty sources",
+			sources: func() []Rows[int] {
+				return []Rows[int]{FromSlice([]int{}), FromSlice[int](nil)}
+			},
+			expectedValues: []int{},
+		},
+		{
+			testName: "interleaved sources",
+			sources: func() []Rows[int] {
+				return []Rows[int]{FromSlice([]int{1, 4, 9}), FromSlice([]int{2, 3, 10, 11}), FromSlice([]int{5})}
+			},
+			expectedValues: []int{1, 2, 3, 4, 5, 9, 10, 11},
+		},
+		{
+			testName: "equal values keep order of sources",
+			sources: func() []Rows[int] {
+				return []Rows[int]{FromSlice([]int{10}), Map(FromSlice([]int{1}), func(v int) int { return v * 10 })}
+			},
+			expectedValues: []int{10, 10},
+		},
+		{
+			testName: "broken source stops the stream",
+			sources: func() []Rows[int] {
+				return []Rows[int]{FromSlice([]int{1, 2, 3}), &brokenRows{FromSlice([]int{2})}}
+			},
+			expectedValues: []int{1, 2, 2},
+			expectedError:  errBroken,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			merged := Merge(func(left, right int) bool { return left < right }, tc.sources()...)
+			values := collect(merged)
+			assert.Equal(t, tc.expectedValues, values, "values don't match")
+			assert.ErrorIs(t, merged.Err(), tc.expectedError, "errors don't match")
+			assert.Nil(t, merged.Close(), "close failed")
+		})
+	}
+}
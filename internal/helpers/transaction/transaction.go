@@ -5,11 +5,21 @@ import (
 	"database/sql"
 )
 
+// Trx wraps sql.Tx for postgres storages. Storages without a database
+// (in-memory) register undo functions via OnRollback instead.
 type Trx struct {
 	*sql.Tx
+	undo []func()
+}
+
+// OnRollback registers fn to be called if the transaction is rolled back.
+// Functions are called in reverse order of registration.
+func (t *Trx) OnRollback(fn func()) {
+	t.undo = append(t.undo, fn)
 }
 
 func (t *Trx) Commit() error {
+	t.undo = nil
 	if t.Tx != nil {
 		return t.Tx.Commit()
 	}
@@ -17,6 +27,10 @@ func (t *Trx) Commit() error {
 }
 
 func (t *Trx) Rollback() error {
+	for i := len(t.undo) - 1; i >= 0; i-- {
+		t.undo[i]()
+	}
+	t.undo = nil
 	if t.Tx != nil {
 		return t.Tx.Rollback()
 	}
@@ -0,0 +1,36 @@
+package transaction
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRollback(t *testing.T) {
+	trx, _ := BeginTx(context.TODO(), nil)
+
+	var calls []int
+	trx.OnRollback(func() { calls = append(calls, 1) })
+	trx.OnRollback(func() { calls = append(calls, 2) })
+
+	err := trx.Rollback()
+	assert.Nil(t, err, "not expected error")
+	assert.Equal(t, []int{2, 1}, calls, "undo functions should be called in reverse order")
+
+	err = trx.Rollback()
+	assert.Nil(t, err, "not expected error")
+	assert.Equal(t, []int{2, 1}, calls, "undo functions should be called only once")
+}
+
+func TestCommit(t *testing.T) {
+	trx, _ := BeginTx(context.TODO(), nil)
+
+	called := false
+	trx.OnRollback(func() { called = true })
+
+	err := trx.Commit()
+	assert.Nil(t, err, "not expected error")
+	trx.Rollback()
+	assert.False(t, called, "undo function shouldn't be called after commit")
+}
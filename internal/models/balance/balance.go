@@ -1,6 +1,53 @@
 package balance
 
+import (
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/ry461ch/loyalty_system/internal/models/money"
+)
+
 type Balance struct {
-	Current   float64 `json:"current"`
-	Withdrawn float64 `json:"withdrawn"`
+	Current   money.Money `json:"current"`
+	Withdrawn money.Money `json:"withdrawn"`
+	// ExpiringSoon is the part of current balance which expires within Expiry.SoonWindow
+	ExpiringSoon money.Money `json:"expiring_soon"`
+	// Debt is the part of taken back accruals which was already spent, next accruals repay it first.
+	// Current balance is zero while there is a debt.
+	Debt money.Money `json:"debt,omitempty"`
+}
+
+// Lot is the part of current balance accrued for one order. Withdrawals consume lots
+// in order of expiration, points added without a lot never expire and are consumed last.
+type Lot struct {
+	ID        uuid.UUID
+	UserID    uuid.UUID
+	OrderID   string
+	Amount    money.Money
+	Remaining money.Money
+	AccruedAt time.Time
+	ExpiresAt *time.Time // nil never expires
+}
+
+// Expiry is the policy of points expiration.
+type Expiry struct {
+	// Lifetime in months after the accrual, 0 disables expiration
+	Lifetime   int
+	SoonWindow time.Duration
+}
+
+func (e Expiry) ExpiresAt(accruedAt time.Time) *time.Time {
+	if e.Lifetime <= 0 {
+		return nil
+	}
+	expiresAt := accruedAt.AddDate(0, e.Lifetime, 0)
+	return &expiresAt
+}
+
+// Clawback is the policy of taking back accruals of returned orders.
+type Clawback struct {
+	// AllowDebt records already spent points as debt, otherwise
+	// at most current balance is taken back and the rest is written off
+	AllowDebt bool
 }
@@ -0,0 +1,8 @@
+package exceptions
+
+import "errors"
+
+var (
+	ErrExportBadFormat = errors.New("bad export format")
+	ErrExportBadPeriod = errors.New("bad export period")
+)
@@ -0,0 +1,8 @@
+package exceptions
+
+import "errors"
+
+var (
+	ErrLedgerBadMovementType = errors.New("bad ledger movement type")
+	ErrBalanceMismatch       = errors.New("balance doesn't match ledger")
+)
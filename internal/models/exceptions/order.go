@@ -5,6 +5,7 @@ import "errors"
 var (
 	ErrOrderBadIDFormat         = errors.New("bad order id format")
 	ErrOrderBadStatusFormat     = errors.New("bad order status format")
+	ErrOrderBadStatusTransition = errors.New("bad order status transition")
 	ErrOrderConflictSameUser    = errors.New("order already exists with same user")
 	ErrOrderConflictAnotherUser = errors.New("order already exists with another user")
 	ErrOrderNotFound            = errors.New("order not found")
@@ -0,0 +1,8 @@
+package exceptions
+
+import "errors"
+
+var (
+	ErrPaginationBadCursor = errors.New("bad pagination cursor")
+	ErrPaginationBadLimit  = errors.New("bad pagination limit")
+)
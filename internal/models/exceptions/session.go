@@ -0,0 +1,9 @@
+package exceptions
+
+import "errors"
+
+var (
+	ErrSessionNotFound  = errors.New("session not found")
+	ErrSessionConflict  = errors.New("session was changed concurrently")
+	ErrSessionBadFormat = errors.New("session bad data format")
+)
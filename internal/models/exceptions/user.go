@@ -1,10 +1,28 @@
 package exceptions
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+	"time"
+)
 
 var (
 	ErrUserNotFound       = errors.New("user not found")
 	ErrUserAuthentication = errors.New("user unauthorized")
 	ErrUserConflict       = errors.New("user already exists")
 	ErrUserBadFormat      = errors.New("user bad data format")
+	ErrUserLocked         = errors.New("user login is temporarily locked")
 )
+
+// LockedError is returned while logins of a user or from an address are blocked after too many failures.
+type LockedError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LockedError) Error() string {
+	return fmt.Sprintf("too many failed login attempts, retry after %s", e.RetryAfter)
+}
+
+func (e *LockedError) Is(target error) bool {
+	return target == ErrUserLocked
+}
@@ -5,4 +5,6 @@ import "errors"
 var (
 	ErrWithdrawalNotFound  = errors.New("withdrawal not found")
 	ErrWithdrawalBadFormat = errors.New("withdrawal bad format")
+	ErrWithdrawalConflict  = errors.New("withdrawal already exists")
+	ErrWithdrawalRefunded  = errors.New("withdrawal is already refunded")
 )
@@ -0,0 +1,83 @@
+package export
+
+import (
+	"time"
+
+	"github.com/ry461ch/loyalty_system/internal/models/exceptions"
+	"github.com/ry461ch/loyalty_system/internal/models/money"
+	"github.com/ry461ch/loyalty_system/internal/models/order"
+	"github.com/ry461ch/loyalty_system/internal/models/withdrawal"
+)
+
+type Format string
+
+const (
+	CSV  Format = "csv"
+	JSON Format = "json"
+)
+
+// ParseFormat parses format of the export, JSON is used by default.
+func ParseFormat(name string) (Format, error) {
+	switch Format(name) {
+	case "", JSON:
+		return JSON, nil
+	case CSV:
+		return CSV, nil
+	default:
+		return "", exceptions.ErrExportBadFormat
+	}
+}
+
+// Query selects entries happened in [From, To), nil bound isn't applied.
+type Query struct {
+	From *time.Time
+	To   *time.Time
+}
+
+func (q *Query) Validate() error {
+	if q.From != nil && q.To != nil && !q.From.Before(*q.To) {
+		return exceptions.ErrExportBadPeriod
+	}
+	return nil
+}
+
+type EntryType string
+
+const (
+	ORDER      EntryType = "ORDER"
+	ACCRUAL    EntryType = "ACCRUAL"
+	WITHDRAWAL EntryType = "WITHDRAWAL"
+)
+
+// Entry is a single row of the user history: uploaded order, accrual for the order or withdrawal.
+type Entry struct {
+	Type    EntryType    `json:"type"`
+	At      time.Time    `json:"at"`
+	OrderID string       `json:"order"`
+	Status  string       `json:"status,omitempty"`
+	Amount  *money.Money `json:"amount,omitempty"`
+}
+
+// FromOrder shows the order with its current status, accrual goes as a separate entry.
+func FromOrder(o order.Order) Entry {
+	return Entry{Type: ORDER, At: o.CreatedAt, OrderID: o.ID, Status: o.Status.String()}
+}
+
+func FromAccrual(e order.Event) Entry {
+	return Entry{Type: ACCRUAL, At: e.CreatedAt, OrderID: e.OrderID, Amount: e.Accrual}
+}
+
+func FromWithdrawal(w withdrawal.Withdrawal) Entry {
+	return Entry{Type: WITHDRAWAL, At: *w.CreatedAt, OrderID: w.OrderID, Status: w.Status.String(), Amount: &w.Sum}
+}
+
+// CSVHeader names columns of CSVRecord.
+var CSVHeader = []string{"type", "at", "order", "status", "amount"}
+
+func (e *Entry) CSVRecord() []string {
+	amount := ""
+	if e.Amount != nil {
+		amount = e.Amount.String()
+	}
+	return []string{string(e.Type), e.At.Format(time.RFC3339Nano), e.OrderID, e.Status, amount}
+}
@@ -0,0 +1,160 @@
+package ledger
+
+import (
+	"database/sql/driver"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/ry461ch/loyalty_system/internal/models/exceptions"
+	"github.com/ry461ch/loyalty_system/internal/models/money"
+)
+
+type MovementType int32
+
+const (
+	ACCRUAL MovementType = iota
+	WITHDRAWAL
+	EXPIRY
+	REFUND
+	CLAWBACK
+)
+
+func (mt MovementType) String() string {
+	switch mt {
+	case ACCRUAL:
+		return "ACCRUAL"
+	case WITHDRAWAL:
+		return "WITHDRAWAL"
+	case EXPIRY:
+		return "EXPIRY"
+	case REFUND:
+		return "REFUND"
+	case CLAWBACK:
+		return "CLAWBACK"
+	default:
+		return ""
+	}
+}
+
+func (mt MovementType) MarshalJSON() ([]byte, error) {
+	if mt.String() == "" {
+		return nil, exceptions.ErrLedgerBadMovementType
+	}
+	return []byte("\"" + mt.String() + "\""), nil
+}
+
+func (mt MovementType) Value() (driver.Value, error) {
+	if mt.String() == "" {
+		return nil, exceptions.ErrLedgerBadMovementType
+	}
+	return mt.String(), nil
+}
+
+func (mt *MovementType) Scan(value interface{}) error {
+	sv, err := driver.String.ConvertValue(value)
+	if err != nil {
+		return errors.New("failed to scan MovementType")
+	}
+
+	switch sv {
+	case "ACCRUAL":
+		*mt = ACCRUAL
+	case "WITHDRAWAL":
+		*mt = WITHDRAWAL
+	case "EXPIRY":
+		*mt = EXPIRY
+	case "REFUND":
+		*mt = REFUND
+	case "CLAWBACK":
+		*mt = CLAWBACK
+	default:
+		return exceptions.ErrLedgerBadMovementType
+	}
+	return nil
+}
+
+type Account int32
+
+const (
+	// CURRENT is user's spendable balance
+	CURRENT Account = iota
+	// WITHDRAWN is user's total of spent points
+	WITHDRAWN
+	// ACCRUALS is the system account all accruals are funded from and clawbacks return to
+	ACCRUALS
+	// EXPIRED is the system account expired points go to
+	EXPIRED
+)
+
+func (a Account) String() string {
+	switch a {
+	case CURRENT:
+		return "CURRENT"
+	case WITHDRAWN:
+		return "WITHDRAWN"
+	case ACCRUALS:
+		return "ACCRUALS"
+	case EXPIRED:
+		return "EXPIRED"
+	default:
+		return ""
+	}
+}
+
+func (a Account) Value() (driver.Value, error) {
+	if a.String() == "" {
+		return nil, errors.New("invalid account")
+	}
+	return a.String(), nil
+}
+
+// Entry is an immutable ledger record, entries of one movement sum up to zero.
+type Entry struct {
+	MovementID uuid.UUID
+	UserID     *uuid.UUID // nil for system accounts
+	Account    Account
+	Amount     money.Money
+	Type       MovementType
+	OrderID    string
+	CreatedAt  time.Time
+}
+
+// Movement is a change of user's current balance, Amount is negative for withdrawals, expiries and clawbacks.
+type Movement struct {
+	ID        uuid.UUID    `json:"-"`
+	UserID    uuid.UUID    `json:"-"`
+	Type      MovementType `json:"type"`
+	OrderID   string       `json:"order"`
+	Amount    money.Money  `json:"amount"`
+	CreatedAt time.Time    `json:"processed_at"`
+}
+
+// Entries splits the movement into double-entry records.
+func (m *Movement) Entries() []Entry {
+	userID := m.UserID
+	userEntry := Entry{
+		MovementID: m.ID,
+		UserID:     &userID,
+		Account:    CURRENT,
+		Amount:     m.Amount,
+		Type:       m.Type,
+		OrderID:    m.OrderID,
+		CreatedAt:  m.CreatedAt,
+	}
+
+	counterEntry := userEntry
+	counterEntry.Amount = -m.Amount
+	switch m.Type {
+	case ACCRUAL, CLAWBACK:
+		counterEntry.UserID = nil
+		counterEntry.Account = ACCRUALS
+	case WITHDRAWAL, REFUND:
+		counterEntry.Account = WITHDRAWN
+	case EXPIRY:
+		counterEntry.UserID = nil
+		counterEntry.Account = EXPIRED
+	}
+	return []Entry{userEntry, counterEntry}
+}
@@ -0,0 +1,121 @@
+package ledger
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ry461ch/loyalty_system/internal/models/money"
+)
+
+func TestEntries(t *testing.T) {
+	testCases := []struct {
+		testName               string
+		movement               Movement
+		expectedCounterAccount Account
+		expectedSystemEntry    bool
+	}{
+		{
+			testName: "accrual",
+			movement: Movement{
+				ID:      uuid.New(),
+				UserID:  uuid.New(),
+				Type:    ACCRUAL,
+				OrderID: "1115",
+				Amount:  money.New(500),
+			},
+			expectedCounterAccount: ACCRUALS,
+			expectedSystemEntry:    true,
+		},
+		{
+			testName: "withdrawal",
+			movement: Movement{
+				ID:      uuid.New(),
+				UserID:  uuid.New(),
+				Type:    WITHDRAWAL,
+				OrderID: "1321",
+				Amount:  money.New(-200),
+			},
+			expectedCounterAccount: WITHDRAWN,
+			expectedSystemEntry:    false,
+		},
+		{
+			testName: "refund",
+			movement: Movement{
+				ID:      uuid.New(),
+				UserID:  uuid.New(),
+				Type:    REFUND,
+				OrderID: "1321",
+				Amount:  money.New(200),
+			},
+			expectedCounterAccount: WITHDRAWN,
+			expectedSystemEntry:    false,
+		},
+		{
+			testName: "expiry",
+			movement: Movement{
+				ID:      uuid.New(),
+				UserID:  uuid.New(),
+				Type:    EXPIRY,
+				OrderID: "1115",
+				Amount:  money.New(-100),
+			},
+			expectedCounterAccount: EXPIRED,
+			expectedSystemEntry:    true,
+		},
+		{
+			testName: "clawback",
+			movement: Movement{
+				ID:      uuid.New(),
+				UserID:  uuid.New(),
+				Type:    CLAWBACK,
+				OrderID: "1115",
+				Amount:  money.New(-100),
+			},
+			expectedCounterAccount: ACCRUALS,
+			expectedSystemEntry:    true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			entries := tc.movement.Entries()
+			assert.Equal(t, 2, len(entries), "num of entries don't match")
+
+			var total money.Money
+			for _, entry := range entries {
+				total += entry.Amount
+				assert.Equal(t, tc.movement.ID, entry.MovementID, "movement ids don't match")
+			}
+			assert.Equal(t, money.Money(0), total, "entries don't sum up to zero")
+
+			assert.Equal(t, CURRENT, entries[0].Account, "accounts don't match")
+			assert.Equal(t, tc.movement.UserID, *entries[0].UserID, "users don't match")
+			assert.Equal(t, tc.expectedCounterAccount, entries[1].Account, "accounts don't match")
+			assert.Equal(t, tc.expectedSystemEntry, entries[1].UserID == nil, "system entry mismatch")
+		})
+	}
+}
+
+func TestMarshal(t *testing.T) {
+	movement := Movement{
+		ID:        uuid.New(),
+		UserID:    uuid.New(),
+		Type:      WITHDRAWAL,
+		OrderID:   "1321",
+		Amount:    money.FromMinor(-5050),
+		CreatedAt: time.Date(2020, 12, 9, 16, 9, 53, 0, time.UTC),
+	}
+
+	marshaled, err := json.Marshal(movement)
+	assert.Nil(t, err, "not expected error")
+	assert.JSONEq(t, `{
+		"type": "WITHDRAWAL",
+		"order": "1321",
+		"amount": -50.5,
+		"processed_at": "2020-12-09T16:09:53Z"
+	}`, string(marshaled), "json doesn't match")
+}
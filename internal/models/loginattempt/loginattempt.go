@@ -0,0 +1,56 @@
+package loginattempt
+
+import (
+	"time"
+
+	"github.com/ry461ch/loyalty_system/internal/helpers/retry"
+)
+
+// Attempts are consecutive failed logins for a key: a login or a client address.
+type Attempts struct {
+	Key           string
+	Failures      int
+	LastFailureAt time.Time
+}
+
+func LoginKey(login string) string {
+	return "login:" + login
+}
+
+func AddrKey(addr string) string {
+	return "addr:" + addr
+}
+
+// Limits allow FreeAttempts failures in a row, every next failure blocks the key
+// for a doubled delay up to Backoff.MaxDelay. Failures older than Window are forgotten.
+type Limits struct {
+	FreeAttempts int
+	Backoff      retry.Policy
+	Window       time.Duration
+}
+
+// Retention is the time after which attempts neither count nor lock the key.
+func (l Limits) Retention() time.Duration {
+	return max(l.Window, l.Backoff.MaxDelay)
+}
+
+// LockedUntil returns zero time if the key isn't locked.
+func (a *Attempts) LockedUntil(limits Limits) time.Time {
+	if a.Failures <= limits.FreeAttempts {
+		return time.Time{}
+	}
+	return a.LastFailureAt.Add(limits.Backoff.Delay(a.Failures - limits.FreeAttempts))
+}
+
+// Reserve counts a new attempt as failed unless the key is locked at now.
+func (a *Attempts) Reserve(limits Limits, now time.Time) bool {
+	if a.LockedUntil(limits).After(now) {
+		return false
+	}
+	if now.Sub(a.LastFailureAt) > limits.Window {
+		a.Failures = 0
+	}
+	a.Failures++
+	a.LastFailureAt = now
+	return true
+}
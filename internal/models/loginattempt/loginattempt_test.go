@@ -0,0 +1,112 @@
+package loginattempt
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ry461ch/loyalty_system/internal/helpers/retry"
+)
+
+func TestLockedUntil(t *testing.T) {
+	lastFailureAt := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	limits := Limits{
+		FreeAttempts: 3,
+		Backoff:      retry.Policy{BaseDelay: time.Second, MaxDelay: time.Minute},
+		Window:       time.Hour,
+	}
+
+	testCases := []struct {
+		testName            string
+		failures            int
+		expectedLockedUntil time.Time
+	}{
+		{
+			testName:            "no failures",
+			failures:            0,
+			expectedLockedUntil: time.Time{},
+		},
+		{
+			testName:            "free attempts",
+			failures:            3,
+			expectedLockedUntil: time.Time{},
+		},
+		{
+			testName:            "first delay",
+			failures:            4,
+			expectedLockedUntil: lastFailureAt.Add(time.Second),
+		},
+		{
+			testName:            "progressive delay",
+			failures:            6,
+			expectedLockedUntil: lastFailureAt.Add(4 * time.Second),
+		},
+		{
+			testName:            "lockout",
+			failures:            100,
+			expectedLockedUntil: lastFailureAt.Add(time.Minute),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			attempts := Attempts{Key: LoginKey("login"), Failures: tc.failures, LastFailureAt: lastFailureAt}
+			assert.Equal(t, tc.expectedLockedUntil, attempts.LockedUntil(limits))
+		})
+	}
+}
+
+func TestReserve(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	limits := Limits{
+		FreeAttempts: 3,
+		Backoff:      retry.Policy{BaseDelay: time.Second, MaxDelay: time.Minute},
+		Window:       time.Hour,
+	}
+
+	testCases := []struct {
+		testName         string
+		failures         int
+		lastFailureAt    time.Time
+		expectedReserved bool
+		expectedFailures int
+	}{
+		{
+			testName:         "free attempt",
+			failures:         3,
+			lastFailureAt:    now.Add(-time.Millisecond),
+			expectedReserved: true,
+			expectedFailures: 4,
+		},
+		{
+			testName:         "locked",
+			failures:         4,
+			lastFailureAt:    now.Add(-time.Millisecond),
+			expectedReserved: false,
+			expectedFailures: 4,
+		},
+		{
+			testName:         "lock expired",
+			failures:         4,
+			lastFailureAt:    now.Add(-time.Second),
+			expectedReserved: true,
+			expectedFailures: 5,
+		},
+		{
+			testName:         "failures out of window",
+			failures:         4,
+			lastFailureAt:    now.Add(-2 * time.Hour),
+			expectedReserved: true,
+			expectedFailures: 1,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			attempts := Attempts{Key: LoginKey("login"), Failures: tc.failures, LastFailureAt: tc.lastFailureAt}
+			assert.Equal(t, tc.expectedReserved, attempts.Reserve(limits, now), "reservations don't match")
+			assert.Equal(t, tc.expectedFailures, attempts.Failures, "failures don't match")
+		})
+	}
+}
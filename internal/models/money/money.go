@@ -0,0 +1,131 @@
+package money
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"math"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/ry461ch/loyalty_system/internal/models/exceptions"
+)
+
+// Money is an amount of points in minor units (hundredths).
+// It is serialized to JSON as a plain decimal number (e.g. 500.5)
+// and stored in postgres as NUMERIC.
+type Money int64
+
+const minorUnitsInUnit = 100
+
+// maxDecimalLength bounds input of Parse, it fits any int64 amount with a lot of fractional digits.
+const maxDecimalLength = 64
+
+var decimalFormat = regexp.MustCompile(`^-?[0-9]+(\.[0-9]+)?$`)
+
+func New(units int64) Money {
+	return Money(units * minorUnitsInUnit)
+}
+
+func FromMinor(minor int64) Money {
+	return Money(minor)
+}
+
+func (m Money) Minor() int64 {
+	return int64(m)
+}
+
+// Parse parses decimal string, rounding it to hundredths half away from zero.
+// Only plain [-]digits[.digits] form is accepted, exponents like 1e1000000 are too costly to expand.
+func Parse(s string) (Money, error) {
+	s = strings.TrimSpace(s)
+	if len(s) > maxDecimalLength || !decimalFormat.MatchString(s) {
+		return 0, exceptions.ErrBalanceBadAmountFormat
+	}
+	r, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return 0, exceptions.ErrBalanceBadAmountFormat
+	}
+
+	num := new(big.Int).Abs(r.Num())
+	num.Mul(num, big.NewInt(minorUnitsInUnit))
+	quo, rem := new(big.Int).QuoRem(num, r.Denom(), new(big.Int))
+	if rem.Lsh(rem, 1).Cmp(r.Denom()) >= 0 {
+		quo.Add(quo, big.NewInt(1))
+	}
+	if !quo.IsInt64() {
+		return 0, exceptions.ErrBalanceBadAmountFormat
+	}
+
+	minor := quo.Int64()
+	if r.Sign() < 0 {
+		minor = -minor
+	}
+	return Money(minor), nil
+}
+
+func (m Money) String() string {
+	sign := ""
+	abs := uint64(m)
+	if m < 0 {
+		sign = "-"
+		abs = uint64(-m)
+	}
+
+	units := strconv.FormatUint(abs/minorUnitsInUnit, 10)
+	fraction := abs % minorUnitsInUnit
+	switch {
+	case fraction == 0:
+		return sign + units
+	case fraction%10 == 0:
+		return fmt.Sprintf("%s%s.%d", sign, units, fraction/10)
+	default:
+		return fmt.Sprintf("%s%s.%02d", sign, units, fraction)
+	}
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+func (m *Money) UnmarshalJSON(data []byte) error {
+	parsed, err := Parse(string(data))
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+func (m Money) Value() (driver.Value, error) {
+	return m.String(), nil
+}
+
+func (m *Money) Scan(src any) error {
+	switch value := src.(type) {
+	case string:
+		return m.parseInto(value)
+	case []byte:
+		return m.parseInto(string(value))
+	case int64:
+		*m = New(value)
+		return nil
+	case float64:
+		if math.IsNaN(value) || math.IsInf(value, 0) {
+			return fmt.Errorf("money: can't scan %v", value)
+		}
+		return m.parseInto(strconv.FormatFloat(value, 'f', -1, 64))
+	default:
+		return fmt.Errorf("money: can't scan %T", src)
+	}
+}
+
+func (m *Money) parseInto(s string) error {
+	parsed, err := Parse(s)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
@@ -0,0 +1,107 @@
+package money
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ry461ch/loyalty_system/internal/models/exceptions"
+)
+
+func TestParse(t *testing.T) {
+	testCases := []struct {
+		testName      string
+		input         string
+		expectedMoney Money
+		expectedErr   error
+	}{
+		{testName: "integer", input: "500", expectedMoney: FromMinor(50000)},
+		{testName: "one decimal", input: "500.5", expectedMoney: FromMinor(50050)},
+		{testName: "two decimals", input: "0.01", expectedMoney: FromMinor(1)},
+		{testName: "exponent", input: "1e2", expectedErr: exceptions.ErrBalanceBadAmountFormat},
+		{testName: "huge exponent", input: "1e1000000", expectedErr: exceptions.ErrBalanceBadAmountFormat},
+		{testName: "fraction", input: "1/2", expectedErr: exceptions.ErrBalanceBadAmountFormat},
+		{testName: "too long", input: "0." + strings.Repeat("0", 100), expectedErr: exceptions.ErrBalanceBadAmountFormat},
+		{testName: "round half up", input: "0.005", expectedMoney: FromMinor(1)},
+		{testName: "round down", input: "0.0049", expectedMoney: FromMinor(0)},
+		{testName: "negative round half away from zero", input: "-0.125", expectedMoney: FromMinor(-13)},
+		{testName: "float drift", input: "0.1", expectedMoney: FromMinor(10)},
+		{testName: "not a number", input: "abc", expectedErr: exceptions.ErrBalanceBadAmountFormat},
+		{testName: "string", input: `"500"`, expectedErr: exceptions.ErrBalanceBadAmountFormat},
+		{testName: "overflow", input: "1000000000000000000000000000000", expectedErr: exceptions.ErrBalanceBadAmountFormat},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			parsed, err := Parse(tc.input)
+			assert.ErrorIs(t, err, tc.expectedErr, "errors don't match")
+			assert.Equal(t, tc.expectedMoney, parsed, "money doesn't match")
+		})
+	}
+}
+
+func TestString(t *testing.T) {
+	testCases := []struct {
+		testName       string
+		money          Money
+		expectedString string
+	}{
+		{testName: "integer", money: New(500), expectedString: "500"},
+		{testName: "one decimal", money: FromMinor(50050), expectedString: "500.5"},
+		{testName: "two decimals", money: FromMinor(50005), expectedString: "500.05"},
+		{testName: "zero", money: FromMinor(0), expectedString: "0"},
+		{testName: "negative", money: FromMinor(-150), expectedString: "-1.5"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			assert.Equal(t, tc.expectedString, tc.money.String(), "strings don't match")
+		})
+	}
+}
+
+func TestJSON(t *testing.T) {
+	type balance struct {
+		Current Money `json:"current"`
+	}
+
+	var parsed balance
+	err := json.Unmarshal([]byte(`{"current": 500.5}`), &parsed)
+	assert.Nil(t, err, "not expected error")
+	assert.Equal(t, FromMinor(50050), parsed.Current, "money doesn't match")
+
+	marshaled, _ := json.Marshal(parsed)
+	assert.JSONEq(t, `{"current": 500.5}`, string(marshaled), "json doesn't match")
+}
+
+func TestNoDrift(t *testing.T) {
+	var sum Money
+	for range 10 {
+		sum += FromMinor(10)
+	}
+	assert.Equal(t, New(1), sum, "sum doesn't match")
+}
+
+func TestScan(t *testing.T) {
+	testCases := []struct {
+		testName      string
+		src           any
+		expectedMoney Money
+	}{
+		{testName: "string", src: "500.50", expectedMoney: FromMinor(50050)},
+		{testName: "bytes", src: []byte("0.10"), expectedMoney: FromMinor(10)},
+		{testName: "int", src: int64(5), expectedMoney: New(5)},
+		{testName: "float", src: float64(0.1) + float64(0.2), expectedMoney: FromMinor(30)},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			var scanned Money
+			err := scanned.Scan(tc.src)
+			assert.Nil(t, err, "not expected error")
+			assert.Equal(t, tc.expectedMoney, scanned, "money doesn't match")
+		})
+	}
+}
@@ -5,9 +5,12 @@ import (
 	"database/sql/driver"
 	"encoding/json"
 	"errors"
+	"slices"
 	"time"
 
+	"github.com/ry461ch/loyalty_system/internal/helpers/pagination"
 	"github.com/ry461ch/loyalty_system/internal/models/exceptions"
+	"github.com/ry461ch/loyalty_system/internal/models/money"
 )
 
 type Status int32
@@ -17,8 +20,26 @@ const (
 	PROCESSING
 	INVALID
 	PROCESSED
+	// RETURNED order was processed, but then returned to the merchant and its accrual taken back
+	RETURNED
 )
 
+// CanTransitionTo reports whether order may move from s to next status:
+// NEW -> PROCESSING -> PROCESSED/INVALID, NEW may skip PROCESSING, PROCESSED -> RETURNED.
+// Repeating the same non-final status is allowed and is a no-op.
+func (s Status) CanTransitionTo(next Status) bool {
+	switch s {
+	case NEW:
+		return next != RETURNED
+	case PROCESSING:
+		return next != NEW && next != RETURNED
+	case PROCESSED:
+		return next == RETURNED
+	default:
+		return false
+	}
+}
+
 func (s Status) MarshalJSON() ([]byte, error) {
 	switch s {
 	case NEW:
@@ -29,6 +50,8 @@ func (s Status) MarshalJSON() ([]byte, error) {
 		return []byte("\"INVALID\""), nil
 	case PROCESSED:
 		return []byte("\"PROCESSED\""), nil
+	case RETURNED:
+		return []byte("\"RETURNED\""), nil
 	default:
 		return nil, exceptions.ErrOrderBadStatusFormat
 	}
@@ -44,11 +67,22 @@ func (s Status) Value() (driver.Value, error) {
 		return "PROCESSED", nil
 	case INVALID:
 		return "INVALID", nil
+	case RETURNED:
+		return "RETURNED", nil
 	default:
 		return nil, errors.New("invalid status")
 	}
 }
 
+// String returns status name as it is stored and shown to users.
+func (s Status) String() string {
+	name, err := s.Value()
+	if err != nil {
+		return "UNKNOWN"
+	}
+	return name.(string)
+}
+
 func (s *Status) Scan(value interface{}) error {
 	if value == nil {
 		*s = NEW
@@ -74,12 +108,25 @@ func (s *Status) Scan(value interface{}) error {
 		*s = PROCESSED
 	case "INVALID":
 		*s = INVALID
+	case "RETURNED":
+		*s = RETURNED
 	default:
 		return errors.New("invalid status")
 	}
 	return nil
 }
 
+// ParseStatus parses status name as it is shown to users.
+func ParseStatus(name string) (Status, error) {
+	var s Status
+	err := s.Scan(name)
+	if err != nil {
+		return NEW, exceptions.ErrOrderBadStatusFormat
+	}
+	return s, nil
+}
+
+// UnmarshalJSON parses statuses of accrual system, which knows nothing about returns.
 func (s *Status) UnmarshalJSON(data []byte) error {
 	switch {
 	case bytes.Equal(data, []byte("\"REGISTERED\"")):
@@ -96,11 +143,108 @@ func (s *Status) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
+// Lease is a claim of waiting orders by one gophermart instance. It expires after TTL,
+// so orders claimed by a crashed instance are picked up by the others.
+type Lease struct {
+	Owner string
+	TTL   time.Duration
+}
+
+// ReasonGivenUp is set for orders which accrual system hasn't processed within the give-up horizon.
+const ReasonGivenUp = "accrual system hasn't processed the order in time"
+
+// MaxBatchSize bounds the number of orders uploaded in one request.
+const MaxBatchSize = 1000
+
+// MaxBatchBodySize bounds the request body of the batch upload, it fits MaxBatchSize long numbers
+// with quotes, separators and whitespace.
+const MaxBatchBodySize = MaxBatchSize * 64
+
+type UploadStatus string
+
+const (
+	UploadAccepted  UploadStatus = "ACCEPTED"
+	UploadDuplicate UploadStatus = "DUPLICATE" // already uploaded by the same user
+	UploadConflict  UploadStatus = "CONFLICT"  // already uploaded by another user
+	UploadInvalid   UploadStatus = "INVALID"   // bad order number
+)
+
+// UploadResult is the outcome of one order of the batch upload.
+type UploadResult struct {
+	ID     string       `json:"number"`
+	Status UploadStatus `json:"result"`
+}
+
+// Return is a merchant request to return the processed order.
+type Return struct {
+	ID     string `json:"order"`
+	Reason string `json:"reason"`
+}
+
+// ListQuery selects orders of the user, zero value selects all of them.
+type ListQuery struct {
+	Statuses     []Status
+	UploadedFrom *time.Time // inclusive
+	UploadedTo   *time.Time // exclusive
+	pagination.Page
+}
+
+// Matches checks filters of the query, page is applied by storages.
+func (q *ListQuery) Matches(o *Order) bool {
+	if len(q.Statuses) > 0 && !slices.Contains(q.Statuses, o.Status) {
+		return false
+	}
+	if q.UploadedFrom != nil && o.CreatedAt.Before(*q.UploadedFrom) {
+		return false
+	}
+	if q.UploadedTo != nil && !o.CreatedAt.Before(*q.UploadedTo) {
+		return false
+	}
+	return q.Cursor.After(o.CreatedAt, o.ID)
+}
+
 type Order struct {
-	ID        string    `json:"number"`
-	Status    Status    `json:"status"`
-	Accrual   *float64  `json:"accrual,omitempty"`
-	CreatedAt time.Time `json:"uploaded_at"`
+	ID        string       `json:"number"`
+	Status    Status       `json:"status"`
+	Accrual   *money.Money `json:"accrual,omitempty"`
+	Reason    string       `json:"reason,omitempty"`
+	CreatedAt time.Time    `json:"uploaded_at"`
+
+	// polling schedule of waiting order, reset on every status change
+	Attempts      int        `json:"-"`
+	LastCheckedAt *time.Time `json:"-"`
+	NextCheckAt   *time.Time `json:"-"`
+}
+
+// Event is a status change of the order.
+type Event struct {
+	OrderID   string       `json:"-"`
+	Status    Status       `json:"status"`
+	Accrual   *money.Money `json:"accrual,omitempty"`
+	Reason    string       `json:"reason,omitempty"`
+	CreatedAt time.Time    `json:"changed_at"`
+
+	// accrual polls made in the previous status
+	Attempts int `json:"-"`
+}
+
+// Details is the order with its status history in chronological order.
+type Details struct {
+	Order
+	AccrualPolls int     `json:"accrual_polls"`
+	History      []Event `json:"history"`
+}
+
+func NewDetails(o *Order, history []Event) *Details {
+	details := Details{Order: *o, AccrualPolls: o.Attempts, History: history}
+	for _, event := range history {
+		details.AccrualPolls += event.Attempts
+	}
+	return &details
+}
+
+func (o Order) PageCursor() pagination.Cursor {
+	return pagination.Cursor{CreatedAt: o.CreatedAt, ID: o.ID}
 }
 
 func (o *Order) UnmarshalJSON(data []byte) error {
@@ -2,14 +2,17 @@ package order
 
 import (
 	"encoding/json"
+	"fmt"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+
+	"github.com/ry461ch/loyalty_system/internal/models/money"
 )
 
 func TestUnmarshal(t *testing.T) {
-	accural := float64(500)
+	accural := money.New(500)
 	datetime := time.Date(2020, 12, 9, 16, 9, 53, 0, &time.Location{})
 
 	testCases := []struct {
@@ -59,7 +62,7 @@ func TestUnmarshal(t *testing.T) {
 }
 
 func TestMarshal(t *testing.T) {
-	accural := float64(500)
+	accural := money.New(500)
 	datetime := time.Date(2020, 12, 9, 16, 9, 53, 0, &time.Location{})
 
 	testCases := []struct {
@@ -82,6 +85,39 @@ func TestMarshal(t *testing.T) {
 				"uploaded_at": "2020-12-09T16:09:53Z"
 			}`,
 		},
+		{
+			testName: "given up with reason",
+			Order: Order{
+				ID:        "1321",
+				Status:    INVALID,
+				Reason:    ReasonGivenUp,
+				CreatedAt: datetime,
+				Attempts:  5,
+			},
+			expectedJSON: `{
+				"number": "1321",
+				"status": "INVALID",
+				"reason": "accrual system hasn't processed the order in time",
+				"uploaded_at": "2020-12-09T16:09:53Z"
+			}`,
+		},
+		{
+			testName: "returned with accrual",
+			Order: Order{
+				ID:        "1321",
+				Status:    RETURNED,
+				Accrual:   &accural,
+				Reason:    "cancelled by customer",
+				CreatedAt: datetime,
+			},
+			expectedJSON: `{
+				"number": "1321",
+				"status": "RETURNED",
+				"accrual": 500,
+				"reason": "cancelled by customer",
+				"uploaded_at": "2020-12-09T16:09:53Z"
+			}`,
+		},
 		{
 			testName: "processed without accrual",
 			Order: Order{
@@ -105,3 +141,35 @@ func TestMarshal(t *testing.T) {
 		})
 	}
 }
+
+func TestCanTransitionTo(t *testing.T) {
+	testCases := []struct {
+		from     Status
+		to       Status
+		expected bool
+	}{
+		{from: NEW, to: NEW, expected: true},
+		{from: NEW, to: PROCESSING, expected: true},
+		{from: NEW, to: PROCESSED, expected: true},
+		{from: NEW, to: INVALID, expected: true},
+		{from: PROCESSING, to: NEW, expected: false},
+		{from: PROCESSING, to: PROCESSING, expected: true},
+		{from: PROCESSING, to: PROCESSED, expected: true},
+		{from: PROCESSING, to: INVALID, expected: true},
+		{from: PROCESSED, to: PROCESSED, expected: false},
+		{from: PROCESSED, to: INVALID, expected: false},
+		{from: PROCESSED, to: RETURNED, expected: true},
+		{from: NEW, to: RETURNED, expected: false},
+		{from: PROCESSING, to: RETURNED, expected: false},
+		{from: RETURNED, to: RETURNED, expected: false},
+		{from: RETURNED, to: PROCESSED, expected: false},
+		{from: INVALID, to: PROCESSED, expected: false},
+		{from: INVALID, to: NEW, expected: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("%d to %d", tc.from, tc.to), func(t *testing.T) {
+			assert.Equal(t, tc.expected, tc.from.CanTransitionTo(tc.to), "transitions don't match")
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package session
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/ry461ch/loyalty_system/internal/models/exceptions"
+)
+
+// Session is a login of a user on one device.
+// Only a hash of the current refresh token is stored, every refresh replaces it.
+type Session struct {
+	ID               uuid.UUID
+	UserID           uuid.UUID
+	Login            string
+	RefreshTokenHash []byte
+	ExpiresAt        time.Time
+	RevokedAt        *time.Time
+	CreatedAt        time.Time
+}
+
+func (s *Session) IsActive(now time.Time) bool {
+	return s.RevokedAt == nil && now.Before(s.ExpiresAt)
+}
+
+type Tokens struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"` // lifetime of access token in seconds
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+func (r *RefreshRequest) UnmarshalJSON(data []byte) error {
+	type RefreshRequestAlias RefreshRequest
+
+	aliasValue := &struct {
+		*RefreshRequestAlias
+	}{
+		RefreshRequestAlias: (*RefreshRequestAlias)(r),
+	}
+
+	if err := json.Unmarshal(data, aliasValue); err != nil {
+		return err
+	}
+
+	if aliasValue.RefreshToken == "" {
+		return exceptions.ErrSessionBadFormat
+	}
+
+	return nil
+}
@@ -1,12 +1,12 @@
 package user
 
 import (
-	"bytes"
-	"crypto/sha256"
 	"encoding/json"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/ry461ch/loyalty_system/internal/models/exceptions"
+	"github.com/ry461ch/loyalty_system/pkg/password"
 )
 
 type InputUser struct {
@@ -35,26 +35,50 @@ func (u *InputUser) UnmarshalJSON(data []byte) error {
 }
 
 type User struct {
-	ID           uuid.UUID `json:"uid"`
-	Login        string    `json:"login"`
-	PasswordHash []byte    `json:"-"`
+	ID           uuid.UUID  `json:"uid"`
+	Login        string     `json:"login"`
+	PasswordHash []byte     `json:"-"`
+	DeletedAt    *time.Time `json:"-"`
 }
 
-func New(inputUser InputUser) *User {
-	return &User{
-		ID:           uuid.New(),
-		Login:        inputUser.Login,
-		PasswordHash: GeneratePasswordHash(inputUser.Password),
+type PasswordChange struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+func (pc *PasswordChange) UnmarshalJSON(data []byte) error {
+	type PasswordChangeAlias PasswordChange
+
+	aliasValue := &struct {
+		*PasswordChangeAlias
+	}{
+		PasswordChangeAlias: (*PasswordChangeAlias)(pc),
 	}
+
+	if err := json.Unmarshal(data, aliasValue); err != nil {
+		return err
+	}
+
+	if aliasValue.CurrentPassword == "" || aliasValue.NewPassword == "" {
+		return exceptions.ErrUserBadFormat
+	}
+
+	return nil
 }
 
-func GeneratePasswordHash(password string) []byte {
-	h := sha256.New()
-	h.Write([]byte(password))
-	hash := h.Sum(nil)
-	return hash
+// AnonymizedLogin frees the login of a deleted user, so it may be registered again.
+func AnonymizedLogin(userID uuid.UUID) string {
+	return "deleted-" + userID.String()
 }
 
-func CheckPassword(passHash []byte, password string) bool {
-	return bytes.Equal(passHash, GeneratePasswordHash(password))
+func New(inputUser InputUser, hasher *password.Hasher) (*User, error) {
+	passwordHash, err := hasher.Hash(inputUser.Password)
+	if err != nil {
+		return nil, err
+	}
+	return &User{
+		ID:           uuid.New(),
+		Login:        inputUser.Login,
+		PasswordHash: passwordHash,
+	}, nil
 }
@@ -4,6 +4,8 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+
+	"github.com/ry461ch/loyalty_system/pkg/password"
 )
 
 func TestCheckPassword(t *testing.T) {
@@ -11,7 +13,9 @@ func TestCheckPassword(t *testing.T) {
 		Login:    "testLogin",
 		Password: "testPassword",
 	}
-	user := New(inputUser)
+	hasher := password.NewHasher(password.Params{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32})
+	user, err := New(inputUser, hasher)
+	assert.NoError(t, err)
 
 	testCases := []struct {
 		testName            string
@@ -32,7 +36,8 @@ func TestCheckPassword(t *testing.T) {
 
 	for _, tc := range testCases {
 		t.Run(tc.testName, func(t *testing.T) {
-			assert.Equal(t, tc.expectedCheckResult, CheckPassword(user.PasswordHash, tc.password))
+			ok, _ := hasher.Verify(user.PasswordHash, tc.password)
+			assert.Equal(t, tc.expectedCheckResult, ok)
 		})
 	}
 }
@@ -1,19 +1,118 @@
 package withdrawal
 
 import (
+	"database/sql/driver"
 	"encoding/json"
+	"errors"
 	"time"
 
 	"github.com/google/uuid"
+
+	"github.com/ry461ch/loyalty_system/internal/helpers/pagination"
 	"github.com/ry461ch/loyalty_system/internal/models/exceptions"
+	"github.com/ry461ch/loyalty_system/internal/models/money"
 )
 
+type Status int32
+
+const (
+	COMPLETED Status = iota
+	// REFUNDED withdrawal is reversed, its sum is returned to current balance
+	REFUNDED
+)
+
+func (s Status) String() string {
+	switch s {
+	case COMPLETED:
+		return "COMPLETED"
+	case REFUNDED:
+		return "REFUNDED"
+	default:
+		return ""
+	}
+}
+
+func (s Status) MarshalJSON() ([]byte, error) {
+	if s.String() == "" {
+		return nil, exceptions.ErrWithdrawalBadFormat
+	}
+	return []byte("\"" + s.String() + "\""), nil
+}
+
+func (s Status) Value() (driver.Value, error) {
+	if s.String() == "" {
+		return nil, errors.New("invalid withdrawal status")
+	}
+	return s.String(), nil
+}
+
+func (s *Status) Scan(value interface{}) error {
+	sv, err := driver.String.ConvertValue(value)
+	if err != nil {
+		return errors.New("failed to scan withdrawal Status")
+	}
+
+	switch sv {
+	case "COMPLETED":
+		*s = COMPLETED
+	case "REFUNDED":
+		*s = REFUNDED
+	default:
+		return errors.New("invalid withdrawal status")
+	}
+	return nil
+}
+
 type Withdrawal struct {
-	ID        *uuid.UUID `json:"-"`
-	UserID    *uuid.UUID `json:"-"`
-	OrderID   string     `json:"order"`
-	Sum       float64    `json:"sum"`
-	CreatedAt *time.Time `json:"processed_at"`
+	ID         *uuid.UUID  `json:"-"`
+	UserID     *uuid.UUID  `json:"-"`
+	OrderID    string      `json:"order"`
+	Sum        money.Money `json:"sum"`
+	Status     Status      `json:"status"`
+	CreatedAt  *time.Time  `json:"processed_at"`
+	RefundedAt *time.Time  `json:"refunded_at,omitempty"`
+}
+
+// Refund is a request of a merchant to reverse the withdrawal, the id is repeated
+// in the body so the signature of the body can't be reused for another withdrawal.
+type Refund struct {
+	WithdrawalID uuid.UUID `json:"withdrawal"`
+}
+
+func (w Withdrawal) PageCursor() pagination.Cursor {
+	return pagination.Cursor{CreatedAt: *w.CreatedAt, ID: w.ID.String()}
+}
+
+// Filter selects withdrawals of the user, zero value selects all of them.
+type Filter struct {
+	OrderID       string
+	ProcessedFrom *time.Time // inclusive
+	ProcessedTo   *time.Time // exclusive
+}
+
+func (f *Filter) Matches(w *Withdrawal) bool {
+	if f.OrderID != "" && w.OrderID != f.OrderID {
+		return false
+	}
+	if f.ProcessedFrom != nil && w.CreatedAt.Before(*f.ProcessedFrom) {
+		return false
+	}
+	if f.ProcessedTo != nil && !w.CreatedAt.Before(*f.ProcessedTo) {
+		return false
+	}
+	return true
+}
+
+type ListQuery struct {
+	Filter
+	pagination.Page
+}
+
+// Summary aggregates all withdrawals matching the filter, not only one page of them.
+// Refunded withdrawals are counted, but not summed, as they are not withdrawn from the balance.
+type Summary struct {
+	Count int
+	Sum   money.Money
 }
 
 func (w *Withdrawal) UnmarshalJSON(data []byte) error {
@@ -32,7 +131,8 @@ func (w *Withdrawal) UnmarshalJSON(data []byte) error {
 	if aliasValue.Sum == 0 {
 		return exceptions.ErrBalanceBadAmountFormat
 	}
-	if aliasValue.UserID != nil || aliasValue.ID != nil || aliasValue.CreatedAt != nil {
+	if aliasValue.UserID != nil || aliasValue.ID != nil || aliasValue.CreatedAt != nil ||
+		aliasValue.Status != COMPLETED || aliasValue.RefundedAt != nil {
 		return exceptions.ErrWithdrawalBadFormat
 	}
 
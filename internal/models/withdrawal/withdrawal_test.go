@@ -5,6 +5,8 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+
+	"github.com/ry461ch/loyalty_system/internal/models/money"
 )
 
 func TestUnmarshal(t *testing.T) {
@@ -21,7 +23,7 @@ func TestUnmarshal(t *testing.T) {
 			}`,
 			expectedWithdrawal: Withdrawal{
 				OrderID: "1321",
-				Sum:     500,
+				Sum:     money.New(500),
 			},
 		},
 	}
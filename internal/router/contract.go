@@ -5,15 +5,42 @@ import "net/http"
 type AuthHandlers interface {
 	Register(res http.ResponseWriter, req *http.Request)
 	Login(res http.ResponseWriter, req *http.Request)
+	Refresh(res http.ResponseWriter, req *http.Request)
+	Logout(res http.ResponseWriter, req *http.Request)
+	LogoutAll(res http.ResponseWriter, req *http.Request)
+	ChangePassword(res http.ResponseWriter, req *http.Request)
+	DeleteUser(res http.ResponseWriter, req *http.Request)
 }
 
 type OrderHandlers interface {
 	PostOrder(res http.ResponseWriter, req *http.Request)
+	PostOrdersBatch(res http.ResponseWriter, req *http.Request)
 	GetOrders(res http.ResponseWriter, req *http.Request)
+	GetOrder(res http.ResponseWriter, req *http.Request)
+	PostReturn(res http.ResponseWriter, req *http.Request)
 }
 
 type MoneyHandlers interface {
 	PostWithdrawal(res http.ResponseWriter, req *http.Request)
+	PostRefund(res http.ResponseWriter, req *http.Request)
 	GetWithdrawals(res http.ResponseWriter, req *http.Request)
 	GetBalance(res http.ResponseWriter, req *http.Request)
+	GetBalanceHistory(res http.ResponseWriter, req *http.Request)
+	GetBalanceVerification(res http.ResponseWriter, req *http.Request)
+}
+
+type ExportHandlers interface {
+	GetExport(res http.ResponseWriter, req *http.Request)
+}
+
+type StatusHandlers interface {
+	GetStatus(res http.ResponseWriter, req *http.Request)
+}
+
+type AccrualHandlers interface {
+	PostCallback(res http.ResponseWriter, req *http.Request)
+}
+
+type KeysHandlers interface {
+	GetJWKS(res http.ResponseWriter, req *http.Request)
 }
@@ -1,25 +1,42 @@
 package router
 
 import (
+	"time"
+
 	"github.com/go-chi/chi/v5"
 
 	"github.com/ry461ch/loyalty_system/pkg/authentication"
 	"github.com/ry461ch/loyalty_system/pkg/authentication/middleware"
+	"github.com/ry461ch/loyalty_system/pkg/encrypt"
+	"github.com/ry461ch/loyalty_system/pkg/encrypt/middleware"
 	"github.com/ry461ch/loyalty_system/pkg/logging/middleware"
 	"github.com/ry461ch/loyalty_system/pkg/middlewares/compressor"
 	"github.com/ry461ch/loyalty_system/pkg/middlewares/contenttypes"
 )
 
+// opsSignatureMaxAge is how long a signed ops request stays valid.
+const opsSignatureMaxAge = 5 * time.Minute
+
 func NewRouter(
 	authHandlers AuthHandlers,
 	moneyHandlers MoneyHandlers,
 	orderHandlers OrderHandlers,
+	statusHandlers StatusHandlers,
+	accrualHandlers AccrualHandlers,
+	keysHandlers KeysHandlers,
+	exportHandlers ExportHandlers,
 	authenticator *authentication.Authenticator,
+	sessionChecker authmiddleware.SessionChecker,
+	accrualEncrypter *encrypt.Encrypter, // nil disables accrual callback
+	merchantEncrypter *encrypt.Encrypter, // nil disables withdrawal refunds and order returns
+	opsEncrypter *encrypt.Encrypter, // nil disables status and balance verification
 ) chi.Router {
 	r := chi.NewRouter()
 
 	r.Use(requestlogger.WithLogging)
 
+	r.Get("/.well-known/jwks.json", keysHandlers.GetJWKS)
+
 	r.Route("/api/user", func(r chi.Router) {
 		r.Route("/register", func(r chi.Router) {
 			r.Use(contenttypes.ValidateJSONContentType)
@@ -29,15 +46,45 @@ func NewRouter(
 			r.Use(contenttypes.ValidateJSONContentType)
 			r.Post("/", authHandlers.Login)
 		})
+		r.Route("/token/refresh", func(r chi.Router) {
+			r.Use(contenttypes.ValidateJSONContentType)
+			r.Post("/", authHandlers.Refresh)
+		})
+		// merchants have no user tokens, refund requests are signed with the merchant key instead
+		if merchantEncrypter != nil {
+			r.Route("/withdrawals/{id}/refund", func(r chi.Router) {
+				r.Use(
+					contenttypes.ValidateJSONContentType,
+					encryptmiddleware.RequireHash,
+					encryptmiddleware.CheckRequestAndEncryptResponse(merchantEncrypter),
+				)
+				r.Post("/", moneyHandlers.PostRefund)
+			})
+		}
 		r.Group(func(r chi.Router) {
-			r.Use(authmiddleware.Authenticate(authenticator))
+			r.Use(authmiddleware.Authenticate(authenticator, sessionChecker))
+			r.Post("/logout", authHandlers.Logout)
+			r.Post("/logout-all", authHandlers.LogoutAll)
+			r.Delete("/", authHandlers.DeleteUser)
+
+			r.Route("/password", func(r chi.Router) {
+				r.Use(contenttypes.ValidateJSONContentType)
+				r.Put("/", authHandlers.ChangePassword)
+			})
+
 			r.Route("/orders", func(r chi.Router) {
-				r.Use(contenttypes.ValidatePlainContentType)
-				r.Post("/", orderHandlers.PostOrder)
+				// batch is either JSON array or plain text, handler checks the content type itself
+				r.Post("/batch", orderHandlers.PostOrdersBatch)
 
 				r.Group(func(r chi.Router) {
-					r.Use(compressor.GzipHandle)
-					r.Get("/", orderHandlers.GetOrders)
+					r.Use(contenttypes.ValidatePlainContentType)
+					r.Post("/", orderHandlers.PostOrder)
+
+					r.Group(func(r chi.Router) {
+						r.Use(compressor.GzipHandle)
+						r.Get("/", orderHandlers.GetOrders)
+						r.Get("/{number}", orderHandlers.GetOrder)
+					})
 				})
 			})
 
@@ -46,12 +93,22 @@ func NewRouter(
 				r.Get("/", moneyHandlers.GetWithdrawals)
 			})
 
+			r.Route("/export", func(r chi.Router) {
+				r.Use(compressor.GzipHandle, contenttypes.ValidatePlainContentType)
+				r.Get("/", exportHandlers.GetExport)
+			})
+
 			r.Route("/balance", func(r chi.Router) {
 				r.Route("/withdraw", func(r chi.Router) {
 					r.Use(contenttypes.ValidateJSONContentType)
 					r.Post("/", moneyHandlers.PostWithdrawal)
 				})
 
+				r.Route("/history", func(r chi.Router) {
+					r.Use(compressor.GzipHandle, contenttypes.ValidateJSONContentType)
+					r.Get("/", moneyHandlers.GetBalanceHistory)
+				})
+
 				r.Group(func(r chi.Router) {
 					r.Use(contenttypes.ValidatePlainContentType)
 					r.Get("/", moneyHandlers.GetBalance)
@@ -60,5 +117,40 @@ func NewRouter(
 		})
 	})
 
+	r.Route("/api/internal", func(r chi.Router) {
+		if opsEncrypter != nil {
+			r.Route("/status", func(r chi.Router) {
+				r.Use(encryptmiddleware.CheckSignedRequest(opsEncrypter, opsSignatureMaxAge))
+				r.Get("/", statusHandlers.GetStatus)
+			})
+			r.Route("/users/{id}/balance/verify", func(r chi.Router) {
+				r.Use(encryptmiddleware.CheckSignedRequest(opsEncrypter, opsSignatureMaxAge))
+				r.Get("/", moneyHandlers.GetBalanceVerification)
+			})
+		}
+
+		if accrualEncrypter != nil {
+			r.Route("/accrual/callback", func(r chi.Router) {
+				r.Use(
+					contenttypes.ValidateJSONContentType,
+					encryptmiddleware.RequireHash,
+					encryptmiddleware.CheckRequestAndEncryptResponse(accrualEncrypter),
+				)
+				r.Post("/", accrualHandlers.PostCallback)
+			})
+		}
+
+		if merchantEncrypter != nil {
+			r.Route("/orders/{number}/return", func(r chi.Router) {
+				r.Use(
+					contenttypes.ValidateJSONContentType,
+					encryptmiddleware.RequireHash,
+					encryptmiddleware.CheckRequestAndEncryptResponse(merchantEncrypter),
+				)
+				r.Post("/", orderHandlers.PostReturn)
+			})
+		}
+	})
+
 	return r
 }
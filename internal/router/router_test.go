@@ -1,8 +1,11 @@
 package router
 
 import (
+	"context"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
 	"testing"
 	"time"
 
@@ -11,6 +14,8 @@ import (
 	"github.com/stretchr/testify/assert"
 
 	"github.com/ry461ch/loyalty_system/pkg/authentication"
+	"github.com/ry461ch/loyalty_system/pkg/encrypt"
+	"github.com/ry461ch/loyalty_system/pkg/encrypt/middleware"
 	"github.com/ry461ch/loyalty_system/pkg/logging"
 )
 
@@ -32,6 +37,39 @@ func (mah *MockAuthHandlers) Login(res http.ResponseWriter, req *http.Request) {
 	res.WriteHeader(http.StatusOK)
 }
 
+func (mah *MockAuthHandlers) Refresh(res http.ResponseWriter, req *http.Request) {
+	mah.pathTimesCalled["refresh"] += 1
+	res.WriteHeader(http.StatusOK)
+}
+
+func (mah *MockAuthHandlers) Logout(res http.ResponseWriter, req *http.Request) {
+	mah.pathTimesCalled["logout"] += 1
+	res.WriteHeader(http.StatusOK)
+}
+
+func (mah *MockAuthHandlers) LogoutAll(res http.ResponseWriter, req *http.Request) {
+	mah.pathTimesCalled["logout_all"] += 1
+	res.WriteHeader(http.StatusOK)
+}
+
+func (mah *MockAuthHandlers) ChangePassword(res http.ResponseWriter, req *http.Request) {
+	mah.pathTimesCalled["change_password"] += 1
+	res.WriteHeader(http.StatusOK)
+}
+
+func (mah *MockAuthHandlers) DeleteUser(res http.ResponseWriter, req *http.Request) {
+	mah.pathTimesCalled["delete_user"] += 1
+	res.WriteHeader(http.StatusOK)
+}
+
+type MockSessionChecker struct {
+	activeSessions map[uuid.UUID]bool
+}
+
+func (msc *MockSessionChecker) IsSessionActive(ctx context.Context, sessionID uuid.UUID) (bool, error) {
+	return msc.activeSessions[sessionID], nil
+}
+
 type MockOrderHandlers struct {
 	pathTimesCalled map[string]int64
 }
@@ -50,6 +88,21 @@ func (moh *MockOrderHandlers) GetOrders(res http.ResponseWriter, req *http.Reque
 	res.WriteHeader(http.StatusOK)
 }
 
+func (moh *MockOrderHandlers) PostOrdersBatch(res http.ResponseWriter, req *http.Request) {
+	moh.pathTimesCalled["post_orders_batch"] += 1
+	res.WriteHeader(http.StatusOK)
+}
+
+func (moh *MockOrderHandlers) GetOrder(res http.ResponseWriter, req *http.Request) {
+	moh.pathTimesCalled["get_order"] += 1
+	res.WriteHeader(http.StatusOK)
+}
+
+func (moh *MockOrderHandlers) PostReturn(res http.ResponseWriter, req *http.Request) {
+	moh.pathTimesCalled["post_return"] += 1
+	res.WriteHeader(http.StatusOK)
+}
+
 type MockMoneyHandlers struct {
 	pathTimesCalled map[string]int64
 }
@@ -63,6 +116,11 @@ func (mmh *MockMoneyHandlers) PostWithdrawal(res http.ResponseWriter, req *http.
 	res.WriteHeader(http.StatusOK)
 }
 
+func (mmh *MockMoneyHandlers) PostRefund(res http.ResponseWriter, req *http.Request) {
+	mmh.pathTimesCalled["post_refund"] += 1
+	res.WriteHeader(http.StatusOK)
+}
+
 func (mmh *MockMoneyHandlers) GetWithdrawals(res http.ResponseWriter, req *http.Request) {
 	mmh.pathTimesCalled["get_withdrawals"] += 1
 	res.WriteHeader(http.StatusOK)
@@ -73,15 +131,80 @@ func (mmh *MockMoneyHandlers) GetBalance(res http.ResponseWriter, req *http.Requ
 	res.WriteHeader(http.StatusOK)
 }
 
+func (mmh *MockMoneyHandlers) GetBalanceHistory(res http.ResponseWriter, req *http.Request) {
+	mmh.pathTimesCalled["get_balance_history"] += 1
+	res.WriteHeader(http.StatusOK)
+}
+
+func (mmh *MockMoneyHandlers) GetBalanceVerification(res http.ResponseWriter, req *http.Request) {
+	mmh.pathTimesCalled["get_balance_verification"] += 1
+	res.WriteHeader(http.StatusOK)
+}
+
+type MockStatusHandlers struct {
+	pathTimesCalled map[string]int64
+}
+
+func NewMockStatusHandlers() *MockStatusHandlers {
+	return &MockStatusHandlers{pathTimesCalled: map[string]int64{}}
+}
+
+func (msh *MockStatusHandlers) GetStatus(res http.ResponseWriter, req *http.Request) {
+	msh.pathTimesCalled["get_status"] += 1
+	res.WriteHeader(http.StatusOK)
+}
+
+type MockAccrualHandlers struct {
+	pathTimesCalled map[string]int64
+}
+
+func NewMockAccrualHandlers() *MockAccrualHandlers {
+	return &MockAccrualHandlers{pathTimesCalled: map[string]int64{}}
+}
+
+func (mah *MockAccrualHandlers) PostCallback(res http.ResponseWriter, req *http.Request) {
+	mah.pathTimesCalled["post_accrual_callback"] += 1
+	res.WriteHeader(http.StatusOK)
+}
+
+type MockKeysHandlers struct {
+	pathTimesCalled map[string]int64
+}
+
+func NewMockKeysHandlers() *MockKeysHandlers {
+	return &MockKeysHandlers{pathTimesCalled: map[string]int64{}}
+}
+
+func (mkh *MockKeysHandlers) GetJWKS(res http.ResponseWriter, req *http.Request) {
+	mkh.pathTimesCalled["get_jwks"] += 1
+	res.WriteHeader(http.StatusOK)
+}
+
+type MockExportHandlers struct {
+	pathTimesCalled map[string]int64
+}
+
+func NewMockExportHandlers() *MockExportHandlers {
+	return &MockExportHandlers{pathTimesCalled: map[string]int64{}}
+}
+
+func (meh *MockExportHandlers) GetExport(res http.ResponseWriter, req *http.Request) {
+	meh.pathTimesCalled["get_export"] += 1
+	res.WriteHeader(http.StatusOK)
+}
+
 func TestRouter(t *testing.T) {
 	jsonContentType := "application/json"
 	plainContentType := "text/plain"
 
 	secretKey := "test_secret_key"
 	authenticator := authentication.NewAuthenticator(secretKey, time.Hour)
-	validTokenStr, _ := authenticator.MakeJWT(uuid.New(), "login")
+	activeSessionID := uuid.New()
+	validTokenStr, _ := authenticator.MakeJWT(activeSessionID, uuid.New(), "login")
+	revokedTokenStr, _ := authenticator.MakeJWT(uuid.New(), uuid.New(), "login")
+	sessionChecker := &MockSessionChecker{activeSessions: map[uuid.UUID]bool{activeSessionID: true}}
 	fakeAuthenticator := authentication.NewAuthenticator("fake_token", time.Hour)
-	invalidTokenStr, _ := fakeAuthenticator.MakeJWT(uuid.New(), "login")
+	invalidTokenStr, _ := fakeAuthenticator.MakeJWT(activeSessionID, uuid.New(), "login")
 	logging.Initialize("INFO")
 
 	client := resty.New()
@@ -89,7 +212,31 @@ func TestRouter(t *testing.T) {
 	authHandlers := NewMockAuthHandlers()
 	orderHandlers := NewMockOrderHandlers()
 	moneyHandlers := NewMockMoneyHandlers()
-	router := NewRouter(authHandlers, moneyHandlers, orderHandlers, authenticator)
+	statusHandlers := NewMockStatusHandlers()
+	accrualHandlers := NewMockAccrualHandlers()
+	keysHandlers := NewMockKeysHandlers()
+	exportHandlers := NewMockExportHandlers()
+	accrualEncrypter := encrypt.New("accrual_secret_key")
+	merchantEncrypter := encrypt.New("merchant_secret_key")
+	opsEncrypter := encrypt.New("ops_secret_key")
+	router := NewRouter(authHandlers, moneyHandlers, orderHandlers, statusHandlers, accrualHandlers, keysHandlers, exportHandlers, authenticator, sessionChecker, accrualEncrypter, merchantEncrypter, opsEncrypter)
+
+	callbackBody := `{"order": "1115", "status": "PROCESSED", "accrual": 100}`
+	callbackHash := fmt.Sprintf("%x", accrualEncrypter.EncryptMessage([]byte(callbackBody)))
+	emptyBodyHash := fmt.Sprintf("%x", accrualEncrypter.EncryptMessage([]byte{}))
+	opsEmptyBodyHash := fmt.Sprintf("%x", opsEncrypter.EncryptMessage([]byte{}))
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	stale := strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10)
+	signOps := func(method string, path string, timestamp string) string {
+		return fmt.Sprintf("%x", opsEncrypter.EncryptMessage(encryptmiddleware.SignedRequestMessage(method, path, timestamp, []byte{})))
+	}
+	verifyPath := "/api/internal/users/" + uuid.NewString() + "/balance/verify"
+	otherVerifyPath := "/api/internal/users/" + uuid.NewString() + "/balance/verify"
+	refundedWithdrawalID := uuid.New()
+	refundBody := fmt.Sprintf(`{"withdrawal": "%s"}`, refundedWithdrawalID)
+	refundHash := fmt.Sprintf("%x", merchantEncrypter.EncryptMessage([]byte(refundBody)))
+	returnBody := `{"order": "1115", "reason": "cancelled"}`
+	returnHash := fmt.Sprintf("%x", merchantEncrypter.EncryptMessage([]byte(returnBody)))
 	srv := httptest.NewServer(router)
 	defer srv.Close()
 
@@ -99,6 +246,9 @@ func TestRouter(t *testing.T) {
 		requestPath             string
 		requestContentType      string
 		requestAuthHeader       string
+		requestBody             string
+		requestHash             string
+		requestTimestamp        string
 		expectedCode            int
 		expectedPathTimesCalled map[string]int64
 	}{
@@ -156,6 +306,106 @@ func TestRouter(t *testing.T) {
 			expectedCode:            http.StatusBadRequest,
 			expectedPathTimesCalled: map[string]int64{},
 		},
+		{
+			testName:                "valid refresh",
+			method:                  http.MethodPost,
+			requestPath:             "/api/user/token/refresh",
+			requestContentType:      jsonContentType,
+			expectedCode:            http.StatusOK,
+			expectedPathTimesCalled: map[string]int64{"refresh": 1},
+		},
+		{
+			testName:                "invalid refresh content type",
+			method:                  http.MethodPost,
+			requestPath:             "/api/user/token/refresh",
+			requestContentType:      plainContentType,
+			expectedCode:            http.StatusBadRequest,
+			expectedPathTimesCalled: map[string]int64{},
+		},
+		{
+			testName:                "valid logout",
+			method:                  http.MethodPost,
+			requestPath:             "/api/user/logout",
+			requestAuthHeader:       *validTokenStr,
+			expectedCode:            http.StatusOK,
+			expectedPathTimesCalled: map[string]int64{"logout": 1},
+		},
+		{
+			testName:                "invalid logout token validation",
+			method:                  http.MethodPost,
+			requestPath:             "/api/user/logout",
+			requestAuthHeader:       *invalidTokenStr,
+			expectedCode:            http.StatusUnauthorized,
+			expectedPathTimesCalled: map[string]int64{},
+		},
+		{
+			testName:                "valid logout all",
+			method:                  http.MethodPost,
+			requestPath:             "/api/user/logout-all",
+			requestAuthHeader:       *validTokenStr,
+			expectedCode:            http.StatusOK,
+			expectedPathTimesCalled: map[string]int64{"logout_all": 1},
+		},
+		{
+			testName:                "invalid logout all method",
+			method:                  http.MethodGet,
+			requestPath:             "/api/user/logout-all",
+			requestAuthHeader:       *validTokenStr,
+			expectedCode:            http.StatusMethodNotAllowed,
+			expectedPathTimesCalled: map[string]int64{},
+		},
+		{
+			testName:                "valid change password",
+			method:                  http.MethodPut,
+			requestPath:             "/api/user/password",
+			requestContentType:      jsonContentType,
+			requestAuthHeader:       *validTokenStr,
+			expectedCode:            http.StatusOK,
+			expectedPathTimesCalled: map[string]int64{"change_password": 1},
+		},
+		{
+			testName:                "invalid change password content type",
+			method:                  http.MethodPut,
+			requestPath:             "/api/user/password",
+			requestContentType:      plainContentType,
+			requestAuthHeader:       *validTokenStr,
+			expectedCode:            http.StatusBadRequest,
+			expectedPathTimesCalled: map[string]int64{},
+		},
+		{
+			testName:                "invalid change password token validation",
+			method:                  http.MethodPut,
+			requestPath:             "/api/user/password",
+			requestContentType:      jsonContentType,
+			requestAuthHeader:       *invalidTokenStr,
+			expectedCode:            http.StatusUnauthorized,
+			expectedPathTimesCalled: map[string]int64{},
+		},
+		{
+			testName:                "valid delete user",
+			method:                  http.MethodDelete,
+			requestPath:             "/api/user",
+			requestAuthHeader:       *validTokenStr,
+			expectedCode:            http.StatusOK,
+			expectedPathTimesCalled: map[string]int64{"delete_user": 1},
+		},
+		{
+			testName:                "invalid delete user token validation",
+			method:                  http.MethodDelete,
+			requestPath:             "/api/user",
+			requestAuthHeader:       *invalidTokenStr,
+			expectedCode:            http.StatusUnauthorized,
+			expectedPathTimesCalled: map[string]int64{},
+		},
+		{
+			testName:                "get orders with token of revoked session",
+			method:                  http.MethodGet,
+			requestPath:             "/api/user/orders",
+			requestContentType:      plainContentType,
+			requestAuthHeader:       *revokedTokenStr,
+			expectedCode:            http.StatusUnauthorized,
+			expectedPathTimesCalled: map[string]int64{},
+		},
 		{
 			testName:                "valid get orders",
 			method:                  http.MethodGet,
@@ -183,6 +433,49 @@ func TestRouter(t *testing.T) {
 			expectedCode:            http.StatusUnauthorized,
 			expectedPathTimesCalled: map[string]int64{},
 		},
+		{
+			testName:                "valid get order",
+			method:                  http.MethodGet,
+			requestPath:             "/api/user/orders/1115",
+			requestAuthHeader:       *validTokenStr,
+			expectedCode:            http.StatusOK,
+			expectedPathTimesCalled: map[string]int64{"get_order": 1},
+		},
+		{
+			testName:                "invalid get order method",
+			method:                  http.MethodPost,
+			requestPath:             "/api/user/orders/1115",
+			requestContentType:      plainContentType,
+			requestAuthHeader:       *validTokenStr,
+			expectedCode:            http.StatusMethodNotAllowed,
+			expectedPathTimesCalled: map[string]int64{},
+		},
+		{
+			testName:                "invalid get order token validation",
+			method:                  http.MethodGet,
+			requestPath:             "/api/user/orders/1115",
+			requestAuthHeader:       *invalidTokenStr,
+			expectedCode:            http.StatusUnauthorized,
+			expectedPathTimesCalled: map[string]int64{},
+		},
+		{
+			testName:                "valid post orders batch",
+			method:                  http.MethodPost,
+			requestPath:             "/api/user/orders/batch",
+			requestContentType:      jsonContentType,
+			requestAuthHeader:       *validTokenStr,
+			expectedCode:            http.StatusOK,
+			expectedPathTimesCalled: map[string]int64{"post_orders_batch": 1},
+		},
+		{
+			testName:                "invalid post orders batch token validation",
+			method:                  http.MethodPost,
+			requestPath:             "/api/user/orders/batch",
+			requestContentType:      plainContentType,
+			requestAuthHeader:       *invalidTokenStr,
+			expectedCode:            http.StatusUnauthorized,
+			expectedPathTimesCalled: map[string]int64{},
+		},
 		{
 			testName:                "valid post order",
 			method:                  http.MethodPost,
@@ -309,6 +602,39 @@ func TestRouter(t *testing.T) {
 			expectedCode:            http.StatusBadRequest,
 			expectedPathTimesCalled: map[string]int64{},
 		},
+		{
+			testName:                "valid export",
+			method:                  http.MethodGet,
+			requestPath:             "/api/user/export?format=csv",
+			requestAuthHeader:       *validTokenStr,
+			expectedCode:            http.StatusOK,
+			expectedPathTimesCalled: map[string]int64{"get_export": 1},
+		},
+		{
+			testName:                "invalid export method",
+			method:                  http.MethodPost,
+			requestPath:             "/api/user/export",
+			requestAuthHeader:       *validTokenStr,
+			expectedCode:            http.StatusMethodNotAllowed,
+			expectedPathTimesCalled: map[string]int64{},
+		},
+		{
+			testName:                "invalid export content type",
+			method:                  http.MethodGet,
+			requestPath:             "/api/user/export",
+			requestContentType:      jsonContentType,
+			requestAuthHeader:       *validTokenStr,
+			expectedCode:            http.StatusBadRequest,
+			expectedPathTimesCalled: map[string]int64{},
+		},
+		{
+			testName:                "invalid export token validation",
+			method:                  http.MethodGet,
+			requestPath:             "/api/user/export",
+			requestAuthHeader:       *invalidTokenStr,
+			expectedCode:            http.StatusUnauthorized,
+			expectedPathTimesCalled: map[string]int64{},
+		},
 		{
 			testName:                "invalid get withdrawals token validation",
 			method:                  http.MethodGet,
@@ -318,17 +644,277 @@ func TestRouter(t *testing.T) {
 			expectedCode:            http.StatusUnauthorized,
 			expectedPathTimesCalled: map[string]int64{},
 		},
+		{
+			testName:                "valid get balance history",
+			method:                  http.MethodGet,
+			requestPath:             "/api/user/balance/history",
+			requestContentType:      jsonContentType,
+			requestAuthHeader:       *validTokenStr,
+			expectedCode:            http.StatusOK,
+			expectedPathTimesCalled: map[string]int64{"get_balance_history": 1},
+		},
+		{
+			testName:                "invalid get balance history method",
+			method:                  http.MethodPost,
+			requestPath:             "/api/user/balance/history",
+			requestContentType:      jsonContentType,
+			requestAuthHeader:       *validTokenStr,
+			expectedCode:            http.StatusMethodNotAllowed,
+			expectedPathTimesCalled: map[string]int64{},
+		},
+		{
+			testName:                "invalid get balance history token validation",
+			method:                  http.MethodGet,
+			requestPath:             "/api/user/balance/history",
+			requestContentType:      jsonContentType,
+			requestAuthHeader:       *invalidTokenStr,
+			expectedCode:            http.StatusUnauthorized,
+			expectedPathTimesCalled: map[string]int64{},
+		},
+		{
+			testName:                "valid get jwks",
+			method:                  http.MethodGet,
+			requestPath:             "/.well-known/jwks.json",
+			expectedCode:            http.StatusOK,
+			expectedPathTimesCalled: map[string]int64{"get_jwks": 1},
+		},
+		{
+			testName:                "invalid get jwks method",
+			method:                  http.MethodPost,
+			requestPath:             "/.well-known/jwks.json",
+			expectedCode:            http.StatusMethodNotAllowed,
+			expectedPathTimesCalled: map[string]int64{},
+		},
+		{
+			testName:                "valid get status",
+			method:                  http.MethodGet,
+			requestPath:             "/api/internal/status",
+			requestHash:             signOps(http.MethodGet, "/api/internal/status", now),
+			requestTimestamp:        now,
+			expectedCode:            http.StatusOK,
+			expectedPathTimesCalled: map[string]int64{"get_status": 1},
+		},
+		{
+			testName:                "unsigned get status",
+			method:                  http.MethodGet,
+			requestPath:             "/api/internal/status",
+			expectedCode:            http.StatusUnauthorized,
+			expectedPathTimesCalled: map[string]int64{},
+		},
+		{
+			testName:                "get status with stale signature",
+			method:                  http.MethodGet,
+			requestPath:             "/api/internal/status",
+			requestHash:             signOps(http.MethodGet, "/api/internal/status", stale),
+			requestTimestamp:        stale,
+			expectedCode:            http.StatusUnauthorized,
+			expectedPathTimesCalled: map[string]int64{},
+		},
+		{
+			testName:                "get status signed for another path",
+			method:                  http.MethodGet,
+			requestPath:             "/api/internal/status",
+			requestHash:             signOps(http.MethodGet, verifyPath, now),
+			requestTimestamp:        now,
+			expectedCode:            http.StatusBadRequest,
+			expectedPathTimesCalled: map[string]int64{},
+		},
+		{
+			testName:                "get status signed with accrual key",
+			method:                  http.MethodGet,
+			requestPath:             "/api/internal/status",
+			requestHash:             fmt.Sprintf("%x", accrualEncrypter.EncryptMessage(encryptmiddleware.SignedRequestMessage(http.MethodGet, "/api/internal/status", now, []byte{}))),
+			requestTimestamp:        now,
+			expectedCode:            http.StatusBadRequest,
+			expectedPathTimesCalled: map[string]int64{},
+		},
+		{
+			testName:                "invalid get status method",
+			method:                  http.MethodPost,
+			requestPath:             "/api/internal/status",
+			requestHash:             signOps(http.MethodPost, "/api/internal/status", now),
+			requestTimestamp:        now,
+			expectedCode:            http.StatusMethodNotAllowed,
+			expectedPathTimesCalled: map[string]int64{},
+		},
+		{
+			testName:                "valid get balance verification",
+			method:                  http.MethodGet,
+			requestPath:             verifyPath,
+			requestHash:             signOps(http.MethodGet, verifyPath, now),
+			requestTimestamp:        now,
+			expectedCode:            http.StatusOK,
+			expectedPathTimesCalled: map[string]int64{"get_balance_verification": 1},
+		},
+		{
+			testName:                "unsigned get balance verification",
+			method:                  http.MethodGet,
+			requestPath:             verifyPath,
+			expectedCode:            http.StatusUnauthorized,
+			expectedPathTimesCalled: map[string]int64{},
+		},
+		{
+			testName:                "get balance verification without timestamp",
+			method:                  http.MethodGet,
+			requestPath:             verifyPath,
+			requestHash:             opsEmptyBodyHash,
+			expectedCode:            http.StatusUnauthorized,
+			expectedPathTimesCalled: map[string]int64{},
+		},
+		{
+			testName:                "get balance verification with stale signature",
+			method:                  http.MethodGet,
+			requestPath:             verifyPath,
+			requestHash:             signOps(http.MethodGet, verifyPath, stale),
+			requestTimestamp:        stale,
+			expectedCode:            http.StatusUnauthorized,
+			expectedPathTimesCalled: map[string]int64{},
+		},
+		{
+			testName:                "get balance verification signed for another user",
+			method:                  http.MethodGet,
+			requestPath:             verifyPath,
+			requestHash:             signOps(http.MethodGet, otherVerifyPath, now),
+			requestTimestamp:        now,
+			expectedCode:            http.StatusBadRequest,
+			expectedPathTimesCalled: map[string]int64{},
+		},
+		{
+			testName:                "get balance verification signed with accrual key",
+			method:                  http.MethodGet,
+			requestPath:             verifyPath,
+			requestHash:             fmt.Sprintf("%x", accrualEncrypter.EncryptMessage(encryptmiddleware.SignedRequestMessage(http.MethodGet, verifyPath, now, []byte{}))),
+			requestTimestamp:        now,
+			expectedCode:            http.StatusBadRequest,
+			expectedPathTimesCalled: map[string]int64{},
+		},
+		{
+			testName:                "valid refund",
+			method:                  http.MethodPost,
+			requestPath:             "/api/user/withdrawals/" + refundedWithdrawalID.String() + "/refund",
+			requestContentType:      jsonContentType,
+			requestBody:             refundBody,
+			requestHash:             refundHash,
+			expectedCode:            http.StatusOK,
+			expectedPathTimesCalled: map[string]int64{"post_refund": 1},
+		},
+		{
+			testName:                "unsigned refund",
+			method:                  http.MethodPost,
+			requestPath:             "/api/user/withdrawals/" + refundedWithdrawalID.String() + "/refund",
+			requestContentType:      jsonContentType,
+			requestAuthHeader:       *validTokenStr,
+			requestBody:             refundBody,
+			expectedCode:            http.StatusUnauthorized,
+			expectedPathTimesCalled: map[string]int64{},
+		},
+		{
+			testName:                "refund signed with accrual key",
+			method:                  http.MethodPost,
+			requestPath:             "/api/user/withdrawals/" + refundedWithdrawalID.String() + "/refund",
+			requestContentType:      jsonContentType,
+			requestBody:             callbackBody,
+			requestHash:             callbackHash,
+			expectedCode:            http.StatusBadRequest,
+			expectedPathTimesCalled: map[string]int64{},
+		},
+		{
+			testName:                "valid order return",
+			method:                  http.MethodPost,
+			requestPath:             "/api/internal/orders/1115/return",
+			requestContentType:      jsonContentType,
+			requestBody:             returnBody,
+			requestHash:             returnHash,
+			expectedCode:            http.StatusOK,
+			expectedPathTimesCalled: map[string]int64{"post_return": 1},
+		},
+		{
+			testName:                "unsigned order return",
+			method:                  http.MethodPost,
+			requestPath:             "/api/internal/orders/1115/return",
+			requestContentType:      jsonContentType,
+			requestBody:             returnBody,
+			expectedCode:            http.StatusUnauthorized,
+			expectedPathTimesCalled: map[string]int64{},
+		},
+		{
+			testName:                "order return signed with accrual key",
+			method:                  http.MethodPost,
+			requestPath:             "/api/internal/orders/1115/return",
+			requestContentType:      jsonContentType,
+			requestBody:             callbackBody,
+			requestHash:             callbackHash,
+			expectedCode:            http.StatusBadRequest,
+			expectedPathTimesCalled: map[string]int64{},
+		},
+		{
+			testName:                "valid accrual callback",
+			method:                  http.MethodPost,
+			requestPath:             "/api/internal/accrual/callback",
+			requestContentType:      jsonContentType,
+			requestBody:             callbackBody,
+			requestHash:             callbackHash,
+			expectedCode:            http.StatusOK,
+			expectedPathTimesCalled: map[string]int64{"post_accrual_callback": 1},
+		},
+		{
+			testName:                "unsigned accrual callback",
+			method:                  http.MethodPost,
+			requestPath:             "/api/internal/accrual/callback",
+			requestContentType:      jsonContentType,
+			requestBody:             callbackBody,
+			expectedCode:            http.StatusUnauthorized,
+			expectedPathTimesCalled: map[string]int64{},
+		},
+		{
+			testName:                "accrual callback with invalid signature",
+			method:                  http.MethodPost,
+			requestPath:             "/api/internal/accrual/callback",
+			requestContentType:      jsonContentType,
+			requestBody:             `{"order": "1115", "status": "PROCESSED", "accrual": 1000}`,
+			requestHash:             callbackHash,
+			expectedCode:            http.StatusBadRequest,
+			expectedPathTimesCalled: map[string]int64{},
+		},
+		{
+			testName:                "invalid accrual callback content type",
+			method:                  http.MethodPost,
+			requestPath:             "/api/internal/accrual/callback",
+			requestContentType:      plainContentType,
+			requestBody:             callbackBody,
+			requestHash:             callbackHash,
+			expectedCode:            http.StatusBadRequest,
+			expectedPathTimesCalled: map[string]int64{},
+		},
+		{
+			testName:                "invalid accrual callback method",
+			method:                  http.MethodGet,
+			requestPath:             "/api/internal/accrual/callback",
+			requestContentType:      jsonContentType,
+			requestHash:             emptyBodyHash,
+			expectedCode:            http.StatusMethodNotAllowed,
+			expectedPathTimesCalled: map[string]int64{},
+		},
 	}
 
 	for _, tc := range testCases {
 		t.Run(tc.testName, func(t *testing.T) {
-			resp, err := client.R().
+			req := client.R().
 				SetHeader("Content-Type", tc.requestContentType).
-				SetHeader("Authorization", tc.requestAuthHeader).
-				Execute(tc.method, srv.URL+tc.requestPath)
+				SetHeader("Authorization", tc.requestAuthHeader)
+			if tc.requestBody != "" {
+				req.SetBody(tc.requestBody)
+			}
+			if tc.requestHash != "" {
+				req.SetHeader("HashSHA256", tc.requestHash)
+			}
+			if tc.requestTimestamp != "" {
+				req.SetHeader("X-Timestamp", tc.requestTimestamp)
+			}
+			resp, err := req.Execute(tc.method, srv.URL+tc.requestPath)
 			assert.Nil(t, err, "Server returned 500")
 			assert.Equal(t, tc.expectedCode, resp.StatusCode(), "statuses not equal")
-			timesCalled := len(authHandlers.pathTimesCalled) + len(moneyHandlers.pathTimesCalled) + len(orderHandlers.pathTimesCalled)
+			timesCalled := len(authHandlers.pathTimesCalled) + len(moneyHandlers.pathTimesCalled) + len(orderHandlers.pathTimesCalled) + len(statusHandlers.pathTimesCalled) + len(accrualHandlers.pathTimesCalled) + len(keysHandlers.pathTimesCalled) + len(exportHandlers.pathTimesCalled)
 			assert.Equal(t, len(tc.expectedPathTimesCalled), timesCalled, "handlers time called not equal")
 
 			pathTimesCalled := authHandlers.pathTimesCalled
@@ -338,6 +924,18 @@ func TestRouter(t *testing.T) {
 			for key, val := range orderHandlers.pathTimesCalled {
 				pathTimesCalled[key] = val
 			}
+			for key, val := range statusHandlers.pathTimesCalled {
+				pathTimesCalled[key] = val
+			}
+			for key, val := range accrualHandlers.pathTimesCalled {
+				pathTimesCalled[key] = val
+			}
+			for key, val := range keysHandlers.pathTimesCalled {
+				pathTimesCalled[key] = val
+			}
+			for key, val := range exportHandlers.pathTimesCalled {
+				pathTimesCalled[key] = val
+			}
 
 			for key, val := range pathTimesCalled {
 				assert.Contains(t, tc.expectedPathTimesCalled, key, "invalid path was called")
@@ -347,6 +945,10 @@ func TestRouter(t *testing.T) {
 			authHandlers.pathTimesCalled = map[string]int64{}
 			moneyHandlers.pathTimesCalled = map[string]int64{}
 			orderHandlers.pathTimesCalled = map[string]int64{}
+			statusHandlers.pathTimesCalled = map[string]int64{}
+			accrualHandlers.pathTimesCalled = map[string]int64{}
+			keysHandlers.pathTimesCalled = map[string]int64{}
+			exportHandlers.pathTimesCalled = map[string]int64{}
 		})
 	}
 }
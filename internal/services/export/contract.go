@@ -0,0 +1,14 @@
+package exportservice
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+
+	"github.com/ry461ch/loyalty_system/internal/helpers/stream"
+	"github.com/ry461ch/loyalty_system/internal/models/export"
+)
+
+type ExportStorage interface {
+	StreamEntries(ctx context.Context, userID uuid.UUID, query export.Query) (stream.Rows[export.Entry], error)
+}
@@ -0,0 +1,30 @@
+package exportservice
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+
+	"github.com/ry461ch/loyalty_system/internal/helpers/stream"
+	"github.com/ry461ch/loyalty_system/internal/models/export"
+)
+
+type ExportService struct {
+	exportStorage ExportStorage
+}
+
+func NewExportService(exportStorage ExportStorage) *ExportService {
+	return &ExportService{
+		exportStorage: exportStorage,
+	}
+}
+
+// Export streams uploaded orders, accruals and withdrawals of the user in chronological order.
+// Rows must be closed by the caller.
+func (es *ExportService) Export(ctx context.Context, userID uuid.UUID, query export.Query) (stream.Rows[export.Entry], error) {
+	err := query.Validate()
+	if err != nil {
+		return nil, err
+	}
+	return es.exportStorage.StreamEntries(ctx, userID, query)
+}
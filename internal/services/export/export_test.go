@@ -0,0 +1,110 @@
+package exportservice
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ry461ch/loyalty_system/internal/models/balance"
+	"github.com/ry461ch/loyalty_system/internal/models/exceptions"
+	"github.com/ry461ch/loyalty_system/internal/models/export"
+	"github.com/ry461ch/loyalty_system/internal/models/money"
+	"github.com/ry461ch/loyalty_system/internal/models/order"
+	"github.com/ry461ch/loyalty_system/internal/models/withdrawal"
+	"github.com/ry461ch/loyalty_system/internal/services/money"
+	"github.com/ry461ch/loyalty_system/internal/services/order"
+	"github.com/ry461ch/loyalty_system/internal/storage/memory/balances"
+	"github.com/ry461ch/loyalty_system/internal/storage/memory/export"
+	"github.com/ry461ch/loyalty_system/internal/storage/memory/ledger"
+	"github.com/ry461ch/loyalty_system/internal/storage/memory/orders"
+	"github.com/ry461ch/loyalty_system/internal/storage/memory/withdrawals"
+)
+
+func TestExport(t *testing.T) {
+	userID := uuid.New()
+	accrual := money.New(500)
+	withdrawalSum := money.New(100)
+	orderStorage := ordermemstorage.NewOrderMemStorage()
+	withdrawalStorage := withdrawalmemstorage.NewWithdrawalMemStorage()
+	moneyService := moneyservice.NewMoneyService(
+		balancememstorage.NewBalanceMemStorage(),
+		withdrawalStorage,
+		ledgermemstorage.NewLedgerMemStorage(),
+		balance.Expiry{},
+		balance.Clawback{},
+	)
+	orderService := orderservice.NewOrderService(orderStorage, moneyService)
+	exportService := NewExportService(exportmemstorage.NewExportMemStorage(orderStorage, withdrawalStorage))
+
+	// every step is made a bit later than the previous one, so the history has strict order
+	step := func(action func()) time.Time {
+		time.Sleep(time.Millisecond)
+		startedAt := time.Now().UTC()
+		action()
+		return startedAt
+	}
+	step(func() { orderService.InsertOrder(context.TODO(), userID, "1115") })
+	step(func() {
+		orderService.UpdateOrder(context.TODO(), &order.Order{ID: "1115", Status: order.PROCESSED, Accrual: &accrual})
+	})
+	withdrawnAt := step(func() {
+		withdrawalID := uuid.New()
+		moneyService.Withdraw(context.TODO(), &withdrawal.Withdrawal{ID: &withdrawalID, UserID: &userID, OrderID: "1321", Sum: withdrawalSum})
+	})
+	uploadedAt := step(func() { orderService.InsertOrder(context.TODO(), userID, "79927398713") })
+	step(func() { orderService.InsertOrder(context.TODO(), uuid.New(), "12345678903") })
+
+	testCases := []struct {
+		testName        string
+		query           export.Query
+		expectedEntries []export.Entry
+		expectedErr     error
+	}{
+		{
+			testName: "whole history",
+			query:    export.Query{},
+			expectedEntries: []export.Entry{
+				{Type: export.ORDER, OrderID: "1115", Status: "PROCESSED"},
+				{Type: export.ACCRUAL, OrderID: "1115", Amount: &accrual},
+				{Type: export.WITHDRAWAL, OrderID: "1321", Status: "COMPLETED", Amount: &withdrawalSum},
+				{Type: export.ORDER, OrderID: "79927398713", Status: "NEW"},
+			},
+		},
+		{
+			testName: "period",
+			query:    export.Query{From: &withdrawnAt, To: &uploadedAt},
+			expectedEntries: []export.Entry{
+				{Type: export.WITHDRAWAL, OrderID: "1321", Status: "COMPLETED", Amount: &withdrawalSum},
+			},
+		},
+		{
+			testName:    "empty period",
+			query:       export.Query{From: &uploadedAt, To: &withdrawnAt},
+			expectedErr: exceptions.ErrExportBadPeriod,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			entries, err := exportService.Export(context.TODO(), userID, tc.query)
+			assert.ErrorIs(t, err, tc.expectedErr, "unexpected error")
+			if tc.expectedErr != nil {
+				return
+			}
+			defer entries.Close()
+
+			exported := []export.Entry{}
+			for entries.Next() {
+				entry := entries.Value()
+				assert.False(t, entry.At.IsZero(), "entry time isn't set")
+				entry.At = time.Time{}
+				exported = append(exported, entry)
+			}
+			assert.Nil(t, entries.Err(), "stream failed")
+			assert.Equal(t, tc.expectedEntries, exported, "entries don't match")
+		})
+	}
+}
@@ -1,16 +1,27 @@
 package services
 
 import (
+	"github.com/ry461ch/loyalty_system/internal/config"
+	"github.com/ry461ch/loyalty_system/internal/helpers/retry"
+	"github.com/ry461ch/loyalty_system/internal/models/balance"
+	"github.com/ry461ch/loyalty_system/internal/models/loginattempt"
+	"github.com/ry461ch/loyalty_system/internal/services/export"
+	"github.com/ry461ch/loyalty_system/internal/services/loginguard"
 	"github.com/ry461ch/loyalty_system/internal/services/money"
 	"github.com/ry461ch/loyalty_system/internal/services/order"
+	"github.com/ry461ch/loyalty_system/internal/services/session"
 	"github.com/ry461ch/loyalty_system/internal/services/user"
 	"github.com/ry461ch/loyalty_system/pkg/authentication"
+	"github.com/ry461ch/loyalty_system/pkg/password"
 )
 
 type Services struct {
-	UserService  *userservice.UserService
-	MoneyService *moneyservice.MoneyService
-	OrderService *orderservice.OrderService
+	UserService    *userservice.UserService
+	SessionService *sessionservice.SessionService
+	MoneyService   *moneyservice.MoneyService
+	OrderService   *orderservice.OrderService
+	ExportService  *exportservice.ExportService
+	LoginGuard     *loginguardservice.LoginGuardService
 }
 
 func NewServices(
@@ -18,12 +29,33 @@ func NewServices(
 	withdrawalStorage moneyservice.WithdrawalStorage,
 	userStorage userservice.UserStorage,
 	orderStorage orderservice.OrderStorage,
+	ledgerStorage moneyservice.LedgerStorage,
+	sessionStorage sessionservice.SessionStorage,
+	loginAttemptStorage loginguardservice.LoginAttemptStorage,
+	exportStorage exportservice.ExportStorage,
 	authenticator *authentication.Authenticator,
+	passwordHasher *password.Hasher,
+	cfg *config.Config,
 ) *Services {
-	moneyService := moneyservice.NewMoneyService(balanceStorage, withdrawalStorage)
+	expiry := balance.Expiry{Lifetime: cfg.PointsLifetime, SoonWindow: cfg.PointsExpiringSoonWindow}
+	clawback := balance.Clawback{AllowDebt: cfg.ClawbackPolicy == config.ClawbackDebt}
+	moneyService := moneyservice.NewMoneyService(balanceStorage, withdrawalStorage, ledgerStorage, expiry, clawback)
+	sessionService := sessionservice.NewSessionService(sessionStorage, authenticator, cfg.RefreshTokenExp)
+	loginLimits := loginattempt.Limits{
+		FreeAttempts: cfg.LoginFreeAttempts,
+		Backoff:      retry.Policy{BaseDelay: cfg.LoginBackoffBaseDelay, MaxDelay: cfg.LoginLockout},
+		Window:       cfg.LoginAttemptsWindow,
+	}
+	addrLimits := loginLimits
+	addrLimits.FreeAttempts = cfg.LoginAddrFreeAttempts
+	loginGuard := loginguardservice.NewLoginGuardService(loginAttemptStorage, loginLimits, addrLimits)
+	orderService := orderservice.NewOrderService(orderStorage, moneyService)
 	return &Services{
-		UserService:  userservice.NewUserService(userStorage, authenticator),
-		MoneyService: moneyService,
-		OrderService: orderservice.NewOrderService(orderStorage, moneyService),
+		UserService:    userservice.NewUserService(userStorage, sessionService, loginGuard, passwordHasher),
+		SessionService: sessionService,
+		MoneyService:   moneyService,
+		OrderService:   orderService,
+		ExportService:  exportservice.NewExportService(exportStorage),
+		LoginGuard:     loginGuard,
 	}
 }
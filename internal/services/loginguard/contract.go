@@ -0,0 +1,15 @@
+package loginguardservice
+
+import (
+	"context"
+	"time"
+
+	"github.com/ry461ch/loyalty_system/internal/models/loginattempt"
+)
+
+type LoginAttemptStorage interface {
+	ReserveLoginAttempt(ctx context.Context, key string, limits loginattempt.Limits) (*loginattempt.Attempts, bool, error)
+	ReleaseLoginAttempt(ctx context.Context, key string) error
+	ResetLoginAttempts(ctx context.Context, key string) error
+	PruneLoginAttempts(ctx context.Context, lastFailureBefore time.Time) (int, error)
+}
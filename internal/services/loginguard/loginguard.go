@@ -0,0 +1,95 @@
+package loginguardservice
+
+import (
+	"context"
+	"time"
+
+	"github.com/ry461ch/loyalty_system/internal/models/exceptions"
+	"github.com/ry461ch/loyalty_system/internal/models/loginattempt"
+	"github.com/ry461ch/loyalty_system/pkg/logging"
+)
+
+// LoginGuardService slows down password guessing: failures are counted both per login
+// and per client address, so neither one login nor one address can try passwords freely.
+type LoginGuardService struct {
+	loginAttemptStorage LoginAttemptStorage
+	loginLimits         loginattempt.Limits
+	addrLimits          loginattempt.Limits
+}
+
+func NewLoginGuardService(loginAttemptStorage LoginAttemptStorage, loginLimits, addrLimits loginattempt.Limits) *LoginGuardService {
+	return &LoginGuardService{
+		loginAttemptStorage: loginAttemptStorage,
+		loginLimits:         loginLimits,
+		addrLimits:          addrLimits,
+	}
+}
+
+// Reserve counts the attempt as failed before the password is checked, so concurrent attempts
+// can't pass the lock together, RegisterSuccess releases it.
+// Returns *exceptions.LockedError if the login or the address is locked.
+func (lgs *LoginGuardService) Reserve(ctx context.Context, login string, addr string) error {
+	var reservedKeys []string
+	for _, key := range lgs.keys(login, addr) {
+		attempts, reserved, err := lgs.loginAttemptStorage.ReserveLoginAttempt(ctx, key.name, key.limits)
+		if err != nil {
+			lgs.release(ctx, reservedKeys)
+			return err
+		}
+		if !reserved {
+			lgs.release(ctx, reservedKeys)
+			lockedUntil := attempts.LockedUntil(key.limits)
+			logging.Logger.Warnf("Audit: rejected login attempt for %q from %s, locked until %s", login, addr, lockedUntil.Format(time.RFC3339))
+			return &exceptions.LockedError{RetryAfter: time.Until(lockedUntil)}
+		}
+		reservedKeys = append(reservedKeys, key.name)
+		if lockedUntil := attempts.LockedUntil(key.limits); !lockedUntil.IsZero() {
+			logging.Logger.Warnf("Audit: %s is locked until %s if login fails, %d attempts in a row", key.name, lockedUntil.Format(time.RFC3339), attempts.Failures)
+		}
+	}
+	return nil
+}
+
+// RegisterFailure only logs the failure, it was counted by Reserve.
+func (lgs *LoginGuardService) RegisterFailure(ctx context.Context, login string, addr string) error {
+	logging.Logger.Infof("Audit: failed login for %q from %s", login, addr)
+	return nil
+}
+
+// RegisterSuccess resets failures of the login and releases the attempt of the address only,
+// an address trying many logins stays suspicious even if one of them is guessed.
+func (lgs *LoginGuardService) RegisterSuccess(ctx context.Context, login string, addr string) error {
+	logging.Logger.Infof("Audit: successful login for %q from %s", login, addr)
+	err := lgs.loginAttemptStorage.ResetLoginAttempts(ctx, loginattempt.LoginKey(login))
+	if err != nil {
+		return err
+	}
+	return lgs.loginAttemptStorage.ReleaseLoginAttempt(ctx, loginattempt.AddrKey(addr))
+}
+
+// PruneAttempts deletes attempts which neither count nor lock anymore, returns num of deleted keys.
+func (lgs *LoginGuardService) PruneAttempts(ctx context.Context) (int, error) {
+	retention := max(lgs.loginLimits.Retention(), lgs.addrLimits.Retention())
+	return lgs.loginAttemptStorage.PruneLoginAttempts(ctx, time.Now().UTC().Add(-retention))
+}
+
+func (lgs *LoginGuardService) release(ctx context.Context, keys []string) {
+	for _, key := range keys {
+		if err := lgs.loginAttemptStorage.ReleaseLoginAttempt(ctx, key); err != nil {
+			logging.Logger.Errorf("Login Guard: can't release attempt of %s: %v", key, err)
+		}
+	}
+}
+
+type guardedKey struct {
+	name   string
+	limits loginattempt.Limits
+}
+
+func (lgs *LoginGuardService) keys(login string, addr string) []guardedKey {
+	// address goes first, attempts from a locked address don't count against the login
+	return []guardedKey{
+		{name: loginattempt.AddrKey(addr), limits: lgs.addrLimits},
+		{name: loginattempt.LoginKey(login), limits: lgs.loginLimits},
+	}
+}
@@ -2,24 +2,41 @@ package moneyservice
 
 import (
 	"context"
+	"time"
 
 	"github.com/google/uuid"
 
+	"github.com/ry461ch/loyalty_system/internal/helpers/pagination"
 	"github.com/ry461ch/loyalty_system/internal/helpers/transaction"
 	"github.com/ry461ch/loyalty_system/internal/models/balance"
+	"github.com/ry461ch/loyalty_system/internal/models/ledger"
+	"github.com/ry461ch/loyalty_system/internal/models/money"
 	"github.com/ry461ch/loyalty_system/internal/models/withdrawal"
 )
 
 type WithdrawalStorage interface {
 	GetWithdrawals(ctx context.Context, userID uuid.UUID) ([]withdrawal.Withdrawal, error)
+	ListWithdrawalsWithSummary(ctx context.Context, userID uuid.UUID, query withdrawal.ListQuery) ([]withdrawal.Withdrawal, *pagination.Cursor, *withdrawal.Summary, error)
 	GetWithdrawal(ctx context.Context, ID uuid.UUID) (*withdrawal.Withdrawal, error)
 	InsertWithdrawal(ctx context.Context, inputWithdrawal *withdrawal.Withdrawal, trx *transaction.Trx) error
+	RefundWithdrawal(ctx context.Context, ID uuid.UUID, trx *transaction.Trx) (*withdrawal.Withdrawal, error)
 	BeginTx(ctx context.Context) (*transaction.Trx, error)
 }
 
 type BalanceStorage interface {
-	AddBalance(ctx context.Context, userID uuid.UUID, amount float64, trx *transaction.Trx) error
-	ReduceBalance(ctx context.Context, userID uuid.UUID, amount float64, trx *transaction.Trx) error
+	AddBalance(ctx context.Context, userID uuid.UUID, amount money.Money, trx *transaction.Trx) error
+	ReduceBalance(ctx context.Context, userID uuid.UUID, amount money.Money, trx *transaction.Trx) error
 	GetBalance(ctx context.Context, userID uuid.UUID) (*balance.Balance, error)
+	AddLot(ctx context.Context, lot *balance.Lot, trx *transaction.Trx) error
+	RefundBalance(ctx context.Context, lot *balance.Lot, trx *transaction.Trx) error
+	ClawbackBalance(ctx context.Context, userID uuid.UUID, orderID string, amount money.Money, allowDebt bool, trx *transaction.Trx) (money.Money, error)
+	ExpireLots(ctx context.Context, expiredAt time.Time, limit int, trx *transaction.Trx) ([]balance.Lot, error)
+	GetExpiringSum(ctx context.Context, userID uuid.UUID, expiresBefore time.Time) (money.Money, error)
 	BeginTx(ctx context.Context) (*transaction.Trx, error)
 }
+
+type LedgerStorage interface {
+	InsertMovement(ctx context.Context, movement *ledger.Movement, trx *transaction.Trx) error
+	GetUserMovements(ctx context.Context, userID uuid.UUID) ([]ledger.Movement, error)
+	GetUserBalance(ctx context.Context, userID uuid.UUID) (*balance.Balance, error)
+}
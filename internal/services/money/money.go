@@ -3,25 +3,36 @@ package moneyservice
 import (
 	"context"
 	"errors"
+	"fmt"
+	"time"
 
 	"github.com/google/uuid"
 
 	"github.com/ry461ch/loyalty_system/internal/helpers/order"
+	"github.com/ry461ch/loyalty_system/internal/helpers/pagination"
 	"github.com/ry461ch/loyalty_system/internal/helpers/transaction"
 	"github.com/ry461ch/loyalty_system/internal/models/balance"
 	"github.com/ry461ch/loyalty_system/internal/models/exceptions"
+	"github.com/ry461ch/loyalty_system/internal/models/ledger"
+	"github.com/ry461ch/loyalty_system/internal/models/money"
 	"github.com/ry461ch/loyalty_system/internal/models/withdrawal"
 )
 
 type MoneyService struct {
 	balanceStorage    BalanceStorage
 	withdrawalStorage WithdrawalStorage
+	ledgerStorage     LedgerStorage
+	expiry            balance.Expiry
+	clawback          balance.Clawback
 }
 
-func NewMoneyService(balanceStorage BalanceStorage, withdrawalStorage WithdrawalStorage) *MoneyService {
+func NewMoneyService(balanceStorage BalanceStorage, withdrawalStorage WithdrawalStorage, ledgerStorage LedgerStorage, expiry balance.Expiry, clawback balance.Clawback) *MoneyService {
 	return &MoneyService{
 		balanceStorage:    balanceStorage,
 		withdrawalStorage: withdrawalStorage,
+		ledgerStorage:     ledgerStorage,
+		expiry:            expiry,
+		clawback:          clawback,
 	}
 }
 
@@ -37,58 +48,217 @@ func (ms *MoneyService) Withdraw(ctx context.Context, inputWithdrawal *withdrawa
 		return exceptions.ErrUserAuthentication
 	}
 
-	userBalance, err := ms.balanceStorage.GetBalance(ctx, *inputWithdrawal.UserID)
-	if err != nil {
-		return err
-	}
-	if inputWithdrawal.Sum > userBalance.Current {
-		return exceptions.ErrNotEnoughBalance
-	}
-
 	if inputWithdrawal.ID == nil {
 		inputWithdrawalID := uuid.New()
 		inputWithdrawal.ID = &inputWithdrawalID
 	}
-	existingWithdrawal, err := ms.withdrawalStorage.GetWithdrawal(ctx, *inputWithdrawal.ID)
-	if existingWithdrawal != nil {
-		return nil
-	}
-	if err != nil && !errors.Is(err, exceptions.ErrWithdrawalNotFound) {
-		return err
-	}
 
 	tx, err := ms.withdrawalStorage.BeginTx(ctx)
 	if err != nil {
 		return err
 	}
 
+	// the insert goes first, so a retried request with the same ID never touches the balance twice
 	err = ms.withdrawalStorage.InsertWithdrawal(ctx, inputWithdrawal, tx)
+	if errors.Is(err, exceptions.ErrWithdrawalConflict) {
+		tx.Rollback()
+		return nil
+	}
 	if err != nil {
 		tx.Rollback()
 		return err
 	}
 
+	// balance check and reduction are a single conditional update, so parallel withdrawals can't overdraw
 	err = ms.balanceStorage.ReduceBalance(ctx, *inputWithdrawal.UserID, inputWithdrawal.Sum, tx)
 	if err != nil {
 		tx.Rollback()
 		return err
 	}
 
+	err = ms.ledgerStorage.InsertMovement(ctx, &ledger.Movement{
+		ID:      *inputWithdrawal.ID,
+		UserID:  *inputWithdrawal.UserID,
+		Type:    ledger.WITHDRAWAL,
+		OrderID: inputWithdrawal.OrderID,
+		Amount:  -inputWithdrawal.Sum,
+	}, tx)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
 	err = tx.Commit()
 	return err
 }
 
 func (ms *MoneyService) GetBalance(ctx context.Context, userID uuid.UUID) (*balance.Balance, error) {
-	return ms.balanceStorage.GetBalance(ctx, userID)
+	userBalance, err := ms.balanceStorage.GetBalance(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	userBalance.ExpiringSoon, err = ms.balanceStorage.GetExpiringSum(ctx, userID, time.Now().UTC().Add(ms.expiry.SoonWindow))
+	if err != nil {
+		return nil, err
+	}
+	return userBalance, nil
 }
 
 func (ms *MoneyService) GetWithdrawals(ctx context.Context, userID uuid.UUID) ([]withdrawal.Withdrawal, error) {
 	return ms.withdrawalStorage.GetWithdrawals(ctx, userID)
 }
 
-func (ms *MoneyService) AddAccrual(ctx context.Context, userID uuid.UUID, amount float64, trx *transaction.Trx) error {
+// ListWithdrawalsWithSummary returns page of user withdrawals and the summary of all withdrawals matching the filter.
+func (ms *MoneyService) ListWithdrawalsWithSummary(ctx context.Context, userID uuid.UUID, query withdrawal.ListQuery) ([]withdrawal.Withdrawal, *pagination.Cursor, *withdrawal.Summary, error) {
+	return ms.withdrawalStorage.ListWithdrawalsWithSummary(ctx, userID, query)
+}
+
+func (ms *MoneyService) GetBalanceHistory(ctx context.Context, userID uuid.UUID) ([]ledger.Movement, error) {
+	return ms.ledgerStorage.GetUserMovements(ctx, userID)
+}
+
+// VerifyBalance checks that the stored balance matches the one derived from the ledger.
+func (ms *MoneyService) VerifyBalance(ctx context.Context, userID uuid.UUID) error {
+	storedBalance, err := ms.balanceStorage.GetBalance(ctx, userID)
+	if err != nil {
+		return err
+	}
+	ledgerBalance, err := ms.ledgerStorage.GetUserBalance(ctx, userID)
+	if err != nil {
+		return err
+	}
+	// ledger knows no debt, it is the negative current balance there
+	if ledgerBalance.Current < 0 {
+		ledgerBalance.Debt = -ledgerBalance.Current
+		ledgerBalance.Current = 0
+	}
+	if *storedBalance != *ledgerBalance {
+		return fmt.Errorf("%w: stored %+v, ledger %+v", exceptions.ErrBalanceMismatch, *storedBalance, *ledgerBalance)
+	}
+	return nil
+}
+
+func (ms *MoneyService) AddAccrual(ctx context.Context, userID uuid.UUID, orderID string, amount money.Money, trx *transaction.Trx) error {
+	if amount <= 0 {
+		return exceptions.ErrBalanceBadAmountFormat
+	}
+	lot := ms.newLot(userID, orderID, amount)
+	err := ms.balanceStorage.AddLot(ctx, lot, trx)
+	if err != nil {
+		return err
+	}
+	return ms.ledgerStorage.InsertMovement(ctx, &ledger.Movement{
+		ID:      lot.ID,
+		UserID:  userID,
+		Type:    ledger.ACCRUAL,
+		OrderID: orderID,
+		Amount:  amount,
+	}, trx)
+}
+
+// ClawbackAccrual takes back the accrual of the returned order in the transaction of the order update.
+// Points already spent become debt or are written off by the clawback policy.
+func (ms *MoneyService) ClawbackAccrual(ctx context.Context, userID uuid.UUID, orderID string, amount money.Money, trx *transaction.Trx) error {
 	if amount <= 0 {
 		return exceptions.ErrBalanceBadAmountFormat
 	}
-	return ms.balanceStorage.AddBalance(ctx, userID, amount, trx)
+	taken, err := ms.balanceStorage.ClawbackBalance(ctx, userID, orderID, amount, ms.clawback.AllowDebt, trx)
+	if err != nil || taken == 0 {
+		return err
+	}
+	return ms.ledgerStorage.InsertMovement(ctx, &ledger.Movement{
+		ID:      uuid.New(),
+		UserID:  userID,
+		Type:    ledger.CLAWBACK,
+		OrderID: orderID,
+		Amount:  -taken,
+	}, trx)
+}
+
+// newLot makes a lot expiring by the policy, the lot shares id with its movement.
+func (ms *MoneyService) newLot(userID uuid.UUID, orderID string, amount money.Money) *balance.Lot {
+	accruedAt := time.Now().UTC()
+	return &balance.Lot{
+		ID:        uuid.New(),
+		UserID:    userID,
+		OrderID:   orderID,
+		Amount:    amount,
+		Remaining: amount,
+		AccruedAt: accruedAt,
+		ExpiresAt: ms.expiry.ExpiresAt(accruedAt),
+	}
+}
+
+// RefundWithdrawal reverses the completed withdrawal: its sum returns to current balance
+// as a new lot and is subtracted from withdrawn. Refunding twice fails with ErrWithdrawalRefunded.
+func (ms *MoneyService) RefundWithdrawal(ctx context.Context, withdrawalID uuid.UUID) (*withdrawal.Withdrawal, error) {
+	tx, err := ms.withdrawalStorage.BeginTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	refundedWithdrawal, err := ms.withdrawalStorage.RefundWithdrawal(ctx, withdrawalID, tx)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	lot := ms.newLot(*refundedWithdrawal.UserID, refundedWithdrawal.OrderID, refundedWithdrawal.Sum)
+	err = ms.balanceStorage.RefundBalance(ctx, lot, tx)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	err = ms.ledgerStorage.InsertMovement(ctx, &ledger.Movement{
+		ID:      lot.ID,
+		UserID:  lot.UserID,
+		Type:    ledger.REFUND,
+		OrderID: lot.OrderID,
+		Amount:  lot.Amount,
+	}, tx)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	return refundedWithdrawal, nil
+}
+
+// ExpirePoints takes expired points from balances of up to limit users, every expired lot is recorded
+// as an expiry movement in the same transaction. Returns the number of expired lots.
+func (ms *MoneyService) ExpirePoints(ctx context.Context, expiredAt time.Time, limit int) (int, error) {
+	tx, err := ms.balanceStorage.BeginTx(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	expiredLots, err := ms.balanceStorage.ExpireLots(ctx, expiredAt, limit, tx)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	for _, lot := range expiredLots {
+		err = ms.ledgerStorage.InsertMovement(ctx, &ledger.Movement{
+			ID:      uuid.New(),
+			UserID:  lot.UserID,
+			Type:    ledger.EXPIRY,
+			OrderID: lot.OrderID,
+			Amount:  -lot.Remaining,
+		}, tx)
+		if err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+	return len(expiredLots), nil
 }
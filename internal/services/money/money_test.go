@@ -10,8 +10,11 @@ import (
 
 	"github.com/ry461ch/loyalty_system/internal/models/balance"
 	"github.com/ry461ch/loyalty_system/internal/models/exceptions"
+	"github.com/ry461ch/loyalty_system/internal/models/ledger"
+	"github.com/ry461ch/loyalty_system/internal/models/money"
 	"github.com/ry461ch/loyalty_system/internal/models/withdrawal"
 	"github.com/ry461ch/loyalty_system/internal/storage/memory/balances"
+	"github.com/ry461ch/loyalty_system/internal/storage/memory/ledger"
 	"github.com/ry461ch/loyalty_system/internal/storage/memory/withdrawals"
 )
 
@@ -26,14 +29,14 @@ func TestGetWithdrawals(t *testing.T) {
 			ID:        &existingWithdrawalID1,
 			OrderID:   "1115",
 			UserID:    &existingUserID,
-			Sum:       500,
+			Sum:       money.New(500),
 			CreatedAt: &createdAt1,
 		},
 		{
 			ID:        &existingWithdrawalID2,
 			OrderID:   "1313",
 			UserID:    &existingUserID,
-			Sum:       400,
+			Sum:       money.New(400),
 			CreatedAt: &createdAt2,
 		},
 	}
@@ -63,7 +66,7 @@ func TestGetWithdrawals(t *testing.T) {
 				withdrawalStorage.InsertWithdrawal(context.TODO(), &existingWithdrawal, nil)
 			}
 
-			service := NewMoneyService(balanceStorage, withdrawalStorage)
+			service := NewMoneyService(balanceStorage, withdrawalStorage, ledgermemstorage.NewLedgerMemStorage(), balance.Expiry{}, balance.Clawback{})
 			userWithdrawals, _ := service.GetWithdrawals(context.TODO(), tc.userID)
 			assert.Equal(t, len(tc.expectedWithdrawals), len(userWithdrawals), "num of withdrawals don't match")
 			for idx, existingWithdrawal := range tc.expectedWithdrawals {
@@ -77,8 +80,8 @@ func TestGetWithdrawals(t *testing.T) {
 func TestGetBalance(t *testing.T) {
 	existingUserID := uuid.New()
 	existingBalance := balance.Balance{
-		Current:   500,
-		Withdrawn: 300,
+		Current:   money.New(500),
+		Withdrawn: money.New(300),
 	}
 
 	testCases := []struct {
@@ -108,7 +111,7 @@ func TestGetBalance(t *testing.T) {
 			balanceStorage.AddBalance(context.TODO(), existingUserID, existingBalance.Current+existingBalance.Withdrawn, nil)
 			balanceStorage.ReduceBalance(context.TODO(), existingUserID, existingBalance.Withdrawn, nil)
 
-			service := NewMoneyService(balanceStorage, withdrawalStorage)
+			service := NewMoneyService(balanceStorage, withdrawalStorage, ledgermemstorage.NewLedgerMemStorage(), balance.Expiry{}, balance.Clawback{})
 			userBalance, _ := service.GetBalance(context.TODO(), tc.userID)
 			assert.Equal(t, tc.expectedBalance, *userBalance, "balances don't match")
 		})
@@ -118,8 +121,8 @@ func TestGetBalance(t *testing.T) {
 func TestWithdraw(t *testing.T) {
 	existingUserID := uuid.New()
 	existingBalance := balance.Balance{
-		Current:   300,
-		Withdrawn: 300,
+		Current:   money.New(300),
+		Withdrawn: money.New(300),
 	}
 	existingWithdrawalID := uuid.New()
 	createdAt := time.Now().UTC()
@@ -127,7 +130,7 @@ func TestWithdraw(t *testing.T) {
 		ID:        &existingWithdrawalID,
 		UserID:    &existingUserID,
 		OrderID:   "1321",
-		Sum:       300,
+		Sum:       money.New(300),
 		CreatedAt: &createdAt,
 	}
 	newWithdrawalID := uuid.New()
@@ -144,12 +147,12 @@ func TestWithdraw(t *testing.T) {
 				ID:      &newWithdrawalID,
 				OrderID: "1115",
 				UserID:  &existingUserID,
-				Sum:     200,
+				Sum:     money.New(200),
 			},
 			expectedError: nil,
 			expectedBalance: balance.Balance{
-				Current:   existingBalance.Current - 200,
-				Withdrawn: existingBalance.Withdrawn + 200,
+				Current:   existingBalance.Current - money.New(200),
+				Withdrawn: existingBalance.Withdrawn + money.New(200),
 			},
 		},
 		{
@@ -158,7 +161,7 @@ func TestWithdraw(t *testing.T) {
 				ID:      existingWithdrawal.ID,
 				OrderID: "1321",
 				UserID:  &existingUserID,
-				Sum:     300,
+				Sum:     money.New(300),
 			},
 			expectedError: nil,
 			expectedBalance: balance.Balance{
@@ -172,7 +175,7 @@ func TestWithdraw(t *testing.T) {
 				ID:      &newWithdrawalID,
 				OrderID: "1115",
 				UserID:  &existingUserID,
-				Sum:     existingBalance.Current + 100,
+				Sum:     existingBalance.Current + money.New(100),
 			},
 			expectedError:   exceptions.ErrNotEnoughBalance,
 			expectedBalance: existingBalance,
@@ -194,7 +197,7 @@ func TestWithdraw(t *testing.T) {
 				ID:      &newWithdrawalID,
 				OrderID: "1114",
 				UserID:  &existingUserID,
-				Sum:     100,
+				Sum:     money.New(100),
 			},
 			expectedError:   exceptions.ErrOrderBadIDFormat,
 			expectedBalance: existingBalance,
@@ -209,7 +212,7 @@ func TestWithdraw(t *testing.T) {
 			balanceStorage.ReduceBalance(context.TODO(), existingUserID, existingBalance.Withdrawn, nil)
 			withdrawalStorage.InsertWithdrawal(context.TODO(), &existingWithdrawal, nil)
 
-			service := NewMoneyService(balanceStorage, withdrawalStorage)
+			service := NewMoneyService(balanceStorage, withdrawalStorage, ledgermemstorage.NewLedgerMemStorage(), balance.Expiry{}, balance.Clawback{})
 			err := service.Withdraw(context.TODO(), &tc.inputWithdrawal)
 			if tc.expectedError == nil {
 				assert.Nil(t, err, "error was unexpected")
@@ -225,31 +228,31 @@ func TestWithdraw(t *testing.T) {
 func TestAddAccrual(t *testing.T) {
 	existingUserID := uuid.New()
 	existingBalance := balance.Balance{
-		Current:   500,
-		Withdrawn: 300,
+		Current:   money.New(500),
+		Withdrawn: money.New(300),
 	}
 
 	testCases := []struct {
 		testName        string
 		userID          uuid.UUID
-		accrual         float64
+		accrual         money.Money
 		expectedBalance *balance.Balance
 	}{
 		{
 			testName: "existing user",
 			userID:   existingUserID,
-			accrual:  200,
+			accrual:  money.New(200),
 			expectedBalance: &balance.Balance{
-				Current:   existingBalance.Current + 200,
+				Current:   existingBalance.Current + money.New(200),
 				Withdrawn: existingBalance.Withdrawn,
 			},
 		},
 		{
 			testName: "new user",
 			userID:   uuid.New(),
-			accrual:  200,
+			accrual:  money.New(200),
 			expectedBalance: &balance.Balance{
-				Current:   200,
+				Current:   money.New(200),
 				Withdrawn: 0,
 			},
 		},
@@ -268,8 +271,8 @@ func TestAddAccrual(t *testing.T) {
 			balanceStorage.AddBalance(context.TODO(), existingUserID, existingBalance.Current+existingBalance.Withdrawn, nil)
 			balanceStorage.ReduceBalance(context.TODO(), existingUserID, existingBalance.Withdrawn, nil)
 
-			service := NewMoneyService(balanceStorage, withdrawalStorage)
-			err := service.AddAccrual(context.TODO(), tc.userID, tc.accrual, nil)
+			service := NewMoneyService(balanceStorage, withdrawalStorage, ledgermemstorage.NewLedgerMemStorage(), balance.Expiry{}, balance.Clawback{})
+			err := service.AddAccrual(context.TODO(), tc.userID, "1115", tc.accrual, nil)
 			if tc.expectedBalance != nil {
 				balanceInDB, _ := balanceStorage.GetBalance(context.TODO(), tc.userID)
 				assert.Equal(t, *tc.expectedBalance, *balanceInDB, "balances don't match")
@@ -279,3 +282,110 @@ func TestAddAccrual(t *testing.T) {
 		})
 	}
 }
+
+func TestBalanceHistory(t *testing.T) {
+	userID := uuid.New()
+	withdrawalID := uuid.New()
+
+	balanceStorage := balancememstorage.NewBalanceMemStorage()
+	withdrawalStorage := withdrawalmemstorage.NewWithdrawalMemStorage()
+	service := NewMoneyService(balanceStorage, withdrawalStorage, ledgermemstorage.NewLedgerMemStorage(), balance.Expiry{}, balance.Clawback{})
+
+	err := service.AddAccrual(context.TODO(), userID, "1115", money.New(500), nil)
+	assert.Nil(t, err, "error was unexpected")
+	err = service.Withdraw(context.TODO(), &withdrawal.Withdrawal{
+		ID:      &withdrawalID,
+		UserID:  &userID,
+		OrderID: "1321",
+		Sum:     money.New(200),
+	})
+	assert.Nil(t, err, "error was unexpected")
+
+	movements, _ := service.GetBalanceHistory(context.TODO(), userID)
+	assert.Equal(t, 2, len(movements), "num of movements don't match")
+	amounts := map[string]money.Money{}
+	for _, movement := range movements {
+		amounts[movement.OrderID] = movement.Amount
+	}
+	assert.Equal(t, map[string]money.Money{"1115": money.New(500), "1321": money.New(-200)}, amounts, "movements don't match")
+
+	emptyMovements, _ := service.GetBalanceHistory(context.TODO(), uuid.New())
+	assert.Equal(t, 0, len(emptyMovements), "num of movements don't match")
+
+	err = service.VerifyBalance(context.TODO(), userID)
+	assert.Nil(t, err, "balance should match ledger")
+
+	balanceStorage.AddBalance(context.TODO(), userID, money.New(100), nil)
+	err = service.VerifyBalance(context.TODO(), userID)
+	assert.ErrorIs(t, err, exceptions.ErrBalanceMismatch, "exceptions don't match")
+}
+
+func TestExpirePoints(t *testing.T) {
+	userID := uuid.New()
+	balanceStorage := balancememstorage.NewBalanceMemStorage()
+	service := NewMoneyService(
+		balanceStorage,
+		withdrawalmemstorage.NewWithdrawalMemStorage(),
+		ledgermemstorage.NewLedgerMemStorage(),
+		balance.Expiry{Lifetime: 1, SoonWindow: time.Hour * 24 * 40},
+		balance.Clawback{},
+	)
+
+	trx, _ := balanceStorage.BeginTx(context.TODO())
+	service.AddAccrual(context.TODO(), userID, "1115", money.New(500), trx)
+	trx.Commit()
+	withdrawalID := uuid.New()
+	service.Withdraw(context.TODO(), &withdrawal.Withdrawal{ID: &withdrawalID, UserID: &userID, OrderID: "1321", Sum: money.New(200)})
+
+	userBalance, _ := service.GetBalance(context.TODO(), userID)
+	assert.Equal(t, balance.Balance{Current: money.New(300), Withdrawn: money.New(200), ExpiringSoon: money.New(300)}, *userBalance, "balances don't match")
+
+	expired, err := service.ExpirePoints(context.TODO(), time.Now().UTC(), 10)
+	assert.Nil(t, err, "error was unexpected")
+	assert.Equal(t, 0, expired, "points expired too early")
+
+	expired, err = service.ExpirePoints(context.TODO(), time.Now().UTC().AddDate(0, 2, 0), 10)
+	assert.Nil(t, err, "error was unexpected")
+	assert.Equal(t, 1, expired, "num of expired lots don't match")
+
+	userBalance, _ = service.GetBalance(context.TODO(), userID)
+	assert.Equal(t, balance.Balance{Withdrawn: money.New(200)}, *userBalance, "balances don't match")
+	movements, _ := service.GetBalanceHistory(context.TODO(), userID)
+	amounts := map[ledger.MovementType]money.Money{}
+	for _, movement := range movements {
+		amounts[movement.Type] = movement.Amount
+	}
+	assert.Equal(t, map[ledger.MovementType]money.Money{ledger.ACCRUAL: money.New(500), ledger.WITHDRAWAL: money.New(-200), ledger.EXPIRY: money.New(-300)}, amounts, "movements don't match")
+	err = service.VerifyBalance(context.TODO(), userID)
+	assert.Nil(t, err, "balance should match ledger")
+}
+
+func TestRefundWithdrawal(t *testing.T) {
+	userID := uuid.New()
+	balanceStorage := balancememstorage.NewBalanceMemStorage()
+	service := NewMoneyService(balanceStorage, withdrawalmemstorage.NewWithdrawalMemStorage(), ledgermemstorage.NewLedgerMemStorage(), balance.Expiry{}, balance.Clawback{})
+
+	trx, _ := balanceStorage.BeginTx(context.TODO())
+	service.AddAccrual(context.TODO(), userID, "1115", money.New(500), trx)
+	trx.Commit()
+	withdrawalID := uuid.New()
+	service.Withdraw(context.TODO(), &withdrawal.Withdrawal{ID: &withdrawalID, UserID: &userID, OrderID: "1321", Sum: money.New(200)})
+
+	refunded, err := service.RefundWithdrawal(context.TODO(), withdrawalID)
+	assert.Nil(t, err, "error was unexpected")
+	assert.Equal(t, withdrawal.REFUNDED, refunded.Status, "status doesn't match")
+	assert.NotNil(t, refunded.RefundedAt, "refund time wasn't set")
+
+	userBalance, _ := service.GetBalance(context.TODO(), userID)
+	assert.Equal(t, balance.Balance{Current: money.New(500)}, *userBalance, "balances don't match")
+
+	_, err = service.RefundWithdrawal(context.TODO(), withdrawalID)
+	assert.ErrorIs(t, err, exceptions.ErrWithdrawalRefunded, "second refund wasn't rejected")
+	_, err = service.RefundWithdrawal(context.TODO(), uuid.New())
+	assert.ErrorIs(t, err, exceptions.ErrWithdrawalNotFound, "unknown withdrawal wasn't rejected")
+
+	userBalance, _ = service.GetBalance(context.TODO(), userID)
+	assert.Equal(t, balance.Balance{Current: money.New(500)}, *userBalance, "failed refund changed balance")
+	err = service.VerifyBalance(context.TODO(), userID)
+	assert.Nil(t, err, "balance should match ledger")
+}
@@ -6,7 +6,10 @@ import (
 
 	"github.com/google/uuid"
 
+	"github.com/ry461ch/loyalty_system/internal/helpers/pagination"
+	"github.com/ry461ch/loyalty_system/internal/helpers/retry"
 	"github.com/ry461ch/loyalty_system/internal/helpers/transaction"
+	"github.com/ry461ch/loyalty_system/internal/models/money"
 	"github.com/ry461ch/loyalty_system/internal/models/order"
 )
 
@@ -14,11 +17,19 @@ type OrderStorage interface {
 	GetOrderUserID(ctx context.Context, orderID string) (*uuid.UUID, error)
 	InsertOrder(ctx context.Context, userID uuid.UUID, orderID string, trx *transaction.Trx) error
 	GetUserOrders(ctx context.Context, userID uuid.UUID) ([]order.Order, error)
-	GetWaitingOrders(ctx context.Context, limit int, inputCreatedAt *time.Time) ([]order.Order, error)
-	UpdateOrder(ctx context.Context, order *order.Order, tx *transaction.Trx) (*uuid.UUID, error)
+	ListUserOrders(ctx context.Context, userID uuid.UUID, query order.ListQuery) ([]order.Order, *pagination.Cursor, error)
+	ClaimWaitingOrders(ctx context.Context, lease order.Lease, backoff retry.Policy, limit int, inputCreatedAt *time.Time) ([]order.Order, error)
+	GiveUpWaitingOrders(ctx context.Context, createdBefore time.Time, reason string) (int, error)
+	ReleaseOrders(ctx context.Context, lease order.Lease, orderIDs []string) (int, error)
+	UpdateOrder(ctx context.Context, order *order.Order, tx *transaction.Trx) (*uuid.UUID, *order.Order, error)
+	InsertOrders(ctx context.Context, userID uuid.UUID, orderIDs []string, trx *transaction.Trx) ([]string, error)
+	InsertOrderEvents(ctx context.Context, events []order.Event, trx *transaction.Trx) error
+	GetUserOrder(ctx context.Context, userID uuid.UUID, orderID string) (*order.Order, error)
+	GetOrderEvents(ctx context.Context, orderID string) ([]order.Event, error)
 	BeginTx(ctx context.Context) (*transaction.Trx, error)
 }
 
 type AccrualAdderService interface {
-	AddAccrual(ctx context.Context, userID uuid.UUID, amount float64, trx *transaction.Trx) error
+	AddAccrual(ctx context.Context, userID uuid.UUID, orderID string, amount money.Money, trx *transaction.Trx) error
+	ClawbackAccrual(ctx context.Context, userID uuid.UUID, orderID string, amount money.Money, trx *transaction.Trx) error
 }
@@ -8,6 +8,8 @@ import (
 	"github.com/google/uuid"
 
 	"github.com/ry461ch/loyalty_system/internal/helpers/order"
+	"github.com/ry461ch/loyalty_system/internal/helpers/pagination"
+	"github.com/ry461ch/loyalty_system/internal/helpers/retry"
 	"github.com/ry461ch/loyalty_system/internal/models/exceptions"
 	"github.com/ry461ch/loyalty_system/internal/models/order"
 )
@@ -28,8 +30,23 @@ func (os *OrderService) GetUserOrders(ctx context.Context, userID uuid.UUID) ([]
 	return os.orderStorage.GetUserOrders(ctx, userID)
 }
 
-func (os *OrderService) GetWaitingOrders(ctx context.Context, limit int, createdAt *time.Time) ([]order.Order, error) {
-	return os.orderStorage.GetWaitingOrders(ctx, limit, createdAt)
+func (os *OrderService) ListUserOrders(ctx context.Context, userID uuid.UUID, query order.ListQuery) ([]order.Order, *pagination.Cursor, error) {
+	return os.orderStorage.ListUserOrders(ctx, userID, query)
+}
+
+func (os *OrderService) ClaimWaitingOrders(ctx context.Context, lease order.Lease, backoff retry.Policy, limit int, createdAt *time.Time) ([]order.Order, error) {
+	return os.orderStorage.ClaimWaitingOrders(ctx, lease, backoff, limit, createdAt)
+}
+
+// ReleaseOrders returns claimed orders which weren't checked, so they are claimed again without extra backoff.
+func (os *OrderService) ReleaseOrders(ctx context.Context, lease order.Lease, orderIDs []string) (int, error) {
+	return os.orderStorage.ReleaseOrders(ctx, lease, orderIDs)
+}
+
+// GiveUpWaitingOrders moves orders which accrual system hasn't accepted for longer than giveUpAfter to INVALID,
+// PROCESSING orders are never given up.
+func (os *OrderService) GiveUpWaitingOrders(ctx context.Context, giveUpAfter time.Duration) (int, error) {
+	return os.orderStorage.GiveUpWaitingOrders(ctx, time.Now().UTC().Add(-giveUpAfter), order.ReasonGivenUp)
 }
 
 func (os *OrderService) InsertOrder(ctx context.Context, userID uuid.UUID, orderID string) error {
@@ -57,8 +74,98 @@ func (os *OrderService) InsertOrder(ctx context.Context, userID uuid.UUID, order
 		tx.Rollback()
 		return err
 	}
-	tx.Commit()
-	return nil
+	err = os.orderStorage.InsertOrderEvents(ctx, []order.Event{{OrderID: orderID, Status: order.NEW}}, tx)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// InsertOrders uploads the batch of orders in one transaction and returns result of every order in the input order.
+// Repeated numbers of the batch are reported as duplicates.
+func (os *OrderService) InsertOrders(ctx context.Context, userID uuid.UUID, orderIDs []string) ([]order.UploadResult, error) {
+	results := make([]order.UploadResult, len(orderIDs))
+	candidateIDs := []string{}
+	candidates := map[string]bool{}
+	for idx, orderID := range orderIDs {
+		results[idx].ID = orderID
+		switch {
+		case !orderhelpers.ValidateOrderID(orderID):
+			results[idx].Status = order.UploadInvalid
+		case candidates[orderID]:
+			results[idx].Status = order.UploadDuplicate
+		default:
+			candidates[orderID] = true
+			candidateIDs = append(candidateIDs, orderID)
+		}
+	}
+
+	tx, err := os.orderStorage.BeginTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	insertedIDs, err := os.orderStorage.InsertOrders(ctx, userID, candidateIDs, tx)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	events := make([]order.Event, 0, len(insertedIDs))
+	for _, orderID := range insertedIDs {
+		events = append(events, order.Event{OrderID: orderID, Status: order.NEW})
+	}
+	err = os.orderStorage.InsertOrderEvents(ctx, events, tx)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	candidateStatuses := make(map[string]order.UploadStatus, len(candidateIDs))
+	for _, orderID := range insertedIDs {
+		candidateStatuses[orderID] = order.UploadAccepted
+	}
+	// the rest of candidates already exist
+	for _, orderID := range candidateIDs {
+		if _, ok := candidateStatuses[orderID]; ok {
+			continue
+		}
+		orderUserID, err := os.orderStorage.GetOrderUserID(ctx, orderID)
+		if err != nil {
+			return nil, err
+		}
+		candidateStatuses[orderID] = order.UploadConflict
+		if *orderUserID == userID {
+			candidateStatuses[orderID] = order.UploadDuplicate
+		}
+	}
+
+	for idx := range results {
+		if results[idx].Status == "" {
+			results[idx].Status = candidateStatuses[results[idx].ID]
+		}
+	}
+	return results, nil
+}
+
+// GetOrderDetails returns the order of the user with its status history.
+func (os *OrderService) GetOrderDetails(ctx context.Context, userID uuid.UUID, orderID string) (*order.Details, error) {
+	if !orderhelpers.ValidateOrderID(orderID) {
+		return nil, exceptions.ErrOrderBadIDFormat
+	}
+
+	userOrder, err := os.orderStorage.GetUserOrder(ctx, userID, orderID)
+	if err != nil {
+		return nil, err
+	}
+	history, err := os.orderStorage.GetOrderEvents(ctx, orderID)
+	if err != nil {
+		return nil, err
+	}
+	return order.NewDetails(userOrder, history), nil
 }
 
 func (os *OrderService) UpdateOrder(ctx context.Context, inputOrder *order.Order) error {
@@ -71,7 +178,7 @@ func (os *OrderService) UpdateOrder(ctx context.Context, inputOrder *order.Order
 		return err
 	}
 
-	userID, err := os.orderStorage.UpdateOrder(ctx, inputOrder, tx)
+	userID, orderInDB, err := os.orderStorage.UpdateOrder(ctx, inputOrder, tx)
 	if err != nil {
 		tx.Rollback()
 		return err
@@ -81,17 +188,40 @@ func (os *OrderService) UpdateOrder(ctx context.Context, inputOrder *order.Order
 		return errors.New("update order returns empty userID")
 	}
 
-	if inputOrder.Accrual == nil {
-		tx.Commit()
-		return nil
+	if orderInDB.Status != inputOrder.Status {
+		err = os.orderStorage.InsertOrderEvents(ctx, []order.Event{{
+			OrderID:  inputOrder.ID,
+			Status:   inputOrder.Status,
+			Accrual:  inputOrder.Accrual,
+			Reason:   inputOrder.Reason,
+			Attempts: orderInDB.Attempts,
+		}}, tx)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
 	}
 
-	err = os.accrualAdderService.AddAccrual(ctx, *userID, *inputOrder.Accrual, tx)
+	// storage rejects repeated transitions into final statuses,
+	// so accrual is credited and taken back at most once per order
+	switch {
+	case inputOrder.Status == order.PROCESSED && inputOrder.Accrual != nil:
+		err = os.accrualAdderService.AddAccrual(ctx, *userID, inputOrder.ID, *inputOrder.Accrual, tx)
+	case inputOrder.Status == order.RETURNED && orderInDB.Accrual != nil:
+		err = os.accrualAdderService.ClawbackAccrual(ctx, *userID, inputOrder.ID, *orderInDB.Accrual, tx)
+	}
 	if err != nil {
 		tx.Rollback()
 		return err
 	}
 
-	tx.Commit()
-	return nil
+	return tx.Commit()
+}
+
+// ReturnOrder moves the processed order to RETURNED and takes its accrual back.
+func (os *OrderService) ReturnOrder(ctx context.Context, orderReturn *order.Return) error {
+	if !orderhelpers.ValidateOrderID(orderReturn.ID) {
+		return exceptions.ErrOrderBadIDFormat
+	}
+	return os.UpdateOrder(ctx, &order.Order{ID: orderReturn.ID, Status: order.RETURNED, Reason: orderReturn.Reason})
 }
@@ -2,17 +2,22 @@ package orderservice
 
 import (
 	"context"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 
+	"github.com/ry461ch/loyalty_system/internal/helpers/retry"
 	"github.com/ry461ch/loyalty_system/internal/models/balance"
 	"github.com/ry461ch/loyalty_system/internal/models/exceptions"
+	"github.com/ry461ch/loyalty_system/internal/models/money"
 	"github.com/ry461ch/loyalty_system/internal/models/order"
+	"github.com/ry461ch/loyalty_system/internal/models/withdrawal"
 	"github.com/ry461ch/loyalty_system/internal/services/money"
 	"github.com/ry461ch/loyalty_system/internal/storage/memory/balances"
+	"github.com/ry461ch/loyalty_system/internal/storage/memory/ledger"
 	"github.com/ry461ch/loyalty_system/internal/storage/memory/orders"
 	"github.com/ry461ch/loyalty_system/internal/storage/memory/withdrawals"
 )
@@ -71,7 +76,7 @@ func TestSaveOrder(t *testing.T) {
 			orderStorage.InsertOrder(context.TODO(), existingUserID, existingOrderID, nil)
 			balanceStorage := balancememstorage.NewBalanceMemStorage()
 			withdrawalStorage := withdrawalmemstorage.NewWithdrawalMemStorage()
-			moneyService := moneyservice.NewMoneyService(balanceStorage, withdrawalStorage)
+			moneyService := moneyservice.NewMoneyService(balanceStorage, withdrawalStorage, ledgermemstorage.NewLedgerMemStorage(), balance.Expiry{}, balance.Clawback{})
 			orderService := NewOrderService(orderStorage, moneyService)
 
 			err := orderService.InsertOrder(context.TODO(), tc.userID, tc.orderID)
@@ -83,8 +88,41 @@ func TestSaveOrder(t *testing.T) {
 	}
 }
 
+func TestInsertOrders(t *testing.T) {
+	existingUserID := uuid.New()
+	anotherUserID := uuid.New()
+	orderStorage := ordermemstorage.NewOrderMemStorage()
+	orderStorage.InsertOrder(context.TODO(), existingUserID, "1115", nil)
+	orderStorage.InsertOrder(context.TODO(), anotherUserID, "1321", nil)
+	moneyService := moneyservice.NewMoneyService(
+		balancememstorage.NewBalanceMemStorage(),
+		withdrawalmemstorage.NewWithdrawalMemStorage(),
+		ledgermemstorage.NewLedgerMemStorage(),
+		balance.Expiry{},
+		balance.Clawback{},
+	)
+	orderService := NewOrderService(orderStorage, moneyService)
+
+	results, err := orderService.InsertOrders(context.TODO(), existingUserID, []string{"79927398713", "1115", "1321", "1111", "79927398713", "12345678903"})
+	assert.NoError(t, err, "unexpected error")
+	assert.Equal(t, []order.UploadResult{
+		{ID: "79927398713", Status: order.UploadAccepted},
+		{ID: "1115", Status: order.UploadDuplicate},
+		{ID: "1321", Status: order.UploadConflict},
+		{ID: "1111", Status: order.UploadInvalid},
+		{ID: "79927398713", Status: order.UploadDuplicate},
+		{ID: "12345678903", Status: order.UploadAccepted},
+	}, results, "results don't match")
+
+	ordersInDB, _ := orderStorage.GetUserOrders(context.TODO(), existingUserID)
+	assert.Equal(t, 3, len(ordersInDB), "orders num don't match")
+	history, _ := orderStorage.GetOrderEvents(context.TODO(), "12345678903")
+	assert.Equal(t, 1, len(history), "upload must be recorded in history")
+	assert.Equal(t, order.NEW, history[0].Status, "statuses don't match")
+}
+
 func TestGetUserOrders(t *testing.T) {
-	accrual := float64(500)
+	accrual := money.New(500)
 	existingUserID := uuid.New()
 	existingOrders := []order.Order{
 		{
@@ -126,7 +164,7 @@ func TestGetUserOrders(t *testing.T) {
 			}
 			balanceStorage := balancememstorage.NewBalanceMemStorage()
 			withdrawalStorage := withdrawalmemstorage.NewWithdrawalMemStorage()
-			moneyService := moneyservice.NewMoneyService(balanceStorage, withdrawalStorage)
+			moneyService := moneyservice.NewMoneyService(balanceStorage, withdrawalStorage, ledgermemstorage.NewLedgerMemStorage(), balance.Expiry{}, balance.Clawback{})
 			orderService := NewOrderService(orderStorage, moneyService)
 
 			userOrdersList, _ := orderService.GetUserOrders(context.TODO(), tc.userID)
@@ -147,8 +185,8 @@ func TestGetUserOrders(t *testing.T) {
 	}
 }
 
-func TestGetWaitingOrderIDs(t *testing.T) {
-	accrual := float64(500)
+func TestClaimWaitingOrders(t *testing.T) {
+	accrual := money.New(500)
 	existingUser1ID := uuid.New()
 	createdAt1, _ := time.Parse(time.RFC3339, "2020-12-09T16:09:53Z")
 	createdAt2, _ := time.Parse(time.RFC3339, "2020-12-10T16:09:53Z")
@@ -193,7 +231,7 @@ func TestGetWaitingOrderIDs(t *testing.T) {
 
 	balanceStorage := balancememstorage.NewBalanceMemStorage()
 	withdrawalStorage := withdrawalmemstorage.NewWithdrawalMemStorage()
-	moneyService := moneyservice.NewMoneyService(balanceStorage, withdrawalStorage)
+	moneyService := moneyservice.NewMoneyService(balanceStorage, withdrawalStorage, ledgermemstorage.NewLedgerMemStorage(), balance.Expiry{}, balance.Clawback{})
 	orderService := NewOrderService(orderStorage, moneyService)
 
 	requestCreatedAt1, _ := time.Parse(time.RFC3339, "2020-12-09T16:00:00Z")
@@ -240,7 +278,7 @@ func TestGetWaitingOrderIDs(t *testing.T) {
 
 	for _, tc := range testCases {
 		t.Run(tc.testName, func(t *testing.T) {
-			waitingOrders, _ := orderService.GetWaitingOrders(context.TODO(), tc.limit, tc.createdAt)
+			waitingOrders, _ := orderService.ClaimWaitingOrders(context.TODO(), order.Lease{Owner: "instance", TTL: time.Minute}, retry.Policy{}, tc.limit, tc.createdAt)
 			assert.Equal(t, len(tc.expectedOrderIDs), len(waitingOrders), "num of orders don't match")
 			for _, userOrder := range waitingOrders {
 				assert.Contains(t, tc.expectedOrderIDs, userOrder.ID, "user orders doesn't contain expected order id")
@@ -253,10 +291,10 @@ func TestUpdateOrder(t *testing.T) {
 	existingUserID := uuid.New()
 	existingOrderID := "1115"
 	existingBalance := balance.Balance{
-		Current:   200,
-		Withdrawn: 200,
+		Current:   money.New(200),
+		Withdrawn: money.New(200),
 	}
-	accrual := float64(200)
+	accrual := money.New(200)
 
 	testCases := []struct {
 		testName             string
@@ -306,14 +344,17 @@ func TestUpdateOrder(t *testing.T) {
 			orderStorage.InsertOrder(context.TODO(), existingUserID, existingOrderID, nil)
 			balanceStorage.AddBalance(context.TODO(), existingUserID, existingBalance.Current+existingBalance.Withdrawn, nil)
 			balanceStorage.ReduceBalance(context.TODO(), existingUserID, existingBalance.Withdrawn, nil)
-			moneyService := moneyservice.NewMoneyService(balanceStorage, withdrawalStorage)
+			moneyService := moneyservice.NewMoneyService(balanceStorage, withdrawalStorage, ledgermemstorage.NewLedgerMemStorage(), balance.Expiry{}, balance.Clawback{})
 			orderService := NewOrderService(orderStorage, moneyService)
 
 			err := orderService.UpdateOrder(context.TODO(), &tc.inputOrder)
 			if tc.expectedSavingResult == nil {
 				assert.Nil(t, err, "not expected error")
 				ordersInDB, _ := orderStorage.GetUserOrders(context.TODO(), existingUserID)
-				assert.Equal(t, tc.inputOrder, ordersInDB[0], "orders not equal")
+				assert.Equal(t, tc.inputOrder.ID, ordersInDB[0].ID, "orders not equal")
+				assert.Equal(t, tc.inputOrder.Status, ordersInDB[0].Status, "orders not equal")
+				assert.Equal(t, tc.inputOrder.Accrual, ordersInDB[0].Accrual, "orders not equal")
+				assert.False(t, ordersInDB[0].CreatedAt.IsZero(), "created_at was reset")
 			} else {
 				assert.ErrorIs(t, err, tc.expectedSavingResult, "exceptions don't match")
 			}
@@ -323,3 +364,237 @@ func TestUpdateOrder(t *testing.T) {
 		})
 	}
 }
+
+func TestUpdateOrderCreditsOnce(t *testing.T) {
+	existingUserID := uuid.New()
+	existingOrderID := "1115"
+	accrual := money.New(200)
+
+	orderStorage := ordermemstorage.NewOrderMemStorage()
+	balanceStorage := balancememstorage.NewBalanceMemStorage()
+	withdrawalStorage := withdrawalmemstorage.NewWithdrawalMemStorage()
+	orderStorage.InsertOrder(context.TODO(), existingUserID, existingOrderID, nil)
+	moneyService := moneyservice.NewMoneyService(balanceStorage, withdrawalStorage, ledgermemstorage.NewLedgerMemStorage(), balance.Expiry{}, balance.Clawback{})
+	orderService := NewOrderService(orderStorage, moneyService)
+
+	const updatersNum = 20
+	errs := make(chan error, updatersNum)
+	var wg sync.WaitGroup
+	for range updatersNum {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- orderService.UpdateOrder(context.TODO(), &order.Order{
+				ID:      existingOrderID,
+				Status:  order.PROCESSED,
+				Accrual: &accrual,
+			})
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	succeeded := 0
+	for err := range errs {
+		if err == nil {
+			succeeded++
+			continue
+		}
+		assert.ErrorIs(t, err, exceptions.ErrOrderBadStatusTransition, "exceptions don't match")
+	}
+	assert.Equal(t, 1, succeeded, "order was processed more than once")
+
+	balanceInDB, _ := balanceStorage.GetBalance(context.TODO(), existingUserID)
+	assert.Equal(t, balance.Balance{Current: accrual}, *balanceInDB, "balances not equal")
+	assert.NoError(t, moneyService.VerifyBalance(context.TODO(), existingUserID))
+}
+
+func TestReturnOrder(t *testing.T) {
+	existingUserID := uuid.New()
+	existingOrderID := "1115"
+	accrual := money.New(500)
+
+	testCases := []struct {
+		testName        string
+		clawback        balance.Clawback
+		withdrawal      money.Money
+		orderID         string
+		expectedErr     error
+		expectedBalance balance.Balance
+	}{
+		{
+			testName:        "unspent accrual",
+			orderID:         existingOrderID,
+			expectedBalance: balance.Balance{},
+		},
+		{
+			testName:        "spent accrual is written off",
+			withdrawal:      money.New(200),
+			orderID:         existingOrderID,
+			expectedBalance: balance.Balance{Withdrawn: money.New(200)},
+		},
+		{
+			testName:        "spent accrual becomes debt",
+			clawback:        balance.Clawback{AllowDebt: true},
+			withdrawal:      money.New(200),
+			orderID:         existingOrderID,
+			expectedBalance: balance.Balance{Withdrawn: money.New(200), Debt: money.New(200)},
+		},
+		{
+			testName:        "unknown order",
+			orderID:         "1321",
+			expectedErr:     exceptions.ErrOrderNotFound,
+			expectedBalance: balance.Balance{Current: accrual},
+		},
+		{
+			testName:        "bad order number",
+			orderID:         "1111",
+			expectedErr:     exceptions.ErrOrderBadIDFormat,
+			expectedBalance: balance.Balance{Current: accrual},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			orderStorage := ordermemstorage.NewOrderMemStorage()
+			balanceStorage := balancememstorage.NewBalanceMemStorage()
+			moneyService := moneyservice.NewMoneyService(balanceStorage, withdrawalmemstorage.NewWithdrawalMemStorage(), ledgermemstorage.NewLedgerMemStorage(), balance.Expiry{}, tc.clawback)
+			orderService := NewOrderService(orderStorage, moneyService)
+
+			orderService.InsertOrder(context.TODO(), existingUserID, existingOrderID)
+			orderService.UpdateOrder(context.TODO(), &order.Order{ID: existingOrderID, Status: order.PROCESSED, Accrual: &accrual})
+			if tc.withdrawal > 0 {
+				withdrawalID := uuid.New()
+				moneyService.Withdraw(context.TODO(), &withdrawal.Withdrawal{ID: &withdrawalID, UserID: &existingUserID, OrderID: "1321", Sum: tc.withdrawal})
+			}
+
+			err := orderService.ReturnOrder(context.TODO(), &order.Return{ID: tc.orderID, Reason: "cancelled"})
+			assert.ErrorIs(t, err, tc.expectedErr, "unexpected error")
+
+			balanceInDB, _ := balanceStorage.GetBalance(context.TODO(), existingUserID)
+			assert.Equal(t, tc.expectedBalance, *balanceInDB, "balances not equal")
+			assert.NoError(t, moneyService.VerifyBalance(context.TODO(), existingUserID))
+			if tc.expectedErr != nil {
+				return
+			}
+
+			details, _ := orderService.GetOrderDetails(context.TODO(), existingUserID, existingOrderID)
+			assert.Equal(t, order.RETURNED, details.Status, "statuses don't match")
+			assert.Equal(t, &accrual, details.Accrual, "returned order must keep its accrual")
+			lastEvent := details.History[len(details.History)-1]
+			assert.Equal(t, order.RETURNED, lastEvent.Status, "return must be recorded in history")
+			assert.Equal(t, "cancelled", lastEvent.Reason, "reasons don't match")
+
+			err = orderService.ReturnOrder(context.TODO(), &order.Return{ID: tc.orderID})
+			assert.ErrorIs(t, err, exceptions.ErrOrderBadStatusTransition, "order was returned twice")
+		})
+	}
+}
+
+func TestGiveUpWaitingOrders(t *testing.T) {
+	existingUserID := uuid.New()
+	orderStorage := ordermemstorage.NewOrderMemStorage()
+	orderStorage.InsertOrder(context.TODO(), existingUserID, "1115", nil)
+	moneyService := moneyservice.NewMoneyService(
+		balancememstorage.NewBalanceMemStorage(),
+		withdrawalmemstorage.NewWithdrawalMemStorage(),
+		ledgermemstorage.NewLedgerMemStorage(),
+		balance.Expiry{},
+		balance.Clawback{},
+	)
+	orderService := NewOrderService(orderStorage, moneyService)
+
+	givenUp, err := orderService.GiveUpWaitingOrders(context.TODO(), time.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, givenUp, "fresh order was given up")
+
+	givenUp, err = orderService.GiveUpWaitingOrders(context.TODO(), -time.Second)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, givenUp, "num of given up orders doesn't match")
+
+	userOrders, _ := orderService.GetUserOrders(context.TODO(), existingUserID)
+	assert.Equal(t, order.INVALID, userOrders[0].Status, "statuses don't match")
+	assert.Equal(t, order.ReasonGivenUp, userOrders[0].Reason, "reasons don't match")
+
+	history, _ := orderStorage.GetOrderEvents(context.TODO(), "1115")
+	assert.Equal(t, 1, len(history), "giving up must be recorded in history")
+	assert.Equal(t, order.INVALID, history[0].Status, "statuses don't match")
+	assert.Equal(t, order.ReasonGivenUp, history[0].Reason, "reasons don't match")
+}
+
+func TestGetOrderDetails(t *testing.T) {
+	existingUserID := uuid.New()
+	existingOrderID := "1115"
+	accrual := money.New(500)
+	lease := order.Lease{Owner: "test", TTL: time.Minute}
+	orderStorage := ordermemstorage.NewOrderMemStorage()
+	moneyService := moneyservice.NewMoneyService(
+		balancememstorage.NewBalanceMemStorage(),
+		withdrawalmemstorage.NewWithdrawalMemStorage(),
+		ledgermemstorage.NewLedgerMemStorage(),
+		balance.Expiry{},
+		balance.Clawback{},
+	)
+	orderService := NewOrderService(orderStorage, moneyService)
+
+	orderService.InsertOrder(context.TODO(), existingUserID, existingOrderID)
+	orderService.ClaimWaitingOrders(context.TODO(), lease, retry.Policy{}, 10, nil)
+	orderService.ClaimWaitingOrders(context.TODO(), lease, retry.Policy{}, 10, nil)
+	orderService.UpdateOrder(context.TODO(), &order.Order{ID: existingOrderID, Status: order.PROCESSING})
+	orderService.UpdateOrder(context.TODO(), &order.Order{ID: existingOrderID, Status: order.PROCESSING})
+	orderService.ClaimWaitingOrders(context.TODO(), lease, retry.Policy{}, 10, nil)
+	orderService.UpdateOrder(context.TODO(), &order.Order{ID: existingOrderID, Status: order.PROCESSED, Accrual: &accrual})
+
+	testCases := []struct {
+		testName         string
+		userID           uuid.UUID
+		orderID          string
+		expectedStatuses []order.Status
+		expectedPolls    int
+		expectedErr      error
+	}{
+		{
+			testName:         "order of the user",
+			userID:           existingUserID,
+			orderID:          existingOrderID,
+			expectedStatuses: []order.Status{order.NEW, order.PROCESSING, order.PROCESSED},
+			expectedPolls:    3,
+		},
+		{
+			testName:    "order of another user",
+			userID:      uuid.New(),
+			orderID:     existingOrderID,
+			expectedErr: exceptions.ErrOrderNotFound,
+		},
+		{
+			testName:    "unknown order",
+			userID:      existingUserID,
+			orderID:     "1321",
+			expectedErr: exceptions.ErrOrderNotFound,
+		},
+		{
+			testName:    "bad order number",
+			userID:      existingUserID,
+			orderID:     "1111",
+			expectedErr: exceptions.ErrOrderBadIDFormat,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			details, err := orderService.GetOrderDetails(context.TODO(), tc.userID, tc.orderID)
+			assert.ErrorIs(t, err, tc.expectedErr, "unexpected error")
+			if tc.expectedErr != nil {
+				return
+			}
+
+			statuses := []order.Status{}
+			for _, event := range details.History {
+				statuses = append(statuses, event.Status)
+			}
+			assert.Equal(t, tc.expectedStatuses, statuses, "status history doesn't match")
+			assert.Equal(t, tc.expectedPolls, details.AccrualPolls, "num of polls doesn't match")
+			assert.Equal(t, &accrual, details.History[len(details.History)-1].Accrual, "accruals don't match")
+		})
+	}
+}
@@ -0,0 +1,20 @@
+package sessionservice
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/ry461ch/loyalty_system/internal/helpers/transaction"
+	"github.com/ry461ch/loyalty_system/internal/models/session"
+)
+
+type SessionStorage interface {
+	InsertSession(ctx context.Context, inputSession *session.Session, trx *transaction.Trx) error
+	GetSession(ctx context.Context, sessionID uuid.UUID) (*session.Session, error)
+	RotateSession(ctx context.Context, sessionID uuid.UUID, oldRefreshTokenHash []byte, newRefreshTokenHash []byte, expiresAt time.Time, trx *transaction.Trx) error
+	RevokeSession(ctx context.Context, sessionID uuid.UUID, trx *transaction.Trx) error
+	RevokeUserSessions(ctx context.Context, userID uuid.UUID, exceptSessionID uuid.UUID, trx *transaction.Trx) error
+	BeginTx(ctx context.Context) (*transaction.Trx, error)
+}
@@ -0,0 +1,200 @@
+package sessionservice
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/ry461ch/loyalty_system/internal/helpers/transaction"
+	"github.com/ry461ch/loyalty_system/internal/models/exceptions"
+	"github.com/ry461ch/loyalty_system/internal/models/session"
+	"github.com/ry461ch/loyalty_system/pkg/authentication"
+	"github.com/ry461ch/loyalty_system/pkg/logging"
+)
+
+const refreshTokenSecretLength = 32
+
+type SessionService struct {
+	sessionStorage  SessionStorage
+	authenticator   *authentication.Authenticator
+	refreshTokenExp time.Duration
+}
+
+func NewSessionService(sessionStorage SessionStorage, authenticator *authentication.Authenticator, refreshTokenExp time.Duration) *SessionService {
+	return &SessionService{
+		sessionStorage:  sessionStorage,
+		authenticator:   authenticator,
+		refreshTokenExp: refreshTokenExp,
+	}
+}
+
+func (ss *SessionService) StartSession(ctx context.Context, userID uuid.UUID, login string) (*session.Tokens, error) {
+	sessionID := uuid.New()
+	refreshToken, err := generateRefreshToken(sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	newSession := session.Session{
+		ID:               sessionID,
+		UserID:           userID,
+		Login:            login,
+		RefreshTokenHash: hashRefreshToken(refreshToken),
+		ExpiresAt:        time.Now().UTC().Add(ss.refreshTokenExp),
+	}
+
+	tx, err := ss.sessionStorage.BeginTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	err = ss.sessionStorage.InsertSession(ctx, &newSession, tx)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return ss.makeTokens(&newSession, refreshToken)
+}
+
+// Refresh exchanges refresh token for a new pair of tokens, the old refresh token becomes invalid.
+// Presenting an already exchanged refresh token means it was stolen, so the whole session is revoked.
+func (ss *SessionService) Refresh(ctx context.Context, refreshToken string) (*session.Tokens, error) {
+	sessionID, err := parseRefreshToken(refreshToken)
+	if err != nil {
+		return nil, exceptions.ErrUserAuthentication
+	}
+
+	storedSession, err := ss.sessionStorage.GetSession(ctx, sessionID)
+	if err != nil {
+		if errors.Is(err, exceptions.ErrSessionNotFound) {
+			return nil, exceptions.ErrUserAuthentication
+		}
+		return nil, err
+	}
+	if !storedSession.IsActive(time.Now().UTC()) {
+		return nil, exceptions.ErrUserAuthentication
+	}
+
+	refreshTokenHash := hashRefreshToken(refreshToken)
+	if subtle.ConstantTimeCompare(refreshTokenHash, storedSession.RefreshTokenHash) != 1 {
+		logging.Logger.Warnf("Session Service: reuse of refresh token of session %s, revoking it", sessionID)
+		if err := ss.RevokeSession(ctx, sessionID); err != nil {
+			return nil, err
+		}
+		return nil, exceptions.ErrUserAuthentication
+	}
+
+	newRefreshToken, err := generateRefreshToken(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	storedSession.RefreshTokenHash = hashRefreshToken(newRefreshToken)
+	storedSession.ExpiresAt = time.Now().UTC().Add(ss.refreshTokenExp)
+
+	tx, err := ss.sessionStorage.BeginTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	err = ss.sessionStorage.RotateSession(ctx, sessionID, refreshTokenHash, storedSession.RefreshTokenHash, storedSession.ExpiresAt, tx)
+	if err != nil {
+		tx.Rollback()
+		if errors.Is(err, exceptions.ErrSessionConflict) || errors.Is(err, exceptions.ErrSessionNotFound) {
+			// the same token was exchanged concurrently or session was revoked meanwhile
+			return nil, exceptions.ErrUserAuthentication
+		}
+		return nil, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return ss.makeTokens(storedSession, newRefreshToken)
+}
+
+func (ss *SessionService) RevokeSession(ctx context.Context, sessionID uuid.UUID) error {
+	tx, err := ss.sessionStorage.BeginTx(ctx)
+	if err != nil {
+		return err
+	}
+	err = ss.sessionStorage.RevokeSession(ctx, sessionID, tx)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func (ss *SessionService) RevokeUserSessions(ctx context.Context, userID uuid.UUID) error {
+	tx, err := ss.sessionStorage.BeginTx(ctx)
+	if err != nil {
+		return err
+	}
+	err = ss.RevokeUserSessionsExcept(ctx, userID, uuid.Nil, tx)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// RevokeUserSessionsExcept revokes sessions of the user within trx of the caller, uuid.Nil as exceptSessionID revokes all of them.
+func (ss *SessionService) RevokeUserSessionsExcept(ctx context.Context, userID uuid.UUID, exceptSessionID uuid.UUID, trx *transaction.Trx) error {
+	return ss.sessionStorage.RevokeUserSessions(ctx, userID, exceptSessionID, trx)
+}
+
+func (ss *SessionService) IsSessionActive(ctx context.Context, sessionID uuid.UUID) (bool, error) {
+	storedSession, err := ss.sessionStorage.GetSession(ctx, sessionID)
+	if err != nil {
+		if errors.Is(err, exceptions.ErrSessionNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	return storedSession.IsActive(time.Now().UTC()), nil
+}
+
+func (ss *SessionService) makeTokens(activeSession *session.Session, refreshToken string) (*session.Tokens, error) {
+	accessToken, err := ss.authenticator.MakeJWT(activeSession.ID, activeSession.UserID, activeSession.Login)
+	if err != nil {
+		return nil, err
+	}
+	return &session.Tokens{
+		AccessToken:  *accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(ss.authenticator.TokenExp().Seconds()),
+	}, nil
+}
+
+// refresh token is "<session id>.<random secret>", only its hash is stored
+func generateRefreshToken(sessionID uuid.UUID) (string, error) {
+	secret := make([]byte, refreshTokenSecretLength)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return sessionID.String() + "." + base64.RawURLEncoding.EncodeToString(secret), nil
+}
+
+func parseRefreshToken(refreshToken string) (uuid.UUID, error) {
+	sessionIDStr, _, found := strings.Cut(refreshToken, ".")
+	if !found {
+		return uuid.Nil, exceptions.ErrSessionBadFormat
+	}
+	return uuid.Parse(sessionIDStr)
+}
+
+func hashRefreshToken(refreshToken string) []byte {
+	hash := sha256.Sum256([]byte(refreshToken))
+	return hash[:]
+}
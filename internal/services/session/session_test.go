@@ -0,0 +1,127 @@
+package sessionservice
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ry461ch/loyalty_system/internal/models/exceptions"
+	"github.com/ry461ch/loyalty_system/internal/storage/memory/sessions"
+	"github.com/ry461ch/loyalty_system/pkg/authentication"
+	"github.com/ry461ch/loyalty_system/pkg/logging"
+)
+
+func TestStartSession(t *testing.T) {
+	authenticator := authentication.NewAuthenticator("test", time.Minute)
+	sessionService := NewSessionService(sessionmemstorage.NewSessionMemStorage(), authenticator, time.Hour)
+	userID := uuid.New()
+
+	tokens, err := sessionService.StartSession(context.TODO(), userID, "login")
+	assert.NoError(t, err, "unexpected error")
+	assert.Equal(t, int64(60), tokens.ExpiresIn, "access token lifetime doesn't match")
+
+	claims, err := authenticator.GetClaims(tokens.AccessToken)
+	assert.NoError(t, err, "invalid access token")
+	assert.Equal(t, userID, claims.UserID, "user ids don't match")
+	sessionID, err := claims.GetSessionID()
+	assert.NoError(t, err, "invalid jti")
+	active, err := sessionService.IsSessionActive(context.TODO(), sessionID)
+	assert.NoError(t, err, "unexpected error")
+	assert.True(t, active, "new session must be active")
+}
+
+func TestRefresh(t *testing.T) {
+	logging.Initialize("INFO")
+	authenticator := authentication.NewAuthenticator("test", time.Minute)
+
+	testCases := []struct {
+		testName                string
+		refreshTokenExp         time.Duration
+		reuseOldToken           bool
+		revokeBeforeRefresh     bool
+		expectedErr             error
+		expectedSessionIsActive bool
+	}{
+		{
+			testName:                "successful refresh",
+			refreshTokenExp:         time.Hour,
+			expectedSessionIsActive: true,
+		},
+		{
+			testName:                "reused refresh token revokes session",
+			refreshTokenExp:         time.Hour,
+			reuseOldToken:           true,
+			expectedErr:             exceptions.ErrUserAuthentication,
+			expectedSessionIsActive: false,
+		},
+		{
+			testName:                "revoked session",
+			refreshTokenExp:         time.Hour,
+			revokeBeforeRefresh:     true,
+			expectedErr:             exceptions.ErrUserAuthentication,
+			expectedSessionIsActive: false,
+		},
+		{
+			testName:                "expired session",
+			refreshTokenExp:         -time.Hour,
+			expectedErr:             exceptions.ErrUserAuthentication,
+			expectedSessionIsActive: false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			sessionService := NewSessionService(sessionmemstorage.NewSessionMemStorage(), authenticator, tc.refreshTokenExp)
+			tokens, _ := sessionService.StartSession(context.TODO(), uuid.New(), "login")
+			claims, _ := authenticator.GetClaims(tokens.AccessToken)
+			sessionID, _ := claims.GetSessionID()
+
+			if tc.revokeBeforeRefresh {
+				sessionService.RevokeSession(context.TODO(), sessionID)
+			}
+			refreshToken := tokens.RefreshToken
+			if tc.reuseOldToken {
+				sessionService.Refresh(context.TODO(), tokens.RefreshToken)
+			}
+
+			newTokens, err := sessionService.Refresh(context.TODO(), refreshToken)
+			if tc.expectedErr == nil {
+				assert.NoError(t, err, "unexpected error")
+				assert.NotEqual(t, tokens.RefreshToken, newTokens.RefreshToken, "refresh token wasn't rotated")
+				newClaims, _ := authenticator.GetClaims(newTokens.AccessToken)
+				newSessionID, _ := newClaims.GetSessionID()
+				assert.Equal(t, sessionID, newSessionID, "refresh must keep the session")
+			} else {
+				assert.ErrorIs(t, err, tc.expectedErr, "unexpected error")
+			}
+
+			active, _ := sessionService.IsSessionActive(context.TODO(), sessionID)
+			assert.Equal(t, tc.expectedSessionIsActive, active, "session activity doesn't match")
+		})
+	}
+}
+
+func TestRevokeUserSessions(t *testing.T) {
+	authenticator := authentication.NewAuthenticator("test", time.Minute)
+	sessionService := NewSessionService(sessionmemstorage.NewSessionMemStorage(), authenticator, time.Hour)
+	userID := uuid.New()
+	anotherUserID := uuid.New()
+
+	sessionIDs := map[uuid.UUID]uuid.UUID{}
+	for _, id := range []uuid.UUID{userID, userID, anotherUserID} {
+		tokens, _ := sessionService.StartSession(context.TODO(), id, "login")
+		claims, _ := authenticator.GetClaims(tokens.AccessToken)
+		sessionID, _ := claims.GetSessionID()
+		sessionIDs[sessionID] = id
+	}
+
+	err := sessionService.RevokeUserSessions(context.TODO(), userID)
+	assert.NoError(t, err, "unexpected error")
+	for sessionID, ownerID := range sessionIDs {
+		active, _ := sessionService.IsSessionActive(context.TODO(), sessionID)
+		assert.Equal(t, ownerID != userID, active, "session activity doesn't match")
+	}
+}
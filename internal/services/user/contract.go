@@ -3,12 +3,29 @@ package userservice
 import (
 	"context"
 
+	"github.com/google/uuid"
+
 	"github.com/ry461ch/loyalty_system/internal/helpers/transaction"
+	"github.com/ry461ch/loyalty_system/internal/models/session"
 	"github.com/ry461ch/loyalty_system/internal/models/user"
 )
 
 type UserStorage interface {
 	GetUser(ctx context.Context, login string) (*user.User, error)
+	GetUserByID(ctx context.Context, userID uuid.UUID) (*user.User, error)
 	InsertUser(ctx context.Context, newUser *user.User, trx *transaction.Trx) error
+	UpdatePasswordHash(ctx context.Context, userID uuid.UUID, passwordHash []byte, trx *transaction.Trx) error
+	AnonymizeUser(ctx context.Context, userID uuid.UUID, trx *transaction.Trx) error
 	BeginTx(ctx context.Context) (*transaction.Trx, error)
 }
+
+type SessionService interface {
+	StartSession(ctx context.Context, userID uuid.UUID, login string) (*session.Tokens, error)
+	RevokeUserSessionsExcept(ctx context.Context, userID uuid.UUID, exceptSessionID uuid.UUID, trx *transaction.Trx) error
+}
+
+type LoginGuard interface {
+	Reserve(ctx context.Context, login string, addr string) error
+	RegisterFailure(ctx context.Context, login string, addr string) error
+	RegisterSuccess(ctx context.Context, login string, addr string) error
+}
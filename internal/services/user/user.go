@@ -7,23 +7,29 @@ import (
 	"github.com/google/uuid"
 
 	"github.com/ry461ch/loyalty_system/internal/models/exceptions"
+	"github.com/ry461ch/loyalty_system/internal/models/session"
 	"github.com/ry461ch/loyalty_system/internal/models/user"
-	"github.com/ry461ch/loyalty_system/pkg/authentication"
+	"github.com/ry461ch/loyalty_system/pkg/logging"
+	"github.com/ry461ch/loyalty_system/pkg/password"
 )
 
 type UserService struct {
-	userStorage   UserStorage
-	authenticator *authentication.Authenticator
+	userStorage    UserStorage
+	sessionService SessionService
+	loginGuard     LoginGuard
+	passwordHasher *password.Hasher
 }
 
-func NewUserService(userStorage UserStorage, authenticator *authentication.Authenticator) *UserService {
+func NewUserService(userStorage UserStorage, sessionService SessionService, loginGuard LoginGuard, passwordHasher *password.Hasher) *UserService {
 	return &UserService{
-		userStorage:   userStorage,
-		authenticator: authenticator,
+		userStorage:    userStorage,
+		sessionService: sessionService,
+		loginGuard:     loginGuard,
+		passwordHasher: passwordHasher,
 	}
 }
 
-func (us *UserService) Register(ctx context.Context, inputUser *user.InputUser) (*string, error) {
+func (us *UserService) Register(ctx context.Context, inputUser *user.InputUser) (*session.Tokens, error) {
 	registeredUser, err := us.userStorage.GetUser(ctx, inputUser.Login)
 	if registeredUser != nil {
 		return nil, exceptions.ErrUserConflict
@@ -32,10 +38,9 @@ func (us *UserService) Register(ctx context.Context, inputUser *user.InputUser)
 		return nil, err
 	}
 
-	newUser := user.User{
-		Login:        inputUser.Login,
-		PasswordHash: user.GeneratePasswordHash(inputUser.Password),
-		ID:           uuid.New(),
+	newUser, err := user.New(*inputUser, us.passwordHasher)
+	if err != nil {
+		return nil, err
 	}
 
 	tx, err := us.userStorage.BeginTx(ctx)
@@ -43,27 +48,142 @@ func (us *UserService) Register(ctx context.Context, inputUser *user.InputUser)
 		return nil, err
 	}
 
-	err = us.userStorage.InsertUser(ctx, &newUser, tx)
+	err = us.userStorage.InsertUser(ctx, newUser, tx)
 	if err != nil {
 		tx.Rollback()
 		return nil, err
 	}
 	tx.Commit()
-	return us.authenticator.MakeJWT(newUser.ID, newUser.Login)
+	return us.sessionService.StartSession(ctx, newUser.ID, newUser.Login)
 }
 
-func (us *UserService) Login(ctx context.Context, inputUser *user.InputUser) (*string, error) {
+// Login returns *exceptions.LockedError without checking the password if there were too many failures.
+func (us *UserService) Login(ctx context.Context, inputUser *user.InputUser, clientAddr string) (*session.Tokens, error) {
+	err := us.loginGuard.Reserve(ctx, inputUser.Login, clientAddr)
+	if err != nil {
+		return nil, err
+	}
+
 	userInDB, err := us.userStorage.GetUser(ctx, inputUser.Login)
 	if err != nil {
 		if errors.Is(err, exceptions.ErrUserNotFound) {
-			return nil, exceptions.ErrUserAuthentication
+			us.passwordHasher.VerifyDummy(inputUser.Password)
+			return nil, us.loginFailed(ctx, inputUser.Login, clientAddr)
 		}
 		return nil, err
 	}
 
-	if !user.CheckPassword(userInDB.PasswordHash, inputUser.Password) {
-		return nil, exceptions.ErrUserAuthentication
+	ok, needsRehash := us.passwordHasher.Verify(userInDB.PasswordHash, inputUser.Password)
+	if !ok {
+		return nil, us.loginFailed(ctx, inputUser.Login, clientAddr)
+	}
+	if err := us.loginGuard.RegisterSuccess(ctx, inputUser.Login, clientAddr); err != nil {
+		logging.Logger.Warnf("User Service: can't reset failed logins of user %s: %s", userInDB.ID, err.Error())
+	}
+	if needsRehash {
+		// login must not fail because of the upgrade, the old hash is still valid
+		if err := us.rehashPassword(ctx, userInDB.ID, inputUser.Password); err != nil {
+			logging.Logger.Warnf("User Service: can't rehash password of user %s: %s", userInDB.ID, err.Error())
+		}
+	}
+
+	return us.sessionService.StartSession(ctx, userInDB.ID, userInDB.Login)
+}
+
+// ChangePassword checks the current password like Login does and logs out all other sessions of the user.
+func (us *UserService) ChangePassword(ctx context.Context, userID uuid.UUID, sessionID uuid.UUID, passwordChange *user.PasswordChange, clientAddr string) error {
+	userInDB, err := us.userStorage.GetUserByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	err = us.loginGuard.Reserve(ctx, userInDB.Login, clientAddr)
+	if err != nil {
+		return err
+	}
+	ok, _ := us.passwordHasher.Verify(userInDB.PasswordHash, passwordChange.CurrentPassword)
+	if !ok {
+		return us.loginFailed(ctx, userInDB.Login, clientAddr)
+	}
+	if err := us.loginGuard.RegisterSuccess(ctx, userInDB.Login, clientAddr); err != nil {
+		logging.Logger.Warnf("User Service: can't reset failed logins of user %s: %s", userInDB.ID, err.Error())
+	}
+
+	passwordHash, err := us.passwordHasher.Hash(passwordChange.NewPassword)
+	if err != nil {
+		return err
+	}
+
+	tx, err := us.userStorage.BeginTx(ctx)
+	if err != nil {
+		return err
+	}
+	err = us.userStorage.UpdatePasswordHash(ctx, userID, passwordHash, tx)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	err = us.sessionService.RevokeUserSessionsExcept(ctx, userID, sessionID, tx)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	logging.Logger.Infof("Audit: password of user %s changed from %s", userID, clientAddr)
+	return nil
+}
+
+// DeleteUser anonymizes the user and logs out all its sessions.
+// Orders, withdrawals and ledger keep the user id for accounting.
+func (us *UserService) DeleteUser(ctx context.Context, userID uuid.UUID) error {
+	tx, err := us.userStorage.BeginTx(ctx)
+	if err != nil {
+		return err
+	}
+	err = us.userStorage.AnonymizeUser(ctx, userID, tx)
+	if err != nil {
+		tx.Rollback()
+		return err
 	}
+	err = us.sessionService.RevokeUserSessionsExcept(ctx, userID, uuid.Nil, tx)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	logging.Logger.Infof("Audit: user %s deleted", userID)
+	return nil
+}
+
+func (us *UserService) loginFailed(ctx context.Context, login string, clientAddr string) error {
+	if err := us.loginGuard.RegisterFailure(ctx, login, clientAddr); err != nil {
+		logging.Logger.Errorf("User Service: can't register failed login: %s", err.Error())
+	}
+	return exceptions.ErrUserAuthentication
+}
 
-	return us.authenticator.MakeJWT(userInDB.ID, userInDB.Login)
+func (us *UserService) rehashPassword(ctx context.Context, userID uuid.UUID, password string) error {
+	passwordHash, err := us.passwordHasher.Hash(password)
+	if err != nil {
+		return err
+	}
+
+	tx, err := us.userStorage.BeginTx(ctx)
+	if err != nil {
+		return err
+	}
+	err = us.userStorage.UpdatePasswordHash(ctx, userID, passwordHash, tx)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
 }
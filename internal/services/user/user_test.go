@@ -2,7 +2,10 @@ package userservice
 
 import (
 	"context"
+	"crypto/sha256"
+	"errors"
 	"fmt"
+	"sync"
 	"testing"
 	"time"
 
@@ -10,17 +13,38 @@ import (
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 
+	"github.com/ry461ch/loyalty_system/internal/helpers/retry"
 	"github.com/ry461ch/loyalty_system/internal/models/exceptions"
+	"github.com/ry461ch/loyalty_system/internal/models/loginattempt"
 	"github.com/ry461ch/loyalty_system/internal/models/user"
+	"github.com/ry461ch/loyalty_system/internal/services/loginguard"
+	"github.com/ry461ch/loyalty_system/internal/services/session"
+	"github.com/ry461ch/loyalty_system/internal/storage/memory/loginattempts"
+	"github.com/ry461ch/loyalty_system/internal/storage/memory/sessions"
 	"github.com/ry461ch/loyalty_system/internal/storage/memory/users"
 	"github.com/ry461ch/loyalty_system/pkg/authentication"
+	"github.com/ry461ch/loyalty_system/pkg/logging"
+	"github.com/ry461ch/loyalty_system/pkg/password"
 )
 
+var testPasswordParams = password.Params{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+
+func newTestLoginGuard() *loginguardservice.LoginGuardService {
+	limits := loginattempt.Limits{
+		FreeAttempts: 3,
+		Backoff:      retry.Policy{BaseDelay: time.Minute, MaxDelay: time.Hour},
+		Window:       time.Hour,
+	}
+	return loginguardservice.NewLoginGuardService(loginattemptmemstorage.NewLoginAttemptMemStorage(), limits, limits)
+}
+
 func TestRegister(t *testing.T) {
+	hasher := password.NewHasher(testPasswordParams)
+	passwordHash, _ := hasher.Hash("test")
 	existingUser := user.User{
 		ID:           uuid.New(),
 		Login:        "login_1",
-		PasswordHash: user.GeneratePasswordHash("test"),
+		PasswordHash: passwordHash,
 	}
 
 	testCases := []struct {
@@ -49,15 +73,15 @@ func TestRegister(t *testing.T) {
 	for _, tc := range testCases {
 		t.Run(tc.testName, func(t *testing.T) {
 			secretKey := "test"
-			storage := usermemstorage.NewUserMemStorage()
+			storage := usermemstorage.NewUserMemStorage(sessionmemstorage.NewSessionMemStorage(), loginattemptmemstorage.NewLoginAttemptMemStorage())
 			authenticator := authentication.NewAuthenticator(secretKey, time.Hour)
 			storage.InsertUser(context.TODO(), &existingUser, nil)
-			userService := NewUserService(storage, authenticator)
+			userService := NewUserService(storage, sessionservice.NewSessionService(sessionmemstorage.NewSessionMemStorage(), authenticator, time.Hour), newTestLoginGuard(), hasher)
 
-			tokenStr, registerErr := userService.Register(context.TODO(), &tc.inputUser)
+			tokens, registerErr := userService.Register(context.TODO(), &tc.inputUser)
 			if tc.expectedSavingResult == nil {
 				claims := &authentication.Claims{}
-				_, err := jwt.ParseWithClaims(*tokenStr, claims, func(t *jwt.Token) (interface{}, error) {
+				_, err := jwt.ParseWithClaims(tokens.AccessToken, claims, func(t *jwt.Token) (interface{}, error) {
 					if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
 						return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
 					}
@@ -72,11 +96,14 @@ func TestRegister(t *testing.T) {
 }
 
 func TestLogin(t *testing.T) {
+	logging.Initialize("INFO")
 	existingPassword := "test"
+	hasher := password.NewHasher(testPasswordParams)
+	passwordHash, _ := hasher.Hash(existingPassword)
 	existingUser := user.User{
 		ID:           uuid.New(),
 		Login:        "login_1",
-		PasswordHash: user.GeneratePasswordHash(existingPassword),
+		PasswordHash: passwordHash,
 	}
 
 	testCases := []struct {
@@ -113,15 +140,15 @@ func TestLogin(t *testing.T) {
 	for _, tc := range testCases {
 		t.Run(tc.testName, func(t *testing.T) {
 			secretKey := "test"
-			storage := usermemstorage.NewUserMemStorage()
+			storage := usermemstorage.NewUserMemStorage(sessionmemstorage.NewSessionMemStorage(), loginattemptmemstorage.NewLoginAttemptMemStorage())
 			authenticator := authentication.NewAuthenticator(secretKey, time.Hour)
 			storage.InsertUser(context.TODO(), &existingUser, nil)
-			userService := NewUserService(storage, authenticator)
+			userService := NewUserService(storage, sessionservice.NewSessionService(sessionmemstorage.NewSessionMemStorage(), authenticator, time.Hour), newTestLoginGuard(), hasher)
 
-			tokenStr, authErr := userService.Login(context.TODO(), &tc.inputUser)
+			tokens, authErr := userService.Login(context.TODO(), &tc.inputUser, "127.0.0.1")
 			if tc.expectedSavingResult == nil {
 				claims := &authentication.Claims{}
-				_, err := jwt.ParseWithClaims(*tokenStr, claims, func(t *jwt.Token) (interface{}, error) {
+				_, err := jwt.ParseWithClaims(tokens.AccessToken, claims, func(t *jwt.Token) (interface{}, error) {
 					if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
 						return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
 					}
@@ -134,3 +161,220 @@ func TestLogin(t *testing.T) {
 		})
 	}
 }
+
+func TestLoginRehashesLegacyPassword(t *testing.T) {
+	logging.Initialize("INFO")
+	existingPassword := "test"
+	legacyHash := sha256.Sum256([]byte(existingPassword))
+	existingUser := user.User{
+		ID:           uuid.New(),
+		Login:        "login_1",
+		PasswordHash: legacyHash[:],
+	}
+
+	storage := usermemstorage.NewUserMemStorage(sessionmemstorage.NewSessionMemStorage(), loginattemptmemstorage.NewLoginAttemptMemStorage())
+	storage.InsertUser(context.TODO(), &existingUser, nil)
+	hasher := password.NewHasher(testPasswordParams)
+	userService := NewUserService(storage, sessionservice.NewSessionService(sessionmemstorage.NewSessionMemStorage(), authentication.NewAuthenticator("test", time.Hour), time.Hour), newTestLoginGuard(), hasher)
+
+	_, err := userService.Login(context.TODO(), &user.InputUser{Login: existingUser.Login, Password: "invalid_password"}, "127.0.0.1")
+	assert.ErrorIs(t, err, exceptions.ErrUserAuthentication, "unexpected error")
+	userInDB, _ := storage.GetUser(context.TODO(), existingUser.Login)
+	assert.Equal(t, legacyHash[:], userInDB.PasswordHash, "hash mustn't change after failed login")
+
+	_, err = userService.Login(context.TODO(), &user.InputUser{Login: existingUser.Login, Password: existingPassword}, "127.0.0.1")
+	assert.NoError(t, err, "legacy password must be accepted")
+	userInDB, _ = storage.GetUser(context.TODO(), existingUser.Login)
+	ok, needsRehash := hasher.Verify(userInDB.PasswordHash, existingPassword)
+	assert.True(t, ok, "upgraded hash must match password")
+	assert.False(t, needsRehash, "hash wasn't upgraded")
+
+	_, err = userService.Login(context.TODO(), &user.InputUser{Login: existingUser.Login, Password: existingPassword}, "127.0.0.1")
+	assert.NoError(t, err, "upgraded password must be accepted")
+}
+
+func TestLoginLockout(t *testing.T) {
+	logging.Initialize("INFO")
+	existingPassword := "test"
+	hasher := password.NewHasher(testPasswordParams)
+	passwordHash, _ := hasher.Hash(existingPassword)
+	existingUser := user.User{
+		ID:           uuid.New(),
+		Login:        "login_1",
+		PasswordHash: passwordHash,
+	}
+	anotherUser := user.User{
+		ID:           uuid.New(),
+		Login:        "login_2",
+		PasswordHash: passwordHash,
+	}
+
+	storage := usermemstorage.NewUserMemStorage(sessionmemstorage.NewSessionMemStorage(), loginattemptmemstorage.NewLoginAttemptMemStorage())
+	storage.InsertUser(context.TODO(), &existingUser, nil)
+	storage.InsertUser(context.TODO(), &anotherUser, nil)
+	sessionService := sessionservice.NewSessionService(sessionmemstorage.NewSessionMemStorage(), authentication.NewAuthenticator("test", time.Hour), time.Hour)
+	userService := NewUserService(storage, sessionService, newTestLoginGuard(), hasher)
+
+	// free attempts of the test guard are used
+	for i := 0; i < 3; i++ {
+		_, err := userService.Login(context.TODO(), &user.InputUser{Login: existingUser.Login, Password: "invalid_password"}, "127.0.0.1")
+		assert.ErrorIs(t, err, exceptions.ErrUserAuthentication, "unexpected error")
+	}
+	_, err := userService.Login(context.TODO(), &user.InputUser{Login: existingUser.Login, Password: existingPassword}, "127.0.0.2")
+	assert.NoError(t, err, "free attempts mustn't lock the login")
+
+	// success resets failures of the login, but not of the address
+	for i := 1; i <= 4; i++ {
+		userService.Login(context.TODO(), &user.InputUser{Login: existingUser.Login, Password: "invalid_password"}, fmt.Sprintf("10.0.0.%d", i))
+	}
+	_, err = userService.Login(context.TODO(), &user.InputUser{Login: existingUser.Login, Password: existingPassword}, "127.0.0.2")
+	var lockedErr *exceptions.LockedError
+	assert.ErrorAs(t, err, &lockedErr, "login must be locked")
+	assert.ErrorIs(t, err, exceptions.ErrUserLocked, "unexpected error")
+	assert.InDelta(t, time.Minute.Seconds(), lockedErr.RetryAfter.Seconds(), 1, "unexpected lock time")
+
+	userService.Login(context.TODO(), &user.InputUser{Login: "unknown_login", Password: existingPassword}, "127.0.0.1")
+	_, err = userService.Login(context.TODO(), &user.InputUser{Login: anotherUser.Login, Password: existingPassword}, "127.0.0.1")
+	assert.ErrorIs(t, err, exceptions.ErrUserLocked, "address must be locked")
+
+	_, err = userService.Login(context.TODO(), &user.InputUser{Login: anotherUser.Login, Password: existingPassword}, "127.0.0.2")
+	assert.NoError(t, err, "another login from another address mustn't be locked")
+}
+
+func TestConcurrentLoginFailures(t *testing.T) {
+	logging.Initialize("INFO")
+	const requestsNum = 10
+	hasher := password.NewHasher(testPasswordParams)
+	passwordHash, _ := hasher.Hash("test")
+	existingUser := user.User{
+		ID:           uuid.New(),
+		Login:        "login_1",
+		PasswordHash: passwordHash,
+	}
+
+	storage := usermemstorage.NewUserMemStorage(sessionmemstorage.NewSessionMemStorage(), loginattemptmemstorage.NewLoginAttemptMemStorage())
+	storage.InsertUser(context.TODO(), &existingUser, nil)
+	sessionService := sessionservice.NewSessionService(sessionmemstorage.NewSessionMemStorage(), authentication.NewAuthenticator("test", time.Hour), time.Hour)
+	userService := NewUserService(storage, sessionService, newTestLoginGuard(), hasher)
+
+	errs := make(chan error, requestsNum)
+	var wg sync.WaitGroup
+	for i := range requestsNum {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := userService.Login(context.TODO(), &user.InputUser{Login: existingUser.Login, Password: "invalid_password"}, fmt.Sprintf("10.0.0.%d", i))
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	checkedPasswords := 0
+	for err := range errs {
+		if errors.Is(err, exceptions.ErrUserAuthentication) {
+			checkedPasswords++
+		} else {
+			assert.ErrorIs(t, err, exceptions.ErrUserLocked, "unexpected error")
+		}
+	}
+	// free attempts of the test guard and the one which locks the login
+	assert.Equal(t, 4, checkedPasswords, "concurrent attempts passed the lock")
+}
+
+func TestChangePassword(t *testing.T) {
+	logging.Initialize("INFO")
+	existingPassword := "test"
+	hasher := password.NewHasher(testPasswordParams)
+	passwordHash, _ := hasher.Hash(existingPassword)
+	existingUser := user.User{
+		ID:           uuid.New(),
+		Login:        "login_1",
+		PasswordHash: passwordHash,
+	}
+
+	testCases := []struct {
+		testName        string
+		currentPassword string
+		expectedErr     error
+	}{
+		{
+			testName:        "successfully changed",
+			currentPassword: existingPassword,
+			expectedErr:     nil,
+		},
+		{
+			testName:        "bad current password",
+			currentPassword: "invalid_password",
+			expectedErr:     exceptions.ErrUserAuthentication,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			storage := usermemstorage.NewUserMemStorage(sessionmemstorage.NewSessionMemStorage(), loginattemptmemstorage.NewLoginAttemptMemStorage())
+			storage.InsertUser(context.TODO(), &existingUser, nil)
+			authenticator := authentication.NewAuthenticator("test", time.Hour)
+			sessionService := sessionservice.NewSessionService(sessionmemstorage.NewSessionMemStorage(), authenticator, time.Hour)
+			userService := NewUserService(storage, sessionService, newTestLoginGuard(), hasher)
+
+			currentTokens, _ := userService.Login(context.TODO(), &user.InputUser{Login: existingUser.Login, Password: existingPassword}, "127.0.0.1")
+			otherTokens, _ := userService.Login(context.TODO(), &user.InputUser{Login: existingUser.Login, Password: existingPassword}, "127.0.0.1")
+			currentClaims, _ := authenticator.GetClaims(currentTokens.AccessToken)
+			currentSessionID, _ := currentClaims.GetSessionID()
+			otherClaims, _ := authenticator.GetClaims(otherTokens.AccessToken)
+			otherSessionID, _ := otherClaims.GetSessionID()
+
+			passwordChange := user.PasswordChange{CurrentPassword: tc.currentPassword, NewPassword: "new_password"}
+			err := userService.ChangePassword(context.TODO(), existingUser.ID, currentSessionID, &passwordChange, "127.0.0.1")
+			assert.ErrorIs(t, err, tc.expectedErr, "unexpected error")
+
+			currentActive, _ := sessionService.IsSessionActive(context.TODO(), currentSessionID)
+			assert.True(t, currentActive, "current session must stay active")
+			otherActive, _ := sessionService.IsSessionActive(context.TODO(), otherSessionID)
+			_, newPasswordErr := userService.Login(context.TODO(), &user.InputUser{Login: existingUser.Login, Password: "new_password"}, "127.0.0.2")
+			if tc.expectedErr == nil {
+				assert.False(t, otherActive, "other sessions must be revoked")
+				assert.NoError(t, newPasswordErr, "new password must be accepted")
+			} else {
+				assert.True(t, otherActive, "other sessions mustn't be revoked")
+				assert.ErrorIs(t, newPasswordErr, exceptions.ErrUserAuthentication, "new password mustn't be accepted")
+			}
+		})
+	}
+}
+
+func TestDeleteUser(t *testing.T) {
+	logging.Initialize("INFO")
+	existingPassword := "test"
+	hasher := password.NewHasher(testPasswordParams)
+	passwordHash, _ := hasher.Hash(existingPassword)
+	existingUser := user.User{
+		ID:           uuid.New(),
+		Login:        "login_1",
+		PasswordHash: passwordHash,
+	}
+
+	storage := usermemstorage.NewUserMemStorage(sessionmemstorage.NewSessionMemStorage(), loginattemptmemstorage.NewLoginAttemptMemStorage())
+	storage.InsertUser(context.TODO(), &existingUser, nil)
+	authenticator := authentication.NewAuthenticator("test", time.Hour)
+	sessionService := sessionservice.NewSessionService(sessionmemstorage.NewSessionMemStorage(), authenticator, time.Hour)
+	userService := NewUserService(storage, sessionService, newTestLoginGuard(), hasher)
+
+	tokens, _ := userService.Login(context.TODO(), &user.InputUser{Login: existingUser.Login, Password: existingPassword}, "127.0.0.1")
+	claims, _ := authenticator.GetClaims(tokens.AccessToken)
+	sessionID, _ := claims.GetSessionID()
+
+	err := userService.DeleteUser(context.TODO(), existingUser.ID)
+	assert.NoError(t, err, "unexpected error")
+
+	active, _ := sessionService.IsSessionActive(context.TODO(), sessionID)
+	assert.False(t, active, "sessions of deleted user must be revoked")
+	_, err = userService.Login(context.TODO(), &user.InputUser{Login: existingUser.Login, Password: existingPassword}, "127.0.0.1")
+	assert.ErrorIs(t, err, exceptions.ErrUserAuthentication, "deleted user mustn't login")
+	_, err = userService.Register(context.TODO(), &user.InputUser{Login: existingUser.Login, Password: existingPassword})
+	assert.NoError(t, err, "login of deleted user must be free")
+
+	err = userService.DeleteUser(context.TODO(), existingUser.ID)
+	assert.ErrorIs(t, err, exceptions.ErrUserNotFound, "user can't be deleted twice")
+}
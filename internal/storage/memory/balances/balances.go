@@ -2,20 +2,28 @@ package balancememstorage
 
 import (
 	"context"
+	"slices"
 	"sync"
+	"time"
 
 	"github.com/google/uuid"
 
 	"github.com/ry461ch/loyalty_system/internal/helpers/transaction"
 	"github.com/ry461ch/loyalty_system/internal/models/balance"
+	"github.com/ry461ch/loyalty_system/internal/models/exceptions"
+	"github.com/ry461ch/loyalty_system/internal/models/money"
 )
 
 type BalanceMemStorage struct {
-	balances sync.Map // map[string]balance.Balance
+	mu       sync.Mutex // serializes read-modify-write of balances and lots
+	balances sync.Map   // map[string]balance.Balance
+	lots     map[uuid.UUID][]balance.Lot
 }
 
 func NewBalanceMemStorage() *BalanceMemStorage {
-	return &BalanceMemStorage{}
+	return &BalanceMemStorage{
+		lots: map[uuid.UUID][]balance.Lot{},
+	}
 }
 
 func (bms *BalanceMemStorage) GetBalance(ctx context.Context, userID uuid.UUID) (*balance.Balance, error) {
@@ -27,27 +35,238 @@ func (bms *BalanceMemStorage) GetBalance(ctx context.Context, userID uuid.UUID)
 	return &userBalance, nil
 }
 
-func (bms *BalanceMemStorage) ReduceBalance(ctx context.Context, userID uuid.UUID, amount float64, trx *transaction.Trx) error {
-	val, ok := bms.balances.Load(userID)
-	if !ok {
-		val = balance.Balance{}
+func (bms *BalanceMemStorage) ReduceBalance(ctx context.Context, userID uuid.UUID, amount money.Money, trx *transaction.Trx) error {
+	bms.mu.Lock()
+	defer bms.mu.Unlock()
+
+	userBalance := bms.load(userID)
+	if userBalance.Current < amount {
+		return exceptions.ErrNotEnoughBalance
+	}
+	bms.change(userID, -amount, amount)
+	consumed := bms.consumeLots(userID, amount, "")
+	if trx != nil {
+		trx.OnRollback(func() {
+			bms.mu.Lock()
+			defer bms.mu.Unlock()
+			bms.change(userID, amount, -amount)
+			bms.restoreLots(userID, consumed)
+		})
 	}
-	userBalance := val.(balance.Balance)
-	userBalance.Current -= amount
-	userBalance.Withdrawn += amount
-	bms.balances.Store(userID, userBalance)
 	return nil
 }
 
-func (bms *BalanceMemStorage) AddBalance(ctx context.Context, userID uuid.UUID, amount float64, trx *transaction.Trx) error {
+// consumeLots takes amount from lots of the user in order of expiration, lots of firstOrderID go first.
+// Returns taken amounts by lot ids, points without lots cover the rest. Must be called under bms.mu.
+func (bms *BalanceMemStorage) consumeLots(userID uuid.UUID, amount money.Money, firstOrderID string) map[uuid.UUID]money.Money {
+	userLots := bms.lots[userID]
+	slices.SortStableFunc(userLots, func(left, right balance.Lot) int {
+		switch {
+		case left.OrderID == right.OrderID:
+		case left.OrderID == firstOrderID:
+			return -1
+		case right.OrderID == firstOrderID:
+			return 1
+		}
+		switch {
+		case left.ExpiresAt == nil && right.ExpiresAt == nil:
+		case left.ExpiresAt == nil:
+			return 1
+		case right.ExpiresAt == nil:
+			return -1
+		default:
+			if cmp := left.ExpiresAt.Compare(*right.ExpiresAt); cmp != 0 {
+				return cmp
+			}
+		}
+		return left.AccruedAt.Compare(right.AccruedAt)
+	})
+
+	consumed := map[uuid.UUID]money.Money{}
+	for idx := range userLots {
+		if amount == 0 {
+			break
+		}
+		taken := min(amount, userLots[idx].Remaining)
+		if taken == 0 {
+			continue
+		}
+		userLots[idx].Remaining -= taken
+		consumed[userLots[idx].ID] = taken
+		amount -= taken
+	}
+	return consumed
+}
+
+// restoreLots returns taken amounts back to lots. Must be called under bms.mu.
+func (bms *BalanceMemStorage) restoreLots(userID uuid.UUID, taken map[uuid.UUID]money.Money) {
+	for idx, lot := range bms.lots[userID] {
+		bms.lots[userID][idx].Remaining += taken[lot.ID]
+	}
+}
+
+func (bms *BalanceMemStorage) AddBalance(ctx context.Context, userID uuid.UUID, amount money.Money, trx *transaction.Trx) error {
+	bms.mu.Lock()
+	defer bms.mu.Unlock()
+
+	bms.change(userID, amount, 0)
+	if trx != nil {
+		trx.OnRollback(func() {
+			bms.mu.Lock()
+			defer bms.mu.Unlock()
+			bms.change(userID, -amount, 0)
+		})
+	}
+	return nil
+}
+
+// ClawbackBalance takes amount back from current balance of the user, lots of the order go first.
+// The part exceeding current balance becomes debt if allowDebt is set, otherwise it is written off.
+// Returns the taken amount including the debt.
+func (bms *BalanceMemStorage) ClawbackBalance(ctx context.Context, userID uuid.UUID, orderID string, amount money.Money, allowDebt bool, trx *transaction.Trx) (money.Money, error) {
+	bms.mu.Lock()
+	defer bms.mu.Unlock()
+
+	userBalance := bms.load(userID)
+	fromCurrent := min(amount, userBalance.Current)
+	var debt money.Money
+	if allowDebt {
+		debt = amount - fromCurrent
+	}
+	bms.change(userID, -fromCurrent, 0)
+	bms.changeDebt(userID, debt)
+	consumed := bms.consumeLots(userID, fromCurrent, orderID)
+	if trx != nil {
+		trx.OnRollback(func() {
+			bms.mu.Lock()
+			defer bms.mu.Unlock()
+			bms.change(userID, fromCurrent, 0)
+			bms.changeDebt(userID, -debt)
+			bms.restoreLots(userID, consumed)
+		})
+	}
+	return fromCurrent + debt, nil
+}
+
+// AddLot adds the lot to current balance of its user, debt is repaid from the lot first.
+func (bms *BalanceMemStorage) AddLot(ctx context.Context, lot *balance.Lot, trx *transaction.Trx) error {
+	bms.addLot(lot, 0, trx)
+	return nil
+}
+
+// RefundBalance moves the lot from withdrawn back to current balance of its user, debt is repaid from the lot first.
+func (bms *BalanceMemStorage) RefundBalance(ctx context.Context, lot *balance.Lot, trx *transaction.Trx) error {
+	bms.addLot(lot, -lot.Remaining, trx)
+	return nil
+}
+
+func (bms *BalanceMemStorage) addLot(lot *balance.Lot, withdrawnDelta money.Money, trx *transaction.Trx) {
+	bms.mu.Lock()
+	defer bms.mu.Unlock()
+
+	if lot.AccruedAt.IsZero() {
+		lot.AccruedAt = time.Now().UTC()
+	}
+	repaid := min(bms.load(lot.UserID).Debt, lot.Remaining)
+	lot.Remaining -= repaid
+	added := lot.Remaining
+	bms.change(lot.UserID, added, withdrawnDelta)
+	bms.changeDebt(lot.UserID, -repaid)
+	bms.lots[lot.UserID] = append(bms.lots[lot.UserID], *lot)
+	if trx != nil {
+		trx.OnRollback(func() {
+			bms.mu.Lock()
+			defer bms.mu.Unlock()
+			bms.change(lot.UserID, -added, -withdrawnDelta)
+			bms.changeDebt(lot.UserID, repaid)
+			bms.lots[lot.UserID] = slices.DeleteFunc(bms.lots[lot.UserID], func(userLot balance.Lot) bool {
+				return userLot.ID == lot.ID
+			})
+		})
+	}
+}
+
+// ExpireLots takes remaining points of lots expired by expiredAt from balances of up to limit users
+// and returns the lots with expired remaining amounts.
+func (bms *BalanceMemStorage) ExpireLots(ctx context.Context, expiredAt time.Time, limit int, trx *transaction.Trx) ([]balance.Lot, error) {
+	bms.mu.Lock()
+	defer bms.mu.Unlock()
+
+	expiredLots := []balance.Lot{}
+	users := 0
+	for userID, userLots := range bms.lots {
+		if users >= limit {
+			break
+		}
+		userExpiredLots := []balance.Lot{}
+		for idx, lot := range userLots {
+			if lot.Remaining == 0 || lot.ExpiresAt == nil || lot.ExpiresAt.After(expiredAt) {
+				continue
+			}
+			userExpiredLots = append(userExpiredLots, lot)
+			bms.change(userID, -lot.Remaining, 0)
+			userLots[idx].Remaining = 0
+		}
+		if len(userExpiredLots) == 0 {
+			continue
+		}
+		users++
+		expiredLots = append(expiredLots, userExpiredLots...)
+		if trx != nil {
+			trx.OnRollback(func() {
+				bms.mu.Lock()
+				defer bms.mu.Unlock()
+				taken := map[uuid.UUID]money.Money{}
+				for _, lot := range userExpiredLots {
+					taken[lot.ID] = lot.Remaining
+					bms.change(userID, lot.Remaining, 0)
+				}
+				bms.restoreLots(userID, taken)
+			})
+		}
+	}
+	return expiredLots, nil
+}
+
+// GetExpiringSum returns remaining points of user lots expiring by expiresBefore.
+func (bms *BalanceMemStorage) GetExpiringSum(ctx context.Context, userID uuid.UUID, expiresBefore time.Time) (money.Money, error) {
+	bms.mu.Lock()
+	defer bms.mu.Unlock()
+
+	var expiring money.Money
+	for _, lot := range bms.lots[userID] {
+		if lot.ExpiresAt != nil && !lot.ExpiresAt.After(expiresBefore) {
+			expiring += lot.Remaining
+		}
+	}
+	return expiring, nil
+}
+
+func (bms *BalanceMemStorage) load(userID uuid.UUID) balance.Balance {
 	val, ok := bms.balances.Load(userID)
 	if !ok {
-		val = balance.Balance{}
+		return balance.Balance{}
 	}
-	userBalance := val.(balance.Balance)
-	userBalance.Current += amount
+	return val.(balance.Balance)
+}
+
+// change must be called under bms.mu, undo is done by the inverse change
+// so that concurrent transactions don't overwrite each other
+func (bms *BalanceMemStorage) change(userID uuid.UUID, currentDelta, withdrawnDelta money.Money) {
+	userBalance := bms.load(userID)
+	userBalance.Current += currentDelta
+	userBalance.Withdrawn += withdrawnDelta
+	bms.balances.Store(userID, userBalance)
+}
+
+// changeDebt must be called under bms.mu
+func (bms *BalanceMemStorage) changeDebt(userID uuid.UUID, delta money.Money) {
+	if delta == 0 {
+		return
+	}
+	userBalance := bms.load(userID)
+	userBalance.Debt += delta
 	bms.balances.Store(userID, userBalance)
-	return nil
 }
 
 func (*BalanceMemStorage) BeginTx(ctx context.Context) (*transaction.Trx, error) {
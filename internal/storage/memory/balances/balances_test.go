@@ -3,43 +3,52 @@ package balancememstorage
 import (
 	"context"
 	"testing"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 
 	"github.com/ry461ch/loyalty_system/internal/models/balance"
+	"github.com/ry461ch/loyalty_system/internal/models/exceptions"
+	"github.com/ry461ch/loyalty_system/internal/models/money"
 )
 
 func TestReduceBalance(t *testing.T) {
 	existingUserID := uuid.New()
 	existingBalance := balance.Balance{
-		Current:   500,
-		Withdrawn: 300,
+		Current:   money.New(500),
+		Withdrawn: money.New(300),
 	}
 
 	testCases := []struct {
 		testName        string
 		userID          uuid.UUID
-		withdrawal      float64
+		withdrawal      money.Money
 		expectedBalance balance.Balance
+		expectedErr     error
 	}{
 		{
 			testName:   "existing user",
 			userID:     existingUserID,
-			withdrawal: 200,
+			withdrawal: money.New(200),
 			expectedBalance: balance.Balance{
-				Current:   existingBalance.Current - 200,
-				Withdrawn: existingBalance.Withdrawn + 200,
+				Current:   existingBalance.Current - money.New(200),
+				Withdrawn: existingBalance.Withdrawn + money.New(200),
 			},
 		},
 		{
-			testName:   "new user",
-			userID:     uuid.New(),
-			withdrawal: 200,
-			expectedBalance: balance.Balance{
-				Current:   -200,
-				Withdrawn: 200,
-			},
+			testName:        "not enough balance",
+			userID:          existingUserID,
+			withdrawal:      money.New(600),
+			expectedBalance: existingBalance,
+			expectedErr:     exceptions.ErrNotEnoughBalance,
+		},
+		{
+			testName:        "new user",
+			userID:          uuid.New(),
+			withdrawal:      money.New(200),
+			expectedBalance: balance.Balance{},
+			expectedErr:     exceptions.ErrNotEnoughBalance,
 		},
 	}
 
@@ -48,9 +57,10 @@ func TestReduceBalance(t *testing.T) {
 			storage := NewBalanceMemStorage()
 			storage.balances.Store(existingUserID, existingBalance)
 
-			storage.ReduceBalance(context.TODO(), tc.userID, tc.withdrawal, nil)
-			resultBalance, _ := storage.balances.Load(tc.userID)
-			assert.Equal(t, tc.expectedBalance, resultBalance, "balances don't match")
+			err := storage.ReduceBalance(context.TODO(), tc.userID, tc.withdrawal, nil)
+			assert.ErrorIs(t, err, tc.expectedErr, "errors don't match")
+			resultBalance, _ := storage.GetBalance(context.TODO(), tc.userID)
+			assert.Equal(t, tc.expectedBalance, *resultBalance, "balances don't match")
 		})
 	}
 }
@@ -58,31 +68,31 @@ func TestReduceBalance(t *testing.T) {
 func TestAddBalance(t *testing.T) {
 	existingUserID := uuid.New()
 	existingBalance := balance.Balance{
-		Current:   500,
-		Withdrawn: 300,
+		Current:   money.New(500),
+		Withdrawn: money.New(300),
 	}
 
 	testCases := []struct {
 		testName        string
 		userID          uuid.UUID
-		withdrawal      float64
+		withdrawal      money.Money
 		expectedBalance balance.Balance
 	}{
 		{
 			testName:   "existing user",
 			userID:     existingUserID,
-			withdrawal: 200,
+			withdrawal: money.New(200),
 			expectedBalance: balance.Balance{
-				Current:   existingBalance.Current + 200,
+				Current:   existingBalance.Current + money.New(200),
 				Withdrawn: existingBalance.Withdrawn,
 			},
 		},
 		{
 			testName:   "new user",
 			userID:     uuid.New(),
-			withdrawal: 200,
+			withdrawal: money.New(200),
 			expectedBalance: balance.Balance{
-				Current: 200,
+				Current: money.New(200),
 			},
 		},
 	}
@@ -102,8 +112,8 @@ func TestAddBalance(t *testing.T) {
 func TestGetBalance(t *testing.T) {
 	existingUserID := uuid.New()
 	existingBalance := balance.Balance{
-		Current:   500,
-		Withdrawn: 300,
+		Current:   money.New(500),
+		Withdrawn: money.New(300),
 	}
 
 	testCases := []struct {
@@ -136,3 +146,188 @@ func TestGetBalance(t *testing.T) {
 		})
 	}
 }
+
+func TestRollbackBalance(t *testing.T) {
+	existingUserID := uuid.New()
+	existingBalance := balance.Balance{
+		Current:   money.New(500),
+		Withdrawn: money.New(300),
+	}
+	newUserID := uuid.New()
+
+	storage := NewBalanceMemStorage()
+	storage.balances.Store(existingUserID, existingBalance)
+
+	trx, _ := storage.BeginTx(context.TODO())
+	storage.ReduceBalance(context.TODO(), existingUserID, money.New(200), trx)
+	storage.AddBalance(context.TODO(), existingUserID, money.New(100), trx)
+	storage.AddBalance(context.TODO(), newUserID, money.New(100), trx)
+	storage.AddLot(context.TODO(), &balance.Lot{ID: uuid.New(), UserID: existingUserID, Amount: money.New(100), Remaining: money.New(100)}, trx)
+	storage.ClawbackBalance(context.TODO(), existingUserID, "1115", money.New(1000), true, trx)
+	trx.Rollback()
+
+	resultBalance, _ := storage.balances.Load(existingUserID)
+	assert.Equal(t, existingBalance, resultBalance, "balances don't match")
+	resultBalance, _ = storage.balances.Load(newUserID)
+	assert.Equal(t, balance.Balance{}, resultBalance, "balance of new user should be empty")
+	assert.Empty(t, storage.lots[existingUserID], "lot should be removed")
+}
+
+func TestLots(t *testing.T) {
+	userID := uuid.New()
+	accruedAt := time.Date(2024, 9, 1, 12, 0, 0, 0, time.UTC)
+	expiresSoonAt := accruedAt.AddDate(0, 1, 0)
+	expiresLaterAt := accruedAt.AddDate(0, 2, 0)
+	newLots := func() []balance.Lot {
+		return []balance.Lot{
+			{ID: uuid.New(), UserID: userID, OrderID: "1321", Amount: money.New(100), Remaining: money.New(100), AccruedAt: accruedAt, ExpiresAt: &expiresLaterAt},
+			{ID: uuid.New(), UserID: userID, OrderID: "1115", Amount: money.New(100), Remaining: money.New(100), AccruedAt: accruedAt.Add(time.Hour), ExpiresAt: &expiresSoonAt},
+		}
+	}
+
+	testCases := []struct {
+		testName          string
+		withdrawal        money.Money
+		expiredAt         time.Time
+		expectedExpired   []money.Money
+		expectedCurrent   money.Money
+		expectedRemaining money.Money
+	}{
+		{
+			testName:          "nothing expired",
+			expiredAt:         accruedAt,
+			expectedExpired:   []money.Money{},
+			expectedCurrent:   money.New(250),
+			expectedRemaining: money.New(200),
+		},
+		{
+			testName:          "withdrawal consumes the soonest expiring lot first",
+			withdrawal:        money.New(150),
+			expiredAt:         expiresLaterAt,
+			expectedExpired:   []money.Money{money.New(50)},
+			expectedCurrent:   money.New(50),
+			expectedRemaining: 0,
+		},
+		{
+			testName:          "points without lots are consumed last",
+			withdrawal:        money.New(220),
+			expiredAt:         expiresLaterAt,
+			expectedExpired:   []money.Money{},
+			expectedCurrent:   money.New(30),
+			expectedRemaining: 0,
+		},
+		{
+			testName:          "expired lot",
+			expiredAt:         expiresSoonAt,
+			expectedExpired:   []money.Money{money.New(100)},
+			expectedCurrent:   money.New(150),
+			expectedRemaining: money.New(100),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			storage := NewBalanceMemStorage()
+			storage.AddBalance(context.TODO(), userID, money.New(50), nil)
+			for _, lot := range newLots() {
+				storage.AddLot(context.TODO(), &lot, nil)
+			}
+			if tc.withdrawal > 0 {
+				err := storage.ReduceBalance(context.TODO(), userID, tc.withdrawal, nil)
+				assert.Nil(t, err, "unexpected error")
+			}
+
+			expiredLots, err := storage.ExpireLots(context.TODO(), tc.expiredAt, 10, nil)
+			assert.Nil(t, err, "unexpected error")
+			expired := []money.Money{}
+			for _, lot := range expiredLots {
+				expired = append(expired, lot.Remaining)
+			}
+			assert.Equal(t, tc.expectedExpired, expired, "expired amounts don't match")
+
+			resultBalance, _ := storage.GetBalance(context.TODO(), userID)
+			assert.Equal(t, tc.expectedCurrent, resultBalance.Current, "balances don't match")
+			remaining, _ := storage.GetExpiringSum(context.TODO(), userID, expiresLaterAt)
+			assert.Equal(t, tc.expectedRemaining, remaining, "remaining points of lots don't match")
+		})
+	}
+}
+
+func TestClawbackBalance(t *testing.T) {
+	userID := uuid.New()
+	accruedAt := time.Date(2024, 9, 1, 12, 0, 0, 0, time.UTC)
+	expiresSoonAt := accruedAt.AddDate(0, 1, 0)
+	expiresLaterAt := accruedAt.AddDate(0, 2, 0)
+	newLots := func() []balance.Lot {
+		return []balance.Lot{
+			{ID: uuid.New(), UserID: userID, OrderID: "1321", Amount: money.New(100), Remaining: money.New(100), AccruedAt: accruedAt, ExpiresAt: &expiresLaterAt},
+			{ID: uuid.New(), UserID: userID, OrderID: "1115", Amount: money.New(100), Remaining: money.New(100), AccruedAt: accruedAt.Add(time.Hour), ExpiresAt: &expiresSoonAt},
+		}
+	}
+
+	testCases := []struct {
+		testName          string
+		withdrawal        money.Money
+		allowDebt         bool
+		nextLot           money.Money
+		expectedTaken     money.Money
+		expectedCurrent   money.Money
+		expectedDebt      money.Money
+		expectedRemaining money.Money
+	}{
+		{
+			testName:          "lot of the order is taken first",
+			expectedTaken:     money.New(100),
+			expectedCurrent:   money.New(150),
+			expectedRemaining: money.New(100),
+		},
+		{
+			testName:        "spent points are written off",
+			withdrawal:      money.New(200),
+			expectedTaken:   money.New(50),
+			expectedCurrent: 0,
+		},
+		{
+			testName:        "spent points become debt",
+			withdrawal:      money.New(200),
+			allowDebt:       true,
+			expectedTaken:   money.New(100),
+			expectedCurrent: 0,
+			expectedDebt:    money.New(50),
+		},
+		{
+			testName:        "next lot repays debt",
+			withdrawal:      money.New(200),
+			allowDebt:       true,
+			nextLot:         money.New(80),
+			expectedTaken:   money.New(100),
+			expectedCurrent: money.New(30),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			storage := NewBalanceMemStorage()
+			storage.AddBalance(context.TODO(), userID, money.New(50), nil)
+			for _, lot := range newLots() {
+				storage.AddLot(context.TODO(), &lot, nil)
+			}
+			if tc.withdrawal > 0 {
+				storage.ReduceBalance(context.TODO(), userID, tc.withdrawal, nil)
+			}
+
+			taken, err := storage.ClawbackBalance(context.TODO(), userID, "1321", money.New(100), tc.allowDebt, nil)
+			assert.Nil(t, err, "unexpected error")
+			assert.Equal(t, tc.expectedTaken, taken, "taken amounts don't match")
+			if tc.nextLot > 0 {
+				storage.AddLot(context.TODO(), &balance.Lot{ID: uuid.New(), UserID: userID, OrderID: "79927398713", Amount: tc.nextLot, Remaining: tc.nextLot}, nil)
+			}
+
+			resultBalance, _ := storage.GetBalance(context.TODO(), userID)
+			assert.Equal(t, tc.expectedCurrent, resultBalance.Current, "balances don't match")
+			assert.Equal(t, tc.expectedDebt, resultBalance.Debt, "debts don't match")
+			remaining, _ := storage.GetExpiringSum(context.TODO(), userID, expiresLaterAt)
+			assert.Equal(t, tc.expectedRemaining, remaining, "remaining points of lots don't match")
+		})
+	}
+}
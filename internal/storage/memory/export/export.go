@@ -0,0 +1,50 @@
+package exportmemstorage
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+
+	"github.com/ry461ch/loyalty_system/internal/helpers/stream"
+	"github.com/ry461ch/loyalty_system/internal/models/export"
+	"github.com/ry461ch/loyalty_system/internal/models/withdrawal"
+	"github.com/ry461ch/loyalty_system/internal/storage/memory/orders"
+	"github.com/ry461ch/loyalty_system/internal/storage/memory/withdrawals"
+)
+
+type ExportMemStorage struct {
+	orderStorage      *ordermemstorage.OrderMemStorage
+	withdrawalStorage *withdrawalmemstorage.WithdrawalMemStorage
+}
+
+func NewExportMemStorage(orderStorage *ordermemstorage.OrderMemStorage, withdrawalStorage *withdrawalmemstorage.WithdrawalMemStorage) *ExportMemStorage {
+	return &ExportMemStorage{
+		orderStorage:      orderStorage,
+		withdrawalStorage: withdrawalStorage,
+	}
+}
+
+// StreamEntries streams uploaded orders, accruals and withdrawals of the user made in [query.From, query.To)
+// in chronological order, order goes before its accrual if both happened at the same moment.
+func (ems *ExportMemStorage) StreamEntries(ctx context.Context, userID uuid.UUID, query export.Query) (stream.Rows[export.Entry], error) {
+	orders, err := ems.orderStorage.StreamUserOrders(ctx, userID, query.From, query.To)
+	if err != nil {
+		return nil, err
+	}
+	accruals, err := ems.orderStorage.StreamUserAccruals(ctx, userID, query.From, query.To)
+	if err != nil {
+		return nil, err
+	}
+	withdrawals, err := ems.withdrawalStorage.StreamWithdrawals(ctx, userID, withdrawal.Filter{ProcessedFrom: query.From, ProcessedTo: query.To})
+	if err != nil {
+		return nil, err
+	}
+	return stream.Merge(
+		func(left, right export.Entry) bool {
+			return left.At.Before(right.At)
+		},
+		stream.Map(orders, export.FromOrder),
+		stream.Map(accruals, export.FromAccrual),
+		stream.Map(withdrawals, export.FromWithdrawal),
+	), nil
+}
@@ -1,24 +1,48 @@
 package memstorage
 
 import (
+	"context"
+
 	"github.com/ry461ch/loyalty_system/internal/storage/memory/balances"
+	"github.com/ry461ch/loyalty_system/internal/storage/memory/export"
+	"github.com/ry461ch/loyalty_system/internal/storage/memory/ledger"
+	"github.com/ry461ch/loyalty_system/internal/storage/memory/loginattempts"
 	"github.com/ry461ch/loyalty_system/internal/storage/memory/orders"
+	"github.com/ry461ch/loyalty_system/internal/storage/memory/sessions"
 	"github.com/ry461ch/loyalty_system/internal/storage/memory/users"
 	"github.com/ry461ch/loyalty_system/internal/storage/memory/withdrawals"
 )
 
 type MemStorage struct {
-	OrderStorage      *ordermemstorage.OrderMemStorage
-	WithdrawalStorage *withdrawalmemstorage.WithdrawalMemStorage
-	BalanceStorage    *balancememstorage.BalanceMemStorage
-	UserStorage       *usermemstorage.UserMemStorage
+	OrderStorage        *ordermemstorage.OrderMemStorage
+	WithdrawalStorage   *withdrawalmemstorage.WithdrawalMemStorage
+	BalanceStorage      *balancememstorage.BalanceMemStorage
+	LedgerStorage       *ledgermemstorage.LedgerMemStorage
+	SessionStorage      *sessionmemstorage.SessionMemStorage
+	LoginAttemptStorage *loginattemptmemstorage.LoginAttemptMemStorage
+	UserStorage         *usermemstorage.UserMemStorage
+	ExportStorage       *exportmemstorage.ExportMemStorage
 }
 
-func NewPGStorage() *MemStorage {
+func NewMemStorage() *MemStorage {
+	orderStorage := ordermemstorage.NewOrderMemStorage()
+	withdrawalStorage := withdrawalmemstorage.NewWithdrawalMemStorage()
+	sessionStorage := sessionmemstorage.NewSessionMemStorage()
+	loginAttemptStorage := loginattemptmemstorage.NewLoginAttemptMemStorage()
 	return &MemStorage{
-		OrderStorage:      ordermemstorage.NewOrderMemStorage(),
-		UserStorage:       usermemstorage.NewUserMemStorage(),
-		BalanceStorage:    balancememstorage.NewBalanceMemStorage(),
-		WithdrawalStorage: withdrawalmemstorage.NewWithdrawalMemStorage(),
+		OrderStorage:        orderStorage,
+		LedgerStorage:       ledgermemstorage.NewLedgerMemStorage(),
+		UserStorage:         usermemstorage.NewUserMemStorage(sessionStorage, loginAttemptStorage),
+		SessionStorage:      sessionStorage,
+		LoginAttemptStorage: loginAttemptStorage,
+		BalanceStorage:      balancememstorage.NewBalanceMemStorage(),
+		WithdrawalStorage:   withdrawalStorage,
+		ExportStorage:       exportmemstorage.NewExportMemStorage(orderStorage, withdrawalStorage),
 	}
 }
+
+func (*MemStorage) Init(ctx context.Context) error {
+	return nil
+}
+
+func (*MemStorage) Close() {}
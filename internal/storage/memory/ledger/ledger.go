@@ -0,0 +1,90 @@
+package ledgermemstorage
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/ry461ch/loyalty_system/internal/helpers/transaction"
+	"github.com/ry461ch/loyalty_system/internal/models/balance"
+	"github.com/ry461ch/loyalty_system/internal/models/ledger"
+)
+
+type LedgerMemStorage struct {
+	mu      sync.RWMutex
+	entries []ledger.Entry
+}
+
+func NewLedgerMemStorage() *LedgerMemStorage {
+	return &LedgerMemStorage{}
+}
+
+func (lms *LedgerMemStorage) InsertMovement(ctx context.Context, movement *ledger.Movement, trx *transaction.Trx) error {
+	if movement.CreatedAt.IsZero() {
+		movement.CreatedAt = time.Now().UTC()
+	}
+
+	lms.mu.Lock()
+	defer lms.mu.Unlock()
+	lms.entries = append(lms.entries, movement.Entries()...)
+	if trx != nil {
+		trx.OnRollback(func() {
+			lms.mu.Lock()
+			defer lms.mu.Unlock()
+			lms.entries = slices.DeleteFunc(lms.entries, func(entry ledger.Entry) bool {
+				return entry.MovementID == movement.ID
+			})
+		})
+	}
+	return nil
+}
+
+func (lms *LedgerMemStorage) GetUserMovements(ctx context.Context, userID uuid.UUID) ([]ledger.Movement, error) {
+	lms.mu.RLock()
+	defer lms.mu.RUnlock()
+
+	movements := []ledger.Movement{}
+	for _, entry := range lms.entries {
+		if entry.UserID == nil || *entry.UserID != userID || entry.Account != ledger.CURRENT {
+			continue
+		}
+		movements = append(movements, ledger.Movement{
+			ID:        entry.MovementID,
+			UserID:    userID,
+			Type:      entry.Type,
+			OrderID:   entry.OrderID,
+			Amount:    entry.Amount,
+			CreatedAt: entry.CreatedAt,
+		})
+	}
+	slices.SortStableFunc(movements, func(left, right ledger.Movement) int {
+		return right.CreatedAt.Compare(left.CreatedAt)
+	})
+	return movements, nil
+}
+
+func (lms *LedgerMemStorage) GetUserBalance(ctx context.Context, userID uuid.UUID) (*balance.Balance, error) {
+	lms.mu.RLock()
+	defer lms.mu.RUnlock()
+
+	var userBalance balance.Balance
+	for _, entry := range lms.entries {
+		if entry.UserID == nil || *entry.UserID != userID {
+			continue
+		}
+		switch entry.Account {
+		case ledger.CURRENT:
+			userBalance.Current += entry.Amount
+		case ledger.WITHDRAWN:
+			userBalance.Withdrawn += entry.Amount
+		}
+	}
+	return &userBalance, nil
+}
+
+func (*LedgerMemStorage) BeginTx(ctx context.Context) (*transaction.Trx, error) {
+	return transaction.BeginTx(ctx, nil)
+}
@@ -0,0 +1,90 @@
+package ledgermemstorage
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ry461ch/loyalty_system/internal/models/balance"
+	"github.com/ry461ch/loyalty_system/internal/models/ledger"
+	"github.com/ry461ch/loyalty_system/internal/models/money"
+)
+
+func TestGetUserBalance(t *testing.T) {
+	existingUserID := uuid.New()
+	storage := NewLedgerMemStorage()
+	storage.InsertMovement(context.TODO(), &ledger.Movement{
+		ID:      uuid.New(),
+		UserID:  existingUserID,
+		Type:    ledger.ACCRUAL,
+		OrderID: "1115",
+		Amount:  money.New(500),
+	}, nil)
+	storage.InsertMovement(context.TODO(), &ledger.Movement{
+		ID:      uuid.New(),
+		UserID:  existingUserID,
+		Type:    ledger.WITHDRAWAL,
+		OrderID: "1321",
+		Amount:  money.New(-200),
+	}, nil)
+
+	testCases := []struct {
+		testName          string
+		userID            uuid.UUID
+		expectedBalance   balance.Balance
+		expectedMovements int
+	}{
+		{
+			testName: "existing user",
+			userID:   existingUserID,
+			expectedBalance: balance.Balance{
+				Current:   money.New(300),
+				Withdrawn: money.New(200),
+			},
+			expectedMovements: 2,
+		},
+		{
+			testName:          "new user",
+			userID:            uuid.New(),
+			expectedBalance:   balance.Balance{},
+			expectedMovements: 0,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			userBalance, _ := storage.GetUserBalance(context.TODO(), tc.userID)
+			assert.Equal(t, tc.expectedBalance, *userBalance, "balances don't match")
+			movements, _ := storage.GetUserMovements(context.TODO(), tc.userID)
+			assert.Equal(t, tc.expectedMovements, len(movements), "num of movements don't match")
+		})
+	}
+}
+
+func TestRollbackMovement(t *testing.T) {
+	userID := uuid.New()
+	storage := NewLedgerMemStorage()
+	storage.InsertMovement(context.TODO(), &ledger.Movement{
+		ID:      uuid.New(),
+		UserID:  userID,
+		Type:    ledger.ACCRUAL,
+		OrderID: "1115",
+		Amount:  money.New(500),
+	}, nil)
+
+	trx, _ := storage.BeginTx(context.TODO())
+	storage.InsertMovement(context.TODO(), &ledger.Movement{
+		ID:      uuid.New(),
+		UserID:  userID,
+		Type:    ledger.WITHDRAWAL,
+		OrderID: "1321",
+		Amount:  money.New(-200),
+	}, trx)
+	trx.Rollback()
+
+	movements, _ := storage.GetUserMovements(context.TODO(), userID)
+	assert.Equal(t, 1, len(movements), "num of movements don't match")
+	assert.Equal(t, 2, len(storage.entries), "num of entries don't match")
+}
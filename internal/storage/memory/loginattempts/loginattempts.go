@@ -0,0 +1,99 @@
+package loginattemptmemstorage
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/ry461ch/loyalty_system/internal/helpers/transaction"
+	"github.com/ry461ch/loyalty_system/internal/models/loginattempt"
+)
+
+type LoginAttemptMemStorage struct {
+	mu       sync.Mutex
+	attempts map[string]loginattempt.Attempts
+}
+
+func NewLoginAttemptMemStorage() *LoginAttemptMemStorage {
+	return &LoginAttemptMemStorage{attempts: map[string]loginattempt.Attempts{}}
+}
+
+func (lms *LoginAttemptMemStorage) GetLoginAttempts(ctx context.Context, key string) (*loginattempt.Attempts, error) {
+	lms.mu.Lock()
+	defer lms.mu.Unlock()
+
+	attempts, ok := lms.attempts[key]
+	if !ok {
+		return &loginattempt.Attempts{Key: key}, nil
+	}
+	return &attempts, nil
+}
+
+// ReserveLoginAttempt returns false if the key is locked, the attempt isn't counted then.
+func (lms *LoginAttemptMemStorage) ReserveLoginAttempt(ctx context.Context, key string, limits loginattempt.Limits) (*loginattempt.Attempts, bool, error) {
+	lms.mu.Lock()
+	defer lms.mu.Unlock()
+
+	attempts, ok := lms.attempts[key]
+	if !ok {
+		attempts = loginattempt.Attempts{Key: key}
+	}
+	reserved := attempts.Reserve(limits, time.Now().UTC())
+	if reserved {
+		lms.attempts[key] = attempts
+	}
+	return &attempts, reserved, nil
+}
+
+// ReleaseLoginAttempt uncounts the reserved attempt which turned out to be successful.
+func (lms *LoginAttemptMemStorage) ReleaseLoginAttempt(ctx context.Context, key string) error {
+	lms.mu.Lock()
+	defer lms.mu.Unlock()
+
+	attempts, ok := lms.attempts[key]
+	if !ok || attempts.Failures == 0 {
+		return nil
+	}
+	attempts.Failures--
+	lms.attempts[key] = attempts
+	return nil
+}
+
+func (lms *LoginAttemptMemStorage) ResetLoginAttempts(ctx context.Context, key string) error {
+	return lms.DeleteLoginAttempts(ctx, key, nil)
+}
+
+// PruneLoginAttempts deletes attempts of keys which last failed before the given time.
+func (lms *LoginAttemptMemStorage) PruneLoginAttempts(ctx context.Context, lastFailureBefore time.Time) (int, error) {
+	lms.mu.Lock()
+	defer lms.mu.Unlock()
+
+	pruned := 0
+	for key, attempts := range lms.attempts {
+		if attempts.LastFailureAt.Before(lastFailureBefore) {
+			delete(lms.attempts, key)
+			pruned++
+		}
+	}
+	return pruned, nil
+}
+
+// DeleteLoginAttempts is ResetLoginAttempts restoring the attempts if trx is rolled back.
+func (lms *LoginAttemptMemStorage) DeleteLoginAttempts(ctx context.Context, key string, trx *transaction.Trx) error {
+	lms.mu.Lock()
+	defer lms.mu.Unlock()
+
+	attempts, ok := lms.attempts[key]
+	if !ok {
+		return nil
+	}
+	delete(lms.attempts, key)
+	if trx != nil {
+		trx.OnRollback(func() {
+			lms.mu.Lock()
+			defer lms.mu.Unlock()
+			lms.attempts[key] = attempts
+		})
+	}
+	return nil
+}
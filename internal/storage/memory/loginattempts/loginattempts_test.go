@@ -0,0 +1,112 @@
+package loginattemptmemstorage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ry461ch/loyalty_system/internal/helpers/retry"
+	"github.com/ry461ch/loyalty_system/internal/models/loginattempt"
+)
+
+func TestReserveLoginAttempt(t *testing.T) {
+	key := loginattempt.LoginKey("login")
+	limits := loginattempt.Limits{
+		FreeAttempts: 3,
+		Backoff:      retry.Policy{BaseDelay: time.Minute, MaxDelay: time.Hour},
+		Window:       time.Hour,
+	}
+
+	testCases := []struct {
+		testName         string
+		lastFailureAt    time.Time
+		failures         int
+		expectedReserved bool
+		expectedFailures int
+	}{
+		{
+			testName:         "first attempt",
+			expectedReserved: true,
+			expectedFailures: 1,
+		},
+		{
+			testName:         "attempt in window",
+			lastFailureAt:    time.Now().UTC().Add(-time.Minute),
+			failures:         3,
+			expectedReserved: true,
+			expectedFailures: 4,
+		},
+		{
+			testName:         "attempt after window",
+			lastFailureAt:    time.Now().UTC().Add(-2 * time.Hour),
+			failures:         3,
+			expectedReserved: true,
+			expectedFailures: 1,
+		},
+		{
+			testName:         "locked key",
+			lastFailureAt:    time.Now().UTC().Add(-time.Second),
+			failures:         4,
+			expectedReserved: false,
+			expectedFailures: 4,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			storage := NewLoginAttemptMemStorage()
+			if tc.failures > 0 {
+				storage.attempts[key] = loginattempt.Attempts{Key: key, Failures: tc.failures, LastFailureAt: tc.lastFailureAt}
+			}
+
+			attempts, reserved, err := storage.ReserveLoginAttempt(context.TODO(), key, limits)
+			assert.NoError(t, err, "unexpected error")
+			assert.Equal(t, tc.expectedReserved, reserved, "reservations don't match")
+			assert.Equal(t, tc.expectedFailures, attempts.Failures, "failures don't match")
+
+			storedAttempts, _ := storage.GetLoginAttempts(context.TODO(), key)
+			assert.Equal(t, tc.expectedFailures, storedAttempts.Failures, "attempts weren't saved")
+		})
+	}
+}
+
+func TestReleaseLoginAttempt(t *testing.T) {
+	key := loginattempt.AddrKey("127.0.0.1")
+	storage := NewLoginAttemptMemStorage()
+	storage.ReserveLoginAttempt(context.TODO(), key, loginattempt.Limits{Window: time.Hour})
+	storage.ReserveLoginAttempt(context.TODO(), key, loginattempt.Limits{Window: time.Hour})
+
+	err := storage.ReleaseLoginAttempt(context.TODO(), key)
+	assert.NoError(t, err, "unexpected error")
+	attempts, _ := storage.GetLoginAttempts(context.TODO(), key)
+	assert.Equal(t, 1, attempts.Failures, "attempt wasn't released")
+
+	err = storage.ReleaseLoginAttempt(context.TODO(), loginattempt.AddrKey("127.0.0.2"))
+	assert.NoError(t, err, "unexpected error")
+}
+
+func TestPruneLoginAttempts(t *testing.T) {
+	now := time.Now().UTC()
+	storage := NewLoginAttemptMemStorage()
+	storage.attempts["old"] = loginattempt.Attempts{Key: "old", Failures: 1, LastFailureAt: now.Add(-2 * time.Hour)}
+	storage.attempts["recent"] = loginattempt.Attempts{Key: "recent", Failures: 1, LastFailureAt: now}
+
+	pruned, err := storage.PruneLoginAttempts(context.TODO(), now.Add(-time.Hour))
+	assert.NoError(t, err, "unexpected error")
+	assert.Equal(t, 1, pruned, "num of pruned keys don't match")
+	assert.NotContains(t, storage.attempts, "old", "old attempts weren't pruned")
+	assert.Contains(t, storage.attempts, "recent", "recent attempts were pruned")
+}
+
+func TestResetLoginAttempts(t *testing.T) {
+	key := loginattempt.LoginKey("login")
+	storage := NewLoginAttemptMemStorage()
+	storage.ReserveLoginAttempt(context.TODO(), key, loginattempt.Limits{Window: time.Hour})
+
+	err := storage.ResetLoginAttempts(context.TODO(), key)
+	assert.NoError(t, err, "unexpected error")
+	attempts, _ := storage.GetLoginAttempts(context.TODO(), key)
+	assert.Equal(t, loginattempt.Attempts{Key: key}, *attempts, "attempts weren't reset")
+}
@@ -2,24 +2,40 @@ package ordermemstorage
 
 import (
 	"context"
+	"maps"
 	"slices"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/google/uuid"
 
+	"github.com/ry461ch/loyalty_system/internal/helpers/pagination"
+	"github.com/ry461ch/loyalty_system/internal/helpers/retry"
+	"github.com/ry461ch/loyalty_system/internal/helpers/stream"
 	"github.com/ry461ch/loyalty_system/internal/helpers/transaction"
 	"github.com/ry461ch/loyalty_system/internal/models/exceptions"
 	"github.com/ry461ch/loyalty_system/internal/models/order"
 )
 
+type orderLease struct {
+	owner string
+	until time.Time
+}
+
 type OrderMemStorage struct {
+	mu               sync.Mutex
 	usersToOrdersMap sync.Map // map[uuid.UUID]map[string]order.Order
 	ordersToUsersMap sync.Map // map[string]uuid.UUID
+	leases           map[string]orderLease
+	events           map[string][]order.Event
 }
 
 func NewOrderMemStorage() *OrderMemStorage {
-	return &OrderMemStorage{}
+	return &OrderMemStorage{
+		leases: map[string]orderLease{},
+		events: map[string][]order.Event{},
+	}
 }
 
 func (oms *OrderMemStorage) GetOrderUserID(ctx context.Context, orderID string) (*uuid.UUID, error) {
@@ -32,49 +48,197 @@ func (oms *OrderMemStorage) GetOrderUserID(ctx context.Context, orderID string)
 }
 
 func (oms *OrderMemStorage) InsertOrder(ctx context.Context, userID uuid.UUID, orderID string, trx *transaction.Trx) error {
-	oms.ordersToUsersMap.Store(orderID, userID)
+	oms.mu.Lock()
+	defer oms.mu.Unlock()
+
 	newOrder := order.Order{
 		ID:        orderID,
 		Status:    order.NEW,
 		CreatedAt: time.Now().UTC(),
 	}
-
-	val, ok := oms.usersToOrdersMap.Load(userID)
-	if !ok {
-		val = map[string]order.Order{}
+	if trx != nil {
+		trx.OnRollback(func() {
+			oms.mu.Lock()
+			defer oms.mu.Unlock()
+			oms.ordersToUsersMap.Delete(orderID)
+			oms.storeUserOrder(userID, orderID, nil)
+		})
 	}
-	userOrders := val.(map[string]order.Order)
-	userOrders[orderID] = newOrder
-	oms.usersToOrdersMap.Store(userID, userOrders)
+
+	oms.storeUserOrder(userID, orderID, &newOrder)
+	oms.ordersToUsersMap.Store(orderID, userID)
 	return nil
 }
 
-func (oms *OrderMemStorage) UpdateOrder(ctx context.Context, newOrder *order.Order, trx *transaction.Trx) (*uuid.UUID, error) {
+// InsertOrders inserts orders which don't exist yet and returns ids of inserted ones.
+func (oms *OrderMemStorage) InsertOrders(ctx context.Context, userID uuid.UUID, orderIDs []string, trx *transaction.Trx) ([]string, error) {
+	oms.mu.Lock()
+	defer oms.mu.Unlock()
+
+	insertedIDs := []string{}
+	createdAt := time.Now().UTC()
+	for _, orderID := range orderIDs {
+		if _, exists := oms.ordersToUsersMap.Load(orderID); exists {
+			continue
+		}
+		if trx != nil {
+			trx.OnRollback(func() {
+				oms.mu.Lock()
+				defer oms.mu.Unlock()
+				oms.ordersToUsersMap.Delete(orderID)
+				oms.storeUserOrder(userID, orderID, nil)
+			})
+		}
+		oms.storeUserOrder(userID, orderID, &order.Order{ID: orderID, Status: order.NEW, CreatedAt: createdAt})
+		oms.ordersToUsersMap.Store(orderID, userID)
+		insertedIDs = append(insertedIDs, orderID)
+	}
+	return insertedIDs, nil
+}
+
+// UpdateOrder returns owner of the order and the order as it was before the update.
+func (oms *OrderMemStorage) UpdateOrder(ctx context.Context, newOrder *order.Order, trx *transaction.Trx) (*uuid.UUID, *order.Order, error) {
+	oms.mu.Lock()
+	defer oms.mu.Unlock()
+
 	val, ok := oms.ordersToUsersMap.Load(newOrder.ID)
 	if !ok {
-		return nil, exceptions.ErrOrderNotFound
+		return nil, nil, exceptions.ErrOrderNotFound
 	}
 	userID := val.(uuid.UUID)
 
 	val, ok = oms.usersToOrdersMap.Load(userID)
+	if !ok {
+		return nil, nil, exceptions.ErrOrderNotFound
+	}
+	orderInDB, ok := val.(map[string]order.Order)[newOrder.ID]
+	if !ok {
+		return nil, nil, exceptions.ErrOrderNotFound
+	}
+	if !orderInDB.Status.CanTransitionTo(newOrder.Status) {
+		return nil, nil, exceptions.ErrOrderBadStatusTransition
+	}
+	if trx != nil {
+		trx.OnRollback(func() {
+			oms.mu.Lock()
+			defer oms.mu.Unlock()
+			oms.storeUserOrder(userID, orderInDB.ID, &orderInDB)
+		})
+	}
+
+	updatedOrder := *newOrder
+	if updatedOrder.CreatedAt.IsZero() {
+		updatedOrder.CreatedAt = orderInDB.CreatedAt
+	}
+	if updatedOrder.Accrual == nil {
+		// returned order keeps the accrual it was credited
+		updatedOrder.Accrual = orderInDB.Accrual
+	}
+	updatedOrder.Attempts = 0
+	updatedOrder.LastCheckedAt = orderInDB.LastCheckedAt
+	updatedOrder.NextCheckAt = nil
+	if updatedOrder.Status == orderInDB.Status {
+		// no progress, keep backing off
+		updatedOrder.Attempts = orderInDB.Attempts
+		updatedOrder.NextCheckAt = orderInDB.NextCheckAt
+	}
+	oms.storeUserOrder(userID, newOrder.ID, &updatedOrder)
+	return &userID, &orderInDB, nil
+}
+
+func (oms *OrderMemStorage) InsertOrderEvents(ctx context.Context, events []order.Event, trx *transaction.Trx) error {
+	oms.mu.Lock()
+	defer oms.mu.Unlock()
+
+	createdAt := time.Now().UTC()
+	for _, event := range events {
+		newEvent := event
+		newEvent.CreatedAt = createdAt
+		if trx != nil {
+			trx.OnRollback(func() {
+				oms.mu.Lock()
+				defer oms.mu.Unlock()
+				orderEvents := oms.events[newEvent.OrderID]
+				if idx := slices.Index(orderEvents, newEvent); idx >= 0 {
+					oms.events[newEvent.OrderID] = slices.Delete(slices.Clone(orderEvents), idx, idx+1)
+				}
+			})
+		}
+		oms.events[newEvent.OrderID] = append(oms.events[newEvent.OrderID], newEvent)
+	}
+	return nil
+}
+
+// GetUserOrder returns the order only to its owner, orders of other users aren't found.
+func (oms *OrderMemStorage) GetUserOrder(ctx context.Context, userID uuid.UUID, orderID string) (*order.Order, error) {
+	val, ok := oms.usersToOrdersMap.Load(userID)
 	if !ok {
 		return nil, exceptions.ErrOrderNotFound
 	}
-	userOrders := val.(map[string]order.Order)
-	userOrders[newOrder.ID] = *newOrder
+	userOrder, ok := val.(map[string]order.Order)[orderID]
+	if !ok {
+		return nil, exceptions.ErrOrderNotFound
+	}
+	return &userOrder, nil
+}
+
+// GetOrderEvents returns status history of the order in chronological order.
+func (oms *OrderMemStorage) GetOrderEvents(ctx context.Context, orderID string) ([]order.Event, error) {
+	oms.mu.Lock()
+	defer oms.mu.Unlock()
+
+	return append([]order.Event{}, oms.events[orderID]...), nil
+}
+
+// storeUserOrder replaces a single order of the user, nil userOrder removes it. Must be called under mu.
+func (oms *OrderMemStorage) storeUserOrder(userID uuid.UUID, orderID string, userOrder *order.Order) {
+	val, ok := oms.usersToOrdersMap.Load(userID)
+	if !ok {
+		val = map[string]order.Order{}
+	}
+	userOrders := maps.Clone(val.(map[string]order.Order))
+	if userOrder == nil {
+		delete(userOrders, orderID)
+	} else {
+		userOrders[orderID] = *userOrder
+	}
+
+	if len(userOrders) == 0 {
+		oms.usersToOrdersMap.Delete(userID)
+		return
+	}
 	oms.usersToOrdersMap.Store(userID, userOrders)
-	return &userID, nil
 }
 
-func (oms *OrderMemStorage) GetWaitingOrders(ctx context.Context, limit int, inputCreatedAt *time.Time) ([]order.Order, error) {
+func (oms *OrderMemStorage) ClaimWaitingOrders(ctx context.Context, lease order.Lease, backoff retry.Policy, limit int, inputCreatedAt *time.Time) ([]order.Order, error) {
+	oms.mu.Lock()
+	defer oms.mu.Unlock()
+
+	now := time.Now()
+	// expired leases don't stop anyone, orders which reached a final status are never claimed again
+	for orderID, orderLease := range oms.leases {
+		if !orderLease.until.After(now) {
+			delete(oms.leases, orderID)
+		}
+	}
+
 	var waitingOrders []order.Order
 	oms.usersToOrdersMap.Range(func(key any, val any) bool {
 		userOrders := val.(map[string]order.Order)
 		for _, userOrder := range userOrders {
-			if (userOrder.Status == order.NEW || userOrder.Status == order.PROCESSING) &&
-				(inputCreatedAt == nil || inputCreatedAt.Compare(userOrder.CreatedAt) > 0) {
-				waitingOrders = append(waitingOrders, userOrder)
+			if userOrder.Status != order.NEW && userOrder.Status != order.PROCESSING {
+				continue
+			}
+			if inputCreatedAt != nil && inputCreatedAt.Compare(userOrder.CreatedAt) <= 0 {
+				continue
+			}
+			if orderLease, ok := oms.leases[userOrder.ID]; ok && orderLease.owner != lease.Owner && orderLease.until.After(now) {
+				continue
 			}
+			if userOrder.NextCheckAt != nil && userOrder.NextCheckAt.After(now) {
+				continue
+			}
+			waitingOrders = append(waitingOrders, userOrder)
 		}
 
 		return true
@@ -85,24 +249,154 @@ func (oms *OrderMemStorage) GetWaitingOrders(ctx context.Context, limit int, inp
 	})
 
 	resultOrders := waitingOrders[:min(limit, len(waitingOrders))]
+	for idx := range resultOrders {
+		// every claim is a check attempt, next one is postponed by backoff
+		resultOrders[idx].Attempts++
+		lastCheckedAt := now.UTC()
+		nextCheckAt := lastCheckedAt.Add(backoff.Delay(resultOrders[idx].Attempts))
+		resultOrders[idx].LastCheckedAt = &lastCheckedAt
+		resultOrders[idx].NextCheckAt = &nextCheckAt
+
+		val, _ := oms.ordersToUsersMap.Load(resultOrders[idx].ID)
+		oms.storeUserOrder(val.(uuid.UUID), resultOrders[idx].ID, &resultOrders[idx])
+		oms.leases[resultOrders[idx].ID] = orderLease{owner: lease.Owner, until: now.Add(lease.TTL)}
+	}
 	return resultOrders, nil
 }
 
+// ReleaseOrders drops leases of the owner from orders claimed but never checked,
+// the claim is not counted as an attempt and orders can be claimed again right away.
+func (oms *OrderMemStorage) ReleaseOrders(ctx context.Context, lease order.Lease, orderIDs []string) (int, error) {
+	oms.mu.Lock()
+	defer oms.mu.Unlock()
+
+	released := 0
+	for _, orderID := range orderIDs {
+		orderLease, ok := oms.leases[orderID]
+		if !ok || orderLease.owner != lease.Owner {
+			continue
+		}
+		delete(oms.leases, orderID)
+
+		val, ok := oms.ordersToUsersMap.Load(orderID)
+		if !ok {
+			continue
+		}
+		userID := val.(uuid.UUID)
+		userOrders, _ := oms.usersToOrdersMap.Load(userID)
+		userOrder, ok := userOrders.(map[string]order.Order)[orderID]
+		if !ok || (userOrder.Status != order.NEW && userOrder.Status != order.PROCESSING) {
+			continue
+		}
+		userOrder.Attempts = max(userOrder.Attempts-1, 0)
+		userOrder.NextCheckAt = nil
+		oms.storeUserOrder(userID, orderID, &userOrder)
+		released++
+	}
+	return released, nil
+}
+
+func (oms *OrderMemStorage) GiveUpWaitingOrders(ctx context.Context, createdBefore time.Time, reason string) (int, error) {
+	oms.mu.Lock()
+	defer oms.mu.Unlock()
+
+	givenUp := 0
+	oms.usersToOrdersMap.Range(func(key any, val any) bool {
+		userID := key.(uuid.UUID)
+		userOrders := val.(map[string]order.Order)
+		for _, userOrder := range userOrders {
+			// PROCESSING orders are accepted by accrual system and wait for its result however long it takes
+			if userOrder.Status != order.NEW {
+				continue
+			}
+			if !userOrder.CreatedAt.Before(createdBefore) {
+				continue
+			}
+			// given up orders are recorded in status history with polls made before giving up
+			oms.events[userOrder.ID] = append(oms.events[userOrder.ID], order.Event{
+				OrderID:   userOrder.ID,
+				Status:    order.INVALID,
+				Reason:    reason,
+				Attempts:  userOrder.Attempts,
+				CreatedAt: time.Now().UTC(),
+			})
+			userOrder.Status = order.INVALID
+			userOrder.Reason = reason
+			userOrder.Attempts = 0
+			userOrder.NextCheckAt = nil
+			oms.storeUserOrder(userID, userOrder.ID, &userOrder)
+			givenUp++
+		}
+		return true
+	})
+	return givenUp, nil
+}
+
 func (oms *OrderMemStorage) GetUserOrders(ctx context.Context, userID uuid.UUID) ([]order.Order, error) {
+	ordersList, _, err := oms.ListUserOrders(ctx, userID, order.ListQuery{})
+	return ordersList, err
+}
+
+// ListUserOrders returns page of user orders ordered by uploaded_at DESC and cursor of the next page if there is one.
+func (oms *OrderMemStorage) ListUserOrders(ctx context.Context, userID uuid.UUID, query order.ListQuery) ([]order.Order, *pagination.Cursor, error) {
 	val, ok := oms.usersToOrdersMap.Load(userID)
 	if !ok {
-		return []order.Order{}, nil
+		return []order.Order{}, nil, nil
 	}
 
 	ordersList := []order.Order{}
 	userOrders := val.(map[string]order.Order)
 	for _, userOrder := range userOrders {
-		ordersList = append(ordersList, userOrder)
+		if query.Matches(&userOrder) {
+			ordersList = append(ordersList, userOrder)
+		}
 	}
 	slices.SortFunc(ordersList, func(left, right order.Order) int {
-		return right.CreatedAt.Compare(left.CreatedAt)
+		if cmp := right.CreatedAt.Compare(left.CreatedAt); cmp != 0 {
+			return cmp
+		}
+		return strings.Compare(right.ID, left.ID)
+	})
+	ordersList, next := pagination.Cut(ordersList, query.Limit, order.Order.PageCursor)
+	return ordersList, next, nil
+}
+
+// StreamUserOrders streams user orders uploaded in [from, to) ordered by uploaded_at ASC, nil bound isn't applied.
+func (oms *OrderMemStorage) StreamUserOrders(ctx context.Context, userID uuid.UUID, from, to *time.Time) (stream.Rows[order.Order], error) {
+	ordersList, _, err := oms.ListUserOrders(ctx, userID, order.ListQuery{UploadedFrom: from, UploadedTo: to})
+	if err != nil {
+		return nil, err
+	}
+	slices.Reverse(ordersList)
+	return stream.FromSlice(ordersList), nil
+}
+
+// StreamUserAccruals streams PROCESSED events with accrual of user orders happened in [from, to) in chronological order.
+func (oms *OrderMemStorage) StreamUserAccruals(ctx context.Context, userID uuid.UUID, from, to *time.Time) (stream.Rows[order.Event], error) {
+	val, ok := oms.usersToOrdersMap.Load(userID)
+	if !ok {
+		return stream.FromSlice([]order.Event{}), nil
+	}
+
+	oms.mu.Lock()
+	defer oms.mu.Unlock()
+
+	accruals := []order.Event{}
+	for orderID := range val.(map[string]order.Order) {
+		for _, event := range oms.events[orderID] {
+			if event.Status != order.PROCESSED || event.Accrual == nil {
+				continue
+			}
+			if (from != nil && event.CreatedAt.Before(*from)) || (to != nil && !event.CreatedAt.Before(*to)) {
+				continue
+			}
+			accruals = append(accruals, event)
+		}
+	}
+	slices.SortStableFunc(accruals, func(left, right order.Event) int {
+		return left.CreatedAt.Compare(right.CreatedAt)
 	})
-	return ordersList, nil
+	return stream.FromSlice(accruals), nil
 }
 
 func (*OrderMemStorage) BeginTx(ctx context.Context) (*transaction.Trx, error) {
@@ -8,12 +8,15 @@ import (
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 
+	"github.com/ry461ch/loyalty_system/internal/helpers/pagination"
+	"github.com/ry461ch/loyalty_system/internal/helpers/retry"
 	"github.com/ry461ch/loyalty_system/internal/models/exceptions"
+	"github.com/ry461ch/loyalty_system/internal/models/money"
 	"github.com/ry461ch/loyalty_system/internal/models/order"
 )
 
 func TestInsertOrder(t *testing.T) {
-	accrual := float64(500)
+	accrual := money.New(500)
 	existingUserID := uuid.New()
 	existingOrder := order.Order{
 		ID:        "1115",
@@ -61,8 +64,53 @@ func TestInsertOrder(t *testing.T) {
 	}
 }
 
+func TestInsertOrders(t *testing.T) {
+	existingUserID := uuid.New()
+
+	testCases := []struct {
+		testName            string
+		orderIDs            []string
+		rollback            bool
+		expectedInsertedIDs []string
+		expectedOrdersNum   int
+	}{
+		{
+			testName:            "new and existing orders",
+			orderIDs:            []string{"1321", "1115", "79927398713"},
+			expectedInsertedIDs: []string{"1321", "79927398713"},
+			expectedOrdersNum:   3,
+		},
+		{
+			testName:            "rolled back",
+			orderIDs:            []string{"1321", "79927398713"},
+			rollback:            true,
+			expectedInsertedIDs: []string{"1321", "79927398713"},
+			expectedOrdersNum:   1,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			storage := NewOrderMemStorage()
+			storage.InsertOrder(context.TODO(), existingUserID, "1115", nil)
+
+			trx, _ := storage.BeginTx(context.TODO())
+			insertedIDs, err := storage.InsertOrders(context.TODO(), existingUserID, tc.orderIDs, trx)
+			if tc.rollback {
+				trx.Rollback()
+			} else {
+				trx.Commit()
+			}
+			assert.NoError(t, err, "unexpected error")
+			assert.Equal(t, tc.expectedInsertedIDs, insertedIDs, "inserted orders don't match")
+			userOrders, _ := storage.GetUserOrders(context.TODO(), existingUserID)
+			assert.Equal(t, tc.expectedOrdersNum, len(userOrders), "num of orders doesn't match")
+		})
+	}
+}
+
 func TestGetUserID(t *testing.T) {
-	accrual := float64(500)
+	accrual := money.New(500)
 	existingUserID := uuid.New()
 	existingOrder := order.Order{
 		ID:        "1115",
@@ -110,7 +158,7 @@ func TestGetUserID(t *testing.T) {
 }
 
 func TestGetUserOrders(t *testing.T) {
-	accrual := float64(500)
+	accrual := money.New(500)
 	existingUserID := uuid.New()
 	existingOrders := []order.Order{
 		{
@@ -159,8 +207,82 @@ func TestGetUserOrders(t *testing.T) {
 	}
 }
 
-func TestGetWaitingOrders(t *testing.T) {
-	accrual := float64(500)
+func TestListUserOrders(t *testing.T) {
+	existingUserID := uuid.New()
+	uploadedAt := time.Date(2024, 9, 1, 12, 0, 0, 0, time.UTC)
+	existingOrders := []order.Order{
+		{ID: "1115", Status: order.PROCESSED, CreatedAt: uploadedAt},
+		{ID: "1321", Status: order.NEW, CreatedAt: uploadedAt.Add(time.Hour)},
+		{ID: "12345678903", Status: order.NEW, CreatedAt: uploadedAt.Add(time.Hour)},
+		{ID: "79927398713", Status: order.INVALID, CreatedAt: uploadedAt.Add(2 * time.Hour)},
+	}
+	uploadedTo := uploadedAt.Add(2 * time.Hour)
+
+	testCases := []struct {
+		testName         string
+		query            order.ListQuery
+		expectedOrderIDs []string
+		expectedNextID   string
+	}{
+		{
+			testName:         "whole listing",
+			query:            order.ListQuery{},
+			expectedOrderIDs: []string{"79927398713", "1321", "12345678903", "1115"},
+		},
+		{
+			testName:         "first page",
+			query:            order.ListQuery{Page: pagination.Page{Limit: 2}},
+			expectedOrderIDs: []string{"79927398713", "1321"},
+			expectedNextID:   "1321",
+		},
+		{
+			testName: "page after cursor with same upload time",
+			query: order.ListQuery{Page: pagination.Page{
+				Limit:  2,
+				Cursor: &pagination.Cursor{CreatedAt: uploadedAt.Add(time.Hour), ID: "1321"},
+			}},
+			expectedOrderIDs: []string{"12345678903", "1115"},
+		},
+		{
+			testName:         "filter by status",
+			query:            order.ListQuery{Statuses: []order.Status{order.NEW, order.INVALID}},
+			expectedOrderIDs: []string{"79927398713", "1321", "12345678903"},
+		},
+		{
+			testName:         "filter by upload time",
+			query:            order.ListQuery{UploadedFrom: &uploadedAt, UploadedTo: &uploadedTo},
+			expectedOrderIDs: []string{"1321", "12345678903", "1115"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			storage := NewOrderMemStorage()
+			existingOrdersMap := map[string]order.Order{}
+			for _, existingOrder := range existingOrders {
+				storage.ordersToUsersMap.Store(existingOrder.ID, existingUserID)
+				existingOrdersMap[existingOrder.ID] = existingOrder
+			}
+			storage.usersToOrdersMap.Store(existingUserID, existingOrdersMap)
+
+			userOrders, next, err := storage.ListUserOrders(context.TODO(), existingUserID, tc.query)
+			assert.NoError(t, err, "unexpected error")
+			orderIDs := []string{}
+			for _, userOrder := range userOrders {
+				orderIDs = append(orderIDs, userOrder.ID)
+			}
+			assert.Equal(t, tc.expectedOrderIDs, orderIDs, "orders don't match")
+			if tc.expectedNextID == "" {
+				assert.Nil(t, next, "unexpected next cursor")
+			} else {
+				assert.Equal(t, tc.expectedNextID, next.ID, "next cursors don't match")
+			}
+		})
+	}
+}
+
+func TestClaimWaitingOrders(t *testing.T) {
+	accrual := money.New(500)
 	existingUser1ID := uuid.New()
 	createdAt1, _ := time.Parse(time.RFC3339, "2020-12-09T16:09:53Z")
 	createdAt2, _ := time.Parse(time.RFC3339, "2020-12-10T16:09:53Z")
@@ -248,7 +370,7 @@ func TestGetWaitingOrders(t *testing.T) {
 
 	for _, tc := range testCases {
 		t.Run(tc.testName, func(t *testing.T) {
-			waitingOrders, _ := storage.GetWaitingOrders(context.TODO(), tc.limit, tc.createdAt)
+			waitingOrders, _ := storage.ClaimWaitingOrders(context.TODO(), order.Lease{Owner: "instance", TTL: time.Minute}, retry.Policy{}, tc.limit, tc.createdAt)
 			assert.Equal(t, len(tc.expectedOrderIDs), len(waitingOrders), "num of orders don't match")
 			for _, userOrder := range waitingOrders {
 				assert.Contains(t, tc.expectedOrderIDs, userOrder.ID, "user orders doesn't contain expected order id")
@@ -257,8 +379,125 @@ func TestGetWaitingOrders(t *testing.T) {
 	}
 }
 
+func TestClaimWaitingOrdersLease(t *testing.T) {
+	storage := NewOrderMemStorage()
+	storage.InsertOrder(context.TODO(), uuid.New(), "1115", nil)
+
+	claimedOrders, _ := storage.ClaimWaitingOrders(context.TODO(), order.Lease{Owner: "instance-1", TTL: time.Minute}, retry.Policy{}, 10, nil)
+	assert.Equal(t, 1, len(claimedOrders), "order wasn't claimed")
+
+	claimedOrders, _ = storage.ClaimWaitingOrders(context.TODO(), order.Lease{Owner: "instance-2", TTL: time.Minute}, retry.Policy{}, 10, nil)
+	assert.Equal(t, 0, len(claimedOrders), "order leased by another instance was claimed")
+
+	claimedOrders, _ = storage.ClaimWaitingOrders(context.TODO(), order.Lease{Owner: "instance-1", TTL: -time.Second}, retry.Policy{}, 10, nil)
+	assert.Equal(t, 1, len(claimedOrders), "owner can't claim its own order")
+
+	claimedOrders, _ = storage.ClaimWaitingOrders(context.TODO(), order.Lease{Owner: "instance-2", TTL: time.Minute}, retry.Policy{}, 10, nil)
+	assert.Equal(t, 1, len(claimedOrders), "order with expired lease wasn't claimed")
+}
+
+func TestClaimWaitingOrdersSweepsLeases(t *testing.T) {
+	storage := NewOrderMemStorage()
+	storage.InsertOrder(context.TODO(), uuid.New(), "1115", nil)
+	storage.InsertOrder(context.TODO(), uuid.New(), "1321", nil)
+
+	claimedOrders, _ := storage.ClaimWaitingOrders(context.TODO(), order.Lease{Owner: "instance", TTL: -time.Second}, retry.Policy{}, 10, nil)
+	assert.Equal(t, 2, len(claimedOrders), "orders weren't claimed")
+	storage.UpdateOrder(context.TODO(), &order.Order{ID: "1115", Status: order.INVALID}, nil)
+	storage.UpdateOrder(context.TODO(), &order.Order{ID: "1321", Status: order.INVALID}, nil)
+
+	claimedOrders, _ = storage.ClaimWaitingOrders(context.TODO(), order.Lease{Owner: "instance", TTL: time.Minute}, retry.Policy{}, 10, nil)
+	assert.Equal(t, 0, len(claimedOrders), "orders in final status were claimed")
+	assert.Empty(t, storage.leases, "expired leases weren't deleted")
+}
+
+func TestReleaseOrders(t *testing.T) {
+	lease := order.Lease{Owner: "instance", TTL: time.Minute}
+	backoff := retry.Policy{BaseDelay: time.Minute}
+	storage := NewOrderMemStorage()
+	storage.InsertOrder(context.TODO(), uuid.New(), "1115", nil)
+	storage.InsertOrder(context.TODO(), uuid.New(), "1321", nil)
+
+	claimedOrders, _ := storage.ClaimWaitingOrders(context.TODO(), lease, backoff, 10, nil)
+	assert.Equal(t, 2, len(claimedOrders), "orders weren't claimed")
+
+	released, err := storage.ReleaseOrders(context.TODO(), order.Lease{Owner: "other", TTL: time.Minute}, []string{"1115"})
+	assert.NoError(t, err)
+	assert.Equal(t, 0, released, "order leased by another instance was released")
+
+	released, err = storage.ReleaseOrders(context.TODO(), lease, []string{"1115"})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, released, "num of released orders doesn't match")
+
+	claimedOrders, _ = storage.ClaimWaitingOrders(context.TODO(), order.Lease{Owner: "other", TTL: time.Minute}, backoff, 10, nil)
+	assert.Equal(t, 1, len(claimedOrders), "released order wasn't claimed right away")
+	assert.Equal(t, "1115", claimedOrders[0].ID, "order ids don't match")
+	assert.Equal(t, 1, claimedOrders[0].Attempts, "release was counted as an attempt")
+}
+
+func TestClaimWaitingOrdersBackoff(t *testing.T) {
+	lease := order.Lease{Owner: "instance", TTL: time.Minute}
+	backoff := retry.Policy{BaseDelay: time.Minute, MaxDelay: time.Hour}
+	storage := NewOrderMemStorage()
+	storage.InsertOrder(context.TODO(), uuid.New(), "1115", nil)
+
+	start := time.Now().UTC()
+	claimedOrders, _ := storage.ClaimWaitingOrders(context.TODO(), lease, backoff, 10, nil)
+	assert.Equal(t, 1, len(claimedOrders), "order wasn't claimed")
+	assert.Equal(t, 1, claimedOrders[0].Attempts, "attempts don't match")
+	assert.WithinRange(t, *claimedOrders[0].LastCheckedAt, start, time.Now().UTC(), "last check time is wrong")
+	assert.Equal(t, time.Minute, claimedOrders[0].NextCheckAt.Sub(*claimedOrders[0].LastCheckedAt), "next check time is wrong")
+
+	claimedOrders, _ = storage.ClaimWaitingOrders(context.TODO(), lease, backoff, 10, nil)
+	assert.Equal(t, 0, len(claimedOrders), "order was claimed before next check time")
+
+	_, _, err := storage.UpdateOrder(context.TODO(), &order.Order{ID: "1115", Status: order.NEW}, nil)
+	assert.NoError(t, err)
+	claimedOrders, _ = storage.ClaimWaitingOrders(context.TODO(), lease, backoff, 10, nil)
+	assert.Equal(t, 0, len(claimedOrders), "backoff was reset without status change")
+
+	_, _, err = storage.UpdateOrder(context.TODO(), &order.Order{ID: "1115", Status: order.PROCESSING}, nil)
+	assert.NoError(t, err)
+	claimedOrders, _ = storage.ClaimWaitingOrders(context.TODO(), lease, backoff, 10, nil)
+	assert.Equal(t, 1, len(claimedOrders), "backoff wasn't reset after status change")
+	assert.Equal(t, 1, claimedOrders[0].Attempts, "attempts don't match")
+}
+
+func TestGiveUpWaitingOrders(t *testing.T) {
+	existingUserID := uuid.New()
+	storage := NewOrderMemStorage()
+	storage.InsertOrder(context.TODO(), existingUserID, "1115", nil)
+	storage.InsertOrder(context.TODO(), existingUserID, "1321", nil)
+	storage.UpdateOrder(context.TODO(), &order.Order{ID: "1321", Status: order.PROCESSED}, nil)
+	storage.InsertOrder(context.TODO(), existingUserID, "1719", nil)
+	storage.UpdateOrder(context.TODO(), &order.Order{ID: "1719", Status: order.PROCESSING}, nil)
+
+	givenUp, err := storage.GiveUpWaitingOrders(context.TODO(), time.Now().UTC().Add(-time.Hour), order.ReasonGivenUp)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, givenUp, "fresh order was given up")
+
+	givenUp, err = storage.GiveUpWaitingOrders(context.TODO(), time.Now().UTC().Add(time.Second), order.ReasonGivenUp)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, givenUp, "num of given up orders doesn't match")
+
+	userOrders, _ := storage.GetUserOrders(context.TODO(), existingUserID)
+	for _, userOrder := range userOrders {
+		switch userOrder.ID {
+		case "1115":
+			assert.Equal(t, order.INVALID, userOrder.Status, "statuses don't match")
+			assert.Equal(t, order.ReasonGivenUp, userOrder.Reason, "reasons don't match")
+		case "1321":
+			assert.Equal(t, order.PROCESSED, userOrder.Status, "final order was given up")
+			assert.Empty(t, userOrder.Reason, "final order has reason")
+		case "1719":
+			assert.Equal(t, order.PROCESSING, userOrder.Status, "processing order was given up")
+			assert.Empty(t, userOrder.Reason, "processing order has reason")
+		}
+	}
+}
+
 func TestUpdateOrder(t *testing.T) {
-	accrual := float64(500)
+	accrual := money.New(500)
 	createdAt, _ := time.Parse(time.RFC3339, "2020-12-09T16:09:53Z")
 	existingUserID := uuid.New()
 	existingOrder := order.Order{
@@ -282,6 +521,24 @@ func TestUpdateOrder(t *testing.T) {
 			},
 			expectedErr: nil,
 		},
+		{
+			testName: "same non-final status",
+			newOrder: order.Order{
+				ID:        existingOrder.ID,
+				Status:    order.PROCESSING,
+				CreatedAt: createdAt,
+			},
+			expectedErr: nil,
+		},
+		{
+			testName: "backward transition",
+			newOrder: order.Order{
+				ID:        existingOrder.ID,
+				Status:    order.NEW,
+				CreatedAt: createdAt,
+			},
+			expectedErr: exceptions.ErrOrderBadStatusTransition,
+		},
 		{
 			testName: "not existing order",
 			newOrder: order.Order{
@@ -305,7 +562,7 @@ func TestUpdateOrder(t *testing.T) {
 				},
 			)
 
-			userID, err := storage.UpdateOrder(context.TODO(), &tc.newOrder, nil)
+			userID, _, err := storage.UpdateOrder(context.TODO(), &tc.newOrder, nil)
 			assert.ErrorIs(t, tc.expectedErr, err, "errors don't match")
 			val, _ := storage.usersToOrdersMap.Load(existingUserID)
 			userOrders := val.(map[string]order.Order)
@@ -318,3 +575,82 @@ func TestUpdateOrder(t *testing.T) {
 		})
 	}
 }
+
+func TestUpdateFinalOrder(t *testing.T) {
+	accrual := money.New(500)
+	existingUserID := uuid.New()
+
+	for _, finalStatus := range []order.Status{order.PROCESSED, order.INVALID} {
+		storage := NewOrderMemStorage()
+		storage.InsertOrder(context.TODO(), existingUserID, "1115", nil)
+		_, _, err := storage.UpdateOrder(context.TODO(), &order.Order{ID: "1115", Status: finalStatus}, nil)
+		assert.NoError(t, err)
+
+		for _, newStatus := range []order.Status{order.NEW, order.PROCESSING, order.PROCESSED, order.INVALID} {
+			_, _, err = storage.UpdateOrder(context.TODO(), &order.Order{ID: "1115", Status: newStatus, Accrual: &accrual}, nil)
+			assert.ErrorIs(t, err, exceptions.ErrOrderBadStatusTransition, "final order was updated")
+		}
+		userOrders, _ := storage.GetUserOrders(context.TODO(), existingUserID)
+		assert.Equal(t, finalStatus, userOrders[0].Status, "statuses not equal")
+		assert.Nil(t, userOrders[0].Accrual, "accrual was updated")
+	}
+}
+
+func TestStreamUserAccruals(t *testing.T) {
+	existingUserID := uuid.New()
+	processedAt := time.Date(2024, 9, 1, 12, 0, 0, 0, time.UTC)
+	accrual := money.New(100)
+	storage := NewOrderMemStorage()
+	storage.usersToOrdersMap.Store(existingUserID, map[string]order.Order{
+		"1115": {ID: "1115", Status: order.PROCESSED},
+		"1321": {ID: "1321", Status: order.PROCESSED},
+	})
+	storage.usersToOrdersMap.Store(uuid.New(), map[string]order.Order{
+		"12345678903": {ID: "12345678903", Status: order.PROCESSED},
+	})
+	storage.events = map[string][]order.Event{
+		"1115": {
+			{OrderID: "1115", Status: order.NEW, CreatedAt: processedAt.Add(-time.Hour)},
+			{OrderID: "1115", Status: order.PROCESSED, Accrual: &accrual, CreatedAt: processedAt.Add(time.Hour)},
+		},
+		"1321": {
+			{OrderID: "1321", Status: order.PROCESSED, Accrual: &accrual, CreatedAt: processedAt},
+		},
+		"12345678903": {
+			{OrderID: "12345678903", Status: order.PROCESSED, Accrual: &accrual, CreatedAt: processedAt},
+		},
+	}
+	processedTo := processedAt.Add(time.Hour)
+
+	testCases := []struct {
+		testName         string
+		from             *time.Time
+		to               *time.Time
+		expectedOrderIDs []string
+	}{
+		{
+			testName:         "all accruals",
+			expectedOrderIDs: []string{"1321", "1115"},
+		},
+		{
+			testName:         "period",
+			from:             &processedAt,
+			to:               &processedTo,
+			expectedOrderIDs: []string{"1321"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			accruals, err := storage.StreamUserAccruals(context.TODO(), existingUserID, tc.from, tc.to)
+			assert.NoError(t, err, "unexpected error")
+			defer accruals.Close()
+
+			orderIDs := []string{}
+			for accruals.Next() {
+				orderIDs = append(orderIDs, accruals.Value().OrderID)
+			}
+			assert.Equal(t, tc.expectedOrderIDs, orderIDs, "accruals don't match")
+		})
+	}
+}
@@ -0,0 +1,148 @@
+package sessionmemstorage
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/ry461ch/loyalty_system/internal/helpers/transaction"
+	"github.com/ry461ch/loyalty_system/internal/models/exceptions"
+	"github.com/ry461ch/loyalty_system/internal/models/session"
+)
+
+type SessionMemStorage struct {
+	mu       sync.Mutex
+	sessions map[uuid.UUID]session.Session
+}
+
+func NewSessionMemStorage() *SessionMemStorage {
+	return &SessionMemStorage{sessions: map[uuid.UUID]session.Session{}}
+}
+
+func (sms *SessionMemStorage) InsertSession(ctx context.Context, inputSession *session.Session, trx *transaction.Trx) error {
+	sms.mu.Lock()
+	defer sms.mu.Unlock()
+
+	if inputSession.CreatedAt.IsZero() {
+		inputSession.CreatedAt = time.Now().UTC()
+	}
+	sms.sessions[inputSession.ID] = *inputSession
+	if trx != nil {
+		trx.OnRollback(func() {
+			sms.mu.Lock()
+			defer sms.mu.Unlock()
+			delete(sms.sessions, inputSession.ID)
+		})
+	}
+	return nil
+}
+
+func (sms *SessionMemStorage) GetSession(ctx context.Context, sessionID uuid.UUID) (*session.Session, error) {
+	sms.mu.Lock()
+	defer sms.mu.Unlock()
+
+	storedSession, ok := sms.sessions[sessionID]
+	if !ok {
+		return nil, exceptions.ErrSessionNotFound
+	}
+	return &storedSession, nil
+}
+
+func (sms *SessionMemStorage) RotateSession(
+	ctx context.Context,
+	sessionID uuid.UUID,
+	oldRefreshTokenHash []byte,
+	newRefreshTokenHash []byte,
+	expiresAt time.Time,
+	trx *transaction.Trx,
+) error {
+	sms.mu.Lock()
+	defer sms.mu.Unlock()
+
+	storedSession, ok := sms.sessions[sessionID]
+	if !ok {
+		return exceptions.ErrSessionNotFound
+	}
+	if storedSession.RevokedAt != nil || !bytes.Equal(storedSession.RefreshTokenHash, oldRefreshTokenHash) {
+		return exceptions.ErrSessionConflict
+	}
+
+	rotatedSession := storedSession
+	rotatedSession.RefreshTokenHash = newRefreshTokenHash
+	rotatedSession.ExpiresAt = expiresAt
+	sms.sessions[sessionID] = rotatedSession
+	sms.restoreOnRollback(storedSession, trx)
+	return nil
+}
+
+func (sms *SessionMemStorage) RevokeSession(ctx context.Context, sessionID uuid.UUID, trx *transaction.Trx) error {
+	sms.mu.Lock()
+	defer sms.mu.Unlock()
+
+	storedSession, ok := sms.sessions[sessionID]
+	if !ok {
+		return exceptions.ErrSessionNotFound
+	}
+	sms.revoke(storedSession, time.Now().UTC(), trx)
+	return nil
+}
+
+// RevokeUserSessions revokes all sessions of the user but exceptSessionID, uuid.Nil revokes all of them.
+func (sms *SessionMemStorage) RevokeUserSessions(ctx context.Context, userID uuid.UUID, exceptSessionID uuid.UUID, trx *transaction.Trx) error {
+	sms.mu.Lock()
+	defer sms.mu.Unlock()
+
+	now := time.Now().UTC()
+	for _, storedSession := range sms.sessions {
+		if storedSession.UserID == userID && storedSession.ID != exceptSessionID {
+			sms.revoke(storedSession, now, trx)
+		}
+	}
+	return nil
+}
+
+// RenameUserSessions replaces login stored in all sessions of the user.
+func (sms *SessionMemStorage) RenameUserSessions(ctx context.Context, userID uuid.UUID, login string, trx *transaction.Trx) error {
+	sms.mu.Lock()
+	defer sms.mu.Unlock()
+
+	for _, storedSession := range sms.sessions {
+		if storedSession.UserID != userID {
+			continue
+		}
+		renamedSession := storedSession
+		renamedSession.Login = login
+		sms.sessions[storedSession.ID] = renamedSession
+		sms.restoreOnRollback(storedSession, trx)
+	}
+	return nil
+}
+
+func (*SessionMemStorage) BeginTx(ctx context.Context) (*transaction.Trx, error) {
+	return transaction.BeginTx(ctx, nil)
+}
+
+// revoke must be called with mu held, already revoked sessions keep their revocation time.
+func (sms *SessionMemStorage) revoke(storedSession session.Session, now time.Time, trx *transaction.Trx) {
+	if storedSession.RevokedAt != nil {
+		return
+	}
+	revokedSession := storedSession
+	revokedSession.RevokedAt = &now
+	sms.sessions[storedSession.ID] = revokedSession
+	sms.restoreOnRollback(storedSession, trx)
+}
+
+func (sms *SessionMemStorage) restoreOnRollback(prevSession session.Session, trx *transaction.Trx) {
+	if trx == nil {
+		return
+	}
+	trx.OnRollback(func() {
+		sms.mu.Lock()
+		defer sms.mu.Unlock()
+		sms.sessions[prevSession.ID] = prevSession
+	})
+}
@@ -0,0 +1,117 @@
+package sessionmemstorage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ry461ch/loyalty_system/internal/models/exceptions"
+	"github.com/ry461ch/loyalty_system/internal/models/session"
+)
+
+func TestRotateSession(t *testing.T) {
+	revokedAt := time.Now().UTC()
+	activeSession := session.Session{
+		ID:               uuid.New(),
+		UserID:           uuid.New(),
+		RefreshTokenHash: []byte("hash_1"),
+		ExpiresAt:        time.Now().UTC().Add(time.Hour),
+	}
+	revokedSession := activeSession
+	revokedSession.ID = uuid.New()
+	revokedSession.RevokedAt = &revokedAt
+
+	testCases := []struct {
+		testName     string
+		sessionID    uuid.UUID
+		oldHash      []byte
+		rollback     bool
+		expectedErr  error
+		expectedHash []byte
+	}{
+		{
+			testName:     "successful rotation",
+			sessionID:    activeSession.ID,
+			oldHash:      []byte("hash_1"),
+			expectedHash: []byte("hash_2"),
+		},
+		{
+			testName:     "rolled back rotation",
+			sessionID:    activeSession.ID,
+			oldHash:      []byte("hash_1"),
+			rollback:     true,
+			expectedHash: []byte("hash_1"),
+		},
+		{
+			testName:     "outdated hash",
+			sessionID:    activeSession.ID,
+			oldHash:      []byte("hash_0"),
+			expectedErr:  exceptions.ErrSessionConflict,
+			expectedHash: []byte("hash_1"),
+		},
+		{
+			testName:     "revoked session",
+			sessionID:    revokedSession.ID,
+			oldHash:      []byte("hash_1"),
+			expectedErr:  exceptions.ErrSessionConflict,
+			expectedHash: []byte("hash_1"),
+		},
+		{
+			testName:    "unknown session",
+			sessionID:   uuid.New(),
+			oldHash:     []byte("hash_1"),
+			expectedErr: exceptions.ErrSessionNotFound,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			storage := NewSessionMemStorage()
+			storage.InsertSession(context.TODO(), &activeSession, nil)
+			storage.InsertSession(context.TODO(), &revokedSession, nil)
+
+			trx, _ := storage.BeginTx(context.TODO())
+			err := storage.RotateSession(context.TODO(), tc.sessionID, tc.oldHash, []byte("hash_2"), time.Now().UTC().Add(time.Hour), trx)
+			if tc.rollback {
+				trx.Rollback()
+			} else {
+				trx.Commit()
+			}
+			assert.ErrorIs(t, err, tc.expectedErr, "exceptions don't match")
+
+			storedSession, err := storage.GetSession(context.TODO(), tc.sessionID)
+			if tc.expectedHash == nil {
+				assert.ErrorIs(t, err, exceptions.ErrSessionNotFound, "exceptions don't match")
+				return
+			}
+			assert.Equal(t, tc.expectedHash, storedSession.RefreshTokenHash, "hashes don't match")
+		})
+	}
+}
+
+func TestRevokeSession(t *testing.T) {
+	storedSession := session.Session{
+		ID:        uuid.New(),
+		UserID:    uuid.New(),
+		ExpiresAt: time.Now().UTC().Add(time.Hour),
+	}
+	storage := NewSessionMemStorage()
+	storage.InsertSession(context.TODO(), &storedSession, nil)
+
+	trx, _ := storage.BeginTx(context.TODO())
+	storage.RevokeSession(context.TODO(), storedSession.ID, trx)
+	trx.Rollback()
+	sessionInDB, _ := storage.GetSession(context.TODO(), storedSession.ID)
+	assert.True(t, sessionInDB.IsActive(time.Now().UTC()), "rolled back revocation")
+
+	err := storage.RevokeSession(context.TODO(), storedSession.ID, nil)
+	assert.NoError(t, err, "unexpected error")
+	sessionInDB, _ = storage.GetSession(context.TODO(), storedSession.ID)
+	assert.False(t, sessionInDB.IsActive(time.Now().UTC()), "session wasn't revoked")
+
+	err = storage.RevokeSession(context.TODO(), uuid.New(), nil)
+	assert.ErrorIs(t, err, exceptions.ErrSessionNotFound, "exceptions don't match")
+}
@@ -3,21 +3,46 @@ package usermemstorage
 import (
 	"context"
 	"sync"
+	"time"
+
+	"github.com/google/uuid"
 
 	"github.com/ry461ch/loyalty_system/internal/helpers/transaction"
 	"github.com/ry461ch/loyalty_system/internal/models/exceptions"
+	"github.com/ry461ch/loyalty_system/internal/models/loginattempt"
 	"github.com/ry461ch/loyalty_system/internal/models/user"
+	"github.com/ry461ch/loyalty_system/internal/storage/memory/loginattempts"
+	"github.com/ry461ch/loyalty_system/internal/storage/memory/sessions"
 )
 
 type UserMemStorage struct {
-	users sync.Map // map[string]user.User
+	users               sync.Map // map[string]user.User
+	sessionStorage      *sessionmemstorage.SessionMemStorage
+	loginAttemptStorage *loginattemptmemstorage.LoginAttemptMemStorage
 }
 
-func NewUserMemStorage() *UserMemStorage {
-	return &UserMemStorage{}
+// NewUserMemStorage takes storages which keep logins of users, they are cleared on anonymization.
+func NewUserMemStorage(
+	sessionStorage *sessionmemstorage.SessionMemStorage,
+	loginAttemptStorage *loginattemptmemstorage.LoginAttemptMemStorage,
+) *UserMemStorage {
+	return &UserMemStorage{
+		sessionStorage:      sessionStorage,
+		loginAttemptStorage: loginAttemptStorage,
+	}
 }
 
 func (ums *UserMemStorage) InsertUser(ctx context.Context, inputUser *user.User, trx *transaction.Trx) error {
+	prevVal, existed := ums.users.Load(inputUser.Login)
+	if trx != nil {
+		trx.OnRollback(func() {
+			if existed {
+				ums.users.Store(inputUser.Login, prevVal)
+			} else {
+				ums.users.Delete(inputUser.Login)
+			}
+		})
+	}
 	ums.users.Store(inputUser.Login, *inputUser)
 	return nil
 }
@@ -31,6 +56,69 @@ func (ums *UserMemStorage) GetUser(ctx context.Context, login string) (*user.Use
 	return &userInDB, nil
 }
 
+func (ums *UserMemStorage) GetUserByID(ctx context.Context, userID uuid.UUID) (*user.User, error) {
+	var userInDB *user.User
+	ums.users.Range(func(_, val any) bool {
+		if storedUser := val.(user.User); storedUser.ID == userID && storedUser.DeletedAt == nil {
+			userInDB = &storedUser
+			return false
+		}
+		return true
+	})
+	if userInDB == nil {
+		return nil, exceptions.ErrUserNotFound
+	}
+	return userInDB, nil
+}
+
+func (ums *UserMemStorage) UpdatePasswordHash(ctx context.Context, userID uuid.UUID, passwordHash []byte, trx *transaction.Trx) error {
+	userInDB, err := ums.GetUserByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if trx != nil {
+		prevVal := *userInDB
+		trx.OnRollback(func() {
+			ums.users.Store(prevVal.Login, prevVal)
+		})
+	}
+	userInDB.PasswordHash = passwordHash
+	ums.users.Store(userInDB.Login, *userInDB)
+	return nil
+}
+
+// AnonymizeUser moves the user to anonymized login and removes its password,
+// the id is kept, so orders and withdrawals of the user are still accounted.
+// Login is also removed from sessions and failed login attempts of the user.
+func (ums *UserMemStorage) AnonymizeUser(ctx context.Context, userID uuid.UUID, trx *transaction.Trx) error {
+	userInDB, err := ums.GetUserByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if trx != nil {
+		prevVal := *userInDB
+		trx.OnRollback(func() {
+			ums.users.Delete(user.AnonymizedLogin(prevVal.ID))
+			ums.users.Store(prevVal.Login, prevVal)
+		})
+	}
+	deletedAt := time.Now().UTC()
+	prevLogin := userInDB.Login
+	ums.users.Delete(prevLogin)
+	userInDB.Login = user.AnonymizedLogin(userInDB.ID)
+	userInDB.PasswordHash = []byte{}
+	userInDB.DeletedAt = &deletedAt
+	ums.users.Store(userInDB.Login, *userInDB)
+
+	err = ums.sessionStorage.RenameUserSessions(ctx, userID, userInDB.Login, trx)
+	if err != nil {
+		return err
+	}
+	return ums.loginAttemptStorage.DeleteLoginAttempts(ctx, loginattempt.LoginKey(prevLogin), trx)
+}
+
 func (*UserMemStorage) BeginTx(ctx context.Context) (*transaction.Trx, error) {
 	return transaction.BeginTx(ctx, nil)
 }
@@ -3,12 +3,17 @@ package usermemstorage
 import (
 	"context"
 	"testing"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 
 	"github.com/ry461ch/loyalty_system/internal/models/exceptions"
+	"github.com/ry461ch/loyalty_system/internal/models/loginattempt"
+	"github.com/ry461ch/loyalty_system/internal/models/session"
 	"github.com/ry461ch/loyalty_system/internal/models/user"
+	"github.com/ry461ch/loyalty_system/internal/storage/memory/loginattempts"
+	"github.com/ry461ch/loyalty_system/internal/storage/memory/sessions"
 )
 
 func TestInsertUser(t *testing.T) {
@@ -42,7 +47,7 @@ func TestInsertUser(t *testing.T) {
 
 	for _, tc := range testCases {
 		t.Run(tc.testName, func(t *testing.T) {
-			storage := NewUserMemStorage()
+			storage := NewUserMemStorage(sessionmemstorage.NewSessionMemStorage(), loginattemptmemstorage.NewLoginAttemptMemStorage())
 			storage.users.Store(existingUser.Login, existingUser)
 
 			storage.InsertUser(context.TODO(), &tc.inputUser, nil)
@@ -78,7 +83,7 @@ func TestGetUser(t *testing.T) {
 
 	for _, tc := range testCases {
 		t.Run(tc.testName, func(t *testing.T) {
-			storage := NewUserMemStorage()
+			storage := NewUserMemStorage(sessionmemstorage.NewSessionMemStorage(), loginattemptmemstorage.NewLoginAttemptMemStorage())
 			storage.users.Store(existingUser.Login, existingUser)
 
 			userInDB, err := storage.GetUser(context.TODO(), tc.login)
@@ -93,3 +98,131 @@ func TestGetUser(t *testing.T) {
 		})
 	}
 }
+
+func TestUpdatePasswordHash(t *testing.T) {
+	existingUser := user.User{
+		ID:           uuid.New(),
+		Login:        "login_1",
+		PasswordHash: []byte("testPass1"),
+	}
+
+	testCases := []struct {
+		testName      string
+		userID        uuid.UUID
+		rollback      bool
+		expectedHash  []byte
+		expectedError error
+	}{
+		{
+			testName:     "existing user",
+			userID:       existingUser.ID,
+			expectedHash: []byte("testPass2"),
+		},
+		{
+			testName:     "rolled back",
+			userID:       existingUser.ID,
+			rollback:     true,
+			expectedHash: existingUser.PasswordHash,
+		},
+		{
+			testName:      "unknown user",
+			userID:        uuid.New(),
+			expectedHash:  existingUser.PasswordHash,
+			expectedError: exceptions.ErrUserNotFound,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			storage := NewUserMemStorage(sessionmemstorage.NewSessionMemStorage(), loginattemptmemstorage.NewLoginAttemptMemStorage())
+			storage.users.Store(existingUser.Login, existingUser)
+
+			trx, _ := storage.BeginTx(context.TODO())
+			err := storage.UpdatePasswordHash(context.TODO(), tc.userID, []byte("testPass2"), trx)
+			if tc.rollback {
+				trx.Rollback()
+			} else {
+				trx.Commit()
+			}
+			assert.ErrorIs(t, err, tc.expectedError, "exceptions don't match")
+			userInDB, _ := storage.GetUser(context.TODO(), existingUser.Login)
+			assert.Equal(t, tc.expectedHash, userInDB.PasswordHash, "hashes don't match")
+		})
+	}
+}
+
+func TestAnonymizeUser(t *testing.T) {
+	existingUser := user.User{
+		ID:           uuid.New(),
+		Login:        "login_1",
+		PasswordHash: []byte("testPass1"),
+	}
+	userSession := session.Session{
+		ID:        uuid.New(),
+		UserID:    existingUser.ID,
+		Login:     existingUser.Login,
+		ExpiresAt: time.Now().Add(time.Hour),
+	}
+
+	testCases := []struct {
+		testName      string
+		userID        uuid.UUID
+		rollback      bool
+		expectedError error
+	}{
+		{
+			testName: "existing user",
+			userID:   existingUser.ID,
+		},
+		{
+			testName: "rolled back",
+			userID:   existingUser.ID,
+			rollback: true,
+		},
+		{
+			testName:      "unknown user",
+			userID:        uuid.New(),
+			expectedError: exceptions.ErrUserNotFound,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			sessionStorage := sessionmemstorage.NewSessionMemStorage()
+			loginAttemptStorage := loginattemptmemstorage.NewLoginAttemptMemStorage()
+			storage := NewUserMemStorage(sessionStorage, loginAttemptStorage)
+			storage.users.Store(existingUser.Login, existingUser)
+			sessionStorage.InsertSession(context.TODO(), &userSession, nil)
+			loginAttemptStorage.ReserveLoginAttempt(context.TODO(), loginattempt.LoginKey(existingUser.Login), loginattempt.Limits{Window: time.Hour})
+
+			trx, _ := storage.BeginTx(context.TODO())
+			err := storage.AnonymizeUser(context.TODO(), tc.userID, trx)
+			if tc.rollback {
+				trx.Rollback()
+			} else {
+				trx.Commit()
+			}
+			assert.ErrorIs(t, err, tc.expectedError, "exceptions don't match")
+
+			userInDB, loginErr := storage.GetUser(context.TODO(), existingUser.Login)
+			_, idErr := storage.GetUserByID(context.TODO(), existingUser.ID)
+			sessionInDB, _ := sessionStorage.GetSession(context.TODO(), userSession.ID)
+			attempts, _ := loginAttemptStorage.GetLoginAttempts(context.TODO(), loginattempt.LoginKey(existingUser.Login))
+			if tc.expectedError == nil && !tc.rollback {
+				assert.ErrorIs(t, loginErr, exceptions.ErrUserNotFound, "login must be freed")
+				assert.ErrorIs(t, idErr, exceptions.ErrUserNotFound, "deleted user mustn't be found by id")
+				anonymizedUser, _ := storage.GetUser(context.TODO(), user.AnonymizedLogin(existingUser.ID))
+				assert.Equal(t, existingUser.ID, anonymizedUser.ID, "id must be kept")
+				assert.Empty(t, anonymizedUser.PasswordHash, "password hash must be removed")
+				assert.NotNil(t, anonymizedUser.DeletedAt, "deleted_at must be set")
+				assert.Equal(t, user.AnonymizedLogin(existingUser.ID), sessionInDB.Login, "login must be removed from sessions")
+				assert.Equal(t, 0, attempts.Failures, "login attempts must be removed")
+			} else {
+				assert.Equal(t, existingUser, *userInDB, "users not equal")
+				assert.NoError(t, idErr, "user must be found by id")
+				assert.Equal(t, existingUser.Login, sessionInDB.Login, "logins of sessions not equal")
+				assert.Equal(t, 1, attempts.Failures, "login attempts must be kept")
+			}
+		})
+	}
+}
@@ -2,18 +2,23 @@ package withdrawalmemstorage
 
 import (
 	"context"
+	"maps"
 	"slices"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/google/uuid"
 
+	"github.com/ry461ch/loyalty_system/internal/helpers/pagination"
+	"github.com/ry461ch/loyalty_system/internal/helpers/stream"
 	"github.com/ry461ch/loyalty_system/internal/helpers/transaction"
 	"github.com/ry461ch/loyalty_system/internal/models/exceptions"
 	"github.com/ry461ch/loyalty_system/internal/models/withdrawal"
 )
 
 type WithdrawalMemStorage struct {
+	mu                    sync.Mutex
 	usersToWithdrawalsMap sync.Map // map[uuid.UUID]map[uuid.UUID]withdrawal.Withdrawal
 	withdrawalsToUsersMap sync.Map // map[uuid.UUID]uuid.UUID
 }
@@ -23,12 +28,23 @@ func NewWithdrawalMemStorage() *WithdrawalMemStorage {
 }
 
 func (wms *WithdrawalMemStorage) InsertWithdrawal(ctx context.Context, inputWithdrawal *withdrawal.Withdrawal, trx *transaction.Trx) error {
+	wms.mu.Lock()
+	defer wms.mu.Unlock()
+
+	if _, exists := wms.withdrawalsToUsersMap.Load(*inputWithdrawal.ID); exists {
+		return exceptions.ErrWithdrawalConflict
+	}
+	if trx != nil {
+		trx.OnRollback(func() {
+			wms.remove(*inputWithdrawal.UserID, *inputWithdrawal.ID)
+		})
+	}
+
 	val, ok := wms.usersToWithdrawalsMap.Load(*inputWithdrawal.UserID)
 	if !ok {
 		val = map[uuid.UUID]withdrawal.Withdrawal{}
 	}
-	userWithdrawals := val.(map[uuid.UUID]withdrawal.Withdrawal)
-
+	userWithdrawals := maps.Clone(val.(map[uuid.UUID]withdrawal.Withdrawal))
 	createdAt := time.Now().UTC()
 	userWithdrawals[*inputWithdrawal.ID] = withdrawal.Withdrawal{
 		CreatedAt: &createdAt,
@@ -42,21 +58,95 @@ func (wms *WithdrawalMemStorage) InsertWithdrawal(ctx context.Context, inputWith
 	return nil
 }
 
-func (wms *WithdrawalMemStorage) GetWithdrawals(ctx context.Context, userID uuid.UUID) ([]withdrawal.Withdrawal, error) {
+// remove deletes only the given withdrawal, so concurrent transactions of the same user are kept intact.
+func (wms *WithdrawalMemStorage) remove(userID uuid.UUID, ID uuid.UUID) {
+	wms.mu.Lock()
+	defer wms.mu.Unlock()
+
+	wms.withdrawalsToUsersMap.Delete(ID)
 	val, ok := wms.usersToWithdrawalsMap.Load(userID)
 	if !ok {
-		val = map[uuid.UUID]withdrawal.Withdrawal{}
+		return
+	}
+	userWithdrawals := maps.Clone(val.(map[uuid.UUID]withdrawal.Withdrawal))
+	delete(userWithdrawals, ID)
+	if len(userWithdrawals) == 0 {
+		wms.usersToWithdrawalsMap.Delete(userID)
+		return
 	}
-	userWithdrawals := val.(map[uuid.UUID]withdrawal.Withdrawal)
+	wms.usersToWithdrawalsMap.Store(userID, userWithdrawals)
+}
+
+func (wms *WithdrawalMemStorage) GetWithdrawals(ctx context.Context, userID uuid.UUID) ([]withdrawal.Withdrawal, error) {
+	resultWithdrawals, _, err := wms.ListWithdrawals(ctx, userID, withdrawal.ListQuery{})
+	return resultWithdrawals, err
+}
+
+// ListWithdrawals returns page of user withdrawals ordered by processed_at DESC and cursor of the next page if there is one.
+func (wms *WithdrawalMemStorage) ListWithdrawals(ctx context.Context, userID uuid.UUID, query withdrawal.ListQuery) ([]withdrawal.Withdrawal, *pagination.Cursor, error) {
+	resultWithdrawals, next := listWithdrawals(wms.loadUserWithdrawals(userID), query)
+	return resultWithdrawals, next, nil
+}
+
+func (wms *WithdrawalMemStorage) SummarizeWithdrawals(ctx context.Context, userID uuid.UUID, filter withdrawal.Filter) (*withdrawal.Summary, error) {
+	return summarizeWithdrawals(wms.loadUserWithdrawals(userID), filter), nil
+}
+
+// ListWithdrawalsWithSummary reads the page and the summary of the whole listing from one snapshot
+// of user withdrawals, so the totals always match the page.
+func (wms *WithdrawalMemStorage) ListWithdrawalsWithSummary(ctx context.Context, userID uuid.UUID, query withdrawal.ListQuery) ([]withdrawal.Withdrawal, *pagination.Cursor, *withdrawal.Summary, error) {
+	userWithdrawals := wms.loadUserWithdrawals(userID)
+	resultWithdrawals, next := listWithdrawals(userWithdrawals, query)
+	return resultWithdrawals, next, summarizeWithdrawals(userWithdrawals, query.Filter), nil
+}
+
+func listWithdrawals(userWithdrawals map[uuid.UUID]withdrawal.Withdrawal, query withdrawal.ListQuery) ([]withdrawal.Withdrawal, *pagination.Cursor) {
 	resultWithdrawals := []withdrawal.Withdrawal{}
 	for _, userWithdrawal := range userWithdrawals {
-		resultWithdrawals = append(resultWithdrawals, userWithdrawal)
+		if query.Matches(&userWithdrawal) && query.Cursor.After(*userWithdrawal.CreatedAt, userWithdrawal.ID.String()) {
+			resultWithdrawals = append(resultWithdrawals, userWithdrawal)
+		}
 	}
 
 	slices.SortFunc(resultWithdrawals, func(left, right withdrawal.Withdrawal) int {
-		return right.CreatedAt.Compare(*left.CreatedAt)
+		if cmp := right.CreatedAt.Compare(*left.CreatedAt); cmp != 0 {
+			return cmp
+		}
+		return strings.Compare(right.ID.String(), left.ID.String())
 	})
-	return resultWithdrawals, nil
+	return pagination.Cut(resultWithdrawals, query.Limit, withdrawal.Withdrawal.PageCursor)
+}
+
+// StreamWithdrawals streams user withdrawals matching the filter ordered by processed_at ASC.
+func (wms *WithdrawalMemStorage) StreamWithdrawals(ctx context.Context, userID uuid.UUID, filter withdrawal.Filter) (stream.Rows[withdrawal.Withdrawal], error) {
+	resultWithdrawals, _, err := wms.ListWithdrawals(ctx, userID, withdrawal.ListQuery{Filter: filter})
+	if err != nil {
+		return nil, err
+	}
+	slices.Reverse(resultWithdrawals)
+	return stream.FromSlice(resultWithdrawals), nil
+}
+
+func summarizeWithdrawals(userWithdrawals map[uuid.UUID]withdrawal.Withdrawal, filter withdrawal.Filter) *withdrawal.Summary {
+	summary := withdrawal.Summary{}
+	for _, userWithdrawal := range userWithdrawals {
+		if !filter.Matches(&userWithdrawal) {
+			continue
+		}
+		summary.Count++
+		if userWithdrawal.Status != withdrawal.REFUNDED {
+			summary.Sum += userWithdrawal.Sum
+		}
+	}
+	return &summary
+}
+
+func (wms *WithdrawalMemStorage) loadUserWithdrawals(userID uuid.UUID) map[uuid.UUID]withdrawal.Withdrawal {
+	val, ok := wms.usersToWithdrawalsMap.Load(userID)
+	if !ok {
+		return map[uuid.UUID]withdrawal.Withdrawal{}
+	}
+	return val.(map[uuid.UUID]withdrawal.Withdrawal)
 }
 
 func (wms *WithdrawalMemStorage) GetWithdrawal(ctx context.Context, ID uuid.UUID) (*withdrawal.Withdrawal, error) {
@@ -75,6 +165,43 @@ func (wms *WithdrawalMemStorage) GetWithdrawal(ctx context.Context, ID uuid.UUID
 	return &withdrawalInDB, nil
 }
 
+// RefundWithdrawal marks the completed withdrawal as refunded and returns it.
+func (wms *WithdrawalMemStorage) RefundWithdrawal(ctx context.Context, ID uuid.UUID, trx *transaction.Trx) (*withdrawal.Withdrawal, error) {
+	wms.mu.Lock()
+	defer wms.mu.Unlock()
+
+	userVal, ok := wms.withdrawalsToUsersMap.Load(ID)
+	if !ok {
+		return nil, exceptions.ErrWithdrawalNotFound
+	}
+	userID := userVal.(uuid.UUID)
+	userWithdrawal := wms.loadUserWithdrawals(userID)[ID]
+	if userWithdrawal.Status == withdrawal.REFUNDED {
+		return nil, exceptions.ErrWithdrawalRefunded
+	}
+
+	refundedAt := time.Now().UTC()
+	refundedWithdrawal := userWithdrawal
+	refundedWithdrawal.Status = withdrawal.REFUNDED
+	refundedWithdrawal.RefundedAt = &refundedAt
+	wms.store(userID, refundedWithdrawal)
+	if trx != nil {
+		trx.OnRollback(func() {
+			wms.mu.Lock()
+			defer wms.mu.Unlock()
+			wms.store(userID, userWithdrawal)
+		})
+	}
+	return &refundedWithdrawal, nil
+}
+
+// store replaces a single withdrawal of the user. Must be called under mu.
+func (wms *WithdrawalMemStorage) store(userID uuid.UUID, userWithdrawal withdrawal.Withdrawal) {
+	userWithdrawals := maps.Clone(wms.loadUserWithdrawals(userID))
+	userWithdrawals[*userWithdrawal.ID] = userWithdrawal
+	wms.usersToWithdrawalsMap.Store(userID, userWithdrawals)
+}
+
 func (*WithdrawalMemStorage) BeginTx(ctx context.Context) (*transaction.Trx, error) {
 	return transaction.BeginTx(ctx, nil)
 }
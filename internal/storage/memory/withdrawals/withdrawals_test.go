@@ -8,7 +8,9 @@ import (
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 
+	"github.com/ry461ch/loyalty_system/internal/helpers/pagination"
 	"github.com/ry461ch/loyalty_system/internal/models/exceptions"
+	"github.com/ry461ch/loyalty_system/internal/models/money"
 	"github.com/ry461ch/loyalty_system/internal/models/withdrawal"
 )
 
@@ -19,7 +21,7 @@ func TestInsertWithdrawal(t *testing.T) {
 	existingWithdrawal := withdrawal.Withdrawal{
 		ID:        &existingWithdrawalID,
 		OrderID:   "1115",
-		Sum:       500,
+		Sum:       money.New(500),
 		CreatedAt: &createdAt,
 	}
 	newWithdrawalID := uuid.New()
@@ -36,7 +38,7 @@ func TestInsertWithdrawal(t *testing.T) {
 				ID:      &newWithdrawalID,
 				UserID:  &existingUserID,
 				OrderID: "1313",
-				Sum:     400,
+				Sum:     money.New(400),
 			},
 			expectedWithdrawalsNum: 2,
 		},
@@ -46,7 +48,7 @@ func TestInsertWithdrawal(t *testing.T) {
 				ID:      &newWithdrawalID,
 				UserID:  &newUserID,
 				OrderID: "1313",
-				Sum:     400,
+				Sum:     money.New(400),
 			},
 			expectedWithdrawalsNum: 1,
 		},
@@ -56,7 +58,7 @@ func TestInsertWithdrawal(t *testing.T) {
 				ID:      &existingWithdrawalID,
 				UserID:  &existingUserID,
 				OrderID: "1313",
-				Sum:     400,
+				Sum:     money.New(400),
 			},
 			expectedWithdrawalsNum: 1,
 		},
@@ -84,13 +86,13 @@ func TestGetWithdrawals(t *testing.T) {
 	existingWithdrawal1 := withdrawal.Withdrawal{
 		ID:        &existingWithdrawalID1,
 		OrderID:   "1115",
-		Sum:       500,
+		Sum:       money.New(500),
 		CreatedAt: &createdAt1,
 	}
 	existingWithdrawal2 := withdrawal.Withdrawal{
 		ID:        &existingWithdrawalID2,
 		OrderID:   "1313",
-		Sum:       400,
+		Sum:       money.New(400),
 		CreatedAt: &createdAt2,
 	}
 	existingWithdrawals := map[uuid.UUID]withdrawal.Withdrawal{
@@ -131,6 +133,129 @@ func TestGetWithdrawals(t *testing.T) {
 	}
 }
 
+func TestListWithdrawals(t *testing.T) {
+	existingUserID := uuid.New()
+	createdAt1, _ := time.Parse(time.RFC3339, "2020-12-09T16:09:53Z")
+	createdAt2, _ := time.Parse(time.RFC3339, "2020-12-10T16:09:53Z")
+	existingWithdrawalIDs := []uuid.UUID{
+		uuid.MustParse("00000000-0000-0000-0000-000000000001"),
+		uuid.MustParse("00000000-0000-0000-0000-000000000002"),
+		uuid.MustParse("00000000-0000-0000-0000-000000000003"),
+	}
+	existingWithdrawals := map[uuid.UUID]withdrawal.Withdrawal{
+		existingWithdrawalIDs[0]: {ID: &existingWithdrawalIDs[0], OrderID: "1115", Sum: money.New(500), CreatedAt: &createdAt1},
+		existingWithdrawalIDs[1]: {ID: &existingWithdrawalIDs[1], OrderID: "1313", Sum: money.New(400), CreatedAt: &createdAt2},
+		existingWithdrawalIDs[2]: {ID: &existingWithdrawalIDs[2], OrderID: "1115", Sum: money.New(100), CreatedAt: &createdAt2},
+	}
+
+	testCases := []struct {
+		testName              string
+		query                 withdrawal.ListQuery
+		expectedWithdrawalIDs []uuid.UUID
+		expectedNext          bool
+		expectedSummary       withdrawal.Summary
+	}{
+		{
+			testName:              "whole history",
+			query:                 withdrawal.ListQuery{},
+			expectedWithdrawalIDs: []uuid.UUID{existingWithdrawalIDs[2], existingWithdrawalIDs[1], existingWithdrawalIDs[0]},
+			expectedSummary:       withdrawal.Summary{Count: 3, Sum: money.New(1000)},
+		},
+		{
+			testName:              "first page",
+			query:                 withdrawal.ListQuery{Page: pagination.Page{Limit: 2}},
+			expectedWithdrawalIDs: []uuid.UUID{existingWithdrawalIDs[2], existingWithdrawalIDs[1]},
+			expectedNext:          true,
+			expectedSummary:       withdrawal.Summary{Count: 3, Sum: money.New(1000)},
+		},
+		{
+			testName: "page after cursor with same processing time",
+			query: withdrawal.ListQuery{Page: pagination.Page{
+				Limit:  2,
+				Cursor: &pagination.Cursor{CreatedAt: createdAt2, ID: existingWithdrawalIDs[2].String()},
+			}},
+			expectedWithdrawalIDs: []uuid.UUID{existingWithdrawalIDs[1], existingWithdrawalIDs[0]},
+			expectedSummary:       withdrawal.Summary{Count: 3, Sum: money.New(1000)},
+		},
+		{
+			testName:              "filter by order",
+			query:                 withdrawal.ListQuery{Filter: withdrawal.Filter{OrderID: "1115"}},
+			expectedWithdrawalIDs: []uuid.UUID{existingWithdrawalIDs[2], existingWithdrawalIDs[0]},
+			expectedSummary:       withdrawal.Summary{Count: 2, Sum: money.New(600)},
+		},
+		{
+			testName:              "filter by processing time",
+			query:                 withdrawal.ListQuery{Filter: withdrawal.Filter{ProcessedFrom: &createdAt1, ProcessedTo: &createdAt2}},
+			expectedWithdrawalIDs: []uuid.UUID{existingWithdrawalIDs[0]},
+			expectedSummary:       withdrawal.Summary{Count: 1, Sum: money.New(500)},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			storage := NewWithdrawalMemStorage()
+			storage.usersToWithdrawalsMap.Store(existingUserID, existingWithdrawals)
+
+			userWithdrawals, next, err := storage.ListWithdrawals(context.TODO(), existingUserID, tc.query)
+			assert.NoError(t, err, "unexpected error")
+			withdrawalIDs := []uuid.UUID{}
+			for _, userWithdrawal := range userWithdrawals {
+				withdrawalIDs = append(withdrawalIDs, *userWithdrawal.ID)
+			}
+			assert.Equal(t, tc.expectedWithdrawalIDs, withdrawalIDs, "withdrawals don't match")
+			assert.Equal(t, tc.expectedNext, next != nil, "unexpected next cursor")
+
+			summary, _ := storage.SummarizeWithdrawals(context.TODO(), existingUserID, tc.query.Filter)
+			assert.Equal(t, tc.expectedSummary, *summary, "summaries don't match")
+
+			pageWithdrawals, pageNext, pageSummary, err := storage.ListWithdrawalsWithSummary(context.TODO(), existingUserID, tc.query)
+			assert.NoError(t, err, "unexpected error")
+			assert.Equal(t, userWithdrawals, pageWithdrawals, "withdrawals with summary don't match")
+			assert.Equal(t, next, pageNext, "next cursors with summary don't match")
+			assert.Equal(t, summary, pageSummary, "summaries with page don't match")
+		})
+	}
+}
+
+func TestSummarizeWithdrawals(t *testing.T) {
+	existingUserID := uuid.New()
+	createdAt, _ := time.Parse(time.RFC3339, "2020-12-09T16:09:53Z")
+	completedWithdrawalID := uuid.New()
+	refundedWithdrawalID := uuid.New()
+	existingWithdrawals := map[uuid.UUID]withdrawal.Withdrawal{
+		completedWithdrawalID: {ID: &completedWithdrawalID, OrderID: "1115", Sum: money.New(500), CreatedAt: &createdAt},
+		refundedWithdrawalID:  {ID: &refundedWithdrawalID, OrderID: "1313", Sum: money.New(400), Status: withdrawal.REFUNDED, CreatedAt: &createdAt},
+	}
+
+	testCases := []struct {
+		testName        string
+		filter          withdrawal.Filter
+		expectedSummary withdrawal.Summary
+	}{
+		{
+			testName:        "refunded withdrawal isn't summed",
+			filter:          withdrawal.Filter{},
+			expectedSummary: withdrawal.Summary{Count: 2, Sum: money.New(500)},
+		},
+		{
+			testName:        "only refunded withdrawal",
+			filter:          withdrawal.Filter{OrderID: "1313"},
+			expectedSummary: withdrawal.Summary{Count: 1, Sum: 0},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			storage := NewWithdrawalMemStorage()
+			storage.usersToWithdrawalsMap.Store(existingUserID, existingWithdrawals)
+
+			summary, err := storage.SummarizeWithdrawals(context.TODO(), existingUserID, tc.filter)
+			assert.NoError(t, err, "unexpected error")
+			assert.Equal(t, tc.expectedSummary, *summary, "summaries don't match")
+		})
+	}
+}
+
 func TestGetWithdrawal(t *testing.T) {
 	existingUserID := uuid.New()
 	createdAt, _ := time.Parse(time.RFC3339, "2020-12-09T16:09:53Z")
@@ -138,7 +263,7 @@ func TestGetWithdrawal(t *testing.T) {
 	existingWithdrawal := withdrawal.Withdrawal{
 		ID:        &existingWithdrawalID,
 		OrderID:   "1115",
-		Sum:       500,
+		Sum:       money.New(500),
 		CreatedAt: &createdAt,
 	}
 
@@ -4,12 +4,14 @@ import (
 	"context"
 	"database/sql"
 	"errors"
-	"strings"
+	"time"
 
 	"github.com/google/uuid"
 
 	"github.com/ry461ch/loyalty_system/internal/helpers/transaction"
 	"github.com/ry461ch/loyalty_system/internal/models/balance"
+	"github.com/ry461ch/loyalty_system/internal/models/exceptions"
+	"github.com/ry461ch/loyalty_system/internal/models/money"
 )
 
 type BalancePGStorage struct {
@@ -17,21 +19,6 @@ type BalancePGStorage struct {
 	dsn string
 }
 
-func getDDL() string {
-	return `
-		CREATE TABLE IF NOT EXISTS content.balances (
-			user_id UUID PRIMARY KEY,
-			current	DOUBLE PRECISION NOT NULL DEFAULT 0,
-			withdrawn DOUBLE PRECISION NOT NULL DEFAULT 0,
-			created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
-			updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
-		);
-
-		CREATE INDEX IF NOT EXISTS balances_created_at_idx ON content.balances(created_at);
-		CREATE INDEX IF NOT EXISTS balances_updated_at_idx ON content.balances(updated_at);
-	`
-}
-
 func NewBalancePGStorage(DBDsn string) *BalancePGStorage {
 	return &BalancePGStorage{
 		dsn: DBDsn,
@@ -45,27 +32,17 @@ func (bps *BalancePGStorage) Initialize(ctx context.Context, DB *sql.DB) error {
 	}
 	bps.DB = DB
 
-	requests := strings.Split(getDDL(), ";")
-	for _, request := range requests {
-		if request != "" {
-			_, err := bps.DB.ExecContext(ctx, request)
-			if err != nil {
-				return err
-			}
-		}
-	}
-
 	return nil
 }
 
 func (bps *BalancePGStorage) GetBalance(ctx context.Context, userID uuid.UUID) (*balance.Balance, error) {
 	getBalanceFromDB := `
-		SELECT current, withdrawn FROM content.balances WHERE user_id = $1;
+		SELECT current, withdrawn, debt FROM content.balances WHERE user_id = $1;
 	`
 	row := bps.DB.QueryRowContext(ctx, getBalanceFromDB, userID.String())
 
 	var userBalance balance.Balance
-	err := row.Scan(&userBalance.Current, &userBalance.Withdrawn)
+	err := row.Scan(&userBalance.Current, &userBalance.Withdrawn, &userBalance.Debt)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return &balance.Balance{}, nil
@@ -75,21 +52,78 @@ func (bps *BalancePGStorage) GetBalance(ctx context.Context, userID uuid.UUID) (
 	return &userBalance, nil
 }
 
-func (bps *BalancePGStorage) ReduceBalance(ctx context.Context, userID uuid.UUID, amount float64, tx *transaction.Trx) error {
+func (bps *BalancePGStorage) ReduceBalance(ctx context.Context, userID uuid.UUID, amount money.Money, tx *transaction.Trx) error {
+	// balance check and deduction are done by a single conditional update,
+	// so concurrent withdrawals can't drive current balance below zero
 	spendAmountQuery := `
 		UPDATE content.balances
 		SET
 			current = balances.current - $2,
 			withdrawn = balances.withdrawn + $2,
 			updated_at = CURRENT_TIMESTAMP
-		WHERE user_id = $1;
+		WHERE user_id = $1 AND balances.current >= $2;
 	`
 
-	_, err := tx.ExecContext(ctx, spendAmountQuery, userID, amount)
-	return err
+	result, err := tx.ExecContext(ctx, spendAmountQuery, userID, amount)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return exceptions.ErrNotEnoughBalance
+	}
+	return consumeLots(ctx, userID, amount, "", tx)
+}
+
+// consumeLots takes amount from lots of the user in order of expiration, lots of firstOrderID go first,
+// points without lots cover the rest. Lots are locked after the balance row, in the same order as ExpireLots does.
+func consumeLots(ctx context.Context, userID uuid.UUID, amount money.Money, firstOrderID string, tx *transaction.Trx) error {
+	getLotsQuery := `
+		SELECT id, remaining
+		FROM content.point_lots
+		WHERE user_id = $1 AND remaining > 0
+		ORDER BY order_id = $2 DESC, expires_at NULLS LAST, accrued_at, id
+		FOR UPDATE;
+	`
+	rows, err := tx.QueryContext(ctx, getLotsQuery, userID, firstOrderID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	taken := map[uuid.UUID]money.Money{}
+	for rows.Next() && amount > 0 {
+		var lotID uuid.UUID
+		var remaining money.Money
+		err = rows.Scan(&lotID, &remaining)
+		if err != nil {
+			return err
+		}
+		taken[lotID] = min(amount, remaining)
+		amount -= taken[lotID]
+	}
+	err = rows.Err()
+	if err != nil {
+		return err
+	}
+	rows.Close()
+
+	consumeLotQuery := `
+		UPDATE content.point_lots SET remaining = remaining - $2 WHERE id = $1;
+	`
+	for lotID, lotAmount := range taken {
+		_, err = tx.ExecContext(ctx, consumeLotQuery, lotID, lotAmount)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-func (bps *BalancePGStorage) AddBalance(ctx context.Context, userID uuid.UUID, amount float64, tx *transaction.Trx) error {
+func (bps *BalancePGStorage) AddBalance(ctx context.Context, userID uuid.UUID, amount money.Money, tx *transaction.Trx) error {
 	insertBalanceQuery := `
 		INSERT INTO content.balances (user_id, current)
 		VALUES ($1, $2)
@@ -104,6 +138,253 @@ func (bps *BalancePGStorage) AddBalance(ctx context.Context, userID uuid.UUID, a
 	return err
 }
 
+// ClawbackBalance takes amount back from current balance of the user, lots of the order go first.
+// The part exceeding current balance becomes debt if allowDebt is set, otherwise it is written off.
+// Returns the taken amount including the debt.
+func (bps *BalancePGStorage) ClawbackBalance(ctx context.Context, userID uuid.UUID, orderID string, amount money.Money, allowDebt bool, tx *transaction.Trx) (money.Money, error) {
+	current, _, err := lockBalance(ctx, userID, tx)
+	if err != nil {
+		return 0, err
+	}
+	fromCurrent := min(amount, current)
+	var debt money.Money
+	if allowDebt {
+		debt = amount - fromCurrent
+	}
+	if fromCurrent+debt == 0 {
+		return 0, nil
+	}
+
+	clawbackQuery := `
+		INSERT INTO content.balances (user_id, current, debt)
+		VALUES ($1, 0, $3)
+		ON CONFLICT (user_id)
+		DO UPDATE SET
+			current = balances.current - $2,
+			debt = balances.debt + $3,
+			updated_at = CURRENT_TIMESTAMP
+		;
+	`
+	_, err = tx.ExecContext(ctx, clawbackQuery, userID, fromCurrent, debt)
+	if err != nil {
+		return 0, err
+	}
+	err = consumeLots(ctx, userID, fromCurrent, orderID, tx)
+	if err != nil {
+		return 0, err
+	}
+	return fromCurrent + debt, nil
+}
+
+// lockBalance locks the balance row of the user until the end of transaction
+// and returns its current balance and debt, zeros if the user has no balance yet.
+func lockBalance(ctx context.Context, userID uuid.UUID, tx *transaction.Trx) (money.Money, money.Money, error) {
+	lockBalanceQuery := `
+		SELECT current, debt FROM content.balances WHERE user_id = $1 FOR UPDATE;
+	`
+	var current, debt money.Money
+	err := tx.QueryRowContext(ctx, lockBalanceQuery, userID).Scan(&current, &debt)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return 0, 0, err
+	}
+	return current, debt, nil
+}
+
+// repayDebt takes the debt of the lot user from the lot before it is added to current balance.
+func repayDebt(ctx context.Context, lot *balance.Lot, tx *transaction.Trx) error {
+	_, debt, err := lockBalance(ctx, lot.UserID, tx)
+	if err != nil || debt == 0 {
+		return err
+	}
+	repaid := min(debt, lot.Remaining)
+	repayDebtQuery := `
+		UPDATE content.balances
+		SET
+			debt = balances.debt - $2,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE user_id = $1;
+	`
+	_, err = tx.ExecContext(ctx, repayDebtQuery, lot.UserID, repaid)
+	if err != nil {
+		return err
+	}
+	lot.Remaining -= repaid
+	return nil
+}
+
+// AddLot adds the lot to current balance of its user, debt is repaid from the lot first.
+func (bps *BalancePGStorage) AddLot(ctx context.Context, lot *balance.Lot, tx *transaction.Trx) error {
+	err := repayDebt(ctx, lot, tx)
+	if err != nil {
+		return err
+	}
+	err = bps.AddBalance(ctx, lot.UserID, lot.Remaining, tx)
+	if err != nil {
+		return err
+	}
+	return insertLot(ctx, lot, tx)
+}
+
+// RefundBalance moves the lot from withdrawn back to current balance of its user, debt is repaid from the lot first.
+func (bps *BalancePGStorage) RefundBalance(ctx context.Context, lot *balance.Lot, tx *transaction.Trx) error {
+	refunded := lot.Remaining
+	err := repayDebt(ctx, lot, tx)
+	if err != nil {
+		return err
+	}
+
+	refundQuery := `
+		UPDATE content.balances
+		SET
+			current = balances.current + $2,
+			withdrawn = balances.withdrawn - $3,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE user_id = $1 AND balances.withdrawn >= $3;
+	`
+	result, err := tx.ExecContext(ctx, refundQuery, lot.UserID, lot.Remaining, refunded)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return exceptions.ErrNotEnoughBalance
+	}
+	return insertLot(ctx, lot, tx)
+}
+
+func insertLot(ctx context.Context, lot *balance.Lot, tx *transaction.Trx) error {
+	insertLotQuery := `
+		INSERT INTO content.point_lots (id, user_id, order_id, amount, remaining, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6);
+	`
+	_, err := tx.ExecContext(ctx, insertLotQuery, lot.ID, lot.UserID, lot.OrderID, lot.Amount, lot.Remaining, lot.ExpiresAt)
+	return err
+}
+
+// ExpireLots takes remaining points of lots expired by expiredAt from balances of up to limit users
+// and returns the lots with expired remaining amounts.
+func (bps *BalancePGStorage) ExpireLots(ctx context.Context, expiredAt time.Time, limit int, tx *transaction.Trx) ([]balance.Lot, error) {
+	getUsersQuery := `
+		SELECT DISTINCT user_id
+		FROM content.point_lots
+		WHERE remaining > 0 AND expires_at <= $1
+		ORDER BY user_id
+		LIMIT $2;
+	`
+	rows, err := tx.QueryContext(ctx, getUsersQuery, expiredAt, limit)
+	if err != nil {
+		return nil, err
+	}
+	userIDs := []uuid.UUID{}
+	for rows.Next() {
+		var userID uuid.UUID
+		err = rows.Scan(&userID)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		userIDs = append(userIDs, userID)
+	}
+	rows.Close()
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	expiredLots := []balance.Lot{}
+	for _, userID := range userIDs {
+		userExpiredLots, err := expireUserLots(ctx, userID, expiredAt, tx)
+		if err != nil {
+			return nil, err
+		}
+		expiredLots = append(expiredLots, userExpiredLots...)
+	}
+	return expiredLots, nil
+}
+
+// expireUserLots locks the balance row before the lots, so it can't deadlock with withdrawals.
+// Lots consumed by concurrent withdrawals are rechecked under the lock.
+func expireUserLots(ctx context.Context, userID uuid.UUID, expiredAt time.Time, tx *transaction.Trx) ([]balance.Lot, error) {
+	lockBalanceQuery := `
+		SELECT 1 FROM content.balances WHERE user_id = $1 FOR UPDATE;
+	`
+	_, err := tx.ExecContext(ctx, lockBalanceQuery, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	expireLotsQuery := `
+		UPDATE content.point_lots l
+		SET remaining = 0
+		FROM (
+			SELECT id, remaining
+			FROM content.point_lots
+			WHERE user_id = $1 AND remaining > 0 AND expires_at <= $2
+			FOR UPDATE
+		) prev
+		WHERE l.id = prev.id
+		RETURNING l.id, l.order_id, l.amount, prev.remaining, l.accrued_at, l.expires_at;
+	`
+	rows, err := tx.QueryContext(ctx, expireLotsQuery, userID, expiredAt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	expiredLots := []balance.Lot{}
+	var expiredSum money.Money
+	for rows.Next() {
+		lot := balance.Lot{UserID: userID}
+		err = rows.Scan(&lot.ID, &lot.OrderID, &lot.Amount, &lot.Remaining, &lot.AccruedAt, &lot.ExpiresAt)
+		if err != nil {
+			return nil, err
+		}
+		expiredLots = append(expiredLots, lot)
+		expiredSum += lot.Remaining
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+	rows.Close()
+	if expiredSum == 0 {
+		return expiredLots, nil
+	}
+
+	reduceBalanceQuery := `
+		UPDATE content.balances
+		SET
+			current = balances.current - $2,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE user_id = $1;
+	`
+	_, err = tx.ExecContext(ctx, reduceBalanceQuery, userID, expiredSum)
+	if err != nil {
+		return nil, err
+	}
+	return expiredLots, nil
+}
+
+// GetExpiringSum returns remaining points of user lots expiring by expiresBefore.
+func (bps *BalancePGStorage) GetExpiringSum(ctx context.Context, userID uuid.UUID, expiresBefore time.Time) (money.Money, error) {
+	getExpiringSumQuery := `
+		SELECT COALESCE(SUM(remaining), 0)
+		FROM content.point_lots
+		WHERE user_id = $1 AND remaining > 0 AND expires_at <= $2;
+	`
+	row := bps.DB.QueryRowContext(ctx, getExpiringSumQuery, userID, expiresBefore)
+
+	var expiring money.Money
+	err := row.Scan(&expiring)
+	if err != nil {
+		return 0, err
+	}
+	return expiring, nil
+}
+
 func (bps *BalancePGStorage) BeginTx(ctx context.Context) (*transaction.Trx, error) {
 	return transaction.BeginTx(ctx, bps.DB)
 }
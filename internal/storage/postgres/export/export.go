@@ -0,0 +1,69 @@
+package exportpgstorage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/google/uuid"
+
+	"github.com/ry461ch/loyalty_system/internal/helpers/stream"
+	"github.com/ry461ch/loyalty_system/internal/models/export"
+	"github.com/ry461ch/loyalty_system/internal/models/order"
+)
+
+type ExportPGStorage struct {
+	DB  *sql.DB
+	dsn string
+}
+
+func NewExportPGStorage(DBDsn string) *ExportPGStorage {
+	return &ExportPGStorage{
+		dsn: DBDsn,
+		DB:  nil,
+	}
+}
+
+func (eps *ExportPGStorage) Initialize(ctx context.Context, DB *sql.DB) error {
+	if DB == nil {
+		return errors.New("db wasn't initialized")
+	}
+	eps.DB = DB
+
+	return nil
+}
+
+// StreamEntries streams uploaded orders, accruals and withdrawals of the user made in [query.From, query.To)
+// in chronological order. The history is read by a single query, so the stream holds one connection
+// and sees one snapshot; order goes before its accrual if both happened at the same moment.
+func (eps *ExportPGStorage) StreamEntries(ctx context.Context, userID uuid.UUID, query export.Query) (stream.Rows[export.Entry], error) {
+	getEntriesFromDB := `
+		SELECT type, at, order_id, status, amount
+		FROM (
+			SELECT $4::TEXT AS type, created_at AS at, id AS order_id, status, NULL::NUMERIC(20, 2) AS amount, 0 AS priority, id AS entry_id
+			FROM content.orders
+			WHERE user_id = $1
+			UNION ALL
+			SELECT $5::TEXT, e.created_at, e.order_id, '', e.accrual, 1, e.id::TEXT
+			FROM content.order_events e
+			JOIN content.orders o ON o.id = e.order_id
+			WHERE o.user_id = $1 AND e.status = $7 AND e.accrual IS NOT NULL
+			UNION ALL
+			SELECT $6::TEXT, created_at, order_id, status, sum, 2, id::TEXT
+			FROM content.withdrawals
+			WHERE user_id = $1
+		) entries
+		WHERE ($2::TIMESTAMPTZ IS NULL OR at >= $2) AND ($3::TIMESTAMPTZ IS NULL OR at < $3)
+		ORDER BY at, priority, entry_id;
+	`
+	rows, err := eps.DB.QueryContext(ctx, getEntriesFromDB,
+		userID, query.From, query.To, export.ORDER, export.ACCRUAL, export.WITHDRAWAL, order.PROCESSED)
+	if err != nil {
+		return nil, err
+	}
+	return stream.FromSQL(rows, func(rows *sql.Rows) (export.Entry, error) {
+		var entry export.Entry
+		err := rows.Scan(&entry.Type, &entry.At, &entry.OrderID, &entry.Status, &entry.Amount)
+		return entry, err
+	}), nil
+}
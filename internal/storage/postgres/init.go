@@ -3,41 +3,47 @@ package pgstorage
 import (
 	"context"
 	"database/sql"
-	"strings"
 
 	"github.com/ry461ch/loyalty_system/internal/storage/postgres/balances"
+	"github.com/ry461ch/loyalty_system/internal/storage/postgres/export"
+	"github.com/ry461ch/loyalty_system/internal/storage/postgres/ledger"
+	"github.com/ry461ch/loyalty_system/internal/storage/postgres/loginattempts"
+	"github.com/ry461ch/loyalty_system/internal/storage/postgres/migrations"
 	"github.com/ry461ch/loyalty_system/internal/storage/postgres/orders"
+	"github.com/ry461ch/loyalty_system/internal/storage/postgres/sessions"
 	"github.com/ry461ch/loyalty_system/internal/storage/postgres/users"
 	"github.com/ry461ch/loyalty_system/internal/storage/postgres/withdrawals"
 )
 
 type PGStorage struct {
-	connectionsLimit  int
-	dsn               string
-	DB                *sql.DB
-	OrderStorage      *orderpgstorage.OrderPGStorage
-	WithdrawalStorage *withdrawalpgstorage.WithdrawalPGStorage
-	BalanceStorage    *balancepgstorage.BalancePGStorage
-	UserStorage       *userpgstorage.UserPGStorage
+	connectionsLimit    int
+	dsn                 string
+	DB                  *sql.DB
+	OrderStorage        *orderpgstorage.OrderPGStorage
+	WithdrawalStorage   *withdrawalpgstorage.WithdrawalPGStorage
+	BalanceStorage      *balancepgstorage.BalancePGStorage
+	LedgerStorage       *ledgerpgstorage.LedgerPGStorage
+	SessionStorage      *sessionpgstorage.SessionPGStorage
+	LoginAttemptStorage *loginattemptpgstorage.LoginAttemptPGStorage
+	UserStorage         *userpgstorage.UserPGStorage
+	ExportStorage       *exportpgstorage.ExportPGStorage
 }
 
 func NewPGStorage(DBDsn string, connectionsLimit int) *PGStorage {
 	return &PGStorage{
-		connectionsLimit:  connectionsLimit,
-		dsn:               DBDsn,
-		OrderStorage:      orderpgstorage.NewOrderPGStorage(DBDsn),
-		UserStorage:       userpgstorage.NewUserPGStorage(DBDsn),
-		BalanceStorage:    balancepgstorage.NewBalancePGStorage(DBDsn),
-		WithdrawalStorage: withdrawalpgstorage.NewWithdrawalPGStorage(DBDsn),
+		connectionsLimit:    connectionsLimit,
+		dsn:                 DBDsn,
+		OrderStorage:        orderpgstorage.NewOrderPGStorage(DBDsn),
+		LedgerStorage:       ledgerpgstorage.NewLedgerPGStorage(DBDsn),
+		UserStorage:         userpgstorage.NewUserPGStorage(DBDsn),
+		SessionStorage:      sessionpgstorage.NewSessionPGStorage(DBDsn),
+		LoginAttemptStorage: loginattemptpgstorage.NewLoginAttemptPGStorage(DBDsn),
+		BalanceStorage:      balancepgstorage.NewBalancePGStorage(DBDsn),
+		WithdrawalStorage:   withdrawalpgstorage.NewWithdrawalPGStorage(DBDsn),
+		ExportStorage:       exportpgstorage.NewExportPGStorage(DBDsn),
 	}
 }
 
-func getDDL() string {
-	return `
-		CREATE SCHEMA IF NOT EXISTS content;
-	`
-}
-
 func (ps *PGStorage) Init(ctx context.Context) error {
 	DB, err := sql.Open("pgx", ps.dsn)
 	if err != nil {
@@ -46,14 +52,13 @@ func (ps *PGStorage) Init(ctx context.Context) error {
 	DB.SetMaxIdleConns(ps.connectionsLimit)
 	DB.SetMaxOpenConns(ps.connectionsLimit)
 
-	requests := strings.Split(getDDL(), ";")
-	for _, request := range requests {
-		if request != "" {
-			_, err := DB.ExecContext(ctx, request)
-			if err != nil {
-				return err
-			}
-		}
+	migrator, err := pgmigrations.NewMigrator(DB)
+	if err != nil {
+		return err
+	}
+	_, err = migrator.Up(ctx)
+	if err != nil {
+		return err
 	}
 
 	err = ps.BalanceStorage.Initialize(ctx, DB)
@@ -76,6 +81,26 @@ func (ps *PGStorage) Init(ctx context.Context) error {
 		return err
 	}
 
+	err = ps.LedgerStorage.Initialize(ctx, DB)
+	if err != nil {
+		return err
+	}
+
+	err = ps.SessionStorage.Initialize(ctx, DB)
+	if err != nil {
+		return err
+	}
+
+	err = ps.LoginAttemptStorage.Initialize(ctx, DB)
+	if err != nil {
+		return err
+	}
+
+	err = ps.ExportStorage.Initialize(ctx, DB)
+	if err != nil {
+		return err
+	}
+
 	ps.DB = DB
 	return nil
 }
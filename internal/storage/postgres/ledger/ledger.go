@@ -0,0 +1,102 @@
+package ledgerpgstorage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/google/uuid"
+
+	"github.com/ry461ch/loyalty_system/internal/helpers/transaction"
+	"github.com/ry461ch/loyalty_system/internal/models/balance"
+	"github.com/ry461ch/loyalty_system/internal/models/ledger"
+)
+
+type LedgerPGStorage struct {
+	DB  *sql.DB
+	dsn string
+}
+
+func NewLedgerPGStorage(DBDsn string) *LedgerPGStorage {
+	return &LedgerPGStorage{
+		dsn: DBDsn,
+		DB:  nil,
+	}
+}
+
+func (lps *LedgerPGStorage) Initialize(ctx context.Context, DB *sql.DB) error {
+	if DB == nil {
+		return errors.New("db wasn't initialized")
+	}
+	lps.DB = DB
+
+	return nil
+}
+
+func (lps *LedgerPGStorage) InsertMovement(ctx context.Context, movement *ledger.Movement, tx *transaction.Trx) error {
+	insertEntryQuery := `
+		INSERT INTO content.ledger_entries (movement_id, user_id, account, amount, movement_type, order_id)
+		VALUES ($1, $2, $3, $4, $5, $6);
+	`
+
+	for _, entry := range movement.Entries() {
+		_, err := tx.ExecContext(ctx, insertEntryQuery, entry.MovementID, entry.UserID, entry.Account, entry.Amount, entry.Type, entry.OrderID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (lps *LedgerPGStorage) GetUserMovements(ctx context.Context, userID uuid.UUID) ([]ledger.Movement, error) {
+	getMovementsFromDB := `
+		SELECT movement_id, movement_type, order_id, amount, created_at
+		FROM content.ledger_entries
+		WHERE user_id = $1 AND account = 'CURRENT'
+		ORDER BY created_at DESC, id DESC;
+	`
+	rows, err := lps.DB.QueryContext(ctx, getMovementsFromDB, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	movements := []ledger.Movement{}
+	for rows.Next() {
+		movement := ledger.Movement{UserID: userID}
+		err = rows.Scan(&movement.ID, &movement.Type, &movement.OrderID, &movement.Amount, &movement.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		movements = append(movements, movement)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+	return movements, nil
+}
+
+func (lps *LedgerPGStorage) GetUserBalance(ctx context.Context, userID uuid.UUID) (*balance.Balance, error) {
+	getBalanceFromDB := `
+		SELECT
+			COALESCE(SUM(amount) FILTER (WHERE account = 'CURRENT'), 0),
+			COALESCE(SUM(amount) FILTER (WHERE account = 'WITHDRAWN'), 0)
+		FROM content.ledger_entries
+		WHERE user_id = $1;
+	`
+	row := lps.DB.QueryRowContext(ctx, getBalanceFromDB, userID)
+
+	var userBalance balance.Balance
+	err := row.Scan(&userBalance.Current, &userBalance.Withdrawn)
+	if err != nil {
+		return nil, err
+	}
+	return &userBalance, nil
+}
+
+func (lps *LedgerPGStorage) BeginTx(ctx context.Context) (*transaction.Trx, error) {
+	return transaction.BeginTx(ctx, lps.DB)
+}
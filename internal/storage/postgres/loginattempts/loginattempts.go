@@ -0,0 +1,124 @@
+package loginattemptpgstorage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/ry461ch/loyalty_system/internal/helpers/transaction"
+	"github.com/ry461ch/loyalty_system/internal/models/loginattempt"
+)
+
+type LoginAttemptPGStorage struct {
+	DB  *sql.DB
+	dsn string
+}
+
+func NewLoginAttemptPGStorage(DBDsn string) *LoginAttemptPGStorage {
+	return &LoginAttemptPGStorage{
+		dsn: DBDsn,
+		DB:  nil,
+	}
+}
+
+func (lps *LoginAttemptPGStorage) Initialize(ctx context.Context, DB *sql.DB) error {
+	if DB == nil {
+		return errors.New("db wasn't initialized")
+	}
+	lps.DB = DB
+
+	return nil
+}
+
+func (lps *LoginAttemptPGStorage) GetLoginAttempts(ctx context.Context, key string) (*loginattempt.Attempts, error) {
+	getLoginAttemptsFromDB := `
+		SELECT failures, last_failure_at FROM content.login_attempts WHERE key = $1;
+	`
+	row := lps.DB.QueryRowContext(ctx, getLoginAttemptsFromDB, key)
+
+	attempts := loginattempt.Attempts{Key: key}
+	err := row.Scan(&attempts.Failures, &attempts.LastFailureAt)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+	return &attempts, nil
+}
+
+// ReserveLoginAttempt returns false if the key is locked, the attempt isn't counted then.
+// The row is locked until the attempt is counted, so concurrent attempts can't pass the lock together.
+func (lps *LoginAttemptPGStorage) ReserveLoginAttempt(ctx context.Context, key string, limits loginattempt.Limits) (*loginattempt.Attempts, bool, error) {
+	tx, err := transaction.BeginTx(ctx, lps.DB)
+	if err != nil {
+		return nil, false, err
+	}
+	defer tx.Rollback()
+
+	insertLoginAttemptsQuery := `
+		INSERT INTO content.login_attempts (key, failures, last_failure_at)
+		VALUES ($1, 0, CURRENT_TIMESTAMP)
+		ON CONFLICT (key) DO NOTHING;
+	`
+	_, err = tx.ExecContext(ctx, insertLoginAttemptsQuery, key)
+	if err != nil {
+		return nil, false, err
+	}
+
+	getLoginAttemptsQuery := `
+		SELECT failures, last_failure_at FROM content.login_attempts WHERE key = $1 FOR UPDATE;
+	`
+	attempts := loginattempt.Attempts{Key: key}
+	err = tx.QueryRowContext(ctx, getLoginAttemptsQuery, key).Scan(&attempts.Failures, &attempts.LastFailureAt)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if !attempts.Reserve(limits, time.Now().UTC()) {
+		return &attempts, false, nil
+	}
+	updateLoginAttemptsQuery := `
+		UPDATE content.login_attempts SET failures = $2, last_failure_at = $3 WHERE key = $1;
+	`
+	_, err = tx.ExecContext(ctx, updateLoginAttemptsQuery, key, attempts.Failures, attempts.LastFailureAt)
+	if err != nil {
+		return nil, false, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return nil, false, err
+	}
+	return &attempts, true, nil
+}
+
+// ReleaseLoginAttempt uncounts the reserved attempt which turned out to be successful.
+func (lps *LoginAttemptPGStorage) ReleaseLoginAttempt(ctx context.Context, key string) error {
+	releaseLoginAttemptQuery := `
+		UPDATE content.login_attempts SET failures = failures - 1 WHERE key = $1 AND failures > 0;
+	`
+	_, err := lps.DB.ExecContext(ctx, releaseLoginAttemptQuery, key)
+	return err
+}
+
+// PruneLoginAttempts deletes attempts of keys which last failed before the given time.
+func (lps *LoginAttemptPGStorage) PruneLoginAttempts(ctx context.Context, lastFailureBefore time.Time) (int, error) {
+	pruneLoginAttemptsQuery := `
+		DELETE FROM content.login_attempts WHERE last_failure_at < $1;
+	`
+	res, err := lps.DB.ExecContext(ctx, pruneLoginAttemptsQuery, lastFailureBefore)
+	if err != nil {
+		return 0, err
+	}
+	pruned, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return int(pruned), nil
+}
+
+func (lps *LoginAttemptPGStorage) ResetLoginAttempts(ctx context.Context, key string) error {
+	resetLoginAttemptsQuery := `
+		DELETE FROM content.login_attempts WHERE key = $1;
+	`
+	_, err := lps.DB.ExecContext(ctx, resetLoginAttemptsQuery, key)
+	return err
+}
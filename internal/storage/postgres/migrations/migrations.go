@@ -0,0 +1,258 @@
+package pgmigrations
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+	"time"
+)
+
+//go:embed sql/*.sql
+var migrationFiles embed.FS
+
+// advisoryLockID is an arbitrary constant which guards migrations from concurrent gophermart instances.
+const advisoryLockID int64 = 4610001
+
+var fileNameRegexp = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+var ErrNoMigrationsToRevert = errors.New("no applied migrations to revert")
+
+type migration struct {
+	version int64
+	name    string
+	up      string
+	down    string
+}
+
+type Status struct {
+	Version   int64
+	Name      string
+	AppliedAt *time.Time
+}
+
+type Migrator struct {
+	DB         *sql.DB
+	migrations []migration
+}
+
+func NewMigrator(DB *sql.DB) (*Migrator, error) {
+	sqlFiles, err := fs.Sub(migrationFiles, "sql")
+	if err != nil {
+		return nil, err
+	}
+	loadedMigrations, err := load(sqlFiles)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{
+		DB:         DB,
+		migrations: loadedMigrations,
+	}, nil
+}
+
+func load(fsys fs.FS) ([]migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	migrationsByVersion := map[int64]*migration{}
+	for _, entry := range entries {
+		matches := fileNameRegexp.FindStringSubmatch(entry.Name())
+		if matches == nil {
+			return nil, fmt.Errorf("bad migration file name: %s", entry.Name())
+		}
+		version, err := strconv.ParseInt(matches[1], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		content, err := fs.ReadFile(fsys, path.Join(".", entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := migrationsByVersion[version]
+		if !ok {
+			m = &migration{version: version, name: matches[2]}
+			migrationsByVersion[version] = m
+		}
+		if m.name != matches[2] {
+			return nil, fmt.Errorf("migration %d has different names: %s and %s", version, m.name, matches[2])
+		}
+		if matches[3] == "up" {
+			m.up = string(content)
+		} else {
+			m.down = string(content)
+		}
+	}
+
+	loadedMigrations := make([]migration, 0, len(migrationsByVersion))
+	for _, m := range migrationsByVersion {
+		if m.up == "" || m.down == "" {
+			return nil, fmt.Errorf("migration %d_%s must have both up and down files", m.version, m.name)
+		}
+		loadedMigrations = append(loadedMigrations, *m)
+	}
+	slices.SortFunc(loadedMigrations, func(left, right migration) int {
+		return int(left.version - right.version)
+	})
+	for idx, m := range loadedMigrations {
+		if m.version != int64(idx+1) {
+			return nil, fmt.Errorf("migration versions must be contiguous starting from 1, got %d at position %d", m.version, idx+1)
+		}
+	}
+	return loadedMigrations, nil
+}
+
+// Up applies all pending migrations and returns the number of applied ones.
+func (m *Migrator) Up(ctx context.Context) (int, error) {
+	applied := 0
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		appliedVersions, err := getAppliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, migration := range m.migrations {
+			if _, ok := appliedVersions[migration.version]; ok {
+				continue
+			}
+			err = apply(ctx, conn, migration.up, `
+				INSERT INTO schema_migrations (version, name) VALUES ($1, $2);
+			`, migration.version, migration.name)
+			if err != nil {
+				return fmt.Errorf("migration %d_%s: %w", migration.version, migration.name, err)
+			}
+			applied++
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// Down reverts the last applied migration.
+func (m *Migrator) Down(ctx context.Context) (*Status, error) {
+	var reverted *Status
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		appliedVersions, err := getAppliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for idx := len(m.migrations) - 1; idx >= 0; idx-- {
+			migration := m.migrations[idx]
+			if _, ok := appliedVersions[migration.version]; !ok {
+				continue
+			}
+			err = apply(ctx, conn, migration.down, `
+				DELETE FROM schema_migrations WHERE version = $1;
+			`, migration.version)
+			if err != nil {
+				return fmt.Errorf("migration %d_%s: %w", migration.version, migration.name, err)
+			}
+			reverted = &Status{Version: migration.version, Name: migration.name}
+			return nil
+		}
+		return ErrNoMigrationsToRevert
+	})
+	return reverted, err
+}
+
+// Status returns all known migrations, AppliedAt is nil for pending ones.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	var statuses []Status
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		appliedVersions, err := getAppliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, migration := range m.migrations {
+			status := Status{Version: migration.version, Name: migration.name}
+			if appliedAt, ok := appliedVersions[migration.version]; ok {
+				status.AppliedAt = &appliedAt
+			}
+			statuses = append(statuses, status)
+		}
+		return nil
+	})
+	return statuses, err
+}
+
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	// advisory locks are bound to the session, so all work is done on a single connection
+	conn, err := m.DB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = conn.ExecContext(ctx, "SELECT pg_advisory_lock($1);", advisoryLockID)
+	if err != nil {
+		return err
+	}
+	defer conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1);", advisoryLockID)
+
+	_, err = conn.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version BIGINT PRIMARY KEY,
+			name VARCHAR(255) NOT NULL,
+			applied_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+		);
+	`)
+	if err != nil {
+		return err
+	}
+
+	return fn(conn)
+}
+
+func getAppliedVersions(ctx context.Context, conn *sql.Conn) (map[int64]time.Time, error) {
+	rows, err := conn.QueryContext(ctx, "SELECT version, applied_at FROM schema_migrations;")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	appliedVersions := map[int64]time.Time{}
+	for rows.Next() {
+		var version int64
+		var appliedAt time.Time
+		err = rows.Scan(&version, &appliedAt)
+		if err != nil {
+			return nil, err
+		}
+		appliedVersions[version] = appliedAt
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+	return appliedVersions, nil
+}
+
+func apply(ctx context.Context, conn *sql.Conn, migrationSQL string, bookkeepingQuery string, args ...any) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, migrationSQL)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, bookkeepingQuery, args...)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
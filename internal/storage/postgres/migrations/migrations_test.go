@@ -0,0 +1,86 @@
+package pgmigrations
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEmbeddedMigrations(t *testing.T) {
+	migrator, err := NewMigrator(nil)
+	assert.Nil(t, err, "embedded migrations are invalid")
+	assert.NotEmpty(t, migrator.migrations, "no embedded migrations")
+	for _, m := range migrator.migrations {
+		assert.NotEmpty(t, m.up, "empty up migration")
+		assert.NotEmpty(t, m.down, "empty down migration")
+	}
+}
+
+func TestLoad(t *testing.T) {
+	testCases := []struct {
+		testName         string
+		files            fstest.MapFS
+		expectedVersions []int64
+		expectedErr      bool
+	}{
+		{
+			testName: "valid migrations",
+			files: fstest.MapFS{
+				"0002_second.up.sql":   {Data: []byte("SELECT 2;")},
+				"0002_second.down.sql": {Data: []byte("SELECT 2;")},
+				"0001_first.up.sql":    {Data: []byte("SELECT 1;")},
+				"0001_first.down.sql":  {Data: []byte("SELECT 1;")},
+			},
+			expectedVersions: []int64{1, 2},
+		},
+		{
+			testName: "missing down migration",
+			files: fstest.MapFS{
+				"0001_first.up.sql": {Data: []byte("SELECT 1;")},
+			},
+			expectedErr: true,
+		},
+		{
+			testName: "gap in versions",
+			files: fstest.MapFS{
+				"0001_first.up.sql":   {Data: []byte("SELECT 1;")},
+				"0001_first.down.sql": {Data: []byte("SELECT 1;")},
+				"0003_third.up.sql":   {Data: []byte("SELECT 3;")},
+				"0003_third.down.sql": {Data: []byte("SELECT 3;")},
+			},
+			expectedErr: true,
+		},
+		{
+			testName: "different names",
+			files: fstest.MapFS{
+				"0001_first.up.sql":     {Data: []byte("SELECT 1;")},
+				"0001_another.down.sql": {Data: []byte("SELECT 1;")},
+			},
+			expectedErr: true,
+		},
+		{
+			testName: "bad file name",
+			files: fstest.MapFS{
+				"first.sql": {Data: []byte("SELECT 1;")},
+			},
+			expectedErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			loadedMigrations, err := load(tc.files)
+			if tc.expectedErr {
+				assert.NotNil(t, err, "expected error")
+				return
+			}
+			assert.Nil(t, err, "not expected error")
+			versions := []int64{}
+			for _, m := range loadedMigrations {
+				versions = append(versions, m.version)
+			}
+			assert.Equal(t, tc.expectedVersions, versions, "versions don't match")
+		})
+	}
+}
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS content.withdrawals;
+DROP TABLE IF EXISTS content.balances;
+DROP TABLE IF EXISTS content.orders;
+DROP TABLE IF EXISTS content.users;
@@ -0,0 +1,49 @@
+CREATE SCHEMA IF NOT EXISTS content;
+
+CREATE TABLE IF NOT EXISTS content.users (
+	id UUID PRIMARY KEY,
+	login VARCHAR(255) NOT NULL,
+	password_hash bytea NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS users_login_idx ON content.users(login);
+CREATE INDEX IF NOT EXISTS users_created_at_idx ON content.users(created_at);
+CREATE INDEX IF NOT EXISTS users_updated_at_idx ON content.users(updated_at);
+
+CREATE TABLE IF NOT EXISTS content.orders (
+	id VARCHAR(255) PRIMARY KEY,
+	status VARCHAR(255) NOT NULL default 'NEW',
+	accrual	DOUBLE PRECISION,
+	user_id UUID NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS orders_user_id_idx ON content.orders(user_id);
+CREATE INDEX IF NOT EXISTS orders_created_at_idx ON content.orders(created_at);
+CREATE INDEX IF NOT EXISTS orders_updated_at_idx ON content.orders(updated_at);
+
+CREATE TABLE IF NOT EXISTS content.balances (
+	user_id UUID PRIMARY KEY,
+	current	DOUBLE PRECISION NOT NULL DEFAULT 0,
+	withdrawn DOUBLE PRECISION NOT NULL DEFAULT 0,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS balances_created_at_idx ON content.balances(created_at);
+CREATE INDEX IF NOT EXISTS balances_updated_at_idx ON content.balances(updated_at);
+
+CREATE TABLE IF NOT EXISTS content.withdrawals (
+	id UUID PRIMARY KEY,
+	order_id VARCHAR(255) NOT NULL,
+	user_id UUID NOT NULL,
+	sum	DOUBLE PRECISION NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS withdrawals_order_id_idx ON content.withdrawals(order_id);
+CREATE INDEX IF NOT EXISTS withdrawals_user_id_idx ON content.withdrawals(user_id);
+CREATE INDEX IF NOT EXISTS withdrawals_created_at_idx ON content.withdrawals(created_at);
@@ -0,0 +1,7 @@
+ALTER TABLE content.orders ALTER COLUMN accrual TYPE DOUBLE PRECISION;
+
+ALTER TABLE content.balances
+	ALTER COLUMN current TYPE DOUBLE PRECISION,
+	ALTER COLUMN withdrawn TYPE DOUBLE PRECISION;
+
+ALTER TABLE content.withdrawals ALTER COLUMN sum TYPE DOUBLE PRECISION;
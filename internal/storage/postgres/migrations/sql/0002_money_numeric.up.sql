@@ -0,0 +1,7 @@
+ALTER TABLE content.orders ALTER COLUMN accrual TYPE NUMERIC(20, 2);
+
+ALTER TABLE content.balances
+	ALTER COLUMN current TYPE NUMERIC(20, 2),
+	ALTER COLUMN withdrawn TYPE NUMERIC(20, 2);
+
+ALTER TABLE content.withdrawals ALTER COLUMN sum TYPE NUMERIC(20, 2);
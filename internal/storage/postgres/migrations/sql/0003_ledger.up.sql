@@ -0,0 +1,29 @@
+CREATE TABLE IF NOT EXISTS content.ledger_entries (
+	id BIGSERIAL PRIMARY KEY,
+	movement_id UUID NOT NULL,
+	user_id UUID,
+	account VARCHAR(32) NOT NULL,
+	amount NUMERIC(20, 2) NOT NULL,
+	movement_type VARCHAR(32) NOT NULL,
+	order_id VARCHAR(255) NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS ledger_entries_movement_id_idx ON content.ledger_entries(movement_id);
+CREATE INDEX IF NOT EXISTS ledger_entries_user_id_account_idx ON content.ledger_entries(user_id, account, created_at);
+
+-- backfill history from existing withdrawals and processed orders
+INSERT INTO content.ledger_entries (movement_id, user_id, account, amount, movement_type, order_id, created_at)
+SELECT w.id, w.user_id, e.account, e.sign * w.sum, 'WITHDRAWAL', w.order_id, w.created_at
+FROM content.withdrawals w
+CROSS JOIN (VALUES ('CURRENT', -1), ('WITHDRAWN', 1)) AS e(account, sign);
+
+WITH accruals AS (
+	SELECT gen_random_uuid() AS movement_id, id, user_id, accrual, updated_at
+	FROM content.orders
+	WHERE status = 'PROCESSED' AND accrual > 0
+)
+INSERT INTO content.ledger_entries (movement_id, user_id, account, amount, movement_type, order_id, created_at)
+SELECT a.movement_id, CASE WHEN e.account = 'CURRENT' THEN a.user_id END, e.account, e.sign * a.accrual, 'ACCRUAL', a.id, a.updated_at
+FROM accruals a
+CROSS JOIN (VALUES ('CURRENT', 1), ('ACCRUALS', -1)) AS e(account, sign);
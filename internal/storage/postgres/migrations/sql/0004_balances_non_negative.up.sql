@@ -0,0 +1,4 @@
+-- NOT VALID skips rows which could have gone negative before withdrawals were made atomic,
+-- the constraint is still enforced for all new writes
+ALTER TABLE content.balances
+	ADD CONSTRAINT balances_current_non_negative CHECK (current >= 0) NOT VALID;
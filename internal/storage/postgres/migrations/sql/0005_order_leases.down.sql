@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS content.orders_waiting_created_at_idx;
+
+ALTER TABLE content.orders DROP COLUMN locked_until;
+ALTER TABLE content.orders DROP COLUMN locked_by;
@@ -0,0 +1,6 @@
+-- order getters of different instances lease waiting orders to avoid polling accrual service twice
+ALTER TABLE content.orders ADD COLUMN locked_by VARCHAR(255);
+ALTER TABLE content.orders ADD COLUMN locked_until TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS orders_waiting_created_at_idx ON content.orders(created_at)
+	WHERE status = 'NEW' OR status = 'PROCESSING';
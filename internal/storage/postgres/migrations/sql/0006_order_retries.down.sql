@@ -0,0 +1,4 @@
+ALTER TABLE content.orders DROP COLUMN reason;
+ALTER TABLE content.orders DROP COLUMN next_check_at;
+ALTER TABLE content.orders DROP COLUMN last_checked_at;
+ALTER TABLE content.orders DROP COLUMN attempts;
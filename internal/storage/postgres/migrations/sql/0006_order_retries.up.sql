@@ -0,0 +1,6 @@
+-- polling schedule of waiting orders, see retry.Policy
+ALTER TABLE content.orders ADD COLUMN attempts INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE content.orders ADD COLUMN last_checked_at TIMESTAMPTZ;
+ALTER TABLE content.orders ADD COLUMN next_check_at TIMESTAMPTZ;
+-- why order was moved to a final status without accrual system answer
+ALTER TABLE content.orders ADD COLUMN reason TEXT;
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS content.sessions (
+	id UUID PRIMARY KEY,
+	user_id UUID NOT NULL,
+	login VARCHAR(255) NOT NULL,
+	-- sha256 of the current refresh token, replaced on every refresh
+	refresh_token_hash bytea NOT NULL,
+	expires_at TIMESTAMPTZ NOT NULL,
+	revoked_at TIMESTAMPTZ,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS sessions_user_id_active_idx ON content.sessions(user_id) WHERE revoked_at IS NULL;
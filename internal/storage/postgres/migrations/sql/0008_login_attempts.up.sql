@@ -0,0 +1,8 @@
+-- consecutive failed logins per login or client address, see loginattempt.Limits
+CREATE TABLE IF NOT EXISTS content.login_attempts (
+	key VARCHAR(512) PRIMARY KEY,
+	failures INTEGER NOT NULL,
+	last_failure_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS login_attempts_last_failure_at_idx ON content.login_attempts(last_failure_at);
@@ -0,0 +1 @@
+ALTER TABLE content.users DROP COLUMN deleted_at;
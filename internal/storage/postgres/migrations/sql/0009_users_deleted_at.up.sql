@@ -0,0 +1,2 @@
+-- deleted users are anonymized, not removed, their orders and withdrawals stay accounted
+ALTER TABLE content.users ADD COLUMN deleted_at TIMESTAMPTZ;
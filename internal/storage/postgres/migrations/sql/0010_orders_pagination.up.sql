@@ -0,0 +1,2 @@
+-- keyset pagination of user orders, see pagination.Cursor
+CREATE INDEX IF NOT EXISTS orders_user_id_created_at_id_idx ON content.orders(user_id, created_at DESC, id DESC);
@@ -0,0 +1,2 @@
+-- keyset pagination of user withdrawals, see pagination.Cursor
+CREATE INDEX IF NOT EXISTS withdrawals_user_id_created_at_id_idx ON content.withdrawals(user_id, created_at DESC, id DESC);
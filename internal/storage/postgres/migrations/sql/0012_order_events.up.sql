@@ -0,0 +1,22 @@
+CREATE TABLE IF NOT EXISTS content.order_events (
+	id BIGSERIAL PRIMARY KEY,
+	order_id VARCHAR(255) NOT NULL,
+	status VARCHAR(255) NOT NULL,
+	accrual NUMERIC(20, 2),
+	reason TEXT,
+	-- accrual polls made in the previous status
+	attempts INTEGER NOT NULL DEFAULT 0,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS order_events_order_id_idx ON content.order_events(order_id, created_at);
+
+-- backfill history from existing orders, intermediate statuses are unknown
+INSERT INTO content.order_events (order_id, status, created_at)
+SELECT id, 'NEW', created_at
+FROM content.orders;
+
+INSERT INTO content.order_events (order_id, status, accrual, reason, created_at)
+SELECT id, status, accrual, reason, updated_at
+FROM content.orders
+WHERE status <> 'NEW';
@@ -0,0 +1,13 @@
+-- points accrued before lots existed have no lot and never expire
+CREATE TABLE IF NOT EXISTS content.point_lots (
+	id UUID PRIMARY KEY,
+	user_id UUID NOT NULL,
+	order_id VARCHAR(255) NOT NULL,
+	amount NUMERIC(20, 2) NOT NULL,
+	remaining NUMERIC(20, 2) NOT NULL CHECK (remaining >= 0),
+	accrued_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	expires_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS point_lots_user_id_idx ON content.point_lots(user_id, expires_at, accrued_at) WHERE remaining > 0;
+CREATE INDEX IF NOT EXISTS point_lots_expires_at_idx ON content.point_lots(expires_at) WHERE remaining > 0;
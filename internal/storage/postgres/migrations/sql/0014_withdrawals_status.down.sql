@@ -0,0 +1,3 @@
+ALTER TABLE content.withdrawals
+	DROP COLUMN IF EXISTS refunded_at,
+	DROP COLUMN IF EXISTS status;
@@ -0,0 +1,3 @@
+ALTER TABLE content.withdrawals
+	ADD COLUMN IF NOT EXISTS status VARCHAR(32) NOT NULL DEFAULT 'COMPLETED',
+	ADD COLUMN IF NOT EXISTS refunded_at TIMESTAMPTZ;
@@ -0,0 +1 @@
+ALTER TABLE content.balances DROP COLUMN IF EXISTS debt;
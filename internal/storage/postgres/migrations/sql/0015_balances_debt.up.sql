@@ -0,0 +1,3 @@
+-- spent part of taken back accruals, current stays non-negative while the debt is repaid
+ALTER TABLE content.balances
+	ADD COLUMN IF NOT EXISTS debt NUMERIC(20, 2) NOT NULL DEFAULT 0 CONSTRAINT balances_debt_non_negative CHECK (debt >= 0);
@@ -4,38 +4,28 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
+	"slices"
 	"strings"
 	"time"
 
 	"github.com/google/uuid"
 
+	"github.com/ry461ch/loyalty_system/internal/helpers/pagination"
+	"github.com/ry461ch/loyalty_system/internal/helpers/retry"
 	"github.com/ry461ch/loyalty_system/internal/helpers/transaction"
 	"github.com/ry461ch/loyalty_system/internal/models/exceptions"
 	"github.com/ry461ch/loyalty_system/internal/models/order"
 )
 
+// bulkChunkSize keeps bulk statements far below the limit of 65535 bind parameters.
+const bulkChunkSize = 1000
+
 type OrderPGStorage struct {
 	DB  *sql.DB
 	dsn string
 }
 
-func getDDL() string {
-	return `
-		CREATE TABLE IF NOT EXISTS content.orders (
-			id VARCHAR(255) PRIMARY KEY,
-			status VARCHAR(255) NOT NULL default 'NEW',
-			accrual	DOUBLE PRECISION,
-			user_id UUID NOT NULL,
-			created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
-			updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
-		);
-
-		CREATE INDEX IF NOT EXISTS orders_user_id_idx ON content.orders(user_id);
-		CREATE INDEX IF NOT EXISTS orders_created_at_idx ON content.orders(created_at);
-		CREATE INDEX IF NOT EXISTS orders_updated_at_idx ON content.orders(updated_at);
-	`
-}
-
 func NewOrderPGStorage(DBDsn string) *OrderPGStorage {
 	return &OrderPGStorage{
 		dsn: DBDsn,
@@ -49,16 +39,6 @@ func (ops *OrderPGStorage) Initialize(ctx context.Context, DB *sql.DB) error {
 	}
 	ops.DB = DB
 
-	requests := strings.Split(getDDL(), ";")
-	for _, request := range requests {
-		if request != "" {
-			_, err := ops.DB.ExecContext(ctx, request)
-			if err != nil {
-				return err
-			}
-		}
-	}
-
 	return nil
 }
 
@@ -87,43 +67,191 @@ func (ops *OrderPGStorage) InsertOrder(ctx context.Context, userID uuid.UUID, or
 	return err
 }
 
-func (ops *OrderPGStorage) UpdateOrder(ctx context.Context, order *order.Order, tx *transaction.Trx) (*uuid.UUID, error) {
+// InsertOrders inserts orders which don't exist yet and returns ids of inserted ones,
+// orders inserted concurrently by other transactions are skipped instead of failing the batch.
+func (ops *OrderPGStorage) InsertOrders(ctx context.Context, userID uuid.UUID, orderIDs []string, tx *transaction.Trx) ([]string, error) {
+	insertedIDs := []string{}
+	for start := 0; start < len(orderIDs); start += bulkChunkSize {
+		chunk := orderIDs[start:min(start+bulkChunkSize, len(orderIDs))]
+		insertOrdersQuery := `
+			INSERT INTO content.orders (id, user_id)
+			VALUES `
+		args := []any{userID}
+		for idx, orderID := range chunk {
+			if idx > 0 {
+				insertOrdersQuery += ", "
+			}
+			args = append(args, orderID)
+			insertOrdersQuery += fmt.Sprintf("($%d, $1)", len(args))
+		}
+		insertOrdersQuery += " ON CONFLICT (id) DO NOTHING RETURNING id;"
+
+		rows, err := tx.QueryContext(ctx, insertOrdersQuery, args...)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var insertedID string
+			err = rows.Scan(&insertedID)
+			if err != nil {
+				rows.Close()
+				return nil, err
+			}
+			insertedIDs = append(insertedIDs, insertedID)
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return insertedIDs, nil
+}
+
+// UpdateOrder returns owner of the order and the order as it was before the update.
+func (ops *OrderPGStorage) UpdateOrder(ctx context.Context, inputOrder *order.Order, tx *transaction.Trx) (*uuid.UUID, *order.Order, error) {
+	// the row is locked until the end of transaction, so concurrent updaters
+	// see the status written by each other and can't repeat the same transition
+	getOrderForUpdateQuery := `
+		SELECT user_id, status, accrual, attempts FROM content.orders WHERE id = $1 FOR UPDATE;
+	`
+	row := tx.QueryRowContext(ctx, getOrderForUpdateQuery, inputOrder.ID)
+	var userID uuid.UUID
+	orderInDB := order.Order{ID: inputOrder.ID}
+	err := row.Scan(&userID, &orderInDB.Status, &orderInDB.Accrual, &orderInDB.Attempts)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil, exceptions.ErrOrderNotFound
+		}
+		return nil, nil, err
+	}
+	if !orderInDB.Status.CanTransitionTo(inputOrder.Status) {
+		return nil, nil, exceptions.ErrOrderBadStatusTransition
+	}
+
+	// polling schedule is reset on progress, expressions in SET see the previous status,
+	// returned order keeps the accrual it was credited
 	updateOrderQuery := `
 		UPDATE content.orders
 		SET
 			status = $2,
-			accrual = $3,
+			accrual = COALESCE($3, accrual),
+			reason = NULLIF($4, ''),
+			attempts = CASE WHEN status = $2 THEN attempts ELSE 0 END,
+			next_check_at = CASE WHEN status = $2 THEN next_check_at ELSE NULL END,
 			updated_at = CURRENT_TIMESTAMP
-		WHERE id = $1
-		RETURNING user_id;
+		WHERE id = $1;
 	`
-	var accrual sql.NullFloat64
-	if order.Accrual != nil {
-		accrual = sql.NullFloat64{
-			Float64: *order.Accrual,
-			Valid:   true,
+	_, err = tx.ExecContext(ctx, updateOrderQuery, inputOrder.ID, inputOrder.Status, inputOrder.Accrual, inputOrder.Reason)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &userID, &orderInDB, nil
+}
+
+func (ops *OrderPGStorage) InsertOrderEvents(ctx context.Context, events []order.Event, tx *transaction.Trx) error {
+	for start := 0; start < len(events); start += bulkChunkSize {
+		chunk := events[start:min(start+bulkChunkSize, len(events))]
+		insertOrderEventsQuery := `
+			INSERT INTO content.order_events (order_id, status, accrual, reason, attempts)
+			VALUES `
+		args := make([]any, 0, 5*len(chunk))
+		for idx, event := range chunk {
+			if idx > 0 {
+				insertOrderEventsQuery += ", "
+			}
+			insertOrderEventsQuery += fmt.Sprintf("($%d, $%d, $%d, NULLIF($%d, ''), $%d)", len(args)+1, len(args)+2, len(args)+3, len(args)+4, len(args)+5)
+			args = append(args, event.OrderID, event.Status, event.Accrual, event.Reason, event.Attempts)
+		}
+
+		_, err := tx.ExecContext(ctx, insertOrderEventsQuery, args...)
+		if err != nil {
+			return err
 		}
 	}
+	return nil
+}
 
-	row := tx.QueryRowContext(ctx, updateOrderQuery, order.ID, order.Status, accrual)
-	var userID uuid.UUID
-	err := row.Scan(&userID)
+// GetUserOrder returns the order only to its owner, orders of other users aren't found.
+func (ops *OrderPGStorage) GetUserOrder(ctx context.Context, userID uuid.UUID, orderID string) (*order.Order, error) {
+	getOrderFromDB := `
+		SELECT id, status, accrual, COALESCE(reason, ''), created_at, attempts
+		FROM content.orders
+		WHERE id = $1 AND user_id = $2;
+	`
+	row := ops.DB.QueryRowContext(ctx, getOrderFromDB, orderID, userID)
+
+	var orderInDB order.Order
+	err := row.Scan(&orderInDB.ID, &orderInDB.Status, &orderInDB.Accrual, &orderInDB.Reason, &orderInDB.CreatedAt, &orderInDB.Attempts)
 	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, exceptions.ErrOrderNotFound
+		}
 		return nil, err
 	}
+	return &orderInDB, nil
+}
 
-	return &userID, nil
+// GetOrderEvents returns status history of the order in chronological order.
+func (ops *OrderPGStorage) GetOrderEvents(ctx context.Context, orderID string) ([]order.Event, error) {
+	getOrderEventsFromDB := `
+		SELECT order_id, status, accrual, COALESCE(reason, ''), attempts, created_at
+		FROM content.order_events
+		WHERE order_id = $1
+		ORDER BY created_at, id;
+	`
+
+	rows, err := ops.DB.QueryContext(ctx, getOrderEventsFromDB, orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []order.Event{}
+	for rows.Next() {
+		var event order.Event
+		err = rows.Scan(&event.OrderID, &event.Status, &event.Accrual, &event.Reason, &event.Attempts, &event.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		events = append(events, event)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+	return events, nil
 }
 
-func (ops *OrderPGStorage) GetWaitingOrders(ctx context.Context, limit int, inputCreatedAt *time.Time) ([]order.Order, error) {
-	getOrdersFromDB := `
-		SELECT id, status, accrual, created_at
-		FROM content.orders
-		WHERE 
-			(status = 'NEW' OR status = 'PROCESSING') AND
-			($2::TIMESTAMPTZ IS NULL OR created_at < $2::TIMESTAMPTZ)
-		ORDER BY created_at DESC
-		LIMIT $1;
+func (ops *OrderPGStorage) ClaimWaitingOrders(ctx context.Context, lease order.Lease, backoff retry.Policy, limit int, inputCreatedAt *time.Time) ([]order.Order, error) {
+	// SKIP LOCKED lets concurrent instances claim disjoint batches without waiting for each other,
+	// orders leased by other instances are skipped until their lease expires.
+	// Every claim is a check attempt, next_check_at is computed the same way as retry.Policy.Delay,
+	// LEAST ignores NULL, so there is no cap without max delay
+	claimOrdersQuery := `
+		UPDATE content.orders
+		SET
+			locked_by = $3,
+			locked_until = CURRENT_TIMESTAMP + $4::BIGINT * INTERVAL '1 millisecond',
+			attempts = attempts + 1,
+			last_checked_at = CURRENT_TIMESTAMP,
+			next_check_at = CURRENT_TIMESTAMP + LEAST($5::BIGINT * POWER(2, LEAST(attempts, 40)), $6::BIGINT) * INTERVAL '1 millisecond'
+		WHERE id IN (
+			SELECT id
+			FROM content.orders
+			WHERE
+				(status = 'NEW' OR status = 'PROCESSING') AND
+				($2::TIMESTAMPTZ IS NULL OR created_at < $2::TIMESTAMPTZ) AND
+				(locked_until IS NULL OR locked_until < CURRENT_TIMESTAMP OR locked_by = $3) AND
+				(next_check_at IS NULL OR next_check_at <= CURRENT_TIMESTAMP)
+			ORDER BY created_at DESC
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, status, accrual, created_at, attempts, last_checked_at, next_check_at;
 	`
 
 	var createdAt sql.NullTime
@@ -131,8 +259,22 @@ func (ops *OrderPGStorage) GetWaitingOrders(ctx context.Context, limit int, inpu
 		createdAt.Valid = true
 		createdAt.Time = *inputCreatedAt
 	}
+	var maxDelay sql.NullInt64
+	if backoff.MaxDelay > 0 {
+		maxDelay.Valid = true
+		maxDelay.Int64 = backoff.MaxDelay.Milliseconds()
+	}
 
-	rows, err := ops.DB.QueryContext(ctx, getOrdersFromDB, limit, createdAt)
+	rows, err := ops.DB.QueryContext(
+		ctx,
+		claimOrdersQuery,
+		limit,
+		createdAt,
+		lease.Owner,
+		lease.TTL.Milliseconds(),
+		backoff.BaseDelay.Milliseconds(),
+		maxDelay,
+	)
 	if err != nil {
 		return nil, err
 	}
@@ -141,17 +283,19 @@ func (ops *OrderPGStorage) GetWaitingOrders(ctx context.Context, limit int, inpu
 	waitingOrders := []order.Order{}
 	for rows.Next() {
 		var waitingOrder order.Order
-		var accrual sql.NullFloat64
-
-		err = rows.Scan(&waitingOrder.ID, &waitingOrder.Status, &accrual, &waitingOrder.CreatedAt)
+		err = rows.Scan(
+			&waitingOrder.ID,
+			&waitingOrder.Status,
+			&waitingOrder.Accrual,
+			&waitingOrder.CreatedAt,
+			&waitingOrder.Attempts,
+			&waitingOrder.LastCheckedAt,
+			&waitingOrder.NextCheckAt,
+		)
 		if err != nil {
 			return nil, err
 		}
 
-		if accrual.Valid {
-			waitingOrder.Accrual = &accrual.Float64
-		}
-
 		waitingOrders = append(waitingOrders, waitingOrder)
 	}
 
@@ -159,34 +303,144 @@ func (ops *OrderPGStorage) GetWaitingOrders(ctx context.Context, limit int, inpu
 	if err != nil {
 		return nil, err
 	}
+
+	// RETURNING doesn't keep the order of subquery
+	slices.SortFunc(waitingOrders, func(left, right order.Order) int {
+		return right.CreatedAt.Compare(left.CreatedAt)
+	})
 	return waitingOrders, nil
 }
 
+// ReleaseOrders drops leases of the owner from orders claimed but never checked,
+// the claim is not counted as an attempt and orders can be claimed again right away.
+func (ops *OrderPGStorage) ReleaseOrders(ctx context.Context, lease order.Lease, orderIDs []string) (int, error) {
+	released := 0
+	for start := 0; start < len(orderIDs); start += bulkChunkSize {
+		chunk := orderIDs[start:min(start+bulkChunkSize, len(orderIDs))]
+		args := []any{lease.Owner}
+		placeholders := ""
+		for idx, orderID := range chunk {
+			if idx > 0 {
+				placeholders += ", "
+			}
+			args = append(args, orderID)
+			placeholders += fmt.Sprintf("$%d", len(args))
+		}
+		releaseOrdersQuery := `
+			UPDATE content.orders
+			SET
+				locked_by = NULL,
+				locked_until = NULL,
+				attempts = GREATEST(attempts - 1, 0),
+				next_check_at = NULL
+			WHERE
+				(status = 'NEW' OR status = 'PROCESSING') AND
+				locked_by = $1 AND
+				id IN (` + placeholders + `);
+		`
+		result, err := ops.DB.ExecContext(ctx, releaseOrdersQuery, args...)
+		if err != nil {
+			return released, err
+		}
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return released, err
+		}
+		released += int(rowsAffected)
+	}
+	return released, nil
+}
+
+func (ops *OrderPGStorage) GiveUpWaitingOrders(ctx context.Context, createdBefore time.Time, reason string) (int, error) {
+	// given up orders are recorded in status history with polls made before giving up,
+	// PROCESSING orders are accepted by accrual system and wait for its result however long it takes
+	giveUpOrdersQuery := `
+		WITH given_up AS (
+			UPDATE content.orders o
+			SET
+				status = 'INVALID',
+				reason = $2,
+				attempts = 0,
+				next_check_at = NULL,
+				updated_at = CURRENT_TIMESTAMP
+			FROM (
+				SELECT id, attempts
+				FROM content.orders
+				WHERE
+					status = 'NEW' AND
+					created_at < $1
+				FOR UPDATE
+			) prev
+			WHERE o.id = prev.id
+			RETURNING o.id, prev.attempts
+		)
+		INSERT INTO content.order_events (order_id, status, reason, attempts)
+		SELECT id, 'INVALID', $2, attempts
+		FROM given_up;
+	`
+	result, err := ops.DB.ExecContext(ctx, giveUpOrdersQuery, createdBefore, reason)
+	if err != nil {
+		return 0, err
+	}
+	givenUp, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return int(givenUp), nil
+}
+
 func (ops *OrderPGStorage) GetUserOrders(ctx context.Context, userID uuid.UUID) ([]order.Order, error) {
+	orders, _, err := ops.ListUserOrders(ctx, userID, order.ListQuery{})
+	return orders, err
+}
+
+// ListUserOrders returns page of user orders ordered by uploaded_at DESC and cursor of the next page if there is one.
+func (ops *OrderPGStorage) ListUserOrders(ctx context.Context, userID uuid.UUID, query order.ListQuery) ([]order.Order, *pagination.Cursor, error) {
 	getOrdersFromDB := `
-		SELECT id, status, accrual, created_at
+		SELECT id, status, accrual, COALESCE(reason, ''), created_at
 		FROM content.orders
-		WHERE user_id = $1
-		ORDER BY created_at DESC;
-	`
+		WHERE user_id = $1`
+	args := []any{userID.String()}
+
+	if len(query.Statuses) > 0 {
+		placeholders := make([]string, 0, len(query.Statuses))
+		for _, status := range query.Statuses {
+			args = append(args, status)
+			placeholders = append(placeholders, fmt.Sprintf("$%d", len(args)))
+		}
+		getOrdersFromDB += " AND status IN (" + strings.Join(placeholders, ", ") + ")"
+	}
+	if query.UploadedFrom != nil {
+		args = append(args, *query.UploadedFrom)
+		getOrdersFromDB += fmt.Sprintf(" AND created_at >= $%d", len(args))
+	}
+	if query.UploadedTo != nil {
+		args = append(args, *query.UploadedTo)
+		getOrdersFromDB += fmt.Sprintf(" AND created_at < $%d", len(args))
+	}
+	if query.Cursor != nil {
+		args = append(args, query.Cursor.CreatedAt, query.Cursor.ID)
+		getOrdersFromDB += fmt.Sprintf(" AND (created_at, id) < ($%d, $%d)", len(args)-1, len(args))
+	}
+	getOrdersFromDB += " ORDER BY created_at DESC, id DESC"
+	if query.Limit > 0 {
+		// one extra row tells whether there is the next page
+		args = append(args, query.Limit+1)
+		getOrdersFromDB += fmt.Sprintf(" LIMIT $%d", len(args))
+	}
 
-	rows, err := ops.DB.QueryContext(ctx, getOrdersFromDB, userID.String())
+	rows, err := ops.DB.QueryContext(ctx, getOrdersFromDB, args...)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	defer rows.Close()
 
 	orders := []order.Order{}
 	for rows.Next() {
 		var orderRow order.Order
-		var accrual sql.NullFloat64
-
-		err = rows.Scan(&orderRow.ID, &orderRow.Status, &accrual, &orderRow.CreatedAt)
+		err = rows.Scan(&orderRow.ID, &orderRow.Status, &orderRow.Accrual, &orderRow.Reason, &orderRow.CreatedAt)
 		if err != nil {
-			return nil, err
-		}
-		if accrual.Valid {
-			orderRow.Accrual = &accrual.Float64
+			return nil, nil, err
 		}
 
 		orders = append(orders, orderRow)
@@ -194,9 +448,10 @@ func (ops *OrderPGStorage) GetUserOrders(ctx context.Context, userID uuid.UUID)
 
 	err = rows.Err()
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-	return orders, nil
+	orders, next := pagination.Cut(orders, query.Limit, order.Order.PageCursor)
+	return orders, next, nil
 }
 
 func (ops *OrderPGStorage) BeginTx(ctx context.Context) (*transaction.Trx, error) {
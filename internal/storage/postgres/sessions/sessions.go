@@ -0,0 +1,147 @@
+package sessionpgstorage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/ry461ch/loyalty_system/internal/helpers/transaction"
+	"github.com/ry461ch/loyalty_system/internal/models/exceptions"
+	"github.com/ry461ch/loyalty_system/internal/models/session"
+)
+
+type SessionPGStorage struct {
+	DB  *sql.DB
+	dsn string
+}
+
+func NewSessionPGStorage(DBDsn string) *SessionPGStorage {
+	return &SessionPGStorage{
+		dsn: DBDsn,
+		DB:  nil,
+	}
+}
+
+func (sps *SessionPGStorage) Initialize(ctx context.Context, DB *sql.DB) error {
+	if DB == nil {
+		return errors.New("db wasn't initialized")
+	}
+	sps.DB = DB
+
+	return nil
+}
+
+func (sps *SessionPGStorage) InsertSession(ctx context.Context, inputSession *session.Session, tx *transaction.Trx) error {
+	insertSessionQuery := `
+		INSERT INTO content.sessions (id, user_id, login, refresh_token_hash, expires_at)
+		VALUES ($1, $2, $3, $4, $5);
+	`
+
+	_, err := tx.ExecContext(
+		ctx,
+		insertSessionQuery,
+		inputSession.ID,
+		inputSession.UserID,
+		inputSession.Login,
+		inputSession.RefreshTokenHash,
+		inputSession.ExpiresAt,
+	)
+	return err
+}
+
+func (sps *SessionPGStorage) GetSession(ctx context.Context, sessionID uuid.UUID) (*session.Session, error) {
+	getSessionFromDB := `
+		SELECT id, user_id, login, refresh_token_hash, expires_at, revoked_at, created_at
+		FROM content.sessions
+		WHERE id = $1;
+	`
+	row := sps.DB.QueryRowContext(ctx, getSessionFromDB, sessionID)
+
+	var sessionInDB session.Session
+	err := row.Scan(
+		&sessionInDB.ID,
+		&sessionInDB.UserID,
+		&sessionInDB.Login,
+		&sessionInDB.RefreshTokenHash,
+		&sessionInDB.ExpiresAt,
+		&sessionInDB.RevokedAt,
+		&sessionInDB.CreatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, exceptions.ErrSessionNotFound
+		}
+		return nil, err
+	}
+	return &sessionInDB, nil
+}
+
+// RotateSession replaces refresh token hash only if it wasn't replaced concurrently,
+// so one refresh token may be exchanged only once.
+func (sps *SessionPGStorage) RotateSession(
+	ctx context.Context,
+	sessionID uuid.UUID,
+	oldRefreshTokenHash []byte,
+	newRefreshTokenHash []byte,
+	expiresAt time.Time,
+	tx *transaction.Trx,
+) error {
+	rotateSessionQuery := `
+		UPDATE content.sessions
+		SET refresh_token_hash = $3, expires_at = $4, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND refresh_token_hash = $2 AND revoked_at IS NULL;
+	`
+
+	result, err := tx.ExecContext(ctx, rotateSessionQuery, sessionID, oldRefreshTokenHash, newRefreshTokenHash, expiresAt)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return exceptions.ErrSessionConflict
+	}
+	return nil
+}
+
+func (sps *SessionPGStorage) RevokeSession(ctx context.Context, sessionID uuid.UUID, tx *transaction.Trx) error {
+	revokeSessionQuery := `
+		UPDATE content.sessions
+		SET revoked_at = COALESCE(revoked_at, CURRENT_TIMESTAMP), updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1;
+	`
+
+	result, err := tx.ExecContext(ctx, revokeSessionQuery, sessionID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return exceptions.ErrSessionNotFound
+	}
+	return nil
+}
+
+// RevokeUserSessions revokes all sessions of the user but exceptSessionID, uuid.Nil revokes all of them.
+func (sps *SessionPGStorage) RevokeUserSessions(ctx context.Context, userID uuid.UUID, exceptSessionID uuid.UUID, tx *transaction.Trx) error {
+	revokeUserSessionsQuery := `
+		UPDATE content.sessions
+		SET revoked_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+		WHERE user_id = $1 AND id <> $2 AND revoked_at IS NULL;
+	`
+
+	_, err := tx.ExecContext(ctx, revokeUserSessionsQuery, userID, exceptSessionID)
+	return err
+}
+
+func (sps *SessionPGStorage) BeginTx(ctx context.Context) (*transaction.Trx, error) {
+	return transaction.BeginTx(ctx, sps.DB)
+}
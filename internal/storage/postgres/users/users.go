@@ -4,10 +4,12 @@ import (
 	"context"
 	"database/sql"
 	"errors"
-	"strings"
+
+	"github.com/google/uuid"
 
 	"github.com/ry461ch/loyalty_system/internal/helpers/transaction"
 	"github.com/ry461ch/loyalty_system/internal/models/exceptions"
+	"github.com/ry461ch/loyalty_system/internal/models/loginattempt"
 	"github.com/ry461ch/loyalty_system/internal/models/user"
 )
 
@@ -16,22 +18,6 @@ type UserPGStorage struct {
 	dsn string
 }
 
-func getDDL() string {
-	return `
-		CREATE TABLE IF NOT EXISTS content.users (
-			id UUID PRIMARY KEY,
-			login VARCHAR(255) NOT NULL,
-			password_hash bytea NOT NULL,
-			created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
-			updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
-		);
-
-		CREATE UNIQUE INDEX IF NOT EXISTS users_login_idx ON content.users(login);
-		CREATE INDEX IF NOT EXISTS users_created_at_idx ON content.users(created_at);
-		CREATE INDEX IF NOT EXISTS users_updated_at_idx ON content.users(updated_at);
-	`
-}
-
 func NewUserPGStorage(DBDsn string) *UserPGStorage {
 	return &UserPGStorage{
 		dsn: DBDsn,
@@ -45,16 +31,6 @@ func (ups *UserPGStorage) Initialize(ctx context.Context, DB *sql.DB) error {
 	}
 	ups.DB = DB
 
-	requests := strings.Split(getDDL(), ";")
-	for _, request := range requests {
-		if request != "" {
-			_, err := ups.DB.ExecContext(ctx, request)
-			if err != nil {
-				return err
-			}
-		}
-	}
-
 	return nil
 }
 
@@ -84,6 +60,84 @@ func (ups *UserPGStorage) InsertUser(ctx context.Context, newUser *user.User, tx
 	return err
 }
 
+func (ups *UserPGStorage) GetUserByID(ctx context.Context, userID uuid.UUID) (*user.User, error) {
+	getUserFromDB := `
+		SELECT id, login, password_hash FROM content.users WHERE id = $1 AND deleted_at IS NULL;
+	`
+	row := ups.DB.QueryRowContext(ctx, getUserFromDB, userID)
+
+	var userInDB user.User
+	err := row.Scan(&userInDB.ID, &userInDB.Login, &userInDB.PasswordHash)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, exceptions.ErrUserNotFound
+		}
+		return nil, err
+	}
+	return &userInDB, nil
+}
+
+func (ups *UserPGStorage) UpdatePasswordHash(ctx context.Context, userID uuid.UUID, passwordHash []byte, tx *transaction.Trx) error {
+	updatePasswordHashQuery := `
+		UPDATE content.users SET password_hash = $2, updated_at = CURRENT_TIMESTAMP WHERE id = $1 AND deleted_at IS NULL;
+	`
+
+	res, err := tx.ExecContext(ctx, updatePasswordHashQuery, userID, passwordHash)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return exceptions.ErrUserNotFound
+	}
+	return nil
+}
+
+// AnonymizeUser moves the user to anonymized login and removes its password,
+// the row is kept, so orders and withdrawals of the user are still accounted.
+// Login is also removed from sessions and failed login attempts of the user.
+func (ups *UserPGStorage) AnonymizeUser(ctx context.Context, userID uuid.UUID, tx *transaction.Trx) error {
+	getLoginQuery := `
+		SELECT login FROM content.users WHERE id = $1 AND deleted_at IS NULL FOR UPDATE;
+	`
+	var login string
+	err := tx.QueryRowContext(ctx, getLoginQuery, userID).Scan(&login)
+	if errors.Is(err, sql.ErrNoRows) {
+		return exceptions.ErrUserNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	anonymizedLogin := user.AnonymizedLogin(userID)
+	anonymizeUserQuery := `
+		UPDATE content.users
+		SET login = $2, password_hash = ''::bytea, deleted_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1;
+	`
+	_, err = tx.ExecContext(ctx, anonymizeUserQuery, userID, anonymizedLogin)
+	if err != nil {
+		return err
+	}
+
+	anonymizeSessionsQuery := `
+		UPDATE content.sessions SET login = $2 WHERE user_id = $1;
+	`
+	_, err = tx.ExecContext(ctx, anonymizeSessionsQuery, userID, anonymizedLogin)
+	if err != nil {
+		return err
+	}
+
+	deleteLoginAttemptsQuery := `
+		DELETE FROM content.login_attempts WHERE key = $1;
+	`
+	_, err = tx.ExecContext(ctx, deleteLoginAttemptsQuery, loginattempt.LoginKey(login))
+	return err
+}
+
 func (ups *UserPGStorage) BeginTx(ctx context.Context) (*transaction.Trx, error) {
 	return transaction.BeginTx(ctx, ups.DB)
 }
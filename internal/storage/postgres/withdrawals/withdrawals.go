@@ -4,36 +4,27 @@ import (
 	"context"
 	"database/sql"
 	"errors"
-	"strings"
+	"fmt"
 
 	"github.com/google/uuid"
 
+	"github.com/ry461ch/loyalty_system/internal/helpers/pagination"
 	"github.com/ry461ch/loyalty_system/internal/helpers/transaction"
 	"github.com/ry461ch/loyalty_system/internal/models/exceptions"
 	"github.com/ry461ch/loyalty_system/internal/models/withdrawal"
 )
 
+// queryer is either DB or transaction, so reads can be made in one snapshot.
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
 type WithdrawalPGStorage struct {
 	DB  *sql.DB
 	dsn string
 }
 
-func getDDL() string {
-	return `
-		CREATE TABLE IF NOT EXISTS content.withdrawals (
-			id UUID PRIMARY KEY,
-			order_id VARCHAR(255) NOT NULL,
-			user_id UUID NOT NULL,
-			sum	DOUBLE PRECISION NOT NULL,
-			created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
-		);
-
-		CREATE INDEX IF NOT EXISTS withdrawals_order_id_idx ON content.withdrawals(order_id);
-		CREATE INDEX IF NOT EXISTS withdrawals_user_id_idx ON content.withdrawals(user_id);
-		CREATE INDEX IF NOT EXISTS withdrawals_created_at_idx ON content.withdrawals(created_at);
-	`
-}
-
 func NewWithdrawalPGStorage(DBDsn string) *WithdrawalPGStorage {
 	return &WithdrawalPGStorage{
 		dsn: DBDsn,
@@ -47,16 +38,6 @@ func (wps *WithdrawalPGStorage) Initialize(ctx context.Context, DB *sql.DB) erro
 	}
 	wps.DB = DB
 
-	requests := strings.Split(getDDL(), ";")
-	for _, request := range requests {
-		if request != "" {
-			_, err := wps.DB.ExecContext(ctx, request)
-			if err != nil {
-				return err
-			}
-		}
-	}
-
 	return nil
 }
 
@@ -67,51 +48,139 @@ func (wps *WithdrawalPGStorage) InsertWithdrawal(ctx context.Context, inputWithd
 		ON CONFLICT (id) DO NOTHING;
 	`
 
-	_, err := tx.ExecContext(ctx, insertWithdrawalQuery, *inputWithdrawal.ID, inputWithdrawal.OrderID, *inputWithdrawal.UserID, inputWithdrawal.Sum)
-	return err
+	result, err := tx.ExecContext(ctx, insertWithdrawalQuery, *inputWithdrawal.ID, inputWithdrawal.OrderID, *inputWithdrawal.UserID, inputWithdrawal.Sum)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return exceptions.ErrWithdrawalConflict
+	}
+	return nil
 }
 
 func (wps *WithdrawalPGStorage) GetWithdrawals(ctx context.Context, userID uuid.UUID) ([]withdrawal.Withdrawal, error) {
-	getWithdrawalsFromDB := `
-		SELECT id, order_id, sum, created_at
-		FROM content.withdrawals
-		WHERE user_id = $1
-		ORDER BY created_at DESC;
-	`
-	rows, err := wps.DB.QueryContext(ctx, getWithdrawalsFromDB, userID)
+	withdrawals, _, err := wps.ListWithdrawals(ctx, userID, withdrawal.ListQuery{})
+	return withdrawals, err
+}
+
+// ListWithdrawals returns page of user withdrawals ordered by processed_at DESC and cursor of the next page if there is one.
+func (wps *WithdrawalPGStorage) ListWithdrawals(ctx context.Context, userID uuid.UUID, query withdrawal.ListQuery) ([]withdrawal.Withdrawal, *pagination.Cursor, error) {
+	return listWithdrawals(ctx, wps.DB, userID, query)
+}
+
+func (wps *WithdrawalPGStorage) SummarizeWithdrawals(ctx context.Context, userID uuid.UUID, filter withdrawal.Filter) (*withdrawal.Summary, error) {
+	return summarizeWithdrawals(ctx, wps.DB, userID, filter)
+}
+
+// ListWithdrawalsWithSummary reads the page and the summary of the whole listing in one snapshot,
+// so the totals always match the page.
+func (wps *WithdrawalPGStorage) ListWithdrawalsWithSummary(ctx context.Context, userID uuid.UUID, query withdrawal.ListQuery) ([]withdrawal.Withdrawal, *pagination.Cursor, *withdrawal.Summary, error) {
+	tx, err := wps.DB.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
 	if err != nil {
-		return nil, err
+		return nil, nil, nil, err
+	}
+	defer tx.Rollback()
+
+	withdrawals, next, err := listWithdrawals(ctx, tx, userID, query)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	summary, err := summarizeWithdrawals(ctx, tx, userID, query.Filter)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return withdrawals, next, summary, tx.Commit()
+}
+
+func listWithdrawals(ctx context.Context, q queryer, userID uuid.UUID, query withdrawal.ListQuery) ([]withdrawal.Withdrawal, *pagination.Cursor, error) {
+	getWithdrawalsFromDB, args := filterWithdrawals(`
+		SELECT id, order_id, sum, status, created_at, refunded_at
+		FROM content.withdrawals`, userID, query.Filter)
+	if query.Cursor != nil {
+		args = append(args, query.Cursor.CreatedAt, query.Cursor.ID)
+		getWithdrawalsFromDB += fmt.Sprintf(" AND (created_at, id) < ($%d, $%d::UUID)", len(args)-1, len(args))
+	}
+	getWithdrawalsFromDB += " ORDER BY created_at DESC, id DESC"
+	if query.Limit > 0 {
+		// one extra row tells whether there is the next page
+		args = append(args, query.Limit+1)
+		getWithdrawalsFromDB += fmt.Sprintf(" LIMIT $%d", len(args))
+	}
+
+	rows, err := q.QueryContext(ctx, getWithdrawalsFromDB, args...)
+	if err != nil {
+		return nil, nil, err
 	}
 	defer rows.Close()
 
 	withdrawals := []withdrawal.Withdrawal{}
 	for rows.Next() {
 		var insertedWithdrawal withdrawal.Withdrawal
-		err = rows.Scan(&insertedWithdrawal.ID, &insertedWithdrawal.OrderID, &insertedWithdrawal.Sum, &insertedWithdrawal.CreatedAt)
+		err = rows.Scan(&insertedWithdrawal.ID, &insertedWithdrawal.OrderID, &insertedWithdrawal.Sum, &insertedWithdrawal.Status, &insertedWithdrawal.CreatedAt, &insertedWithdrawal.RefundedAt)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 
 		withdrawals = append(withdrawals, insertedWithdrawal)
 	}
 
 	err = rows.Err()
+	if err != nil {
+		return nil, nil, err
+	}
+	withdrawals, next := pagination.Cut(withdrawals, query.Limit, withdrawal.Withdrawal.PageCursor)
+	return withdrawals, next, nil
+}
+
+func summarizeWithdrawals(ctx context.Context, q queryer, userID uuid.UUID, filter withdrawal.Filter) (*withdrawal.Summary, error) {
+	whereQuery, args := filterWithdrawals("", userID, filter)
+	args = append(args, withdrawal.REFUNDED)
+	summarizeWithdrawalsQuery := fmt.Sprintf(`
+		SELECT COUNT(*), COALESCE(SUM(sum) FILTER (WHERE status <> $%d), 0)
+		FROM content.withdrawals`, len(args)) + whereQuery
+	row := q.QueryRowContext(ctx, summarizeWithdrawalsQuery, args...)
+
+	var summary withdrawal.Summary
+	err := row.Scan(&summary.Count, &summary.Sum)
 	if err != nil {
 		return nil, err
 	}
-	return withdrawals, nil
+	return &summary, nil
+}
+
+// filterWithdrawals appends WHERE clause of the filter to selectQuery.
+func filterWithdrawals(selectQuery string, userID uuid.UUID, filter withdrawal.Filter) (string, []any) {
+	query := selectQuery + " WHERE user_id = $1"
+	args := []any{userID}
+	if filter.OrderID != "" {
+		args = append(args, filter.OrderID)
+		query += fmt.Sprintf(" AND order_id = $%d", len(args))
+	}
+	if filter.ProcessedFrom != nil {
+		args = append(args, *filter.ProcessedFrom)
+		query += fmt.Sprintf(" AND created_at >= $%d", len(args))
+	}
+	if filter.ProcessedTo != nil {
+		args = append(args, *filter.ProcessedTo)
+		query += fmt.Sprintf(" AND created_at < $%d", len(args))
+	}
+	return query, args
 }
 
 func (wps *WithdrawalPGStorage) GetWithdrawal(ctx context.Context, ID uuid.UUID) (*withdrawal.Withdrawal, error) {
 	getWithdrawalFromDB := `
-		SELECT order_id, sum, created_at
+		SELECT user_id, order_id, sum, status, created_at, refunded_at
 		FROM content.withdrawals
 		WHERE id = $1;
 	`
 	row := wps.DB.QueryRowContext(ctx, getWithdrawalFromDB, ID)
 
 	var withdrawalInDB withdrawal.Withdrawal
-	err := row.Scan(&withdrawalInDB.OrderID, &withdrawalInDB.Sum, &withdrawalInDB.CreatedAt)
+	err := row.Scan(&withdrawalInDB.UserID, &withdrawalInDB.OrderID, &withdrawalInDB.Sum, &withdrawalInDB.Status, &withdrawalInDB.CreatedAt, &withdrawalInDB.RefundedAt)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, exceptions.ErrWithdrawalNotFound
@@ -122,6 +191,33 @@ func (wps *WithdrawalPGStorage) GetWithdrawal(ctx context.Context, ID uuid.UUID)
 	return &withdrawalInDB, nil
 }
 
+// RefundWithdrawal marks the completed withdrawal as refunded and returns it.
+func (wps *WithdrawalPGStorage) RefundWithdrawal(ctx context.Context, ID uuid.UUID, tx *transaction.Trx) (*withdrawal.Withdrawal, error) {
+	// the status check and the update are one statement, so concurrent refunds can't return the sum twice
+	refundWithdrawalQuery := `
+		UPDATE content.withdrawals
+		SET status = $2, refunded_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND status = $3
+		RETURNING user_id, order_id, sum, status, created_at, refunded_at;
+	`
+	row := tx.QueryRowContext(ctx, refundWithdrawalQuery, ID, withdrawal.REFUNDED, withdrawal.COMPLETED)
+
+	refundedWithdrawal := withdrawal.Withdrawal{ID: &ID}
+	err := row.Scan(&refundedWithdrawal.UserID, &refundedWithdrawal.OrderID, &refundedWithdrawal.Sum, &refundedWithdrawal.Status, &refundedWithdrawal.CreatedAt, &refundedWithdrawal.RefundedAt)
+	if err == nil {
+		return &refundedWithdrawal, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	_, err = wps.GetWithdrawal(ctx, ID)
+	if err != nil {
+		return nil, err
+	}
+	return nil, exceptions.ErrWithdrawalRefunded
+}
+
 func (wps *WithdrawalPGStorage) BeginTx(ctx context.Context) (*transaction.Trx, error) {
 	return transaction.BeginTx(ctx, wps.DB)
 }
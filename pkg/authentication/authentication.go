@@ -9,8 +9,8 @@ import (
 )
 
 type Authenticator struct {
-	secretKey string
-	tokenExp  time.Duration
+	keySet   *KeySet
+	tokenExp time.Duration
 }
 
 type Claims struct {
@@ -19,23 +19,35 @@ type Claims struct {
 	Login  string
 }
 
+// NewAuthenticator signs tokens with HS256, such tokens can't be verified by other services.
 func NewAuthenticator(secretKey string, tokenExp time.Duration) *Authenticator {
+	keySet, _ := NewKeySet(NewHMACKey(secretKey))
+	return NewKeySetAuthenticator(keySet, tokenExp)
+}
+
+func NewKeySetAuthenticator(keySet *KeySet, tokenExp time.Duration) *Authenticator {
 	return &Authenticator{
-		secretKey: secretKey,
-		tokenExp:  tokenExp,
+		keySet:   keySet,
+		tokenExp: tokenExp,
 	}
 }
 
-func (a *Authenticator) MakeJWT(ID uuid.UUID, login string) (*string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, Claims{
+func (a *Authenticator) TokenExp() time.Duration {
+	return a.tokenExp
+}
+
+// MakeJWT issues an access token of the session, session id is passed as jti.
+func (a *Authenticator) MakeJWT(sessionID uuid.UUID, ID uuid.UUID, login string) (*string, error) {
+	now := time.Now().UTC()
+	tokenString, err := a.keySet.sign(Claims{
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().UTC().Add(a.tokenExp)),
+			ID:        sessionID.String(),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(a.tokenExp)),
 		},
 		UserID: ID,
 		Login:  login,
 	})
-
-	tokenString, err := token.SignedString([]byte(a.secretKey))
 	if err != nil {
 		return nil, err
 	}
@@ -44,13 +56,16 @@ func (a *Authenticator) MakeJWT(ID uuid.UUID, login string) (*string, error) {
 }
 
 func (a *Authenticator) GetUserID(tokenStr string) (*uuid.UUID, error) {
+	claims, err := a.GetClaims(tokenStr)
+	if err != nil {
+		return nil, err
+	}
+	return &claims.UserID, nil
+}
+
+func (a *Authenticator) GetClaims(tokenStr string) (*Claims, error) {
 	claims := &Claims{}
-	token, err := jwt.ParseWithClaims(tokenStr, claims, func(t *jwt.Token) (interface{}, error) {
-		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, errors.New("authentication error")
-		}
-		return []byte(a.secretKey), nil
-	})
+	token, err := jwt.ParseWithClaims(tokenStr, claims, a.keySet.verificationKey)
 	if err != nil {
 		return nil, errors.New("authentication error")
 	}
@@ -59,5 +74,14 @@ func (a *Authenticator) GetUserID(tokenStr string) (*uuid.UUID, error) {
 		return nil, errors.New("authentication error")
 	}
 
-	return &claims.UserID, nil
+	return claims, nil
+}
+
+func (a *Authenticator) JWKS() JWKSet {
+	return a.keySet.JWKS()
+}
+
+// GetSessionID returns id of the session the token was issued for.
+func (c *Claims) GetSessionID() (uuid.UUID, error) {
+	return uuid.Parse(c.ID)
 }
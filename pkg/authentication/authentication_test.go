@@ -13,10 +13,7 @@ import (
 
 func TestJWTValidation(t *testing.T) {
 	secretKey := "test"
-	authenticator := Authenticator{
-		secretKey: secretKey,
-		tokenExp:  time.Hour,
-	}
+	authenticator := NewAuthenticator(secretKey, time.Hour)
 	tokenUserID := uuid.New()
 
 	testCases := []struct {
@@ -69,14 +66,12 @@ func TestJWTValidation(t *testing.T) {
 
 func TestJWTGeneration(t *testing.T) {
 	secretKey := "test"
-	authenticator := Authenticator{
-		secretKey: secretKey,
-		tokenExp:  time.Hour,
-	}
+	authenticator := NewAuthenticator(secretKey, time.Hour)
 	inputID := uuid.New()
+	sessionID := uuid.New()
 	login := "login"
 
-	tokenStr, err := authenticator.MakeJWT(inputID, login)
+	tokenStr, err := authenticator.MakeJWT(sessionID, inputID, login)
 	assert.Nil(t, err, "unexpected error")
 
 	claims := &Claims{}
@@ -87,4 +82,8 @@ func TestJWTGeneration(t *testing.T) {
 		return []byte(secretKey), nil
 	})
 	assert.Nil(t, err, "invalid jwt token")
+	assert.Equal(t, inputID, claims.UserID, "user ids don't match")
+	tokenSessionID, err := claims.GetSessionID()
+	assert.Nil(t, err, "invalid jti")
+	assert.Equal(t, sessionID, tokenSessionID, "session ids don't match")
 }
@@ -0,0 +1,48 @@
+package authentication
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+)
+
+// JWK is a public key in RFC 7517 format.
+type JWK struct {
+	Kty string `json:"kty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+}
+
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// thumbprint is RFC 7638 thumbprint: sha256 of required members in lexicographic order.
+func (j JWK) thumbprint() string {
+	var required any
+	switch j.Kty {
+	case "RSA":
+		required = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{E: j.E, Kty: j.Kty, N: j.N}
+	case "OKP":
+		required = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{Crv: j.Crv, Kty: j.Kty, X: j.X}
+	default:
+		return ""
+	}
+
+	data, _ := json.Marshal(required)
+	hash := sha256.Sum256(data)
+	return base64.RawURLEncoding.EncodeToString(hash[:])
+}
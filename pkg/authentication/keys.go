@@ -0,0 +1,200 @@
+package authentication
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const minRSAKeyBits = 2048
+
+var (
+	ErrUnknownKey     = errors.New("unknown jwt key")
+	ErrUnsupportedKey = errors.New("unsupported jwt key type")
+)
+
+// Key is a JWT key, identified by kid header.
+// Asymmetric keys get RFC 7638 thumbprint of the public key as kid,
+// so the same key file always gives the same kid.
+type Key struct {
+	ID        string
+	Method    jwt.SigningMethod
+	signKey   any // nil for verification only keys
+	verifyKey any
+}
+
+func NewHMACKey(secretKey string) *Key {
+	return &Key{
+		Method:    jwt.SigningMethodHS256,
+		signKey:   []byte(secretKey),
+		verifyKey: []byte(secretKey),
+	}
+}
+
+// ParseKey parses RSA (RS256) or Ed25519 (EdDSA) key from PEM.
+// Private key may be used for signing, public key only for verification.
+func ParseKey(pemData []byte) (*Key, error) {
+	block, _ := pem.Decode(pemData)
+	if block == nil {
+		return nil, errors.New("no PEM data found")
+	}
+
+	var parsedKey any
+	var err error
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsedKey, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsedKey, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsedKey, err = x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		parsedKey, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("%w: PEM block %s", ErrUnsupportedKey, block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	key := &Key{}
+	switch k := parsedKey.(type) {
+	case *rsa.PrivateKey:
+		key.Method, key.signKey, key.verifyKey = jwt.SigningMethodRS256, k, &k.PublicKey
+	case *rsa.PublicKey:
+		key.Method, key.verifyKey = jwt.SigningMethodRS256, k
+	case ed25519.PrivateKey:
+		key.Method, key.signKey, key.verifyKey = jwt.SigningMethodEdDSA, k, k.Public()
+	case ed25519.PublicKey:
+		key.Method, key.verifyKey = jwt.SigningMethodEdDSA, k
+	default:
+		return nil, fmt.Errorf("%w: %T", ErrUnsupportedKey, parsedKey)
+	}
+	if rsaKey, ok := key.verifyKey.(*rsa.PublicKey); ok && rsaKey.N.BitLen() < minRSAKeyBits {
+		return nil, fmt.Errorf("%w: rsa key must have at least %d bits", ErrUnsupportedKey, minRSAKeyBits)
+	}
+
+	key.ID = key.JWK().thumbprint()
+	return key, nil
+}
+
+func LoadKey(path string) (*Key, error) {
+	pemData, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := ParseKey(pemData)
+	if err != nil {
+		return nil, fmt.Errorf("jwt key %s: %w", path, err)
+	}
+	return key, nil
+}
+
+// JWK returns public part of the key, HMAC keys are never published.
+func (k *Key) JWK() JWK {
+	switch publicKey := k.verifyKey.(type) {
+	case *rsa.PublicKey:
+		return JWK{
+			Kty: "RSA",
+			N:   base64.RawURLEncoding.EncodeToString(publicKey.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(publicKey.E)).Bytes()),
+			Kid: k.ID,
+			Alg: k.Method.Alg(),
+			Use: "sig",
+		}
+	case ed25519.PublicKey:
+		return JWK{
+			Kty: "OKP",
+			Crv: "Ed25519",
+			X:   base64.RawURLEncoding.EncodeToString(publicKey),
+			Kid: k.ID,
+			Alg: k.Method.Alg(),
+			Use: "sig",
+		}
+	}
+	return JWK{}
+}
+
+// KeySet signs tokens with one key and verifies them with any of its keys,
+// so a new signing key may be rolled out while tokens signed by the old one are still valid.
+type KeySet struct {
+	signingKey *Key
+	keys       map[string]*Key
+}
+
+func NewKeySet(signingKey *Key, verificationKeys ...*Key) (*KeySet, error) {
+	if signingKey == nil || signingKey.signKey == nil {
+		return nil, errors.New("signing jwt key must be a private key")
+	}
+
+	keySet := &KeySet{
+		signingKey: signingKey,
+		keys:       map[string]*Key{signingKey.ID: signingKey},
+	}
+	for _, key := range verificationKeys {
+		keySet.keys[key.ID] = key
+	}
+	return keySet, nil
+}
+
+func LoadKeySet(signingKeyPath string, verificationKeyPaths []string) (*KeySet, error) {
+	signingKey, err := LoadKey(signingKeyPath)
+	if err != nil {
+		return nil, err
+	}
+
+	verificationKeys := make([]*Key, 0, len(verificationKeyPaths))
+	for _, path := range verificationKeyPaths {
+		key, err := LoadKey(path)
+		if err != nil {
+			return nil, err
+		}
+		verificationKeys = append(verificationKeys, key)
+	}
+	return NewKeySet(signingKey, verificationKeys...)
+}
+
+func (ks *KeySet) sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(ks.signingKey.Method, claims)
+	if ks.signingKey.ID != "" {
+		token.Header["kid"] = ks.signingKey.ID
+	}
+	return token.SignedString(ks.signingKey.signKey)
+}
+
+// verificationKey is jwt.Keyfunc, the algorithm of the token must be the algorithm of its key.
+func (ks *KeySet) verificationKey(token *jwt.Token) (any, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, ok := ks.keys[kid]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+	return key.verifyKey, nil
+}
+
+// JWKS returns public keys of the set to verify our tokens by other services.
+func (ks *KeySet) JWKS() JWKSet {
+	jwks := JWKSet{Keys: []JWK{}}
+	for _, key := range ks.keys {
+		if jwk := key.JWK(); jwk.Kty != "" {
+			jwks.Keys = append(jwks.Keys, jwk)
+		}
+	}
+	slices.SortFunc(jwks.Keys, func(a, b JWK) int {
+		return strings.Compare(a.Kid, b.Kid)
+	})
+	return jwks
+}
@@ -0,0 +1,193 @@
+package authentication
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func privateKeyPEM(t *testing.T, privateKey any) []byte {
+	der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	assert.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+}
+
+func publicKeyPEM(t *testing.T, publicKey any) []byte {
+	der, err := x509.MarshalPKIXPublicKey(publicKey)
+	assert.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+}
+
+func TestParseKey(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	weakRSAKey, _ := rsa.GenerateKey(rand.Reader, 1024)
+	edPublicKey, edPrivateKey, _ := ed25519.GenerateKey(rand.Reader)
+
+	testCases := []struct {
+		testName        string
+		pemData         []byte
+		expectedAlg     string
+		expectedSigning bool
+		expectedErr     bool
+	}{
+		{
+			testName:        "rsa private key",
+			pemData:         privateKeyPEM(t, rsaKey),
+			expectedAlg:     "RS256",
+			expectedSigning: true,
+		},
+		{
+			testName:        "rsa pkcs1 private key",
+			pemData:         pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)}),
+			expectedAlg:     "RS256",
+			expectedSigning: true,
+		},
+		{
+			testName:    "rsa public key",
+			pemData:     publicKeyPEM(t, &rsaKey.PublicKey),
+			expectedAlg: "RS256",
+		},
+		{
+			testName:        "ed25519 private key",
+			pemData:         privateKeyPEM(t, edPrivateKey),
+			expectedAlg:     "EdDSA",
+			expectedSigning: true,
+		},
+		{
+			testName:    "ed25519 public key",
+			pemData:     publicKeyPEM(t, edPublicKey),
+			expectedAlg: "EdDSA",
+		},
+		{
+			testName:    "weak rsa key",
+			pemData:     privateKeyPEM(t, weakRSAKey),
+			expectedErr: true,
+		},
+		{
+			testName:    "not a pem",
+			pemData:     []byte("secret"),
+			expectedErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			key, err := ParseKey(tc.pemData)
+			if tc.expectedErr {
+				assert.Error(t, err, "should be an error")
+				return
+			}
+			assert.NoError(t, err, "unexpected error")
+			assert.Equal(t, tc.expectedAlg, key.Method.Alg(), "algorithms don't match")
+			assert.Equal(t, tc.expectedSigning, key.signKey != nil, "signing ability doesn't match")
+			assert.NotEmpty(t, key.ID, "kid must be set")
+		})
+	}
+}
+
+func TestKeyIDIsStable(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+
+	privateKey, err := ParseKey(privateKeyPEM(t, rsaKey))
+	assert.NoError(t, err)
+	publicKey, err := ParseKey(publicKeyPEM(t, &rsaKey.PublicKey))
+	assert.NoError(t, err)
+
+	assert.Equal(t, privateKey.ID, publicKey.ID, "private and public parts must have the same kid")
+}
+
+func TestKeyRotation(t *testing.T) {
+	oldRSAKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	_, newEdKey, _ := ed25519.GenerateKey(rand.Reader)
+	_, unknownEdKey, _ := ed25519.GenerateKey(rand.Reader)
+
+	dir := t.TempDir()
+	oldKeyPath := filepath.Join(dir, "old.pem")
+	newKeyPath := filepath.Join(dir, "new.pem")
+	unknownKeyPath := filepath.Join(dir, "unknown.pem")
+	assert.NoError(t, os.WriteFile(oldKeyPath, publicKeyPEM(t, &oldRSAKey.PublicKey), 0o600))
+	assert.NoError(t, os.WriteFile(newKeyPath, privateKeyPEM(t, newEdKey), 0o600))
+	assert.NoError(t, os.WriteFile(unknownKeyPath, privateKeyPEM(t, unknownEdKey), 0o600))
+
+	oldKey, _ := ParseKey(privateKeyPEM(t, oldRSAKey))
+	oldKeySet, err := NewKeySet(oldKey)
+	assert.NoError(t, err)
+	oldAuthenticator := NewKeySetAuthenticator(oldKeySet, time.Hour)
+
+	keySet, err := LoadKeySet(newKeyPath, []string{oldKeyPath})
+	assert.NoError(t, err)
+	authenticator := NewKeySetAuthenticator(keySet, time.Hour)
+
+	unknownKeySet, err := LoadKeySet(unknownKeyPath, nil)
+	assert.NoError(t, err)
+	unknownAuthenticator := NewKeySetAuthenticator(unknownKeySet, time.Hour)
+
+	_, err = LoadKeySet(oldKeyPath, nil)
+	assert.Error(t, err, "public key can't sign tokens")
+
+	userID := uuid.New()
+	newToken, _ := authenticator.MakeJWT(uuid.New(), userID, "login")
+	oldToken, _ := oldAuthenticator.MakeJWT(uuid.New(), userID, "login")
+	unknownToken, _ := unknownAuthenticator.MakeJWT(uuid.New(), userID, "login")
+	// HS256 token signed by public key of a known RSA key
+	confusedToken := jwt.NewWithClaims(jwt.SigningMethodHS256, Claims{UserID: userID})
+	confusedToken.Header["kid"] = oldKey.ID
+	confusedTokenStr, _ := confusedToken.SignedString(x509.MarshalPKCS1PublicKey(&oldRSAKey.PublicKey))
+
+	testCases := []struct {
+		testName    string
+		token       string
+		expectedErr bool
+	}{
+		{
+			testName:    "token signed by current key",
+			token:       *newToken,
+			expectedErr: false,
+		},
+		{
+			testName:    "token signed by previous key",
+			token:       *oldToken,
+			expectedErr: false,
+		},
+		{
+			testName:    "token signed by unknown key",
+			token:       *unknownToken,
+			expectedErr: true,
+		},
+		{
+			testName:    "token with substituted algorithm",
+			token:       confusedTokenStr,
+			expectedErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			tokenUserID, err := authenticator.GetUserID(tc.token)
+			if tc.expectedErr {
+				assert.Error(t, err, "should be an error")
+				return
+			}
+			assert.NoError(t, err, "unexpected error")
+			assert.Equal(t, userID, *tokenUserID, "user ids don't match")
+		})
+	}
+
+	jwks := authenticator.JWKS()
+	assert.Len(t, jwks.Keys, 2, "both keys must be published")
+	for _, jwk := range jwks.Keys {
+		assert.Contains(t, []string{oldKey.ID, keySet.signingKey.ID}, jwk.Kid, "unexpected kid")
+		assert.Equal(t, "sig", jwk.Use)
+	}
+	assert.Empty(t, NewAuthenticator("secret", time.Hour).JWKS().Keys, "hmac key mustn't be published")
+}
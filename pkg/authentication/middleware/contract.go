@@ -0,0 +1,11 @@
+package authmiddleware
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+type SessionChecker interface {
+	IsSessionActive(ctx context.Context, sessionID uuid.UUID) (bool, error)
+}
@@ -6,17 +6,34 @@ import (
 	"github.com/ry461ch/loyalty_system/pkg/authentication"
 )
 
-func Authenticate(authenticator *authentication.Authenticator) func(http.Handler) http.Handler {
+// Authenticate accepts access tokens of active sessions only,
+// so tokens of revoked sessions stop working before they expire.
+func Authenticate(authenticator *authentication.Authenticator, sessionChecker SessionChecker) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			reqHeaderJWT := r.Header.Get("Authorization")
 
-			userID, err := authenticator.GetUserID(reqHeaderJWT)
+			claims, err := authenticator.GetClaims(reqHeaderJWT)
 			if err != nil {
 				w.WriteHeader(http.StatusUnauthorized)
 				return
 			}
-			r.Header.Set("X-User-Id", userID.String())
+			sessionID, err := claims.GetSessionID()
+			if err != nil {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			active, err := sessionChecker.IsSessionActive(r.Context(), sessionID)
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			if !active {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			r.Header.Set("X-User-Id", claims.UserID.String())
+			r.Header.Set("X-Session-Id", sessionID.String())
 			next.ServeHTTP(w, r)
 		})
 	}
@@ -0,0 +1,169 @@
+package circuitbreaker
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+var ErrOpen = errors.New("circuit breaker is open")
+
+type State int32
+
+const (
+	Closed State = iota
+	Open
+	HalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case Closed:
+		return "closed"
+	case Open:
+		return "open"
+	case HalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+func (s State) MarshalJSON() ([]byte, error) {
+	return []byte("\"" + s.String() + "\""), nil
+}
+
+type Settings struct {
+	// FailureRatio of requests in the current window which opens the breaker.
+	FailureRatio float64
+	// MinRequests in the window before the ratio is taken into account.
+	MinRequests int
+	// Interval after which counters of closed breaker are reset, zero means never.
+	Interval time.Duration
+	// OpenTimeout after which open breaker lets one probe request through.
+	OpenTimeout time.Duration
+	// OnStateChange is called under the breaker lock, so it must not call the breaker.
+	OnStateChange func(from, to State)
+}
+
+// Breaker stops calls to a failing dependency. Closed breaker counts failures,
+// open one rejects all calls until OpenTimeout passes, then half-open breaker
+// lets a single probe through: its success closes the breaker, failure opens it again.
+type Breaker struct {
+	mu          sync.Mutex
+	settings    Settings
+	state       State
+	requests    int
+	failures    int
+	windowStart time.Time
+	openedAt    time.Time
+	probing     bool
+}
+
+func New(settings Settings) *Breaker {
+	return &Breaker{
+		settings:    settings,
+		windowStart: time.Now(),
+	}
+}
+
+// Allow must be called before the request, every allowed request must be followed by Success, Failure or Cancel.
+func (b *Breaker) Allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refresh(time.Now())
+	switch b.state {
+	case Open:
+		return ErrOpen
+	case HalfOpen:
+		if b.probing {
+			return ErrOpen
+		}
+		b.probing = true
+	}
+	return nil
+}
+
+func (b *Breaker) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	b.refresh(now)
+	switch b.state {
+	case HalfOpen:
+		b.setState(Closed, now)
+	case Closed:
+		b.requests++
+	}
+}
+
+func (b *Breaker) Failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	b.refresh(now)
+	switch b.state {
+	case HalfOpen:
+		b.setState(Open, now)
+	case Closed:
+		b.requests++
+		b.failures++
+		if b.requests >= b.settings.MinRequests &&
+			float64(b.failures)/float64(b.requests) >= b.settings.FailureRatio {
+			b.setState(Open, now)
+		}
+	}
+}
+
+// Cancel releases the allowed request which was abandoned by the caller, e.g. on context cancellation,
+// without judging the dependency. Cancelled probe lets the next one through.
+func (b *Breaker) Cancel() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+}
+
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refresh(time.Now())
+	return b.state
+}
+
+// refresh applies time based transitions.
+func (b *Breaker) refresh(now time.Time) {
+	switch b.state {
+	case Open:
+		if now.Sub(b.openedAt) >= b.settings.OpenTimeout {
+			b.setState(HalfOpen, now)
+		}
+	case Closed:
+		if b.settings.Interval > 0 && now.Sub(b.windowStart) >= b.settings.Interval {
+			b.resetWindow(now)
+		}
+	}
+}
+
+func (b *Breaker) setState(state State, now time.Time) {
+	prevState := b.state
+	b.state = state
+	b.probing = false
+	b.resetWindow(now)
+	if state == Open {
+		b.openedAt = now
+	}
+	if b.settings.OnStateChange != nil {
+		b.settings.OnStateChange(prevState, state)
+	}
+}
+
+func (b *Breaker) resetWindow(now time.Time) {
+	b.requests = 0
+	b.failures = 0
+	b.windowStart = now
+}
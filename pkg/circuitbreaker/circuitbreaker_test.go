@@ -0,0 +1,100 @@
+package circuitbreaker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBreaker(t *testing.T) {
+	var transitions []string
+	breaker := New(Settings{
+		FailureRatio: 0.5,
+		MinRequests:  4,
+		OpenTimeout:  time.Millisecond * 100,
+		OnStateChange: func(from, to State) {
+			transitions = append(transitions, from.String()+"->"+to.String())
+		},
+	})
+
+	assert.NoError(t, breaker.Allow())
+	breaker.Success()
+	// not enough requests to open
+	for range 2 {
+		assert.NoError(t, breaker.Allow())
+		breaker.Failure()
+	}
+	assert.Equal(t, Closed, breaker.State())
+
+	assert.NoError(t, breaker.Allow())
+	breaker.Failure()
+	assert.Equal(t, Open, breaker.State(), "ratio 3/4 didn't open breaker")
+	assert.ErrorIs(t, breaker.Allow(), ErrOpen)
+
+	time.Sleep(time.Millisecond * 150)
+	assert.Equal(t, HalfOpen, breaker.State())
+	assert.NoError(t, breaker.Allow(), "probe wasn't allowed")
+	assert.ErrorIs(t, breaker.Allow(), ErrOpen, "second probe was allowed")
+	breaker.Failure()
+	assert.Equal(t, Open, breaker.State(), "failed probe didn't open breaker")
+
+	time.Sleep(time.Millisecond * 150)
+	assert.NoError(t, breaker.Allow(), "probe wasn't allowed")
+	breaker.Success()
+	assert.Equal(t, Closed, breaker.State(), "successful probe didn't close breaker")
+
+	assert.Equal(t, []string{
+		"closed->open",
+		"open->half-open",
+		"half-open->open",
+		"open->half-open",
+		"half-open->closed",
+	}, transitions)
+}
+
+func TestBreakerCancel(t *testing.T) {
+	breaker := New(Settings{
+		FailureRatio: 0.5,
+		MinRequests:  1,
+		OpenTimeout:  time.Millisecond * 100,
+	})
+
+	assert.NoError(t, breaker.Allow())
+	breaker.Failure()
+	time.Sleep(time.Millisecond * 150)
+	assert.NoError(t, breaker.Allow(), "probe wasn't allowed")
+	breaker.Cancel()
+	assert.Equal(t, HalfOpen, breaker.State(), "cancelled probe changed state")
+	assert.NoError(t, breaker.Allow(), "probe after cancelled one wasn't allowed")
+	breaker.Success()
+	assert.Equal(t, Closed, breaker.State())
+}
+
+func TestBreakerInterval(t *testing.T) {
+	breaker := New(Settings{
+		FailureRatio: 0.5,
+		MinRequests:  2,
+		Interval:     time.Millisecond * 100,
+		OpenTimeout:  time.Minute,
+	})
+
+	assert.NoError(t, breaker.Allow())
+	breaker.Failure()
+	time.Sleep(time.Millisecond * 150)
+	assert.NoError(t, breaker.Allow())
+	breaker.Failure()
+	assert.Equal(t, Closed, breaker.State(), "failures of the previous window were counted")
+
+	assert.NoError(t, breaker.Allow())
+	breaker.Failure()
+	assert.Equal(t, Open, breaker.State())
+}
+
+func TestStateMarshal(t *testing.T) {
+	for state, expected := range map[State]string{Closed: `"closed"`, Open: `"open"`, HalfOpen: `"half-open"`} {
+		result, err := state.MarshalJSON()
+		assert.NoError(t, err)
+		assert.Equal(t, expected, string(result))
+	}
+}
@@ -2,22 +2,44 @@ package encryptmiddleware
 
 import (
 	"bytes"
+	"crypto/hmac"
 	"fmt"
 	"io"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/ry461ch/loyalty_system/pkg/encrypt"
 )
 
+// ResponseEncrypter buffers the response, its hash has to be sent in a header,
+// and headers can't be changed after the handler called WriteHeader.
 type ResponseEncrypter struct {
 	http.ResponseWriter
-	encrypter *encrypt.Encrypter
+	encrypter  *encrypt.Encrypter
+	statusCode int
+	body       bytes.Buffer
+}
+
+func (re *ResponseEncrypter) WriteHeader(statusCode int) {
+	if re.statusCode == 0 {
+		re.statusCode = statusCode
+	}
 }
 
 func (re *ResponseEncrypter) Write(b []byte) (int, error) {
-	bodyHash := re.encrypter.EncryptMessage(b)
-	re.Header().Set("HashSHA256", fmt.Sprintf("%x", bodyHash))
-	return re.ResponseWriter.Write(b)
+	re.WriteHeader(http.StatusOK)
+	return re.body.Write(b)
+}
+
+// flush signs the buffered body and sends the response.
+func (re *ResponseEncrypter) flush() {
+	re.WriteHeader(http.StatusOK)
+	if re.body.Len() > 0 {
+		re.Header().Set("HashSHA256", fmt.Sprintf("%x", re.encrypter.EncryptMessage(re.body.Bytes())))
+	}
+	re.ResponseWriter.WriteHeader(re.statusCode)
+	re.ResponseWriter.Write(re.body.Bytes())
 }
 
 func CheckRequestAndEncryptResponse(encrypter *encrypt.Encrypter) func(http.Handler) http.Handler {
@@ -38,13 +60,76 @@ func CheckRequestAndEncryptResponse(encrypter *encrypt.Encrypter) func(http.Hand
 			reqBody := buf.Bytes()
 			reqHash := encrypter.EncryptMessage(reqBody)
 
-			if fmt.Sprintf("%x", reqHash) != reqHeaderHash256 {
+			if !hmac.Equal([]byte(fmt.Sprintf("%x", reqHash)), []byte(reqHeaderHash256)) {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+
+			r.Body = io.NopCloser(bytes.NewBuffer(reqBody))
+			responseEncrypter := &ResponseEncrypter{ResponseWriter: w, encrypter: encrypter}
+			next.ServeHTTP(responseEncrypter, r)
+			responseEncrypter.flush()
+		})
+	}
+}
+
+// RequireHash rejects requests without HashSHA256 header,
+// CheckRequestAndEncryptResponse lets them through unchecked.
+func RequireHash(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("HashSHA256") == "" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// SignedRequestMessage is what CheckSignedRequest expects to be signed: the signature covers
+// the method, the path with query and the time of the request, not only the body,
+// so it can't be replayed for another resource or after maxAge.
+func SignedRequestMessage(method string, requestURI string, timestamp string, body []byte) []byte {
+	message := []byte(method + "\n" + requestURI + "\n" + timestamp + "\n")
+	return append(message, body...)
+}
+
+// CheckSignedRequest rejects requests without signature or with the one older than maxAge
+// with 401 and requests with wrong signature with 400. Timestamp is sent in X-Timestamp header
+// as unix seconds, responses are signed like CheckRequestAndEncryptResponse does.
+func CheckSignedRequest(encrypter *encrypt.Encrypter, maxAge time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			reqHeaderHash256 := r.Header.Get("HashSHA256")
+			timestamp := r.Header.Get("X-Timestamp")
+			signedAt, err := strconv.ParseInt(timestamp, 10, 64)
+			if reqHeaderHash256 == "" || err != nil {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			age := time.Since(time.Unix(signedAt, 0))
+			if age > maxAge || age < -maxAge {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+
+			var buf bytes.Buffer
+			_, err = buf.ReadFrom(r.Body)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			reqBody := buf.Bytes()
+			reqHash := encrypter.EncryptMessage(SignedRequestMessage(r.Method, r.URL.RequestURI(), timestamp, reqBody))
+
+			if !hmac.Equal([]byte(fmt.Sprintf("%x", reqHash)), []byte(reqHeaderHash256)) {
 				w.WriteHeader(http.StatusBadRequest)
 				return
 			}
 
 			r.Body = io.NopCloser(bytes.NewBuffer(reqBody))
-			next.ServeHTTP(&ResponseEncrypter{ResponseWriter: w, encrypter: encrypter}, r)
+			responseEncrypter := &ResponseEncrypter{ResponseWriter: w, encrypter: encrypter}
+			next.ServeHTTP(responseEncrypter, r)
+			responseEncrypter.flush()
 		})
 	}
 }
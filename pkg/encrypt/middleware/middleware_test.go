@@ -0,0 +1,64 @@
+package encryptmiddleware
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ry461ch/loyalty_system/pkg/encrypt"
+)
+
+func TestCheckRequestAndEncryptResponse(t *testing.T) {
+	encrypter := encrypt.New("secret_key")
+	requestBody := `{"order": "1115"}`
+	responseBody := `{"status": "PROCESSED"}`
+	handler := CheckRequestAndEncryptResponse(encrypter)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte(responseBody))
+	}))
+
+	testCases := []struct {
+		testName             string
+		requestHash          string
+		expectedCode         int
+		expectedResponseHash string
+	}{
+		{
+			testName:             "signed request",
+			requestHash:          fmt.Sprintf("%x", encrypter.EncryptMessage([]byte(requestBody))),
+			expectedCode:         http.StatusAccepted,
+			expectedResponseHash: fmt.Sprintf("%x", encrypter.EncryptMessage([]byte(responseBody))),
+		},
+		{
+			testName:     "bad signature",
+			requestHash:  fmt.Sprintf("%x", encrypt.New("other_key").EncryptMessage([]byte(requestBody))),
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			testName:     "unsigned request",
+			expectedCode: http.StatusAccepted,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(requestBody))
+			if tc.requestHash != "" {
+				req.Header.Set("HashSHA256", tc.requestHash)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			assert.Equal(t, tc.expectedCode, rec.Code, "Код ответа не совпадает с ожидаемым")
+			assert.Equal(t, tc.expectedResponseHash, rec.Result().Header.Get("HashSHA256"), "response hashes don't match")
+			if tc.expectedCode == http.StatusAccepted {
+				assert.Equal(t, responseBody, rec.Body.String(), "bodies don't match")
+			}
+		})
+	}
+}
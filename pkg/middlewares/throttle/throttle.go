@@ -0,0 +1,60 @@
+package throttle
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Throttle is a server middleware: it rejects requests over limit per minute using fixed windows
+// and tells clients when to retry. Outgoing requests are paced by pkg/ratelimit instead.
+type Throttle struct {
+	mu          sync.Mutex
+	limit       int
+	windowStart time.Time
+	count       int
+}
+
+func New(limit int) *Throttle {
+	return &Throttle{limit: limit}
+}
+
+func (t *Throttle) allow() (bool, time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now().UTC()
+	if now.Sub(t.windowStart) >= time.Minute {
+		t.windowStart = now
+		t.count = 0
+	}
+
+	if t.count >= t.limit {
+		return false, t.windowStart.Add(time.Minute).Sub(now)
+	}
+	t.count++
+	return true, 0
+}
+
+func (t *Throttle) Handle(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if t.limit <= 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ok, retryAfter := t.allow()
+		if !ok {
+			retryAfterSeconds := int64(retryAfter.Round(time.Second) / time.Second)
+			w.Header().Set("Content-Type", "text/plain")
+			w.Header().Set("Retry-After", strconv.FormatInt(max(retryAfterSeconds, 1), 10))
+			w.WriteHeader(http.StatusTooManyRequests)
+			fmt.Fprintf(w, "No more than %d requests per minute allowed", t.limit)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,131 @@
+package password
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+var ErrBadHashFormat = errors.New("bad password hash format")
+
+const argon2idPrefix = "$argon2id$"
+
+// Params of argon2id. Memory is measured in KiB.
+type Params struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+var DefaultParams = Params{
+	Memory:      64 * 1024,
+	Iterations:  3,
+	Parallelism: 2,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+// Hasher produces argon2id hashes in PHC string format
+// ($argon2id$v=19$m=65536,t=3,p=2$<salt>$<key>), so params may be changed
+// without breaking already stored hashes.
+// Unsalted sha256 hashes produced by earlier versions are still accepted by Verify.
+type Hasher struct {
+	params Params
+}
+
+func NewHasher(params Params) *Hasher {
+	return &Hasher{params: params}
+}
+
+func (h *Hasher) Hash(password string) ([]byte, error) {
+	salt := make([]byte, h.params.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	key := argon2.IDKey([]byte(password), salt, h.params.Iterations, h.params.Memory, h.params.Parallelism, h.params.KeyLength)
+	return []byte(fmt.Sprintf(
+		"$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version,
+		h.params.Memory,
+		h.params.Iterations,
+		h.params.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	)), nil
+}
+
+// Verify checks password against hash.
+// needsRehash reports that the password matches but the hash was made by a legacy algorithm or with other params.
+func (h *Hasher) Verify(hash []byte, password string) (ok bool, needsRehash bool) {
+	if isLegacy(hash) {
+		ok := verifyLegacy(hash, password)
+		return ok, ok
+	}
+
+	params, salt, key, err := decodeHash(hash)
+	if err != nil {
+		return false, false
+	}
+	otherKey := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
+	if subtle.ConstantTimeCompare(key, otherKey) != 1 {
+		return false, false
+	}
+	return true, params != h.params
+}
+
+// VerifyDummy takes as long as Verify of a current hash and always fails,
+// it is called for unknown users, so response time doesn't reveal which users exist.
+func (h *Hasher) VerifyDummy(password string) bool {
+	salt := make([]byte, h.params.SaltLength)
+	argon2.IDKey([]byte(password), salt, h.params.Iterations, h.params.Memory, h.params.Parallelism, h.params.KeyLength)
+	return false
+}
+
+// isLegacy can't look at the first byte only, raw sha256 hashes may start with '$' too.
+func isLegacy(hash []byte) bool {
+	return len(hash) == sha256.Size && !bytes.HasPrefix(hash, []byte(argon2idPrefix))
+}
+
+func verifyLegacy(hash []byte, password string) bool {
+	legacyHash := sha256.Sum256([]byte(password))
+	return subtle.ConstantTimeCompare(hash, legacyHash[:]) == 1
+}
+
+func decodeHash(hash []byte) (Params, []byte, []byte, error) {
+	parts := strings.Split(string(hash), "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return Params{}, nil, nil, ErrBadHashFormat
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return Params{}, nil, nil, ErrBadHashFormat
+	}
+
+	var params Params
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism); err != nil {
+		return Params{}, nil, nil, ErrBadHashFormat
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return Params{}, nil, nil, ErrBadHashFormat
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return Params{}, nil, nil, ErrBadHashFormat
+	}
+	params.SaltLength = uint32(len(salt))
+	params.KeyLength = uint32(len(key))
+
+	return params, salt, key, nil
+}
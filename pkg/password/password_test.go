@@ -0,0 +1,110 @@
+package password
+
+import (
+	"crypto/sha256"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testParams = Params{
+	Memory:      1024,
+	Iterations:  1,
+	Parallelism: 1,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+func TestHashIsSalted(t *testing.T) {
+	hasher := NewHasher(testParams)
+
+	firstHash, err := hasher.Hash("testPassword")
+	assert.NoError(t, err)
+	secondHash, err := hasher.Hash("testPassword")
+	assert.NoError(t, err)
+
+	assert.NotEqual(t, firstHash, secondHash, "hashes of the same password must differ")
+	assert.Regexp(t, `^\$argon2id\$v=19\$m=1024,t=1,p=1\$[A-Za-z0-9+/]+\$[A-Za-z0-9+/]+$`, string(firstHash))
+}
+
+func TestVerify(t *testing.T) {
+	hasher := NewHasher(testParams)
+	currentHash, _ := hasher.Hash("testPassword")
+	otherParams := testParams
+	otherParams.Iterations = 2
+	outdatedHash, _ := NewHasher(otherParams).Hash("testPassword")
+	legacyHash := sha256.Sum256([]byte("testPassword"))
+	// sha256 of this password starts with '$'
+	dollarLegacyHash := sha256.Sum256([]byte("pw352"))
+
+	testCases := []struct {
+		testName            string
+		hash                []byte
+		password            string
+		expectedOk          bool
+		expectedNeedsRehash bool
+	}{
+		{
+			testName:            "same password",
+			hash:                currentHash,
+			password:            "testPassword",
+			expectedOk:          true,
+			expectedNeedsRehash: false,
+		},
+		{
+			testName:            "invalid password",
+			hash:                currentHash,
+			password:            "invalidPassword",
+			expectedOk:          false,
+			expectedNeedsRehash: false,
+		},
+		{
+			testName:            "hash with outdated params",
+			hash:                outdatedHash,
+			password:            "testPassword",
+			expectedOk:          true,
+			expectedNeedsRehash: true,
+		},
+		{
+			testName:            "legacy hash",
+			hash:                legacyHash[:],
+			password:            "testPassword",
+			expectedOk:          true,
+			expectedNeedsRehash: true,
+		},
+		{
+			testName:            "legacy hash with invalid password",
+			hash:                legacyHash[:],
+			password:            "invalidPassword",
+			expectedOk:          false,
+			expectedNeedsRehash: false,
+		},
+		{
+			testName:            "legacy hash starting with dollar",
+			hash:                dollarLegacyHash[:],
+			password:            "pw352",
+			expectedOk:          true,
+			expectedNeedsRehash: true,
+		},
+		{
+			testName:            "malformed hash",
+			hash:                []byte("$argon2id$v=19$m=1024$salt$key"),
+			password:            "testPassword",
+			expectedOk:          false,
+			expectedNeedsRehash: false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			ok, needsRehash := hasher.Verify(tc.hash, tc.password)
+			assert.Equal(t, tc.expectedOk, ok, "check results don't match")
+			assert.Equal(t, tc.expectedNeedsRehash, needsRehash, "rehash flags don't match")
+		})
+	}
+}
+
+func TestVerifyDummy(t *testing.T) {
+	hasher := NewHasher(testParams)
+	assert.False(t, hasher.VerifyDummy("testPassword"), "dummy verification succeeded")
+}
@@ -0,0 +1,101 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Limiter is a token bucket shared by several workers.
+// Pause stops all workers at once, e.g. when the remote side answered with Retry-After.
+type Limiter struct {
+	mu          sync.Mutex
+	rate        float64 // tokens per second, non-positive means no limit
+	burst       float64
+	tokens      float64
+	updatedAt   time.Time
+	pausedUntil time.Time
+}
+
+func New(rate float64, burst int) *Limiter {
+	return &Limiter{
+		rate:      rate,
+		burst:     float64(max(burst, 1)),
+		tokens:    float64(max(burst, 1)),
+		updatedAt: time.Now(),
+	}
+}
+
+// Wait blocks until a token is available or ctx is done.
+func (l *Limiter) Wait(ctx context.Context) error {
+	for {
+		delay := l.reserve()
+		if delay == 0 {
+			return nil
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// reserve takes a token and returns 0 or returns the time to wait before the next try.
+func (l *Limiter) reserve() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if now.Before(l.pausedUntil) {
+		return l.pausedUntil.Sub(now)
+	}
+	if l.rate <= 0 {
+		return 0
+	}
+
+	l.refill(now)
+	if l.tokens >= 1 {
+		l.tokens--
+		return 0
+	}
+	return time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+}
+
+func (l *Limiter) refill(now time.Time) {
+	if l.rate > 0 {
+		l.tokens = min(l.burst, l.tokens+now.Sub(l.updatedAt).Seconds()*l.rate)
+	}
+	l.updatedAt = now
+}
+
+// Pause makes all waiters wait for at least d, an earlier pause is never shortened.
+func (l *Limiter) Pause(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	pausedUntil := time.Now().Add(d)
+	if pausedUntil.After(l.pausedUntil) {
+		l.pausedUntil = pausedUntil
+	}
+	// no burst right after the pause
+	l.tokens = min(l.tokens, 1)
+}
+
+func (l *Limiter) SetRate(rate float64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.refill(time.Now())
+	l.rate = rate
+}
+
+func (l *Limiter) Rate() float64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.rate
+}
@@ -0,0 +1,96 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWait(t *testing.T) {
+	testCases := []struct {
+		testName    string
+		rate        float64
+		burst       int
+		waitsNum    int
+		minDuration time.Duration
+		maxDuration time.Duration
+	}{
+		{
+			testName:    "limited by rate",
+			rate:        10,
+			burst:       1,
+			waitsNum:    6,
+			minDuration: time.Millisecond * 450,
+			maxDuration: time.Millisecond * 800,
+		},
+		{
+			testName:    "burst is not limited",
+			rate:        1,
+			burst:       5,
+			waitsNum:    5,
+			minDuration: 0,
+			maxDuration: time.Millisecond * 100,
+		},
+		{
+			testName:    "no limit",
+			rate:        0,
+			burst:       1,
+			waitsNum:    100,
+			minDuration: 0,
+			maxDuration: time.Millisecond * 100,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			limiter := New(tc.rate, tc.burst)
+
+			start := time.Now()
+			var wg sync.WaitGroup
+			for range tc.waitsNum {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					assert.NoError(t, limiter.Wait(context.TODO()))
+				}()
+			}
+			wg.Wait()
+
+			assert.GreaterOrEqual(t, time.Since(start), tc.minDuration, "waited less than expected")
+			assert.LessOrEqual(t, time.Since(start), tc.maxDuration, "waited more than expected")
+		})
+	}
+}
+
+func TestPause(t *testing.T) {
+	limiter := New(0, 1)
+	limiter.Pause(time.Millisecond * 300)
+	limiter.Pause(time.Millisecond * 100)
+
+	start := time.Now()
+	assert.NoError(t, limiter.Wait(context.TODO()))
+	assert.GreaterOrEqual(t, time.Since(start), time.Millisecond*250, "pause was shortened")
+}
+
+func TestWaitCanceled(t *testing.T) {
+	limiter := New(0, 1)
+	limiter.Pause(time.Minute)
+
+	ctx, cancel := context.WithTimeout(context.TODO(), time.Millisecond*100)
+	defer cancel()
+	assert.ErrorIs(t, limiter.Wait(ctx), context.DeadlineExceeded)
+}
+
+func TestSetRate(t *testing.T) {
+	limiter := New(1, 1)
+	assert.NoError(t, limiter.Wait(context.TODO()))
+	limiter.SetRate(20)
+	assert.Equal(t, float64(20), limiter.Rate())
+
+	start := time.Now()
+	assert.NoError(t, limiter.Wait(context.TODO()))
+	assert.LessOrEqual(t, time.Since(start), time.Millisecond*200, "new rate wasn't applied")
+}